@@ -5,14 +5,22 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/synntx/askmind/internal/llm"
 	"github.com/synntx/askmind/internal/router"
 	"github.com/synntx/askmind/internal/tools"
+	"github.com/synntx/askmind/internal/utils"
 	"go.uber.org/zap"
 )
 
+// how long requests in flight and background work get to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	logger, err := zap.NewDevelopment()
 	if err != nil {
@@ -27,6 +35,9 @@ func main() {
 	}
 
 	requiredEnvVars := []string{"DB_URI", "AUTH_PEPPER"}
+	if os.Getenv("JWT_SIGNING_KEYS") == "" {
+		requiredEnvVars = append(requiredEnvVars, "JWT_SECRET")
+	}
 
 	for _, envVar := range requiredEnvVars {
 		if os.Getenv(envVar) == "" {
@@ -34,6 +45,22 @@ func main() {
 		}
 	}
 
+	// JWT_SIGNING_KEYS="kid1:secret1,kid2:secret2" allows rotation: tokens are
+	// signed with JWT_ACTIVE_KEY_ID (default: the last key) and verified with
+	// any key in the list. JWT_SECRET is a shorthand for a single key.
+	signingKeys, err := utils.ParseSigningKeys(os.Getenv("JWT_SIGNING_KEYS"))
+	if err != nil {
+		logger.Fatal("Invalid JWT_SIGNING_KEYS", zap.Error(err))
+	}
+	if len(signingKeys) == 0 {
+		signingKeys = []utils.SigningKey{{ID: "default", Secret: []byte(os.Getenv("JWT_SECRET"))}}
+	}
+	keySet, err := utils.NewKeySet(signingKeys, os.Getenv("JWT_ACTIVE_KEY_ID"))
+	if err != nil {
+		logger.Fatal("Invalid JWT signing keys", zap.Error(err))
+	}
+	utils.SetKeySet(keySet)
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -71,19 +98,64 @@ func main() {
 	// toolRegistry.Register(notionTool)
 
 	apiKeys := map[llm.ProviderType]string{
-		llm.ProviderGemini: os.Getenv("GEMINI_API_KEY"),
-		llm.ProviderGroq:   os.Getenv("GROQ_API_KEY"),
+		llm.ProviderGemini:    os.Getenv("GEMINI_API_KEY"),
+		llm.ProviderGroq:      os.Getenv("GROQ_API_KEY"),
+		llm.ProviderAnthropic: os.Getenv("ANTHROPIC_API_KEY"),
 	}
 
 	baseUrls := map[llm.ProviderType]string{
-		llm.ProviderOllama: os.Getenv("OLLAMA_BASE_URL"),
+		llm.ProviderOllama:    os.Getenv("OLLAMA_BASE_URL"),
+		llm.ProviderAnthropic: os.Getenv("ANTHROPIC_BASE_URL"),
 	}
 
-	llmFactory := llm.NewDefaultLLMFactory(logger, toolRegistry, apiKeys, baseUrls)
+	// Any OpenAI-compatible server: OpenAI, vLLM, LM Studio, llama.cpp, OpenRouter...
+	openAICompat := llm.OpenAICompatibleConfig{
+		Name:    os.Getenv("OPENAI_COMPATIBLE_NAME"),
+		BaseURL: os.Getenv("OPENAI_COMPATIBLE_BASE_URL"),
+		APIKey:  os.Getenv("OPENAI_COMPATIBLE_API_KEY"),
+		Headers: llm.ParseHeaderList(os.Getenv("OPENAI_COMPATIBLE_HEADERS")),
+		Models:  llm.ParseModelList(os.Getenv("OPENAI_COMPATIBLE_MODELS")),
+	}
+
+	// Retries on rate limits and server errors, then an optional second model
+	fallback := llm.FallbackConfig{
+		Provider: llm.ProviderType(os.Getenv("LLM_FALLBACK_PROVIDER")),
+		Model:    os.Getenv("LLM_FALLBACK_MODEL"),
+		Retry:    llm.DefaultRetryPolicy,
+	}
+	if n, err := strconv.Atoi(os.Getenv("LLM_MAX_ATTEMPTS")); err == nil && n > 0 {
+		fallback.Retry.MaxAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LLM_RETRY_BACKOFF")); err == nil && d > 0 {
+		fallback.Retry.InitialBackoff = d
+	}
+
+	llmFactory := llm.NewDefaultLLMFactory(logger, toolRegistry, apiKeys, baseUrls, openAICompat, fallback)
 
 	muxRouter := router.NewRouter(os.Getenv("DB_URI"), os.Getenv("AUTH_PEPPER"), logger, llmFactory)
 	router := muxRouter.CreateRoutes(ctx)
 
-	logger.Info("Listening on port 8080")
-	http.ListenAndServe(":8080", router)
+	server := &http.Server{Addr: ":8080", Handler: router}
+	go func() {
+		logger.Info("Listening on port 8080")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("Server failed", zap.Error(err))
+		}
+	}()
+
+	// On SIGINT or SIGTERM stop taking requests, then give the ones in
+	// flight and the background work they started time to finish
+	stop, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	<-stop.Done()
+	logger.Info("Shutting down")
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Server shutdown", zap.Error(err))
+	}
+	if err := muxRouter.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Background work did not finish", zap.Error(err))
+	}
 }
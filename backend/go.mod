@@ -14,6 +14,8 @@ require (
 	golang.org/x/crypto v0.37.0
 	golang.org/x/image v0.27.0
 	golang.org/x/net v0.39.0
+	golang.org/x/text v0.25.0
+	golang.org/x/time v0.9.0
 	google.golang.org/api v0.218.0
 )
 
@@ -45,8 +47,6 @@ require (
 	golang.org/x/oauth2 v0.25.0 // indirect
 	golang.org/x/sync v0.14.0 // indirect
 	golang.org/x/sys v0.32.0 // indirect
-	golang.org/x/text v0.25.0 // indirect
-	golang.org/x/time v0.9.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20241209162323-e6fa225c2576 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250115164207-1a7da9e5054f // indirect
 	google.golang.org/grpc v1.69.4 // indirect
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/synntx/askmind/internal/models"
 )
@@ -16,16 +17,52 @@ type DB interface {
 	UpdatePassword(ctx context.Context, userId string, password string) error
 	DeleteUser(ctx context.Context, userId string) error
 
+	// Refresh token operations
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	// RotateRefreshToken revokes oldTokenId in favour of next. It fails with
+	// utils.ErrUnauthorized if oldTokenId was revoked in the meantime.
+	RotateRefreshToken(ctx context.Context, oldTokenId string, next *models.RefreshToken) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyId string) error
+	RevokeUserRefreshTokens(ctx context.Context, userId string) error
+
+	// API key operations
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, userId string) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userId, keyId string) error // keys of other users are not found
+	TouchAPIKey(ctx context.Context, keyId string) error          // records a use, at most once a minute
+
 	// Space operations
 	CreateSpace(ctx context.Context, space *models.CreateSpace) error
 	GetSpace(ctx context.Context, spaceId string) (*models.Space, error)
 	UpdateSpace(ctx context.Context, space *models.UpdateSpace) error
 	DeleteSpace(ctx context.Context, spaceId string) error
-	ListSpacesForUser(ctx context.Context, userId string) ([]models.Space, error)
+	ListSpacesForUser(ctx context.Context, userId string) ([]models.Space, error) // owned and shared spaces, with the user's role
+
+	// Space member operations; invitations are members not yet accepted
+	GetSpaceMember(ctx context.Context, spaceId, userId string) (*models.SpaceMember, error)
+	ListSpaceMembers(ctx context.Context, spaceId string) ([]models.SpaceMember, error)
+	InviteSpaceMember(ctx context.Context, spaceId, email string, role models.SpaceRole, invitedBy string) (*models.SpaceMember, error)
+	ListSpaceInvitations(ctx context.Context, userId string) ([]models.SpaceInvitation, error)
+	AcceptSpaceInvitation(ctx context.Context, spaceId, userId string) error
+	UpdateSpaceMemberRole(ctx context.Context, spaceId, userId string, role models.SpaceRole) error
+	RemoveSpaceMember(ctx context.Context, spaceId, userId string) error
+
+	// Prompt template operations
+	CreatePromptTemplate(ctx context.Context, t *models.PromptTemplate) (*models.PromptTemplate, error)
+	GetPromptTemplate(ctx context.Context, templateId string) (*models.PromptTemplate, error)
+	FindPromptTemplate(ctx context.Context, userId, spaceId, name string) (*models.PromptTemplate, error) // the user's, else the space's
+	ListPromptTemplates(ctx context.Context, userId, spaceId string) ([]models.PromptTemplate, error)     // the user's, then the space's
+	UpdatePromptTemplate(ctx context.Context, t *models.PromptTemplate) (*models.PromptTemplate, error)
+	DeletePromptTemplate(ctx context.Context, templateId string) error
 
 	// Source operations
-	CreateSource(ctx context.Context, source *models.Source) error
+	CreateSource(ctx context.Context, source *models.Source) (*models.Source, error)
 	GetSource(ctx context.Context, sourceId string) (*models.Source, error)
+	UpdateSourceStatus(ctx context.Context, sourceId string, status models.SourceStatus, errMsg string) error
+	FailUnfinishedSources(ctx context.Context, errMsg string) (int64, error) // pending and processing sources
+	UpdateSourceContent(ctx context.Context, sourceId string, text string, metadata models.JSONB) error
 	DeleteSource(ctx context.Context, sourceId string) error
 	ListSourcesForSpace(ctx context.Context, spaceId string) ([]models.Source, error)
 
@@ -34,21 +71,44 @@ type DB interface {
 	// Vector search operations
 	FindSimilarChunks(ctx context.Context, embedding []float32, limit int, filters models.ChunkFilters) ([]models.Chunk, error)
 
+	// Memory operations; memories of other users are not found
+	CreateMemory(ctx context.Context, memory *models.Memory) error
+	ListMemories(ctx context.Context, userId string) ([]models.Memory, error) // most recently updated first
+	UpdateMemory(ctx context.Context, userId, memoryId, content string, embedding []float32) (*models.Memory, error)
+	DeleteMemory(ctx context.Context, userId, memoryId string) error
+	DeleteUserMemories(ctx context.Context, userId string) error
+	FindSimilarMemories(ctx context.Context, userId string, embedding []float32, limit int) ([]models.Memory, error)
+
 	// Conversation operations
 	CreateConversation(ctx context.Context, conv *models.Conversation) (*models.Conversation, error)
 	GetConversation(ctx context.Context, convId string) (*models.Conversation, error)
 	UpdateConversationTitle(ctx context.Context, convId string, title string) error
 	UpdateConversationStatus(ctx context.Context, convId string, status models.ConversationStatus) error
+	UpdateConversationSummary(ctx context.Context, convId, summary, throughMessageId string) error
 	DeleteConversation(ctx context.Context, convId string) error
-	ListConversationsForSpace(ctx context.Context, spaceId string) ([]models.Conversation, error)
+	ListConversationsForSpace(ctx context.Context, userId, spaceId string) ([]models.Conversation, error) // the user's own conversations only
 	ListActiveConversationsForUser(ctx context.Context, userId string) ([]models.Conversation, error)
 
 	// Chat message operations
 	CreateMessage(ctx context.Context, msg *models.CreateMessageRequest) error
 	CreateMessages(ctx context.Context, msgs []models.CreateMessageRequest) error
 	GetMessage(ctx context.Context, messageId string) (*models.ChatMessage, error)
-	GetConversationMessages(ctx context.Context, convId string) ([]models.ChatMessage, error)
+	GetConversationMessages(ctx context.Context, convId string) ([]models.ChatMessage, error)     // the active branch, oldest first
 	GetConversationUserMessages(ctx context.Context, convId string) ([]models.ChatMessage, error) // Only user & assistant messages
+	GetMessagePath(ctx context.Context, messageId string) ([]models.ChatMessage, error)           // from the conversation's start down to the message
+	GetMessageSiblings(ctx context.Context, messageId string) ([]models.ChatMessage, error)
+	SetActiveBranch(ctx context.Context, messageId string) error
+
+	// Token usage operations; conversations the user does not own and spaces they are not a member of are not found
+	GetConversationTokenUsage(ctx context.Context, userId, convId string) (*models.TokenUsage, error)
+	GetSpaceTokenUsage(ctx context.Context, userId, spaceId string) (*models.TokenUsage, error)
+	GetUserDailyTokenUsage(ctx context.Context, userId string, from, to time.Time) ([]models.DailyTokenUsage, error)
+	GetUserUsageSince(ctx context.Context, userId string, since time.Time) (requests int64, tokens int64, err error) // requests are user messages, /v1 completions and regenerations
+	RecordUsage(ctx context.Context, record *models.UsageRecord) error
+
+	// Message reference operations
+	CreateMessageReferences(ctx context.Context, refs []models.MessageReference) error
+	GetMessageReferences(ctx context.Context, messageId string) ([]models.MessageReference, error)
 
 	// Limit checks
 	GetUserSpaceCount(ctx context.Context, userId string) (int, error)
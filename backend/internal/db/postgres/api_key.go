@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
+)
+
+const apiKeyColumns = `
+	key_id, user_id, name, prefix, key_hash, scopes,
+	expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row pgx.Row, key *models.APIKey) error {
+	var scopes []string
+	err := row.Scan(
+		&key.KeyId,
+		&key.UserId,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	key.Scopes = make([]models.APIKeyScope, len(scopes))
+	for i, scope := range scopes {
+		key.Scopes[i] = models.APIKeyScope(scope)
+	}
+	return nil
+}
+
+func (db *Postgres) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	sql := `
+	INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING key_id, created_at`
+
+	scopes := make([]string, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	err := db.pool.QueryRow(ctx, sql,
+		key.UserId,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		scopes,
+		key.ExpiresAt,
+	).Scan(&key.KeyId, &key.CreatedAt)
+	if err != nil {
+		return utils.HandlePgError(err, "CreateAPIKey")
+	}
+	return nil
+}
+
+func (db *Postgres) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	sql := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+
+	var key models.APIKey
+	if err := scanAPIKey(db.pool.QueryRow(ctx, sql, keyHash), &key); err != nil {
+		return nil, utils.HandlePgError(err, "GetAPIKeyByHash")
+	}
+	return &key, nil
+}
+
+func (db *Postgres) ListAPIKeys(ctx context.Context, userId string) ([]models.APIKey, error) {
+	sql := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`
+
+	rows, err := db.pool.Query(ctx, sql, userId)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "ListAPIKeys")
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var key models.APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			return nil, utils.HandlePgError(err, "ListAPIKeys")
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.HandlePgError(err, "ListAPIKeys")
+	}
+	return keys, nil
+}
+
+func (db *Postgres) RevokeAPIKey(ctx context.Context, userId, keyId string) error {
+	sql := `
+	UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW())
+	WHERE key_id = $1 AND user_id = $2`
+
+	tag, err := db.pool.Exec(ctx, sql, keyId, userId)
+	if err != nil {
+		return utils.HandlePgError(err, "RevokeAPIKey")
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrNotFound.Wrap(fmt.Errorf("RevokeAPIKey: key not found"))
+	}
+	return nil
+}
+
+func (db *Postgres) TouchAPIKey(ctx context.Context, keyId string) error {
+	sql := `
+	UPDATE api_keys SET last_used_at = NOW()
+	WHERE key_id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+
+	if _, err := db.pool.Exec(ctx, sql, keyId); err != nil {
+		return utils.HandlePgError(err, "TouchAPIKey")
+	}
+	return nil
+}
@@ -2,136 +2,355 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/synntx/askmind/internal/models"
 	"github.com/synntx/askmind/internal/utils"
 )
 
-func (db *Postgres) CreateMessage(ctx context.Context, msg *models.CreateMessageRequest) error {
-	sql := `INSERT INTO chat_messages
-	(conversation_id, role,  content, tokens_used, model, metadata)
-	VALUES ($1, $2,$3, $4,$5, $6)`
+const messageColumns = `
+	message_id, conversation_id, parent_message_id, role, content, tokens_used, prompt_tokens, completion_tokens,
+	COALESCE(model, ''), metadata, tool_call_id, tool_name, tool_args,
+	status, created_at, updated_at`
+
+// insertMessage adds a message under its parent, by default the
+// conversation's active message, and makes it the active message. A parent
+// outside the conversation, like a missing conversation, inserts nothing.
+// It returns the parent the message was added under.
+const insertMessage = `
+	WITH conv AS (
+		SELECT conversation_id, active_message_id FROM conversations
+		WHERE conversation_id = $2
+		FOR UPDATE
+	), msg AS (
+		INSERT INTO chat_messages
+		(message_id, conversation_id, role, content, tokens_used, prompt_tokens, completion_tokens, model, metadata, tool_call_id, tool_name, tool_args, status, parent_message_id)
+		SELECT $1, conv.conversation_id, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13,
+			CASE WHEN $14::uuid IS NULL THEN conv.active_message_id ELSE NULLIF($14::uuid, '00000000-0000-0000-0000-000000000000') END
+		FROM conv
+		WHERE $14::uuid IS NULL OR $14::uuid = '00000000-0000-0000-0000-000000000000' OR EXISTS (
+			SELECT 1 FROM chat_messages p WHERE p.message_id = $14::uuid AND p.conversation_id = conv.conversation_id
+		)
+		RETURNING message_id, conversation_id, parent_message_id
+	)
+	UPDATE conversations c SET active_message_id = msg.message_id, updated_at = NOW()
+	FROM msg
+	WHERE c.conversation_id = msg.conversation_id
+	RETURNING msg.parent_message_id`
+
+// messagePath selects the messages from the start of a conversation down to
+// the message $1, oldest first, following parents.
+const messagePath = `
+	WITH RECURSIVE path (id, parent_id, depth) AS (
+		SELECT message_id, parent_message_id, 0 FROM chat_messages WHERE message_id = $1
+		UNION ALL
+		SELECT m.message_id, m.parent_message_id, p.depth + 1
+		FROM chat_messages m JOIN path p ON m.message_id = p.parent_id
+	)
+	SELECT` + messageColumns + `
+	FROM chat_messages JOIN path ON path.id = chat_messages.message_id`
 
-	if _, err := db.pool.Exec(ctx, sql,
+func scanMessage(row pgx.Row) (*models.ChatMessage, error) {
+	var msg models.ChatMessage
+	var toolCallId, toolName *string
+	var toolArgs models.JSONB
+	err := row.Scan(
+		&msg.MessageId,
+		&msg.ConversationId,
+		&msg.ParentMessageId,
+		&msg.Role,
+		&msg.Content,
+		&msg.TokensUsed,
+		&msg.PromptTokens,
+		&msg.CompletionTokens,
+		&msg.Model,
+		&msg.Metadata,
+		&toolCallId,
+		&toolName,
+		&toolArgs,
+		&msg.Status,
+		&msg.CreatedAt,
+		&msg.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if toolName != nil {
+		msg.ToolCall = &models.ToolCall{Name: *toolName, Args: toolArgs}
+		if toolCallId != nil {
+			msg.ToolCall.Id = *toolCallId
+		}
+	}
+	return &msg, nil
+}
+
+// messageArgs returns the parameters of insertMessage for msg.
+func messageArgs(msg *models.CreateMessageRequest) []any {
+	var toolCallId, toolName *string
+	var toolArgs models.JSONB
+	if msg.ToolCall != nil {
+		toolCallId, toolName, toolArgs = &msg.ToolCall.Id, &msg.ToolCall.Name, msg.ToolCall.Args
+	}
+	status := msg.Status
+	if status == "" {
+		status = models.MessageStatusCompleted
+	}
+	return []any{
+		msg.MessageId,
 		msg.ConversationId,
 		msg.Role,
 		msg.Content,
 		msg.TokensUsed,
+		msg.PromptTokens,
+		msg.CompletionTokens,
 		msg.Model,
 		msg.Metadata,
-	); err != nil {
-		return utils.HandlePgError(err, "CreateMessage")
+		toolCallId,
+		toolName,
+		toolArgs,
+		status,
+		msg.ParentMessageId,
+	}
+}
+
+// messageInsertError reports a message that insertMessage did not insert.
+func messageInsertError(err error, op string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return utils.ErrNotFound.Wrap(fmt.Errorf("%s: conversation or parent message not found", op))
+	}
+	return utils.HandlePgError(err, op)
+}
+
+func (db *Postgres) CreateMessage(ctx context.Context, msg *models.CreateMessageRequest) error {
+	if msg.MessageId == uuid.Nil {
+		msg.MessageId = uuid.New()
+	}
+
+	if err := db.pool.QueryRow(ctx, insertMessage, messageArgs(msg)...).Scan(&msg.ParentMessageId); err != nil {
+		return messageInsertError(err, "CreateMessage")
 	}
 	return nil
 }
 
+// CreateMessages inserts msgs in order in one transaction, so a chain of
+// messages is saved whole or not at all and the conversation's active
+// message never points into a partly saved chain.
 func (db *Postgres) CreateMessages(ctx context.Context, msgs []models.CreateMessageRequest) error {
-	batch := &pgx.Batch{}
-	for _, msg := range msgs {
-		batch.Queue(
-			`INSERT INTO chat_messages
-			(conversation_id, role, content, tokens_used, model, metadata)
-			VALUES ($1, $2,$3, $4,$5, $6)`,
-			msg.ConversationId,
-			msg.Role,
-			msg.Content,
-			msg.TokensUsed,
-			msg.Model,
-			msg.Metadata,
-		)
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return utils.ErrDatabase.Wrap(fmt.Errorf("begin tx: %w", err))
 	}
+	defer tx.Rollback(ctx)
 
-	br := db.pool.SendBatch(ctx, batch)
-	defer br.Close()
-	if _, err := br.Exec(); err != nil {
+	for i := range msgs {
+		msg := &msgs[i]
+		if msg.MessageId == uuid.Nil {
+			msg.MessageId = uuid.New()
+		}
+		if err := tx.QueryRow(ctx, insertMessage, messageArgs(msg)...).Scan(&msg.ParentMessageId); err != nil {
+			return messageInsertError(err, "CreateMessages")
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
 		return utils.HandlePgError(err, "CreateMessages")
 	}
 	return nil
 }
 
 func (db *Postgres) GetMessage(ctx context.Context, messageId string) (*models.ChatMessage, error) {
-	sql := `SELECT * FROM chat_messages WHERE message_id = $1`
+	sql := `SELECT` + messageColumns + ` FROM chat_messages WHERE message_id = $1`
 
-	var msg models.ChatMessage
-	if err := db.pool.QueryRow(ctx, sql, messageId).Scan(
-		&msg.MessageId,
-		&msg.ConversationId,
-		&msg.Role,
-		&msg.Content,
-		&msg.TokensUsed,
-		&msg.Model,
-		&msg.Metadata,
-		&msg.CreatedAt,
-		&msg.UpdatedAt,
-	); err != nil {
+	msg, err := scanMessage(db.pool.QueryRow(ctx, sql, messageId))
+	if err != nil {
 		return nil, utils.HandlePgError(err, "GetMessage")
 	}
 
-	return &msg, nil
+	return msg, nil
 }
 
+// GetConversationMessages returns the active branch of the conversation.
 func (db *Postgres) GetConversationMessages(ctx context.Context, convId string) ([]models.ChatMessage, error) {
-	sql := `SELECT * FROM chat_messages WHERE conversation_id = $1`
+	sql := `SELECT active_message_id FROM conversations WHERE conversation_id = $1`
 
-	rows, err := db.pool.Query(ctx, sql, convId)
-	if err != nil {
+	var active *uuid.UUID
+	if err := db.pool.QueryRow(ctx, sql, convId).Scan(&active); err != nil {
 		return nil, utils.HandlePgError(err, "GetConversationMessages")
 	}
+	if active == nil {
+		return nil, nil
+	}
+	return db.queryMessages(ctx, "GetConversationMessages", messagePath+`
+	ORDER BY path.depth DESC`, *active)
+}
 
-	var msgs []models.ChatMessage
+// only user & assistant message exclude agents messages
+func (db *Postgres) GetConversationUserMessages(ctx context.Context, convId string) ([]models.ChatMessage, error) {
+	msgs, err := db.GetConversationMessages(ctx, convId)
+	if err != nil {
+		return nil, err
+	}
 
-	for rows.Next() {
-		var msg models.ChatMessage
-		err := rows.Scan(
-			&msg.MessageId,
-			&msg.ConversationId,
-			&msg.Role,
-			&msg.Content,
-			&msg.TokensUsed,
-			&msg.Model,
-			&msg.Metadata,
-			&msg.CreatedAt,
-			&msg.UpdatedAt,
-		)
-		if err != nil {
-			return nil, utils.HandlePgError(err, "GetConversationMessages")
+	userMsgs := msgs[:0]
+	for _, msg := range msgs {
+		if msg.Role == models.RoleUser || msg.Role == models.RoleAssistant {
+			userMsgs = append(userMsgs, msg)
 		}
-		msgs = append(msgs, msg)
 	}
+	return userMsgs, nil
+}
 
-	return msgs, nil
+func (db *Postgres) GetMessagePath(ctx context.Context, messageId string) ([]models.ChatMessage, error) {
+	return db.queryMessages(ctx, "GetMessagePath", messagePath+`
+	ORDER BY path.depth DESC`, messageId)
 }
 
-// only user & assistant message exclude agents messages
-func (db *Postgres) GetConversationUserMessages(ctx context.Context, convId string) ([]models.ChatMessage, error) {
-	sql := `SELECT * FROM chat_messages WHERE conversation_id = $1 AND role = $2 OR role = $3`
+// GetMessageSiblings returns the message and the alternatives to it, oldest
+// first. Alternatives answer the same turn: tool calls are saved between an
+// answer and its user message, so they are looked through on the way up to
+// the turn's parent and on the way down to the other answers, and an answer
+// that used tools and one that did not are still siblings.
+func (db *Postgres) GetMessageSiblings(ctx context.Context, messageId string) ([]models.ChatMessage, error) {
+	sql := `
+	WITH RECURSIVE up (id, parent_id, depth) AS (
+		SELECT message_id, parent_message_id, 0 FROM chat_messages WHERE message_id = $1
+		UNION ALL
+		SELECT m.message_id, m.parent_message_id, up.depth + 1
+		FROM chat_messages m JOIN up ON m.message_id = up.parent_id
+		WHERE m.role = 'tool'
+	), down (id, is_tool) AS (
+		SELECT message_id, role = 'tool' FROM chat_messages
+		WHERE conversation_id = (SELECT conversation_id FROM chat_messages WHERE message_id = $1)
+			AND parent_message_id IS NOT DISTINCT FROM (SELECT parent_id FROM up ORDER BY depth DESC LIMIT 1)
+		UNION ALL
+		SELECT m.message_id, m.role = 'tool'
+		FROM chat_messages m JOIN down ON m.parent_message_id = down.id
+		WHERE down.is_tool
+	)
+	SELECT` + messageColumns + `
+	FROM chat_messages JOIN down ON down.id = chat_messages.message_id
+	WHERE NOT down.is_tool
+	ORDER BY created_at, message_id`
+
+	msgs, err := db.queryMessages(ctx, "GetMessageSiblings", sql, messageId)
+	if err == nil && len(msgs) == 0 {
+		err = utils.ErrNotFound.Wrap(fmt.Errorf("GetMessageSiblings: message not found"))
+	}
+	return msgs, err
+}
 
-	rows, err := db.pool.Query(ctx, sql, convId, models.RoleAssistant, models.RoleUser)
+// SetActiveBranch makes the branch through the message the active one of its
+// conversation, down to the latest message below it, which is always a leaf.
+func (db *Postgres) SetActiveBranch(ctx context.Context, messageId string) error {
+	sql := `
+	WITH RECURSIVE subtree AS (
+		SELECT message_id, conversation_id, created_at, 0 AS depth
+		FROM chat_messages WHERE message_id = $1
+		UNION ALL
+		SELECT m.message_id, m.conversation_id, m.created_at, s.depth + 1
+		FROM chat_messages m JOIN subtree s ON m.parent_message_id = s.message_id
+	), leaf AS (
+		SELECT message_id, conversation_id FROM subtree
+		ORDER BY created_at DESC, depth DESC
+		LIMIT 1
+	)
+	UPDATE conversations c SET active_message_id = leaf.message_id, updated_at = NOW()
+	FROM leaf
+	WHERE c.conversation_id = leaf.conversation_id`
+
+	tag, err := db.pool.Exec(ctx, sql, messageId)
 	if err != nil {
-		return nil, utils.HandlePgError(err, "GetConversationUserMessages")
+		return utils.HandlePgError(err, "SetActiveBranch")
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrNotFound.Wrap(fmt.Errorf("SetActiveBranch: message not found"))
 	}
+	return nil
+}
+
+func (db *Postgres) queryMessages(ctx context.Context, op, sql string, args ...any) ([]models.ChatMessage, error) {
+	rows, err := db.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, utils.HandlePgError(err, op)
+	}
+	defer rows.Close()
 
 	var msgs []models.ChatMessage
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, utils.HandlePgError(err, op)
+		}
+		msgs = append(msgs, *msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.HandlePgError(err, op)
+	}
+	return msgs, nil
+}
+
+func (db *Postgres) CreateMessageReferences(ctx context.Context, refs []models.MessageReference) error {
+	batch := &pgx.Batch{}
+	for _, ref := range refs {
+		batch.Queue(
+			`INSERT INTO message_references
+			(message_id, chunk_id, relevance_score)
+			VALUES ($1, $2, $3)`,
+			ref.MessageId,
+			ref.ChunkId,
+			ref.RelevanceScore,
+		)
+	}
 
+	br := db.pool.SendBatch(ctx, batch)
+	defer br.Close()
+	for range refs {
+		if _, err := br.Exec(); err != nil {
+			return utils.HandlePgError(err, "CreateMessageReferences")
+		}
+	}
+	return nil
+}
+
+func (db *Postgres) GetMessageReferences(ctx context.Context, messageId string) ([]models.MessageReference, error) {
+	sql := `
+	SELECT
+		r.reference_id, r.message_id, r.chunk_id, r.relevance_score, r.created_at,
+		c.source_id, s.location, c.page_number, c.section_title, c.text
+	FROM message_references r
+	JOIN chunks c ON c.chunk_id = r.chunk_id
+	JOIN sources s ON s.source_id = c.source_id
+	WHERE r.message_id = $1
+	ORDER BY r.relevance_score DESC`
+
+	rows, err := db.pool.Query(ctx, sql, messageId)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "GetMessageReferences")
+	}
+	defer rows.Close()
+
+	var refs []models.MessageReference
 	for rows.Next() {
-		var msg models.ChatMessage
+		var ref models.MessageReference
 		err := rows.Scan(
-			&msg.MessageId,
-			&msg.ConversationId,
-			&msg.Role,
-			&msg.Content,
-			&msg.TokensUsed,
-			&msg.Model,
-			&msg.Metadata,
-			&msg.CreatedAt,
-			&msg.UpdatedAt,
+			&ref.ReferenceId,
+			&ref.MessageId,
+			&ref.ChunkId,
+			&ref.RelevanceScore,
+			&ref.CreatedAt,
+			&ref.SourceId,
+			&ref.SourceLocation,
+			&ref.PageNumber,
+			&ref.SectionTitle,
+			&ref.Text,
 		)
 		if err != nil {
-			return nil, utils.HandlePgError(err, "GetConversationUserMessages")
+			return nil, utils.HandlePgError(err, "GetMessageReferences")
 		}
-		msgs = append(msgs, msg)
+		refs = append(refs, ref)
 	}
-
-	return msgs, nil
+	return refs, nil
 }
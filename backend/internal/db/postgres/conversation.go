@@ -3,32 +3,44 @@ package postgres
 import (
 	"context"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/synntx/askmind/internal/models"
 	"github.com/synntx/askmind/internal/utils"
 )
 
+const conversationColumns = `
+	conversation_id, space_id, user_id, title, status, active_message_id,
+	summary, summary_message_id, created_at, updated_at`
+
+func scanConversation(row pgx.Row, conv *models.Conversation) error {
+	return row.Scan(
+		&conv.ConversationId,
+		&conv.SpaceId,
+		&conv.UserId,
+		&conv.Title,
+		&conv.Status,
+		&conv.ActiveMessageId,
+		&conv.Summary,
+		&conv.SummaryMessageId,
+		&conv.CreatedAt,
+		&conv.UpdatedAt,
+	)
+}
+
 func (db *Postgres) CreateConversation(ctx context.Context, conv *models.Conversation) (*models.Conversation, error) {
 	sql := `INSERT INTO conversations
 	(space_id, user_id, title, status)
 	VALUES ($1, $2, $3, $4)
-	RETURNING conversation_id, space_id, user_id, title, status, created_at, updated_at`
+	RETURNING` + conversationColumns
 
 	var conversation models.Conversation
 
-	err := db.pool.QueryRow(ctx, sql,
+	err := scanConversation(db.pool.QueryRow(ctx, sql,
 		conv.SpaceId,
 		conv.UserId,
 		conv.Title,
 		conv.Status,
-	).Scan(
-		&conversation.ConversationId,
-		&conversation.SpaceId,
-		&conversation.UserId,
-		&conversation.Title,
-		&conversation.Status,
-		&conversation.CreatedAt,
-		&conversation.UpdatedAt,
-	)
+	), &conversation)
 	if err != nil {
 		return nil, utils.HandlePgError(err, "CreateConversation")
 	}
@@ -37,17 +49,9 @@ func (db *Postgres) CreateConversation(ctx context.Context, conv *models.Convers
 }
 
 func (db *Postgres) GetConversation(ctx context.Context, convId string) (*models.Conversation, error) {
-	sql := `SELECT * FROM conversations WHERE conversation_id = $1 `
+	sql := `SELECT` + conversationColumns + ` FROM conversations WHERE conversation_id = $1 `
 	var conv models.Conversation
-	if err := db.pool.QueryRow(ctx, sql, convId).Scan(
-		&conv.ConversationId,
-		&conv.SpaceId,
-		&conv.UserId,
-		&conv.Title,
-		&conv.Status,
-		&conv.CreatedAt,
-		&conv.UpdatedAt,
-	); err != nil {
+	if err := scanConversation(db.pool.QueryRow(ctx, sql, convId), &conv); err != nil {
 		return nil, utils.HandlePgError(err, "GetConversation")
 	}
 	return &conv, nil
@@ -73,6 +77,16 @@ func (db *Postgres) UpdateConversationStatus(ctx context.Context, convId string,
 	return nil
 }
 
+func (db *Postgres) UpdateConversationSummary(ctx context.Context, convId, summary, throughMessageId string) error {
+	sql := `UPDATE conversations
+	set summary = $2, summary_message_id = $3 WHERE conversation_id = $1`
+
+	if _, err := db.pool.Exec(ctx, sql, convId, summary, throughMessageId); err != nil {
+		return utils.HandlePgError(err, "UpdateConversationSummary")
+	}
+	return nil
+}
+
 func (db *Postgres) DeleteConversation(ctx context.Context, convId string) error {
 	sql := `DELETE FROM conversations WHERE conversation_id = $1`
 	if _, err := db.pool.Exec(ctx, sql, convId); err != nil {
@@ -81,10 +95,10 @@ func (db *Postgres) DeleteConversation(ctx context.Context, convId string) error
 	return nil
 }
 
-func (db *Postgres) ListConversationsForSpace(ctx context.Context, spaceId string) ([]models.Conversation, error) {
-	sql := `SELECT * FROM conversations WHERE space_id = $1 ORDER BY updated_at DESC`
+func (db *Postgres) ListConversationsForSpace(ctx context.Context, userId, spaceId string) ([]models.Conversation, error) {
+	sql := `SELECT` + conversationColumns + ` FROM conversations WHERE space_id = $1 AND user_id = $2 ORDER BY updated_at DESC`
 
-	rows, err := db.pool.Query(ctx, sql, spaceId)
+	rows, err := db.pool.Query(ctx, sql, spaceId, userId)
 	if err != nil {
 		return nil, utils.HandlePgError(err, "ListConversationsForSpace")
 	}
@@ -92,15 +106,7 @@ func (db *Postgres) ListConversationsForSpace(ctx context.Context, spaceId strin
 	var conversations []models.Conversation
 	for rows.Next() {
 		var conversation models.Conversation
-		err := rows.Scan(
-			&conversation.ConversationId,
-			&conversation.SpaceId,
-			&conversation.UserId,
-			&conversation.Title,
-			&conversation.Status,
-			&conversation.CreatedAt,
-			&conversation.UpdatedAt,
-		)
+		err := scanConversation(rows, &conversation)
 		if err != nil {
 			return nil, utils.HandlePgError(err, "ListConversationsForSpace")
 		}
@@ -111,7 +117,7 @@ func (db *Postgres) ListConversationsForSpace(ctx context.Context, spaceId strin
 }
 
 func (db *Postgres) ListActiveConversationsForUser(ctx context.Context, userId string) ([]models.Conversation, error) {
-	sql := `SELECT * FROM conversations WHERE status = $2 AND user_id = $1`
+	sql := `SELECT` + conversationColumns + ` FROM conversations WHERE status = $2 AND user_id = $1`
 
 	rows, err := db.pool.Query(ctx, sql, userId, models.ConversationStatusActive)
 	if err != nil {
@@ -121,15 +127,7 @@ func (db *Postgres) ListActiveConversationsForUser(ctx context.Context, userId s
 	var conversations []models.Conversation
 	for rows.Next() {
 		var conversation models.Conversation
-		err := rows.Scan(
-			&conversation.ConversationId,
-			&conversation.SpaceId,
-			&conversation.UserId,
-			&conversation.Title,
-			&conversation.Status,
-			&conversation.CreatedAt,
-			&conversation.UpdatedAt,
-		)
+		err := scanConversation(rows, &conversation)
 		if err != nil {
 			return nil, utils.HandlePgError(err, "ListActiveConversationsForUser")
 		}
@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	pgvector "github.com/pgvector/pgvector-go"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
+)
+
+// memoryColumns leaves out the embedding, which no caller needs back.
+const memoryColumns = `
+	memory_id, user_id, content, conversation_id, created_at, updated_at`
+
+func scanMemory(row pgx.Row, memory *models.Memory, extra ...any) error {
+	return row.Scan(append([]any{
+		&memory.MemoryId,
+		&memory.UserId,
+		&memory.Content,
+		&memory.ConversationId,
+		&memory.CreatedAt,
+		&memory.UpdatedAt,
+	}, extra...)...)
+}
+
+func (db *Postgres) CreateMemory(ctx context.Context, memory *models.Memory) error {
+	sql := `
+	INSERT INTO memories (user_id, content, conversation_id, embedding)
+	VALUES ($1, $2, $3, $4)
+	RETURNING` + memoryColumns
+
+	err := scanMemory(db.pool.QueryRow(ctx, sql,
+		memory.UserId,
+		memory.Content,
+		memory.ConversationId,
+		pgvector.NewVector(memory.Embedding),
+	), memory)
+	if err != nil {
+		return utils.HandlePgError(err, "CreateMemory")
+	}
+	return nil
+}
+
+func (db *Postgres) ListMemories(ctx context.Context, userId string) ([]models.Memory, error) {
+	sql := `SELECT` + memoryColumns + ` FROM memories WHERE user_id = $1 ORDER BY updated_at DESC`
+
+	rows, err := db.pool.Query(ctx, sql, userId)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "ListMemories")
+	}
+	defer rows.Close()
+
+	memories := []models.Memory{}
+	for rows.Next() {
+		var memory models.Memory
+		if err := scanMemory(rows, &memory); err != nil {
+			return nil, utils.HandlePgError(err, "ListMemories")
+		}
+		memories = append(memories, memory)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.HandlePgError(err, "ListMemories")
+	}
+	return memories, nil
+}
+
+func (db *Postgres) UpdateMemory(ctx context.Context, userId, memoryId, content string, embedding []float32) (*models.Memory, error) {
+	sql := `
+	UPDATE memories SET content = $3, embedding = $4, updated_at = NOW()
+	WHERE memory_id = $1 AND user_id = $2
+	RETURNING` + memoryColumns
+
+	var memory models.Memory
+	err := scanMemory(db.pool.QueryRow(ctx, sql, memoryId, userId, content, pgvector.NewVector(embedding)), &memory)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "UpdateMemory")
+	}
+	return &memory, nil
+}
+
+func (db *Postgres) DeleteMemory(ctx context.Context, userId, memoryId string) error {
+	sql := `DELETE FROM memories WHERE memory_id = $1 AND user_id = $2`
+
+	tag, err := db.pool.Exec(ctx, sql, memoryId, userId)
+	if err != nil {
+		return utils.HandlePgError(err, "DeleteMemory")
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrNotFound.Wrap(fmt.Errorf("DeleteMemory: memory not found"))
+	}
+	return nil
+}
+
+func (db *Postgres) DeleteUserMemories(ctx context.Context, userId string) error {
+	sql := `DELETE FROM memories WHERE user_id = $1`
+	if _, err := db.pool.Exec(ctx, sql, userId); err != nil {
+		return utils.HandlePgError(err, "DeleteUserMemories")
+	}
+	return nil
+}
+
+func (db *Postgres) FindSimilarMemories(ctx context.Context, userId string, embedding []float32, limit int) ([]models.Memory, error) {
+	sql := `
+	SELECT` + memoryColumns + `, 1 - (embedding <=> $2) AS similarity
+	FROM memories
+	WHERE user_id = $1
+	ORDER BY embedding <=> $2
+	LIMIT $3`
+
+	rows, err := db.pool.Query(ctx, sql, userId, pgvector.NewVector(embedding), limit)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "FindSimilarMemories")
+	}
+	defer rows.Close()
+
+	var memories []models.Memory
+	for rows.Next() {
+		var memory models.Memory
+		if err := scanMemory(rows, &memory, &memory.Similarity); err != nil {
+			return nil, utils.HandlePgError(err, "FindSimilarMemories")
+		}
+		memories = append(memories, memory)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.HandlePgError(err, "FindSimilarMemories")
+	}
+	return memories, nil
+}
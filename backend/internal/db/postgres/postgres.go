@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
@@ -60,25 +61,86 @@ CREATE TABLE IF NOT EXISTS users (
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    family_id UUID NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    replaced_by UUID,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_idx ON refresh_tokens(user_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens(family_id);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    key_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_idx ON api_keys(user_id);
+
 CREATE TABLE IF NOT EXISTS spaces (
     space_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
     title TEXT NOT NULL,
     description TEXT NOT NULL,
     source_limit INTEGER NOT NULL DEFAULT 50,
+    settings JSONB NOT NULL DEFAULT '{}',
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
 CREATE INDEX IF NOT EXISTS spaces_user_idx ON spaces(user_id);
 
+-- Invitations are rows with accepted_at still NULL
+CREATE TABLE IF NOT EXISTS space_members (
+    space_id UUID NOT NULL REFERENCES spaces(space_id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    invited_by UUID REFERENCES users(user_id) ON DELETE SET NULL,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (space_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS space_members_user_idx ON space_members(user_id);
+
+-- System prompts written by users, personal (user_id) or shared with a space (space_id)
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    template_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(user_id) ON DELETE CASCADE,
+    space_id UUID REFERENCES spaces(space_id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK ((user_id IS NULL) <> (space_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS prompt_templates_user_name_idx ON prompt_templates(user_id, name) WHERE user_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS prompt_templates_space_name_idx ON prompt_templates(space_id, name) WHERE space_id IS NOT NULL;
+
 CREATE TABLE IF NOT EXISTS sources (
     source_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     space_id UUID NOT NULL REFERENCES spaces(space_id) ON DELETE CASCADE,
-    source_type TEXT NOT NULL CHECK (source_type IN ('webpage')),
+    source_type TEXT NOT NULL CHECK (source_type IN ('webpage', 'file')),
     location TEXT NOT NULL,
     metadata JSONB NOT NULL,
     text TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processing', 'ready', 'failed')),
+    error_message TEXT,
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
@@ -89,10 +151,13 @@ CREATE TABLE IF NOT EXISTS chunks (
     chunk_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     source_id UUID NOT NULL REFERENCES sources(source_id) ON DELETE CASCADE,
     user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    space_id UUID NOT NULL REFERENCES spaces(space_id) ON DELETE CASCADE,
     text TEXT NOT NULL,
     chunk_index INTEGER NOT NULL,
     chunk_token_count INTEGER NOT NULL,
-    embedding vector(1536)
+    page_number INTEGER,
+    section_title TEXT NOT NULL DEFAULT '',
+    embedding vector(768)
 );
 
 CREATE INDEX IF NOT EXISTS chunks_source_idx ON chunks(source_id);
@@ -111,25 +176,179 @@ CREATE TABLE IF NOT EXISTS conversations (
 CREATE INDEX IF NOT EXISTS conversations_space_idx ON conversations(space_id);
 CREATE INDEX IF NOT EXISTS conversations_status_idx ON conversations(status);
 
+-- Facts about a user remembered across conversations
+CREATE TABLE IF NOT EXISTS memories (
+    memory_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    conversation_id UUID REFERENCES conversations(conversation_id) ON DELETE SET NULL,
+    embedding vector(768) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS memories_user_idx ON memories(user_id);
+
 CREATE TABLE IF NOT EXISTS chat_messages (
     message_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     conversation_id UUID NOT NULL REFERENCES conversations(conversation_id) ON DELETE CASCADE,
-    role TEXT NOT NULL CHECK (role IN ('user', 'assistant', 'system', 'error')),
+    parent_message_id UUID REFERENCES chat_messages(message_id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('user', 'assistant', 'system', 'error', 'tool')),
     content TEXT NOT NULL,
     tokens_used INTEGER,
+    prompt_tokens INTEGER,
+    completion_tokens INTEGER,
     model TEXT,
     metadata JSONB,
+    tool_call_id TEXT,
+    tool_name TEXT,
+    tool_args JSONB,
+    status TEXT NOT NULL DEFAULT 'completed' CHECK (status IN ('completed', 'interrupted')),
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
 CREATE INDEX IF NOT EXISTS chat_messages_conversation_idx ON chat_messages(conversation_id);
 CREATE INDEX IF NOT EXISTS chat_messages_created_at_idx ON chat_messages(created_at);
+
+CREATE TABLE IF NOT EXISTS message_references (
+    reference_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    message_id UUID NOT NULL REFERENCES chat_messages(message_id) ON DELETE CASCADE,
+    chunk_id UUID NOT NULL REFERENCES chunks(chunk_id) ON DELETE CASCADE,
+    relevance_score DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS message_references_message_idx ON message_references(message_id);
+
+-- Model calls made for a user that are not assistant messages; they count in
+-- usage and quotas like messages do
+CREATE TABLE IF NOT EXISTS usage_records (
+    usage_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    conversation_id UUID REFERENCES conversations(conversation_id) ON DELETE SET NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('memory_extraction', 'api', 'regenerate')),
+    model TEXT NOT NULL DEFAULT '',
+    prompt_tokens INTEGER,
+    completion_tokens INTEGER,
+    tokens_used INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS usage_records_user_idx ON usage_records(user_id, created_at);
+CREATE INDEX IF NOT EXISTS usage_records_conversation_idx ON usage_records(conversation_id);
+
+-- Upgrades for databases created before the columns above existed
+ALTER TABLE spaces ADD COLUMN IF NOT EXISTS settings JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE sources ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'pending';
+ALTER TABLE sources ADD COLUMN IF NOT EXISTS error_message TEXT;
+ALTER TABLE sources DROP CONSTRAINT IF EXISTS sources_source_type_check;
+ALTER TABLE sources ADD CONSTRAINT sources_source_type_check CHECK (source_type IN ('webpage', 'file'));
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS space_id UUID REFERENCES spaces(space_id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS chunks_space_idx ON chunks(space_id);
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS page_number INTEGER;
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS section_title TEXT NOT NULL DEFAULT '';
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS tool_call_id TEXT;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS tool_name TEXT;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS tool_args JSONB;
+ALTER TABLE chat_messages DROP CONSTRAINT IF EXISTS chat_messages_role_check;
+ALTER TABLE chat_messages ADD CONSTRAINT chat_messages_role_check CHECK (role IN ('user', 'assistant', 'system', 'error', 'tool'));
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS prompt_tokens INTEGER;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS completion_tokens INTEGER;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'completed' CHECK (status IN ('completed', 'interrupted'));
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS parent_message_id UUID REFERENCES chat_messages(message_id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS chat_messages_parent_idx ON chat_messages(parent_message_id);
+-- chat_messages is created after conversations, so the active branch pointer is always added here
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS active_message_id UUID REFERENCES chat_messages(message_id) ON DELETE SET NULL;
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS summary TEXT NOT NULL DEFAULT '';
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS summary_message_id UUID REFERENCES chat_messages(message_id) ON DELETE SET NULL;
+ALTER TABLE usage_records DROP CONSTRAINT IF EXISTS usage_records_kind_check;
+ALTER TABLE usage_records ADD CONSTRAINT usage_records_kind_check CHECK (kind IN ('memory_extraction', 'api', 'regenerate'));
+
+INSERT INTO space_members (space_id, user_id, role, accepted_at)
+    SELECT space_id, user_id, 'owner', created_at FROM spaces
+    ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    name TEXT PRIMARY KEY,
+    applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Embeddings come from text-embedding-004 / nomic-embed-text, both 768 dimensions
+DO $$
+BEGIN
+    IF (SELECT atttypmod FROM pg_attribute WHERE attrelid = 'chunks'::regclass AND attname = 'embedding') <> 768 THEN
+        ALTER TABLE chunks ALTER COLUMN embedding TYPE vector(768);
+    END IF;
+END $$;
 `
 
+// migrations rewrite existing data, unlike createSchema which can run on
+// every start. Each runs once, in order, recorded in schema_migrations by
+// name; names must never change.
+var migrations = []struct {
+	name string
+	sql  string
+}{
+	{
+		// Messages of conversations from before message trees form a
+		// single branch in creation order
+		name: "linearize_legacy_messages",
+		sql: `
+		WITH legacy AS (
+			SELECT m.message_id,
+				LAG(m.message_id) OVER (PARTITION BY m.conversation_id ORDER BY m.created_at, m.message_id) AS parent_id
+			FROM chat_messages m
+			JOIN conversations c ON c.conversation_id = m.conversation_id
+			WHERE c.active_message_id IS NULL
+		)
+		UPDATE chat_messages m SET parent_message_id = legacy.parent_id
+		FROM legacy
+		WHERE m.message_id = legacy.message_id AND legacy.parent_id IS NOT NULL;
+
+		UPDATE conversations c SET active_message_id = (
+			SELECT m.message_id FROM chat_messages m
+			WHERE m.conversation_id = c.conversation_id
+			ORDER BY m.created_at DESC, m.message_id DESC
+			LIMIT 1
+		)
+		WHERE c.active_message_id IS NULL;`,
+	},
+}
+
 func (db *Postgres) InitSchema(ctx context.Context) error {
-	_, err := db.pool.Exec(ctx, createSchema)
-	return err
+	if _, err := db.pool.Exec(ctx, createSchema); err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if err := db.migrate(ctx, m.name, m.sql); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+// migrate runs sql and records it as name in one transaction, unless it
+// already ran. An instance starting at the same time waits on the row and
+// then skips it.
+func (db *Postgres) migrate(ctx context.Context, name, sql string) error {
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `INSERT INTO schema_migrations (name) VALUES ($1) ON CONFLICT DO NOTHING`, name)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 // Helper functions
@@ -157,9 +376,24 @@ func (db *Postgres) CheckUserSpaceLimit(ctx context.Context, userId string) (boo
 }
 
 func (db *Postgres) GetSpaceSourceCount(ctx context.Context, spaceId string) (int, error) {
-	return 0, nil
+	var count int
+	err := db.pool.QueryRow(ctx,
+		"SELECT COUNT(*) FROM sources WHERE space_id = $1",
+		spaceId,
+	).Scan(&count)
+	return count, err
 }
 
 func (db *Postgres) CheckSpaceSourceLimit(ctx context.Context, spaceId string) (bool, error) {
-	return true, nil
+	space, err := db.GetSpace(ctx, spaceId)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := db.GetSpaceSourceCount(ctx, spaceId)
+	if err != nil {
+		return false, err
+	}
+
+	return count < space.SourceLimit, nil
 }
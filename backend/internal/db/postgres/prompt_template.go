@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
+)
+
+const promptTemplateColumns = `
+	template_id, user_id, space_id, name, description, content, created_at, updated_at`
+
+func scanPromptTemplate(row pgx.Row) (*models.PromptTemplate, error) {
+	var t models.PromptTemplate
+	err := row.Scan(
+		&t.TemplateId,
+		&t.UserId,
+		&t.SpaceId,
+		&t.Name,
+		&t.Description,
+		&t.Content,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (db *Postgres) CreatePromptTemplate(ctx context.Context, t *models.PromptTemplate) (*models.PromptTemplate, error) {
+	sql := `
+	INSERT INTO prompt_templates (user_id, space_id, name, description, content)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING` + promptTemplateColumns
+
+	created, err := scanPromptTemplate(db.pool.QueryRow(ctx, sql,
+		t.UserId,
+		t.SpaceId,
+		t.Name,
+		t.Description,
+		t.Content,
+	))
+	if err != nil {
+		return nil, utils.HandlePgError(err, "CreatePromptTemplate")
+	}
+	return created, nil
+}
+
+func (db *Postgres) GetPromptTemplate(ctx context.Context, templateId string) (*models.PromptTemplate, error) {
+	sql := `SELECT` + promptTemplateColumns + ` FROM prompt_templates WHERE template_id = $1`
+	t, err := scanPromptTemplate(db.pool.QueryRow(ctx, sql, templateId))
+	if err != nil {
+		return nil, utils.HandlePgError(err, "GetPromptTemplate")
+	}
+	return t, nil
+}
+
+// FindPromptTemplate prefers the user's own template to the space's one of
+// the same name. spaceId may be empty.
+func (db *Postgres) FindPromptTemplate(ctx context.Context, userId, spaceId, name string) (*models.PromptTemplate, error) {
+	sql := `
+	SELECT` + promptTemplateColumns + `
+	FROM prompt_templates
+	WHERE name = $3 AND (user_id = $1 OR space_id = NULLIF($2, '')::uuid)
+	ORDER BY user_id IS NULL
+	LIMIT 1`
+
+	t, err := scanPromptTemplate(db.pool.QueryRow(ctx, sql, userId, spaceId, name))
+	if err != nil {
+		return nil, utils.HandlePgError(err, "FindPromptTemplate")
+	}
+	return t, nil
+}
+
+// ListPromptTemplates returns the user's templates followed by the space's,
+// each by name. spaceId may be empty.
+func (db *Postgres) ListPromptTemplates(ctx context.Context, userId, spaceId string) ([]models.PromptTemplate, error) {
+	sql := `
+	SELECT` + promptTemplateColumns + `
+	FROM prompt_templates
+	WHERE user_id = $1 OR space_id = NULLIF($2, '')::uuid
+	ORDER BY user_id IS NULL, name`
+
+	rows, err := db.pool.Query(ctx, sql, userId, spaceId)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "ListPromptTemplates")
+	}
+	defer rows.Close()
+
+	templates := []models.PromptTemplate{}
+	for rows.Next() {
+		t, err := scanPromptTemplate(rows)
+		if err != nil {
+			return nil, utils.HandlePgError(err, "ListPromptTemplates")
+		}
+		templates = append(templates, *t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.HandlePgError(err, "ListPromptTemplates")
+	}
+	return templates, nil
+}
+
+func (db *Postgres) UpdatePromptTemplate(ctx context.Context, t *models.PromptTemplate) (*models.PromptTemplate, error) {
+	sql := `
+	UPDATE prompt_templates
+	SET name = $2, description = $3, content = $4, updated_at = NOW()
+	WHERE template_id = $1
+	RETURNING` + promptTemplateColumns
+
+	updated, err := scanPromptTemplate(db.pool.QueryRow(ctx, sql,
+		t.TemplateId,
+		t.Name,
+		t.Description,
+		t.Content,
+	))
+	if err != nil {
+		return nil, utils.HandlePgError(err, "UpdatePromptTemplate")
+	}
+	return updated, nil
+}
+
+func (db *Postgres) DeletePromptTemplate(ctx context.Context, templateId string) error {
+	sql := `DELETE FROM prompt_templates WHERE template_id = $1`
+
+	tag, err := db.pool.Exec(ctx, sql, templateId)
+	if err != nil {
+		return utils.HandlePgError(err, "DeletePromptTemplate")
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrNotFound.Wrap(fmt.Errorf("DeletePromptTemplate: template not found"))
+	}
+	return nil
+}
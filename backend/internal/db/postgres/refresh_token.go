@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
+)
+
+const insertRefreshToken = `
+	INSERT INTO refresh_tokens (token_id, user_id, family_id, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4, $5)`
+
+func (db *Postgres) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	_, err := db.pool.Exec(ctx, insertRefreshToken,
+		token.TokenId,
+		token.UserId,
+		token.FamilyId,
+		token.TokenHash,
+		token.ExpiresAt,
+	)
+	if err != nil {
+		return utils.HandlePgError(err, "CreateRefreshToken")
+	}
+	return nil
+}
+
+func (db *Postgres) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	sql := `
+	SELECT
+		token_id, user_id, family_id, token_hash,
+		expires_at, revoked_at, replaced_by, created_at
+	FROM refresh_tokens WHERE token_hash = $1`
+
+	var token models.RefreshToken
+	err := db.pool.QueryRow(ctx, sql, tokenHash).Scan(
+		&token.TokenId,
+		&token.UserId,
+		&token.FamilyId,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.RevokedAt,
+		&token.ReplacedBy,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "GetRefreshTokenByHash")
+	}
+	return &token, nil
+}
+
+func (db *Postgres) RotateRefreshToken(ctx context.Context, oldTokenId string, next *models.RefreshToken) error {
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return utils.ErrDatabase.Wrap(fmt.Errorf("begin tx: %w", err))
+	}
+	defer tx.Rollback(ctx)
+
+	// Insert first so replaced_by never points at a missing token
+	_, err = tx.Exec(ctx, insertRefreshToken,
+		next.TokenId,
+		next.UserId,
+		next.FamilyId,
+		next.TokenHash,
+		next.ExpiresAt,
+	)
+	if err != nil {
+		return utils.HandlePgError(err, "RotateRefreshToken")
+	}
+
+	// Two refreshes racing with the same token: only one may win
+	tag, err := tx.Exec(ctx, `
+	UPDATE refresh_tokens SET revoked_at = NOW(), replaced_by = $2
+	WHERE token_id = $1 AND revoked_at IS NULL`, oldTokenId, next.TokenId)
+	if err != nil {
+		return utils.HandlePgError(err, "RotateRefreshToken")
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrUnauthorized.Wrap(fmt.Errorf("refresh token %s was already used", oldTokenId))
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return utils.HandlePgError(err, "RotateRefreshToken")
+	}
+	return nil
+}
+
+func (db *Postgres) RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	sql := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+	if _, err := db.pool.Exec(ctx, sql, familyId); err != nil {
+		return utils.HandlePgError(err, "RevokeRefreshTokenFamily")
+	}
+	return nil
+}
+
+func (db *Postgres) RevokeUserRefreshTokens(ctx context.Context, userId string) error {
+	sql := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := db.pool.Exec(ctx, sql, userId); err != nil {
+		return utils.HandlePgError(err, "RevokeUserRefreshTokens")
+	}
+	return nil
+}
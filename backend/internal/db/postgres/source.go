@@ -4,72 +4,171 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	pgvector "github.com/pgvector/pgvector-go"
 	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
 )
 
-func (db *Postgres) CreateSource(ctx context.Context, source *models.Source) error {
+const sourceColumns = `
+	source_id, space_id, source_type, location, metadata,
+	text, status, COALESCE(error_message, ''), created_at, updated_at`
+
+func scanSource(row pgx.Row) (*models.Source, error) {
+	var source models.Source
+	err := row.Scan(
+		&source.SourceId,
+		&source.SpaceId,
+		&source.SourceType,
+		&source.Location,
+		&source.Metadata,
+		&source.Text,
+		&source.Status,
+		&source.ErrorMessage,
+		&source.CreatedAt,
+		&source.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+func (db *Postgres) CreateSource(ctx context.Context, source *models.Source) (*models.Source, error) {
 	sql := `
 	INSERT INTO sources (
 		space_id, source_type,
-		location, metadata, text
-	) VALUES ($1, $2, $3, $4, $5)`
+		location, metadata, text, status
+	) VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING` + sourceColumns
 
-	_, err := db.pool.Exec(ctx, sql,
+	created, err := scanSource(db.pool.QueryRow(ctx, sql,
 		source.SpaceId,
 		source.SourceType,
 		source.Location,
 		source.Metadata,
 		source.Text,
-	)
-	return err
+		source.Status,
+	))
+	if err != nil {
+		return nil, utils.HandlePgError(err, "CreateSource")
+	}
+	return created, nil
 }
 
 func (db *Postgres) GetSource(ctx context.Context, sourceId string) (*models.Source, error) {
-	sql := `SELECT * FROM sources WHERE source_id = $1`
-	var source models.Source
-	err := db.pool.QueryRow(ctx, sql, sourceId).Scan(&source)
-	return &source, err
+	sql := `SELECT` + sourceColumns + ` FROM sources WHERE source_id = $1`
+	source, err := scanSource(db.pool.QueryRow(ctx, sql, sourceId))
+	if err != nil {
+		return nil, utils.HandlePgError(err, "GetSource")
+	}
+	return source, nil
+}
+
+func (db *Postgres) UpdateSourceStatus(ctx context.Context, sourceId string, status models.SourceStatus, errMsg string) error {
+	sql := `UPDATE sources
+	SET status = $2, error_message = NULLIF($3, ''), updated_at = NOW()
+	WHERE source_id = $1`
+
+	if _, err := db.pool.Exec(ctx, sql, sourceId, status, errMsg); err != nil {
+		return utils.HandlePgError(err, "UpdateSourceStatus")
+	}
+	return nil
+}
+
+// FailUnfinishedSources marks every pending or processing source failed with
+// errMsg and returns how many there were.
+func (db *Postgres) FailUnfinishedSources(ctx context.Context, errMsg string) (int64, error) {
+	sql := `UPDATE sources
+	SET status = 'failed', error_message = $1, updated_at = NOW()
+	WHERE status IN ('pending', 'processing')`
+
+	tag, err := db.pool.Exec(ctx, sql, errMsg)
+	if err != nil {
+		return 0, utils.HandlePgError(err, "FailUnfinishedSources")
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (db *Postgres) UpdateSourceContent(ctx context.Context, sourceId string, text string, metadata models.JSONB) error {
+	sql := `UPDATE sources
+	SET text = $2, metadata = $3, updated_at = NOW()
+	WHERE source_id = $1`
+
+	if _, err := db.pool.Exec(ctx, sql, sourceId, text, metadata); err != nil {
+		return utils.HandlePgError(err, "UpdateSourceContent")
+	}
+	return nil
 }
 
 func (db *Postgres) DeleteSource(ctx context.Context, sourceId string) error {
 	sql := `DELETE FROM sources WHERE source_id = $1`
-	_, err := db.pool.Exec(ctx, sql, sourceId)
-	return err
+	if _, err := db.pool.Exec(ctx, sql, sourceId); err != nil {
+		return utils.HandlePgError(err, "DeleteSource")
+	}
+	return nil
 }
 
+// ListSourcesForSpace leaves out the extracted text, which can be large;
+// use GetSource to fetch a single source with its text.
 func (db *Postgres) ListSourcesForSpace(ctx context.Context, spaceId string) ([]models.Source, error) {
-	sql := `SELECT * FROM sources WHERE space_id = $1`
-	rows, rowErr := db.pool.Query(ctx, sql, spaceId)
-	if rowErr != nil {
-		return nil, rowErr
+	sql := `
+	SELECT
+		source_id, space_id, source_type, location, metadata,
+		'', status, COALESCE(error_message, ''), created_at, updated_at
+	FROM sources WHERE space_id = $1 ORDER BY created_at DESC`
+
+	rows, err := db.pool.Query(ctx, sql, spaceId)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "ListSourcesForSpace")
 	}
 	defer rows.Close()
 
 	var sources []models.Source
-
 	for rows.Next() {
-		var source models.Source
-		err := rows.Scan(&source)
+		source, err := scanSource(rows)
 		if err != nil {
-			return nil, err
+			return nil, utils.HandlePgError(err, "ListSourcesForSpace")
 		}
-		sources = append(sources, source)
+		sources = append(sources, *source)
 	}
 	return sources, nil
 }
 
 func (db *Postgres) CreateChunks(ctx context.Context, userId string, spaceId string, sourceId string, chunks []models.Chunk) error {
+	userUUID, err := uuid.Parse(userId)
+	if err != nil {
+		return fmt.Errorf("parse user id: %w", err)
+	}
+	spaceUUID, err := uuid.Parse(spaceId)
+	if err != nil {
+		return fmt.Errorf("parse space id: %w", err)
+	}
+	sourceUUID, err := uuid.Parse(sourceId)
+	if err != nil {
+		return fmt.Errorf("parse source id: %w", err)
+	}
+
+	for i := range chunks {
+		if chunks[i].ChunkId == uuid.Nil {
+			chunks[i].ChunkId = uuid.New()
+		}
+		chunks[i].UserId = userUUID
+		chunks[i].SpaceId = spaceUUID
+		chunks[i].SourceId = sourceUUID
+	}
+
 	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
 	_, err = tx.CopyFrom(ctx,
 		pgx.Identifier{"chunks"},
-		[]string{"chunk_id", "source_id", "user_id", "text", "chunk_index", "chunk_token_count", "embedding"},
-		pgx.CopyFromSource(chunkSliceToCopyFromRows(chunks)),
+		[]string{"chunk_id", "source_id", "user_id", "space_id", "text", "chunk_index", "chunk_token_count", "page_number", "section_title", "embedding"},
+		chunkSliceToCopyFromRows(chunks),
 	)
 	if err != nil {
 		return fmt.Errorf("copy from: %w", err)
@@ -91,9 +190,12 @@ func chunkSliceToCopyFromRows(chunks []models.Chunk) pgx.CopyFromSource {
 			chunk.ChunkId,
 			chunk.SourceId,
 			chunk.UserId,
+			chunk.SpaceId,
 			chunk.Text,
 			chunk.ChunkIndex,
 			chunk.ChunkTokenCount,
+			chunk.PageNumber,
+			chunk.SectionTitle,
 			queryVector,
 		})
 	}
@@ -104,29 +206,36 @@ func chunkSliceToCopyFromRows(chunks []models.Chunk) pgx.CopyFromSource {
 
 func (db *Postgres) FindSimilarChunks(ctx context.Context, embedding []float32, limit int, filters models.ChunkFilters) ([]models.Chunk, error) {
 	queryVector := pgvector.NewVector(embedding)
-	sqlQuery := `SELECT chunk_id, source_id, user_id, text, chunk_index, chunk_token_count, embedding FROM chunks WHERE 1=1`
+	sqlQuery := `
+	SELECT
+		c.chunk_id, c.source_id, c.user_id, c.space_id, c.text,
+		c.chunk_index, c.chunk_token_count, c.page_number, c.section_title, c.embedding,
+		s.location, 1 - (c.embedding <=> $1) AS similarity
+	FROM chunks c
+	JOIN sources s ON s.source_id = c.source_id
+	WHERE s.status = 'ready'`
 
-	var queryParams []interface{}
-	paramIndex := 1
+	queryParams := []interface{}{queryVector}
+	paramIndex := 2
 
 	if filters.UserID != nil {
-		sqlQuery += fmt.Sprintf(" AND user_id = $%d", paramIndex)
+		sqlQuery += fmt.Sprintf(" AND c.user_id = $%d", paramIndex)
 		queryParams = append(queryParams, *filters.UserID)
 		paramIndex++
 	}
 	if filters.SpaceID != nil {
-		sqlQuery += fmt.Sprintf(" AND space_id = $%d", paramIndex)
+		sqlQuery += fmt.Sprintf(" AND c.space_id = $%d", paramIndex)
 		queryParams = append(queryParams, *filters.SpaceID)
 		paramIndex++
 	}
 	if filters.SourceID != nil {
-		sqlQuery += fmt.Sprintf(" AND source_id = $%d", paramIndex)
+		sqlQuery += fmt.Sprintf(" AND c.source_id = $%d", paramIndex)
 		queryParams = append(queryParams, *filters.SourceID)
 		paramIndex++
 	}
 
-	sqlQuery += fmt.Sprintf("ORDER BY embedding <=> $%d LIMIT $%d", paramIndex, paramIndex+1)
-	queryParams = append(queryParams, queryVector, limit)
+	sqlQuery += fmt.Sprintf(" ORDER BY c.embedding <=> $1 LIMIT $%d", paramIndex)
+	queryParams = append(queryParams, limit)
 
 	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
@@ -134,7 +243,8 @@ func (db *Postgres) FindSimilarChunks(ctx context.Context, embedding []float32,
 	}
 	defer tx.Rollback(ctx)
 
-	_, err = tx.Exec(ctx, "SET ivfflat.probes = 10;")
+	// SET LOCAL only lasts until the end of this transaction
+	_, err = tx.Exec(ctx, "SET LOCAL ivfflat.probes = 10;")
 	if err != nil {
 		return nil, fmt.Errorf("set ivfflat.probes: %w", err)
 	}
@@ -145,33 +255,41 @@ func (db *Postgres) FindSimilarChunks(ctx context.Context, embedding []float32,
 	}
 	defer rows.Close()
 
-	_, err = tx.Exec(ctx, "RESET ivfflat.probes;")
-	if err != nil {
-		return nil, fmt.Errorf("reset ivfflat.probes : %w", err)
-	}
-
-	err = tx.Commit(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("commit tx : %w", err)
-	}
-
 	var chunks []models.Chunk
 	for rows.Next() {
 		var chunk models.Chunk
 		var embedding pgvector.Vector
 
-		rows.Scan(
+		err := rows.Scan(
 			&chunk.ChunkId,
 			&chunk.SourceId,
 			&chunk.UserId,
+			&chunk.SpaceId,
 			&chunk.Text,
 			&chunk.ChunkIndex,
 			&chunk.ChunkTokenCount,
-			&embedding)
+			&chunk.PageNumber,
+			&chunk.SectionTitle,
+			&embedding,
+			&chunk.SourceLocation,
+			&chunk.Similarity,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan similar chunk: %w", err)
+		}
 
 		chunk.Embedding = embedding.Slice()
 		chunks = append(chunks, chunk)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read similar chunks: %w", err)
+	}
+	rows.Close()
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("commit tx : %w", err)
+	}
 
 	return chunks, nil
 }
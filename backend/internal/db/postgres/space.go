@@ -9,12 +9,18 @@ import (
 	"github.com/synntx/askmind/internal/utils"
 )
 
+// CreateSpace creates the space together with its owner's membership.
 func (db *Postgres) CreateSpace(ctx context.Context, space *models.CreateSpace) error {
 	sql := `
-	INSERT INTO spaces (
-		user_id, title, description,
-		source_limit
-	) VALUES ($1, $2, $3, COALESCE(NULLIF($4, 0) , 50))`
+	WITH new_space AS (
+		INSERT INTO spaces (
+			user_id, title, description,
+			source_limit
+		) VALUES ($1, $2, $3, COALESCE(NULLIF($4, 0) , 50))
+		RETURNING space_id, user_id, created_at
+	)
+	INSERT INTO space_members (space_id, user_id, role, accepted_at)
+	SELECT space_id, user_id, 'owner', created_at FROM new_space`
 
 	if _, err := db.pool.Exec(ctx, sql,
 		space.UserId,
@@ -27,12 +33,17 @@ func (db *Postgres) CreateSpace(ctx context.Context, space *models.CreateSpace)
 	return nil
 }
 
+// ListSpacesForUser returns the spaces the user owns or has joined, with the
+// user's role in each.
 func (db *Postgres) ListSpacesForUser(ctx context.Context, userId string) ([]models.Space, error) {
 	sql := `
 	SELECT
-		space_id, user_id, title, description,
-		source_limit, created_at, updated_at
-	FROM spaces WHERE user_id = $1`
+		s.space_id, s.user_id, s.title, s.description,
+		s.source_limit, s.settings, m.role, s.created_at, s.updated_at
+	FROM spaces s
+	JOIN space_members m ON m.space_id = s.space_id
+	WHERE m.user_id = $1 AND m.accepted_at IS NOT NULL
+	ORDER BY s.updated_at DESC`
 
 	rows, err := db.pool.Query(ctx, sql, userId)
 	if err != nil {
@@ -49,6 +60,8 @@ func (db *Postgres) ListSpacesForUser(ctx context.Context, userId string) ([]mod
 			&space.Title,
 			&space.Description,
 			&space.SourceLimit,
+			&space.Settings,
+			&space.Role,
 			&space.CreatedAt,
 			&space.UpdatedAt,
 		)
@@ -61,7 +74,7 @@ func (db *Postgres) ListSpacesForUser(ctx context.Context, userId string) ([]mod
 }
 
 func (db *Postgres) GetSpace(ctx context.Context, spaceId string) (*models.Space, error) {
-	sql := `SELECT space_id, user_id, title, description, source_limit, created_at, updated_at FROM spaces WHERE space_id = $1`
+	sql := `SELECT space_id, user_id, title, description, source_limit, settings, created_at, updated_at FROM spaces WHERE space_id = $1`
 	var space models.Space
 	err := db.pool.QueryRow(ctx, sql, spaceId).Scan(
 		&space.SpaceId,
@@ -69,6 +82,7 @@ func (db *Postgres) GetSpace(ctx context.Context, spaceId string) (*models.Space
 		&space.Title,
 		&space.Description,
 		&space.SourceLimit,
+		&space.Settings,
 		&space.CreatedAt,
 		&space.UpdatedAt,
 	)
@@ -97,6 +111,12 @@ func (db *Postgres) UpdateSpace(ctx context.Context, space *models.UpdateSpace)
 		paramIndex++
 	}
 
+	if space.Settings != nil {
+		values = append(values, fmt.Sprintf("settings = $%d", paramIndex))
+		args = append(args, *space.Settings)
+		paramIndex++
+	}
+
 	sql := fmt.Sprintf(`UPDATE spaces set %s , updated_at = NOW() WHERE space_id = $1`, strings.Join(values, ", "))
 
 	if _, err := db.pool.Exec(ctx, sql, args...); err != nil {
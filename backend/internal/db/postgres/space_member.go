@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
+)
+
+const spaceMemberColumns = `
+	m.space_id, m.user_id, u.first_name, u.last_name, u.email,
+	m.role, m.invited_by, m.accepted_at, m.created_at`
+
+func scanSpaceMember(row pgx.Row, member *models.SpaceMember) error {
+	return row.Scan(
+		&member.SpaceId,
+		&member.UserId,
+		&member.FirstName,
+		&member.LastName,
+		&member.Email,
+		&member.Role,
+		&member.InvitedBy,
+		&member.AcceptedAt,
+		&member.CreatedAt,
+	)
+}
+
+func (db *Postgres) GetSpaceMember(ctx context.Context, spaceId, userId string) (*models.SpaceMember, error) {
+	sql := `
+	SELECT ` + spaceMemberColumns + `
+	FROM space_members m
+	JOIN users u ON u.user_id = m.user_id
+	WHERE m.space_id = $1 AND m.user_id = $2`
+
+	var member models.SpaceMember
+	if err := scanSpaceMember(db.pool.QueryRow(ctx, sql, spaceId, userId), &member); err != nil {
+		return nil, utils.HandlePgError(err, "GetSpaceMember")
+	}
+	return &member, nil
+}
+
+// ListSpaceMembers returns the members of a space, pending invitations
+// included, owner first.
+func (db *Postgres) ListSpaceMembers(ctx context.Context, spaceId string) ([]models.SpaceMember, error) {
+	sql := `
+	SELECT ` + spaceMemberColumns + `
+	FROM space_members m
+	JOIN users u ON u.user_id = m.user_id
+	WHERE m.space_id = $1
+	ORDER BY CASE m.role WHEN 'owner' THEN 0 WHEN 'editor' THEN 1 ELSE 2 END, m.created_at`
+
+	rows, err := db.pool.Query(ctx, sql, spaceId)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "ListSpaceMembers")
+	}
+	defer rows.Close()
+
+	var members []models.SpaceMember
+	for rows.Next() {
+		var member models.SpaceMember
+		if err := scanSpaceMember(rows, &member); err != nil {
+			return nil, utils.HandlePgError(err, "ListSpaceMembers")
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.HandlePgError(err, "ListSpaceMembers")
+	}
+	return members, nil
+}
+
+// InviteSpaceMember adds a pending membership for the user registered with
+// email. It fails with utils.ErrUserNotFound for an unknown email and
+// utils.ErrUniqueConflict if the user is already a member or invited.
+func (db *Postgres) InviteSpaceMember(ctx context.Context, spaceId, email string, role models.SpaceRole, invitedBy string) (*models.SpaceMember, error) {
+	sql := `
+	WITH invited AS (
+		INSERT INTO space_members (space_id, user_id, role, invited_by)
+		SELECT $1, user_id, $3, $4 FROM users WHERE email = $2
+		RETURNING *
+	)
+	SELECT ` + spaceMemberColumns + `
+	FROM invited m
+	JOIN users u ON u.user_id = m.user_id`
+
+	var member models.SpaceMember
+	err := scanSpaceMember(db.pool.QueryRow(ctx, sql, spaceId, email, role, invitedBy), &member)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, utils.ErrUserNotFound.Wrap(fmt.Errorf("InviteSpaceMember: no user with email %q", email))
+	}
+	if err != nil {
+		return nil, utils.HandlePgError(err, "InviteSpaceMember")
+	}
+	return &member, nil
+}
+
+func (db *Postgres) ListSpaceInvitations(ctx context.Context, userId string) ([]models.SpaceInvitation, error) {
+	sql := `
+	SELECT
+		s.space_id, s.title, s.description,
+		m.role, m.invited_by, m.created_at
+	FROM space_members m
+	JOIN spaces s ON s.space_id = m.space_id
+	WHERE m.user_id = $1 AND m.accepted_at IS NULL
+	ORDER BY m.created_at DESC`
+
+	rows, err := db.pool.Query(ctx, sql, userId)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "ListSpaceInvitations")
+	}
+	defer rows.Close()
+
+	var invitations []models.SpaceInvitation
+	for rows.Next() {
+		var inv models.SpaceInvitation
+		err := rows.Scan(
+			&inv.SpaceId,
+			&inv.Title,
+			&inv.Description,
+			&inv.Role,
+			&inv.InvitedBy,
+			&inv.CreatedAt,
+		)
+		if err != nil {
+			return nil, utils.HandlePgError(err, "ListSpaceInvitations")
+		}
+		invitations = append(invitations, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.HandlePgError(err, "ListSpaceInvitations")
+	}
+	return invitations, nil
+}
+
+func (db *Postgres) AcceptSpaceInvitation(ctx context.Context, spaceId, userId string) error {
+	sql := `
+	UPDATE space_members SET accepted_at = NOW()
+	WHERE space_id = $1 AND user_id = $2 AND accepted_at IS NULL`
+
+	tag, err := db.pool.Exec(ctx, sql, spaceId, userId)
+	if err != nil {
+		return utils.HandlePgError(err, "AcceptSpaceInvitation")
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrNotFound.Wrap(fmt.Errorf("AcceptSpaceInvitation: no pending invitation"))
+	}
+	return nil
+}
+
+// UpdateSpaceMemberRole changes the role of a member other than the owner.
+func (db *Postgres) UpdateSpaceMemberRole(ctx context.Context, spaceId, userId string, role models.SpaceRole) error {
+	sql := `
+	UPDATE space_members SET role = $3
+	WHERE space_id = $1 AND user_id = $2 AND role <> 'owner'`
+
+	tag, err := db.pool.Exec(ctx, sql, spaceId, userId, role)
+	if err != nil {
+		return utils.HandlePgError(err, "UpdateSpaceMemberRole")
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrNotFound.Wrap(fmt.Errorf("UpdateSpaceMemberRole: member not found"))
+	}
+	return nil
+}
+
+// RemoveSpaceMember removes a member or a pending invitation. The owner can
+// not be removed.
+func (db *Postgres) RemoveSpaceMember(ctx context.Context, spaceId, userId string) error {
+	sql := `DELETE FROM space_members WHERE space_id = $1 AND user_id = $2 AND role <> 'owner'`
+
+	tag, err := db.pool.Exec(ctx, sql, spaceId, userId)
+	if err != nil {
+		return utils.HandlePgError(err, "RemoveSpaceMember")
+	}
+	if tag.RowsAffected() == 0 {
+		return utils.ErrNotFound.Wrap(fmt.Errorf("RemoveSpaceMember: member not found"))
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
+)
+
+// Only assistant messages carry token counts, so no role filter is needed.
+// Usage records count like assistant messages.
+const usageSums = `
+	COALESCE(SUM(m.prompt_tokens), 0),
+	COALESCE(SUM(m.completion_tokens), 0),
+	COALESCE(SUM(m.tokens_used), 0),
+	COUNT(m.tokens_used)`
+
+// conversationUsage is what usageSums adds up for conversations: their
+// messages and the usage records made in them.
+const conversationUsage = `(
+		SELECT conversation_id, prompt_tokens, completion_tokens, tokens_used FROM chat_messages
+		UNION ALL
+		SELECT conversation_id, prompt_tokens, completion_tokens, tokens_used FROM usage_records
+	)`
+
+// userUsage is the usage of user $1: the messages of their conversations and
+// their usage records, with is_request telling the user messages, /v1
+// completions and regenerations that count as a request against the quota.
+const userUsage = `(
+		SELECT m.role = 'user' AS is_request, m.created_at, m.model, m.prompt_tokens, m.completion_tokens, m.tokens_used
+		FROM chat_messages m
+		JOIN conversations c ON c.conversation_id = m.conversation_id
+		WHERE c.user_id = $1
+		UNION ALL
+		SELECT kind IN ('api', 'regenerate'), created_at, model, prompt_tokens, completion_tokens, tokens_used
+		FROM usage_records
+		WHERE user_id = $1
+	)`
+
+func (db *Postgres) GetConversationTokenUsage(ctx context.Context, userId, convId string) (*models.TokenUsage, error) {
+	sql := `
+	SELECT ` + usageSums + `
+	FROM conversations c
+	LEFT JOIN ` + conversationUsage + ` m ON m.conversation_id = c.conversation_id
+	WHERE c.conversation_id = $1 AND c.user_id = $2
+	GROUP BY c.conversation_id`
+
+	var usage models.TokenUsage
+	err := db.pool.QueryRow(ctx, sql, convId, userId).Scan(
+		&usage.PromptTokens,
+		&usage.CompletionTokens,
+		&usage.TotalTokens,
+		&usage.Messages,
+	)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "GetConversationTokenUsage")
+	}
+	return &usage, nil
+}
+
+func (db *Postgres) GetSpaceTokenUsage(ctx context.Context, userId, spaceId string) (*models.TokenUsage, error) {
+	sql := `
+	SELECT ` + usageSums + `
+	FROM spaces s
+	LEFT JOIN conversations c ON c.space_id = s.space_id
+	LEFT JOIN ` + conversationUsage + ` m ON m.conversation_id = c.conversation_id
+	WHERE s.space_id = $1 AND EXISTS (
+		SELECT 1 FROM space_members sm
+		WHERE sm.space_id = s.space_id AND sm.user_id = $2 AND sm.accepted_at IS NOT NULL
+	)
+	GROUP BY s.space_id`
+
+	var usage models.TokenUsage
+	err := db.pool.QueryRow(ctx, sql, spaceId, userId).Scan(
+		&usage.PromptTokens,
+		&usage.CompletionTokens,
+		&usage.TotalTokens,
+		&usage.Messages,
+	)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "GetSpaceTokenUsage")
+	}
+	return &usage, nil
+}
+
+// GetUserDailyTokenUsage returns the user's usage per UTC day and model for
+// messages and usage records created in [from, to).
+func (db *Postgres) GetUserDailyTokenUsage(ctx context.Context, userId string, from, to time.Time) ([]models.DailyTokenUsage, error) {
+	sql := `
+	SELECT
+		to_char(m.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day,
+		COALESCE(m.model, '') AS model,` + usageSums + `
+	FROM ` + userUsage + ` m
+	WHERE m.tokens_used IS NOT NULL
+		AND m.created_at >= $2 AND m.created_at < $3
+	GROUP BY day, model
+	ORDER BY day, model`
+
+	rows, err := db.pool.Query(ctx, sql, userId, from, to)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "GetUserDailyTokenUsage")
+	}
+	defer rows.Close()
+
+	days := []models.DailyTokenUsage{}
+	for rows.Next() {
+		var day models.DailyTokenUsage
+		err := rows.Scan(
+			&day.Day,
+			&day.Model,
+			&day.PromptTokens,
+			&day.CompletionTokens,
+			&day.TotalTokens,
+			&day.Messages,
+		)
+		if err != nil {
+			return nil, utils.HandlePgError(err, "GetUserDailyTokenUsage")
+		}
+		days = append(days, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.HandlePgError(err, "GetUserDailyTokenUsage")
+	}
+	return days, nil
+}
+
+func (db *Postgres) GetUserUsageSince(ctx context.Context, userId string, since time.Time) (int64, int64, error) {
+	sql := `
+	SELECT
+		COUNT(*) FILTER (WHERE m.is_request),
+		COALESCE(SUM(m.tokens_used), 0)
+	FROM ` + userUsage + ` m
+	WHERE m.created_at >= $2`
+
+	var requests, tokens int64
+	if err := db.pool.QueryRow(ctx, sql, userId, since).Scan(&requests, &tokens); err != nil {
+		return 0, 0, utils.HandlePgError(err, "GetUserUsageSince")
+	}
+	return requests, tokens, nil
+}
+
+func (db *Postgres) RecordUsage(ctx context.Context, record *models.UsageRecord) error {
+	var promptTokens, completionTokens, totalTokens *int
+	if record.TotalTokens > 0 {
+		promptTokens, completionTokens, totalTokens = &record.PromptTokens, &record.CompletionTokens, &record.TotalTokens
+	}
+
+	sql := `
+	INSERT INTO usage_records (user_id, conversation_id, kind, model, prompt_tokens, completion_tokens, tokens_used)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING usage_id, created_at`
+
+	err := db.pool.QueryRow(ctx, sql,
+		record.UserId,
+		record.ConversationId,
+		record.Kind,
+		record.Model,
+		promptTokens,
+		completionTokens,
+		totalTokens,
+	).Scan(&record.UsageId, &record.CreatedAt)
+	if err != nil {
+		return utils.HandlePgError(err, "RecordUsage")
+	}
+	return nil
+}
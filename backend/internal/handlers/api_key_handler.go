@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/service"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+type APIKeyHandler struct {
+	ks     service.APIKeyService
+	logger *zap.Logger
+}
+
+func NewAPIKeyHandler(ks service.APIKeyService, logger *zap.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		ks:     ks,
+		logger: logger,
+	}
+}
+
+// Routes: (prefix : `/keys`, session tokens only)
+// 1. /keys - POST (json: name, scopes, expires_at)
+// 2. /keys/list - GET
+// 3. /keys/revoke?key_id= - DELETE
+
+func (h *APIKeyHandler) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(err))
+		return
+	}
+
+	key, err := h.ks.CreateAPIKey(r.Context(), claims.UserId, &req)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	h.logger.Info("api key created",
+		zap.String("key_id", key.KeyId.String()),
+		zap.String("event", "api_key_created"),
+	)
+
+	utils.SendResponse(w, http.StatusCreated, key)
+}
+
+func (h *APIKeyHandler) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	keys, err := h.ks.ListAPIKeys(r.Context(), claims.UserId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, keys)
+}
+
+func (h *APIKeyHandler) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	keyId := r.FormValue("key_id")
+	if keyId == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter key_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "key_id",
+			Message: "'key_id' is required",
+		}))
+		return
+	}
+
+	if err := h.ks.RevokeAPIKey(r.Context(), claims.UserId, keyId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	h.logger.Info("api key revoked",
+		zap.String("key_id", keyId),
+		zap.String("event", "api_key_revoked"),
+	)
+
+	utils.SendNoContent(w)
+}
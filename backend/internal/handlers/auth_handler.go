@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/synntx/askmind/internal/models"
 	"github.com/synntx/askmind/internal/service"
@@ -40,8 +39,12 @@ type UpdatePasswordRequest struct {
 }
 
 type AuthResponse struct {
-	User  *models.User `json:"user"`
-	Token string       `json:"token,omitempty"`
+	User *models.User `json:"user"`
+	*models.TokenPair
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 func (h *AuthHandlers) RegisterHandler(w http.ResponseWriter, r *http.Request) {
@@ -125,11 +128,12 @@ func (h *AuthHandlers) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := utils.GenerateToken(user.UserId.String(), time.Now().Add(time.Hour*24*30))
+	tokens, err := h.authService.IssueTokens(r.Context(), user.UserId.String())
 	if err != nil {
 		utils.HandleError(w, h.logger, utils.ErrInternal.Wrap(err))
+		return
 	}
-	response := AuthResponse{User: user, Token: token}
+	response := AuthResponse{User: user, TokenPair: tokens}
 
 	h.logger.Info("User logged in successfully",
 		zap.String("email", user.Email),
@@ -168,3 +172,57 @@ func (h *AuthHandlers) UpdatePasswordHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 }
+
+func (h *AuthHandlers) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	refreshToken, ok := h.decodeRefreshToken(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.authService.RefreshTokens(r.Context(), refreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidRefreshToken):
+			utils.HandleError(w, h.logger, utils.ErrUnauthorized.Wrap(err))
+		default:
+			utils.HandleError(w, h.logger, err)
+		}
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, tokens)
+}
+
+func (h *AuthHandlers) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	refreshToken, ok := h.decodeRefreshToken(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.Logout(r.Context(), refreshToken); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendNoContent(w)
+}
+
+func (h *AuthHandlers) decodeRefreshToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("invalid request body"),
+		))
+		return "", false
+	}
+	if req.RefreshToken == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required field refresh_token"),
+		).WithDetails(utils.ValidationError{
+			Field:   "refresh_token",
+			Message: "'refresh_token' is required",
+		}))
+		return "", false
+	}
+	return req.RefreshToken, true
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+// requireClaims returns the claims AuthMiddleware put in the request context,
+// answering 401 itself when they are missing.
+func requireClaims(w http.ResponseWriter, r *http.Request, logger *zap.Logger) (*utils.Claims, bool) {
+	claims, ok := r.Context().Value(utils.ClaimsKey).(*utils.Claims)
+	if !ok || claims == nil {
+		utils.HandleError(w, logger, utils.ErrUnauthorized.Wrap(
+			fmt.Errorf("missing Claims in context"),
+		))
+		return nil, false
+	}
+	return claims, true
+}
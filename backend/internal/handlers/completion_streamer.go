@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/synntx/askmind/internal/llm"
@@ -13,67 +16,108 @@ import (
 )
 
 type CompletionStreamHandler struct {
-	ms     service.MessageService
-	llm    llm.LLM
-	logger *zap.Logger
+	ms            service.MessageService
+	history       service.HistoryBudgeter
+	llm           llm.LLM
+	contextWindow int
+	logger        *zap.Logger
 }
 
-func NewCompletionStreamHandler(ms service.MessageService, logger *zap.Logger, llm llm.LLM) *CompletionStreamHandler {
+func NewCompletionStreamHandler(ms service.MessageService, history service.HistoryBudgeter, logger *zap.Logger, llm llm.LLM, contextWindow int) *CompletionStreamHandler {
 	return &CompletionStreamHandler{
-		ms:     ms,
-		llm:    llm,
-		logger: logger,
+		ms:            ms,
+		history:       history,
+		llm:           llm,
+		contextWindow: contextWindow,
+		logger:        logger,
 	}
 }
 
 func (csh *CompletionStreamHandler) HandleCompletionStream(
 	ctx context.Context,
 	convID uuid.UUID,
-	userMessage string,
+	assistantMessageID string,
+	userMessage *models.ChatMessage,
 	model string,
 	provider string,
-	streamer *SSEStreamer,
+	references []models.Chunk,
+	streamer eventSender,
 ) error {
-	// NOTE: 1. Create User Message (already done in handler in the original code, keep it there for now or move here)
+	// NOTE: 1. Create User Message (done by the handler; the answer is saved below it)
 
-	// 2. Generate Assistant Message ID and Initial SSE Events
+	// 2. Initial SSE Events
 	convIDStr := convID.String()
-	assistantMessageID := uuid.New().String()
 
 	if err := csh.sendInitialEvents(streamer, convIDStr, assistantMessageID, model); err != nil {
 		csh.logger.Error("Failed to send initial SSE events", zap.Error(err), zap.String("conv_id", convIDStr))
 		return err
 	}
 
-	convMessages, err := csh.ms.GetConversationMessages(ctx, convIDStr)
+	// History is the branch leading to the user message, without it: the
+	// user message is passed on its own.
+	var convMessages []models.ChatMessage
+	var err error
+	if userMessage.ParentMessageId != nil {
+		convMessages, err = csh.ms.GetMessagePath(ctx, userMessage.ParentMessageId.String())
+	}
 	if err != nil {
 		csh.logger.Error("Failed to get conversation messages", zap.Error(err), zap.String("conv_id", convIDStr))
 		details := map[string]any{"conversation_id": convIDStr}
 		csh.sendStreamError(streamer, "history_fetch_failed", "Could not retrieve conversation history.", details)
 		return err
 	}
+	// Long conversations are cut down to the model's context window, the
+	// earlier turns summarized.
+	convMessages = csh.history.Fit(ctx, convIDStr, convMessages, csh.contextWindow, csh.llm)
 
-	fullResponse, err := csh.processLLMStream(ctx, streamer, convMessages, userMessage)
+	// Whatever ended the answer, the part generated so far is sent and saved;
+	// only an answer the model finished is saved as completed.
+	result, err := csh.processLLMStream(ctx, streamer, convMessages, userMessage.Content)
+	reason := finishReason(ctx, err)
 	if err != nil {
-		csh.logger.Error("Error during LLM stream processing", zap.Error(err), zap.String("conv_id", convIDStr))
-		return err
+		csh.logger.Warn("LLM stream ended early", zap.Error(err),
+			zap.String("conv_id", convIDStr),
+			zap.String("finish_reason", reason))
 	}
 
-	if err := csh.sendFinalEvents(streamer, convIDStr); err != nil {
+	if err := csh.sendFinalEvents(streamer, convIDStr, references, result.usage, reason); err != nil {
 		return err
 	}
 
-	if err := csh.saveAssistantMessage(convID, fullResponse, model); err != nil {
+	status := models.MessageStatusCompleted
+	if reason != FinishReasonStop {
+		status = models.MessageStatusInterrupted
+	}
+	// The answer may have come from the fallback model rather than the requested one.
+	if err := csh.saveAssistantMessage(convID, userMessage.MessageId, assistantMessageID, csh.llm.GetModelName(), status, reason, result, references); err != nil {
 		details := map[string]any{"conversation_id": convIDStr, "save_failed": true}
 		csh.sendStreamError(streamer, "save_error", "Response was generated but could not be saved.", details)
 		return nil
 	}
 
+	if err != nil {
+		return err
+	}
 	csh.logger.Info("Stream completed successfully", zap.String("conv_id", convIDStr))
 	return nil
 }
 
-func (csh *CompletionStreamHandler) sendInitialEvents(streamer *SSEStreamer, convID, assistantMsgID, model string) error {
+// finishReason tells why processLLMStream returned err, telling a stop
+// requested with /c/stop and the job's timeout apart through the cause of ctx.
+func finishReason(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return FinishReasonStop
+	case errors.Is(context.Cause(ctx), errGenerationStopped):
+		return FinishReasonUserStopped
+	case errors.Is(context.Cause(ctx), errGenerationTimedOut), errors.Is(err, context.DeadlineExceeded):
+		return FinishReasonTimeout
+	default:
+		return FinishReasonError
+	}
+}
+
+func (csh *CompletionStreamHandler) sendInitialEvents(streamer eventSender, convID, assistantMsgID, model string) error {
 	if err := streamer.Send(EventDeltaEncoding, `"v1"`); err != nil {
 		return err
 	}
@@ -81,24 +125,55 @@ func (csh *CompletionStreamHandler) sendInitialEvents(streamer *SSEStreamer, con
 	return streamer.Send(EventDelta, initialPayload)
 }
 
-func (csh *CompletionStreamHandler) processLLMStream(ctx context.Context, streamer *SSEStreamer, history []models.ChatMessage, userMessage string) (string, error) {
+// streamResult is what one answer produced: its text, the tool calls that
+// finished while producing it and the tokens it cost.
+type streamResult struct {
+	content   string
+	toolCalls []llm.ToolInfo
+	usage     *llm.Usage
+}
+
+// processLLMStream relays the model's answer to the client and returns it.
+func (csh *CompletionStreamHandler) processLLMStream(ctx context.Context, streamer eventSender, history []models.ChatMessage, userMessage string) (streamResult, error) {
 	respStream := csh.llm.GenerateContentStream(ctx, history, userMessage)
 	var responseBuilder strings.Builder
+	var result streamResult
+	events := newToolCallEvents()
+	done := func(err error) (streamResult, error) {
+		result.content = responseBuilder.String()
+		return result, err
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			csh.logger.Warn("Context cancelled by client", zap.Error(ctx.Err()))
-			details := map[string]any{"reason": "client_disconnected"}
-			csh.sendStreamError(streamer, "stream_cancelled", "Stream cancelled by client.", details)
-			return responseBuilder.String(), ctx.Err()
+			// The generation outlives the client's request: it was stopped
+			// or timed out, which the final events report.
+			return done(ctx.Err())
 		case chunk, ok := <-respStream:
 			if !ok {
-				return responseBuilder.String(), nil
+				return done(nil)
 			}
 			if chunk.Err != nil {
+				if ctx.Err() != nil {
+					// the provider noticed the cancellation first
+					return done(ctx.Err())
+				}
 				csh.handleLLMError(streamer, chunk.Err)
-				return responseBuilder.String(), chunk.Err
+				return done(chunk.Err)
+			}
+
+			if chunk.Usage != nil {
+				result.usage = chunk.Usage
+			}
+
+			if chunk.ToolInfo != nil {
+				if chunk.ToolInfo.Status == llm.StatusEnd {
+					result.toolCalls = append(result.toolCalls, *chunk.ToolInfo)
+				}
+				if err := streamer.Send(EventDelta, events.update(chunk.ToolInfo)); err != nil {
+					return done(err)
+				}
 			}
 
 			if chunk.Content != "" {
@@ -109,56 +184,186 @@ func (csh *CompletionStreamHandler) processLLMStream(ctx context.Context, stream
 					Value:     chunk.Content,
 				}
 				if err := streamer.Send(EventDelta, contentDelta); err != nil {
-					return responseBuilder.String(), err
+					return done(err)
 				}
 			}
 		}
 	}
 }
 
-func (csh *CompletionStreamHandler) sendFinalEvents(streamer *SSEStreamer, convIDStr string) error {
-	isComplete := true
+// toolResultPreviewLen bounds the tool result sent to the client; pages
+// fetched by tools can be far larger than anything the UI shows.
+const toolResultPreviewLen = 500
+
+// toolCallEvents tracks the tool calls of one answer so every status change
+// can be sent as a patch of that call's entry in the message metadata.
+type toolCallEvents struct {
+	index map[string]int
+	calls []ToolCallEvent
+}
+
+func newToolCallEvents() *toolCallEvents {
+	return &toolCallEvents{index: make(map[string]int)}
+}
+
+// update records info and returns the patch that brings the client's copy of
+// the call up to date.
+func (e *toolCallEvents) update(info *llm.ToolInfo) DeltaPayload {
+	now := time.Now()
+	i, seen := e.index[info.ID]
+	if info.ID == "" {
+		seen = false // without an id a call cannot be matched to its earlier events
+	}
+	if !seen {
+		i = len(e.calls)
+		e.index[info.ID] = i
+		e.calls = append(e.calls, ToolCallEvent{
+			ID:        info.ID,
+			StartTime: float64(now.UnixNano()) / 1e9,
+		})
+	}
+
+	call := &e.calls[i]
+	call.Name = info.Name
+	call.Status = string(info.Status)
+	if info.Args != nil {
+		call.Args = info.Args
+	}
+	if info.Status == llm.StatusEnd {
+		endTime := float64(now.UnixNano()) / 1e9
+		durationMs := int64((endTime - call.StartTime) * 1000)
+		call.EndTime, call.DurationMs = &endTime, &durationMs
+		call.Result, call.ResultTruncated = truncateRunes(info.Result, toolResultPreviewLen)
+	}
+
+	if !seen {
+		return DeltaPayload{Path: PathMessageMetadataTC, Operation: PatchOpAppend, Value: *call}
+	}
+	return DeltaPayload{
+		Path:      fmt.Sprintf("%s/%d", PathMessageMetadataTC, i),
+		Operation: PatchOpReplace,
+		Value:     *call,
+	}
+}
+
+func truncateRunes(s string, n int) (string, bool) {
+	if utf8.RuneCountInString(s) <= n {
+		return s, false
+	}
+	return string([]rune(s)[:n]), true
+}
+
+func (csh *CompletionStreamHandler) sendFinalEvents(streamer eventSender, convIDStr string, references []models.Chunk, usage *llm.Usage, reason string) error {
+	isComplete := reason == FinishReasonStop
+	finish := FinishDetails{Type: reason}
+	status := "finished_successfully"
+	if isComplete {
+		finish.StopTokens = []int{200002}
+	} else {
+		status = string(models.MessageStatusInterrupted)
+	}
+	metadata := map[string]any{
+		"finish_details": finish,
+		"is_complete":    &isComplete,
+	}
+	if len(references) > 0 {
+		metadata["content_references"] = NewContentReferences(references)
+	}
+	if usage != nil {
+		metadata["usage"] = usage
+	}
 	finalPatches := DeltaPayload{
 		Path:      "",
 		Operation: PatchOpPatch,
 		Value: []PatchOperation{
-			{Path: PathMessageStatus, Operation: PatchOpReplace, Value: "finished_successfully"},
+			{Path: PathMessageStatus, Operation: PatchOpReplace, Value: status},
 			{Path: PathMessageEndTurn, Operation: PatchOpReplace, Value: true},
-			{Path: PathMessageMetadata, Operation: PatchOpAppend, Value: map[string]any{
-				"finish_details": FinishDetails{Type: "stop", StopTokens: []int{200002}},
-				"is_complete":    &isComplete,
-			}},
+			{Path: PathMessageMetadata, Operation: PatchOpAppend, Value: metadata},
 		},
 	}
 	if err := streamer.Send(EventDelta, finalPatches); err != nil {
 		return err
 	}
 
-	completionData := CompletionData{Type: "message_stream_complete", ConversationID: convIDStr}
+	completionData := CompletionData{Type: "message_stream_complete", ConversationID: convIDStr, FinishReason: reason}
 	return streamer.Send(EventCompletion, completionData)
 }
 
-func (csh *CompletionStreamHandler) saveAssistantMessage(convID uuid.UUID, content, model string) error {
-	if content == "" {
-		csh.logger.Warn("Skipping save for empty assistant message", zap.String("conv_id", convID.String()))
-		return nil
-	}
-	assistantMessage := &models.CreateMessageRequest{
-		ConversationId: convID,
-		Role:           models.RoleAssistant,
-		Content:        content,
-		Model:          model,
+// saveAssistantMessage saves the turn below the user message: its tool calls,
+// each below the previous one so that history replays them in the order they
+// were made, then the answer. The answer is saved even when empty, as a turn
+// that was stopped or failed before any text still ran tools and used tokens.
+func (csh *CompletionStreamHandler) saveAssistantMessage(convID, userMsgID uuid.UUID, assistantMsgID, model string, status models.MessageStatus, reason string, result streamResult, references []models.Chunk) error {
+	messageID, err := uuid.Parse(assistantMsgID)
+	if err != nil {
+		return err
 	}
 	saveCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	if err := csh.ms.CreateMessage(saveCtx, assistantMessage); err != nil {
-		csh.logger.Error("Failed to save assistant message", zap.Error(err), zap.String("conv_id", convID.String()))
+
+	chain := make([]models.CreateMessageRequest, 0, len(result.toolCalls)+1)
+	parentID := userMsgID
+	for _, tc := range result.toolCalls {
+		parent := parentID
+		toolMessage := models.CreateMessageRequest{
+			MessageId:       uuid.New(),
+			ConversationId:  convID,
+			ParentMessageId: &parent,
+			Role:            models.RoleTool,
+			Content:         tc.Result,
+			Model:           model,
+			ToolCall: &models.ToolCall{
+				Id:   tc.ID,
+				Name: tc.Name,
+				Args: tc.Args,
+			},
+		}
+		chain = append(chain, toolMessage)
+		parentID = toolMessage.MessageId
+	}
+
+	assistantMessage := models.CreateMessageRequest{
+		MessageId:       messageID,
+		ConversationId:  convID,
+		ParentMessageId: &parentID,
+		Role:            models.RoleAssistant,
+		Content:         result.content,
+		Model:           model,
+		Status:          status,
+		Metadata:        models.JSONB{"finish_reason": reason},
+	}
+	if u := result.usage; u != nil {
+		assistantMessage.TokensUsed = &u.TotalTokens
+		assistantMessage.PromptTokens = &u.PromptTokens
+		assistantMessage.CompletionTokens = &u.CompletionTokens
+	}
+	chain = append(chain, assistantMessage)
+
+	// One transaction, so a failed insert cannot leave the conversation's
+	// active message on a tool call with no answer below it.
+	if err := csh.ms.CreateMessages(saveCtx, chain); err != nil {
+		csh.logger.Error("Failed to save assistant message", zap.Error(err),
+			zap.String("conv_id", convID.String()),
+			zap.Int("tool_calls", len(result.toolCalls)))
 		return err
 	}
+
+	refs := make([]models.MessageReference, 0, len(references))
+	for _, chunk := range references {
+		refs = append(refs, models.MessageReference{
+			MessageId:      messageID,
+			ChunkId:        chunk.ChunkId,
+			RelevanceScore: chunk.Similarity,
+		})
+	}
+	if err := csh.ms.CreateMessageReferences(saveCtx, refs); err != nil {
+		// The answer itself is saved; losing its references should not fail the turn.
+		csh.logger.Error("Failed to save message references", zap.Error(err), zap.String("message_id", assistantMsgID))
+	}
 	return nil
 }
 
-func (csh *CompletionStreamHandler) handleLLMError(streamer *SSEStreamer, llmErr error) {
+func (csh *CompletionStreamHandler) handleLLMError(streamer eventSender, llmErr error) {
 	csh.logger.Error("LLM stream returned an error", zap.Error(llmErr))
 	errorType := "generation_error"
 	errorMessage := "The model failed to generate a response."
@@ -170,7 +375,7 @@ func (csh *CompletionStreamHandler) handleLLMError(streamer *SSEStreamer, llmErr
 	csh.sendStreamError(streamer, errorType, errorMessage, details)
 }
 
-func (csh *CompletionStreamHandler) sendStreamError(streamer *SSEStreamer, errType, message string, details map[string]any) {
+func (csh *CompletionStreamHandler) sendStreamError(streamer eventSender, errType, message string, details map[string]any) {
 	payload := ErrorDetails{
 		Type:    errType,
 		Message: message,
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/llm"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/service"
+	"go.uber.org/zap"
+)
+
+// recordingMessages records the chains saved through CreateMessages.
+type recordingMessages struct {
+	service.MessageService
+	chains [][]models.CreateMessageRequest
+}
+
+func (m *recordingMessages) CreateMessages(_ context.Context, msgs []models.CreateMessageRequest) error {
+	m.chains = append(m.chains, msgs)
+	return nil
+}
+
+func (m *recordingMessages) CreateMessageReferences(context.Context, []models.MessageReference) error {
+	return nil
+}
+
+func TestSaveAssistantMessageKeepsEmptyTurn(t *testing.T) {
+	ms := &recordingMessages{}
+	csh := NewCompletionStreamHandler(ms, nil, zap.NewNop(), nil, 0)
+
+	convID, userMsgID, assistantID := uuid.New(), uuid.New(), uuid.New()
+	// stopped after a tool ran, before the model wrote anything
+	result := streamResult{
+		toolCalls: []llm.ToolInfo{{ID: "call_1", Name: "web_search", Status: llm.StatusEnd, Result: "results"}},
+		usage:     &llm.Usage{PromptTokens: 120, CompletionTokens: 8, TotalTokens: 128},
+	}
+	err := csh.saveAssistantMessage(convID, userMsgID, assistantID.String(), "test-model",
+		models.MessageStatusInterrupted, FinishReasonUserStopped, result, nil)
+	if err != nil {
+		t.Fatalf("saveAssistantMessage: %v", err)
+	}
+
+	if len(ms.chains) != 1 {
+		t.Fatalf("saved %d chains, want one", len(ms.chains))
+	}
+	chain := ms.chains[0]
+	if len(chain) != 2 {
+		t.Fatalf("chain has %d messages, want the tool call and the answer", len(chain))
+	}
+
+	tool, answer := chain[0], chain[1]
+	if tool.Role != models.RoleTool || *tool.ParentMessageId != userMsgID {
+		t.Errorf("tool message = %s below %s, want tool below the user message", tool.Role, tool.ParentMessageId)
+	}
+	if answer.MessageId != assistantID || *answer.ParentMessageId != tool.MessageId {
+		t.Errorf("answer %s below %s, want %s below the tool message", answer.MessageId, answer.ParentMessageId, assistantID)
+	}
+	if answer.Content != "" || answer.Status != models.MessageStatusInterrupted {
+		t.Errorf("answer = {%q, %s}, want an empty interrupted message", answer.Content, answer.Status)
+	}
+	if answer.Metadata["finish_reason"] != FinishReasonUserStopped {
+		t.Errorf("finish_reason = %v, want %s", answer.Metadata["finish_reason"], FinishReasonUserStopped)
+	}
+	if answer.TokensUsed == nil || *answer.TokensUsed != 128 {
+		t.Errorf("tokens used = %v, want 128", answer.TokensUsed)
+	}
+}
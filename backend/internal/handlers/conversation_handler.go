@@ -14,12 +14,14 @@ import (
 
 type ConversationHandler struct {
 	cs     service.ConversationService
+	authz  service.Authorizer
 	logger *zap.Logger
 }
 
-func NewConversationService(cservice service.ConversationService, logger *zap.Logger) *ConversationHandler {
+func NewConversationService(cservice service.ConversationService, authz service.Authorizer, logger *zap.Logger) *ConversationHandler {
 	return &ConversationHandler{
 		cs:     cservice,
+		authz:  authz,
 		logger: logger,
 	}
 }
@@ -74,6 +76,11 @@ func (h *ConversationHandler) CreateConversationHandler(w http.ResponseWriter, r
 		return
 	}
 
+	if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, req.SpaceId.String(), models.SpaceRoleViewer); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
 	conv := models.Conversation{
 		SpaceId: req.SpaceId,
 		UserId:  userId,
@@ -91,6 +98,11 @@ func (h *ConversationHandler) CreateConversationHandler(w http.ResponseWriter, r
 }
 
 func (h *ConversationHandler) GetConversationHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	convId := r.FormValue("conv_id")
 	if convId == "" {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
@@ -102,7 +114,7 @@ func (h *ConversationHandler) GetConversationHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	conv, err := h.cs.GetConversation(r.Context(), convId)
+	conv, err := h.authz.AuthorizeConversation(r.Context(), claims.UserId, convId)
 	if err != nil {
 		utils.HandleError(w, h.logger, err)
 		return
@@ -112,6 +124,11 @@ func (h *ConversationHandler) GetConversationHandler(w http.ResponseWriter, r *h
 }
 
 func (h *ConversationHandler) UpdateConversationTitleHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	convId := r.FormValue("conv_id")
 	if convId == "" {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
@@ -134,6 +151,11 @@ func (h *ConversationHandler) UpdateConversationTitleHandler(w http.ResponseWrit
 		return
 	}
 
+	if _, err := h.authz.AuthorizeConversation(r.Context(), claims.UserId, convId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
 	err := h.cs.UpdateConversationTitle(r.Context(), convId, title)
 	if err != nil {
 		utils.HandleError(w, h.logger, err)
@@ -144,6 +166,11 @@ func (h *ConversationHandler) UpdateConversationTitleHandler(w http.ResponseWrit
 }
 
 func (h *ConversationHandler) UpdateConversationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	convId := r.FormValue("conv_id")
 	if convId == "" {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
@@ -178,6 +205,11 @@ func (h *ConversationHandler) UpdateConversationStatusHandler(w http.ResponseWri
 
 	}
 
+	if _, err := h.authz.AuthorizeConversation(r.Context(), claims.UserId, convId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
 	err := h.cs.UpdateConversationStatus(r.Context(), convId, status)
 	if err != nil {
 		utils.HandleError(w, h.logger, err)
@@ -188,6 +220,11 @@ func (h *ConversationHandler) UpdateConversationStatusHandler(w http.ResponseWri
 }
 
 func (h *ConversationHandler) DeleteConversationHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	convId := r.FormValue("conv_id")
 	if convId == "" {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
@@ -199,6 +236,11 @@ func (h *ConversationHandler) DeleteConversationHandler(w http.ResponseWriter, r
 		return
 	}
 
+	if _, err := h.authz.AuthorizeConversation(r.Context(), claims.UserId, convId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
 	err := h.cs.DeleteConversation(r.Context(), convId)
 	if err != nil {
 		utils.HandleError(w, h.logger, err)
@@ -209,6 +251,11 @@ func (h *ConversationHandler) DeleteConversationHandler(w http.ResponseWriter, r
 }
 
 func (h *ConversationHandler) ListConversationsForSpaceHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	spaceId := r.FormValue("space_id")
 	if spaceId == "" {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
@@ -220,7 +267,12 @@ func (h *ConversationHandler) ListConversationsForSpaceHandler(w http.ResponseWr
 		return
 	}
 
-	convList, err := h.cs.ListConversationsForSpace(r.Context(), spaceId)
+	if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, spaceId, models.SpaceRoleViewer); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	convList, err := h.cs.ListConversationsForSpace(r.Context(), claims.UserId, spaceId)
 	if err != nil {
 		utils.HandleError(w, h.logger, err)
 		return
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/synntx/askmind/internal/utils"
+)
+
+// generationReplayWindow is how long the events of a finished answer stay
+// available to clients reconnecting after it ended.
+const generationReplayWindow = 2 * time.Minute
+
+// Causes with which a job's context ends early, see context.Cause.
+var (
+	errGenerationStopped  = errors.New("generation stopped by the user")
+	errGenerationTimedOut = errors.New("generation timed out")
+)
+
+// eventSender is anything a completion can write its events to.
+type eventSender interface {
+	Send(event string, payload any) error
+}
+
+type bufferedEvent struct {
+	id    int
+	event string
+	data  []byte
+}
+
+// generationJob is one answer being generated on the server. Its events are
+// numbered from 1 and buffered, so any number of clients can follow it, each
+// starting after the last event it has seen, and the answer is finished and
+// saved even if every client goes away.
+type generationJob struct {
+	ctx       context.Context
+	convId    string
+	messageId string
+	userId    string
+
+	mu      sync.Mutex
+	events  []bufferedEvent
+	done    bool
+	updated chan struct{} // closed and replaced whenever an event is added or the job ends
+	ended   chan struct{} // closed once the answer is saved and the job is over
+	cancel  context.CancelCauseFunc
+}
+
+// Send buffers an event under the next sequence number. Delta payloads carry
+// the number in their Counter as well.
+func (j *generationJob) Send(event string, payload any) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	id := len(j.events) + 1
+	if delta, ok := payload.(DeltaPayload); ok {
+		delta.Counter = id
+		payload = delta
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	j.events = append(j.events, bufferedEvent{id: id, event: event, data: data})
+	j.notify()
+	return nil
+}
+
+func (j *generationJob) finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.done = true
+	j.notify()
+	j.cancel(nil)
+	close(j.ended)
+}
+
+// stop cancels the generation; what was generated so far is still saved.
+func (j *generationJob) stop() {
+	j.cancel(errGenerationStopped)
+}
+
+// wait blocks until the job is over or ctx is done.
+func (j *generationJob) wait(ctx context.Context) error {
+	select {
+	case <-j.ended:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (j *generationJob) notify() {
+	close(j.updated)
+	j.updated = make(chan struct{})
+}
+
+func (j *generationJob) running() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return !j.done
+}
+
+// eventsAfter returns the events numbered above after, whether the job has
+// ended and a channel that is closed on the next change.
+func (j *generationJob) eventsAfter(after int) ([]bufferedEvent, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if after < 0 {
+		after = 0
+	}
+	if after > len(j.events) {
+		after = len(j.events)
+	}
+	return j.events[after:], j.done, j.updated
+}
+
+// follow writes the events after lastEventID to streamer, then every new one
+// until the job ends or ctx, the client's request, is done.
+func (j *generationJob) follow(ctx context.Context, streamer *SSEStreamer, lastEventID int) error {
+	for {
+		events, done, updated := j.eventsAfter(lastEventID)
+		for _, e := range events {
+			if err := streamer.SendWithID(strconv.Itoa(e.id), e.event, e.data); err != nil {
+				return err
+			}
+			lastEventID = e.id
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-updated:
+		}
+	}
+}
+
+// generationJobs holds the running answers, and recently finished ones, by
+// conversation. A conversation has at most one answer running at a time.
+type generationJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*generationJob
+}
+
+func newGenerationJobs() *generationJobs {
+	return &generationJobs{jobs: make(map[string]*generationJob)}
+}
+
+// reserve registers a job for the conversation, failing while another one
+// is running. Nothing should be saved for an answer before its job is
+// reserved: of two concurrent requests, the second is then turned away with
+// nothing to clean up. The job runs on a context that outlives the request,
+// bounded by timeout; the caller either runs it or releases it.
+func (g *generationJobs) reserve(ctx context.Context, timeout time.Duration, userId, convId, messageId string) (*generationJob, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if existing, ok := g.jobs[convId]; ok && existing.running() {
+		return nil, utils.ErrGenerationRunning.Wrap(
+			fmt.Errorf("conversation %s: answer %s still running", convId, existing.messageId),
+		)
+	}
+
+	jobCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	jobCtx, cancelTimeout := context.WithTimeoutCause(jobCtx, timeout, errGenerationTimedOut)
+	job := &generationJob{
+		ctx:       jobCtx,
+		convId:    convId,
+		messageId: messageId,
+		userId:    userId,
+		updated:   make(chan struct{}),
+		ended:     make(chan struct{}),
+		cancel: func(cause error) {
+			cancel(cause)
+			cancelTimeout()
+		},
+	}
+	g.jobs[convId] = job
+	return job, nil
+}
+
+// run generates the answer of a reserved job in the background.
+func (g *generationJobs) run(job *generationJob, generate func(ctx context.Context, job *generationJob)) {
+	go func() {
+		defer func() {
+			job.finish()
+			time.AfterFunc(generationReplayWindow, func() { g.remove(job) })
+		}()
+		generate(job.ctx, job)
+	}()
+}
+
+// release drops a reserved job that will not run.
+func (g *generationJobs) release(job *generationJob) {
+	job.finish()
+	g.remove(job)
+}
+
+// get returns the conversation's current or last job, if it is still kept.
+func (g *generationJobs) get(convId string) (*generationJob, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	job, ok := g.jobs[convId]
+	return job, ok
+}
+
+// getByMessage returns the job generating the given assistant message.
+func (g *generationJobs) getByMessage(messageId string) (*generationJob, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, job := range g.jobs {
+		if job.messageId == messageId {
+			return job, true
+		}
+	}
+	return nil, false
+}
+
+func (g *generationJobs) remove(job *generationJob) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.jobs[job.convId] == job {
+		delete(g.jobs, job.convId)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/synntx/askmind/internal/utils"
+)
+
+// Of two requests answering the same conversation at once, exactly one
+// reserves it, before either has saved anything.
+func TestGenerationJobsReserveOnce(t *testing.T) {
+	jobs := newGenerationJobs()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var reserved []*generationJob
+	var refused int
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job, err := jobs.reserve(context.Background(), time.Minute, "user", "conv", "answer")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				reserved = append(reserved, job)
+			case errors.Is(err, utils.ErrGenerationRunning):
+				refused++
+			default:
+				t.Errorf("reserve: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(reserved) != 1 || refused != 1 {
+		t.Fatalf("%d reserved and %d refused, want one of each", len(reserved), refused)
+	}
+
+	// released when the request fails before the answer runs
+	jobs.release(reserved[0])
+	if _, ok := jobs.get("conv"); ok {
+		t.Error("released job still kept")
+	}
+	job, err := jobs.reserve(context.Background(), time.Minute, "user", "conv", "answer")
+	if err != nil {
+		t.Fatalf("reserve after release: %v", err)
+	}
+
+	// run frees the conversation once the answer is generated
+	generated := make(chan struct{})
+	jobs.run(job, func(ctx context.Context, job *generationJob) {
+		close(generated)
+	})
+	<-generated
+	if err := job.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.reserve(context.Background(), time.Minute, "user", "conv", "next"); err != nil {
+		t.Errorf("reserve after the answer ended: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/service"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+type MemoryHandler struct {
+	ms     service.MemoryService
+	logger *zap.Logger
+}
+
+func NewMemoryHandler(ms service.MemoryService, logger *zap.Logger) *MemoryHandler {
+	return &MemoryHandler{
+		ms:     ms,
+		logger: logger,
+	}
+}
+
+// Routes: (prefix : `/memory`, the requesting user's memories only)
+// 1. /memory - POST (json: content)
+// 2. /memory/list - GET
+// 3. /memory/update?memory_id= - PUT (json: content)
+// 4. /memory/delete?memory_id= - DELETE
+// 5. /memory/clear - DELETE (every memory)
+
+func (h *MemoryHandler) CreateMemoryHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	var req models.MemoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(err))
+		return
+	}
+
+	memory, err := h.ms.CreateMemory(r.Context(), claims.UserId, &req)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusCreated, memory)
+}
+
+func (h *MemoryHandler) ListMemoriesHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	memories, err := h.ms.ListMemories(r.Context(), claims.UserId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, memories)
+}
+
+func (h *MemoryHandler) UpdateMemoryHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	memoryId, ok := h.requireMemoryId(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.MemoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(err))
+		return
+	}
+
+	memory, err := h.ms.UpdateMemory(r.Context(), claims.UserId, memoryId, &req)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, memory)
+}
+
+func (h *MemoryHandler) DeleteMemoryHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	memoryId, ok := h.requireMemoryId(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.ms.DeleteMemory(r.Context(), claims.UserId, memoryId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendNoContent(w)
+}
+
+func (h *MemoryHandler) ClearMemoriesHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	if err := h.ms.DeleteAllMemories(r.Context(), claims.UserId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	h.logger.Info("memories cleared",
+		zap.String("user_id", claims.UserId),
+		zap.String("event", "memories_cleared"),
+	)
+
+	utils.SendNoContent(w)
+}
+
+func (h *MemoryHandler) requireMemoryId(w http.ResponseWriter, r *http.Request) (string, bool) {
+	memoryId := r.FormValue("memory_id")
+	if memoryId == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter memory_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "memory_id",
+			Message: "'memory_id' is required",
+		}))
+		return "", false
+	}
+	return memoryId, true
+}
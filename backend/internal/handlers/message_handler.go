@@ -3,8 +3,10 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,18 +18,43 @@ import (
 	"go.uber.org/zap"
 )
 
+// number of source chunks injected into the prompt for each completion, unless
+// the space's settings say otherwise
+const retrievalTopK = 5
+
+// number of the user's memories injected into the prompt for each completion
+const memoryRecallLimit = 5
+
+// completionTimeout bounds one generated answer, whether or not a client is
+// still following it.
+const completionTimeout = 2 * time.Minute
+
 type MessageHandler struct {
 	ms         service.MessageService
 	cs         service.ConversationService
+	ss         service.SourceService
+	authz      service.Authorizer
+	memories   service.MemoryService
+	ps         service.PromptService
 	llmFactory llm.LLMFactory
+	history    service.HistoryBudgeter
+	us         service.UsageService
+	jobs       *generationJobs
 	logger     *zap.Logger
 }
 
-func NewMessageHandler(ms service.MessageService, cs service.ConversationService, logger *zap.Logger, llmFactory llm.LLMFactory) *MessageHandler {
+func NewMessageHandler(ms service.MessageService, cs service.ConversationService, ss service.SourceService, authz service.Authorizer, memories service.MemoryService, ps service.PromptService, history service.HistoryBudgeter, us service.UsageService, logger *zap.Logger, llmFactory llm.LLMFactory) *MessageHandler {
 	return &MessageHandler{
 		ms:         ms,
 		cs:         cs,
+		ss:         ss,
+		authz:      authz,
+		memories:   memories,
+		ps:         ps,
 		llmFactory: llmFactory,
+		history:    history,
+		us:         us,
+		jobs:       newGenerationJobs(),
 		logger:     logger,
 	}
 }
@@ -38,8 +65,19 @@ func NewMessageHandler(ms service.MessageService, cs service.ConversationService
 // 3. /msg/get - GET
 // 5. /msg/get/msgs - GET (GetConversationUserMessages)
 // 4. /msg/get/all-msgs - GET (GetConversationMessages)
+// 6. /msg/references - GET (sources an assistant message was grounded in)
+//
+// Completions: (prefix : `/c`)
+// 1. /c/completion - POST (SSE)
+// 2. /c/completion/resume - GET (SSE; conv_id, Last-Event-ID)
+// 3. /c/stop - POST (conv_id or msg_id)
 
 func (h *MessageHandler) CreateMessageHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	var msgReq models.CreateMessageRequest
 	if err := json.NewDecoder(r.Body).Decode(&msgReq); err != nil {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(err))
@@ -48,6 +86,11 @@ func (h *MessageHandler) CreateMessageHandler(w http.ResponseWriter, r *http.Req
 
 	// TODO: Validate msgReq fields
 
+	if _, err := h.authz.AuthorizeConversation(r.Context(), claims.UserId, msgReq.ConversationId.String()); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
 	if err := h.ms.CreateMessage(r.Context(), &msgReq); err != nil {
 		utils.HandleError(w, h.logger, err)
 		return
@@ -57,6 +100,11 @@ func (h *MessageHandler) CreateMessageHandler(w http.ResponseWriter, r *http.Req
 }
 
 func (h *MessageHandler) CreateMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	var msgsReq []models.CreateMessageRequest
 	if err := json.NewDecoder(r.Body).Decode(&msgsReq); err != nil {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(err))
@@ -65,6 +113,18 @@ func (h *MessageHandler) CreateMessagesHandler(w http.ResponseWriter, r *http.Re
 
 	// TODO: Validate msgsReq fields
 
+	authorized := make(map[uuid.UUID]bool)
+	for _, msg := range msgsReq {
+		if authorized[msg.ConversationId] {
+			continue
+		}
+		if _, err := h.authz.AuthorizeConversation(r.Context(), claims.UserId, msg.ConversationId.String()); err != nil {
+			utils.HandleError(w, h.logger, err)
+			return
+		}
+		authorized[msg.ConversationId] = true
+	}
+
 	if err := h.ms.CreateMessages(r.Context(), msgsReq); err != nil {
 		utils.HandleError(w, h.logger, err)
 		return
@@ -74,6 +134,11 @@ func (h *MessageHandler) CreateMessagesHandler(w http.ResponseWriter, r *http.Re
 }
 
 func (h *MessageHandler) GetMessageHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	msgId := r.FormValue("msg_id")
 	if msgId == "" {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
@@ -85,7 +150,7 @@ func (h *MessageHandler) GetMessageHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	msg, err := h.ms.GetMessage(r.Context(), msgId)
+	msg, err := h.authz.AuthorizeMessage(r.Context(), claims.UserId, msgId)
 	if err != nil {
 		utils.HandleError(w, h.logger, err)
 		return
@@ -95,6 +160,11 @@ func (h *MessageHandler) GetMessageHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (h *MessageHandler) GetConvMessageHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	convId := r.FormValue("conv_id")
 	if convId == "" {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
@@ -106,6 +176,11 @@ func (h *MessageHandler) GetConvMessageHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if _, err := h.authz.AuthorizeConversation(r.Context(), claims.UserId, convId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
 	msgs, err := h.ms.GetConversationMessages(r.Context(), convId)
 	if err != nil {
 		utils.HandleError(w, h.logger, err)
@@ -116,6 +191,11 @@ func (h *MessageHandler) GetConvMessageHandler(w http.ResponseWriter, r *http.Re
 }
 
 func (h *MessageHandler) GetConvUserMessageHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	convId := r.FormValue("conv_id")
 	if convId == "" {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
@@ -127,6 +207,11 @@ func (h *MessageHandler) GetConvUserMessageHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
+	if _, err := h.authz.AuthorizeConversation(r.Context(), claims.UserId, convId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
 	msgs, err := h.ms.GetConversationUserMessages(r.Context(), convId)
 	if err != nil {
 		utils.HandleError(w, h.logger, err)
@@ -136,21 +221,66 @@ func (h *MessageHandler) GetConvUserMessageHandler(w http.ResponseWriter, r *htt
 	utils.SendResponse(w, http.StatusOK, msgs)
 }
 
-func (h *MessageHandler) ListPromptsHandler(w http.ResponseWriter, r *http.Request) {
-	// _ = json.NewEncoder(w).Encode(prompts.List())
-	utils.SendResponse(w, http.StatusOK, prompts.List())
+func (h *MessageHandler) GetMessageReferencesHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	msgId := r.FormValue("msg_id")
+	if msgId == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter msg_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "msg_id",
+			Message: "msg_id is required",
+		}))
+		return
+	}
+
+	if _, err := h.authz.AuthorizeMessage(r.Context(), claims.UserId, msgId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	refs, err := h.ms.GetMessageReferences(r.Context(), msgId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, refs)
 }
 
-func (h *MessageHandler) CompletionHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
-	defer cancel()
+// ListPromptsHandler lists the names system_prompt can take: the built-in
+// prompts, the user's templates and, given space_id, the space's.
+func (h *MessageHandler) ListPromptsHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
 
-	params, err := utils.ExtractCompletionRequestParams(r)
+	spaceId := r.FormValue("space_id")
+	if spaceId != "" {
+		if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, spaceId, models.SpaceRoleViewer); err != nil {
+			utils.HandleError(w, h.logger, err)
+			return
+		}
+	}
+
+	names, err := h.ps.ListPromptNames(r.Context(), claims.UserId, spaceId)
 	if err != nil {
 		utils.HandleError(w, h.logger, err)
 		return
 	}
 
+	utils.SendResponse(w, http.StatusOK, names)
+}
+
+func (h *MessageHandler) CompletionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), completionTimeout)
+	defer cancel()
+
 	claims, ok := r.Context().Value(utils.ClaimsKey).(*utils.Claims)
 	if !ok || claims == nil {
 		utils.HandleError(w, h.logger, utils.ErrUnauthorized.Wrap(
@@ -159,12 +289,42 @@ func (h *MessageHandler) CompletionHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	params, err := utils.ExtractCompletionRequestParams(r, func(spaceID uuid.UUID) (*models.SpaceSettings, error) {
+		space, err := h.authz.AuthorizeSpace(ctx, claims.UserId, spaceID.String(), models.SpaceRoleViewer)
+		if err != nil {
+			return nil, err
+		}
+		return &space.Settings, nil
+	})
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
 	userId, err := uuid.Parse(claims.UserId)
 	if err != nil {
 		utils.HandleError(w, h.logger, utils.ErrUnauthorized.Wrap(err))
 		return
 	}
 
+	if err := h.authorizeCompletion(ctx, claims.UserId, params); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	modelInfo, err := h.validateModel(ctx, params.Provider, params.Model)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	if !params.IsNewConv {
+		if err := h.checkNotGenerating(params.ConvID.String()); err != nil {
+			utils.HandleError(w, h.logger, err)
+			return
+		}
+	}
+
 	var conversation *models.Conversation
 	if params.IsNewConv {
 		conv := models.Conversation{
@@ -195,15 +355,66 @@ func (h *MessageHandler) CompletionHandler(w http.ResponseWriter, r *http.Reques
 		conversationIdToUse = params.ConvID
 	}
 
+	llmInstance, references, err := h.completionLLM(ctx, claims.UserId, params.SpaceID.String(), params.UserMessage, params.GenerationParams)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	job, err := h.reserveAnswer(r, claims.UserId, conversationIdToUse)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+	// continues the conversation's active branch
+	userMsg, err := h.saveUserMessage(ctx, conversationIdToUse, nil, params.UserMessage, params.Model)
+	if err != nil {
+		h.jobs.release(job)
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	h.streamAnswer(w, r, job, userMsg, llmInstance, references, params.Model, params.Provider, modelInfo.Capabilities.ContextWindow)
+}
+
+// reserveAnswer reserves the conversation for a new answer, before anything
+// is saved for it; see generationJobs.reserve.
+func (h *MessageHandler) reserveAnswer(r *http.Request, userId string, convId uuid.UUID) (*generationJob, error) {
+	return h.jobs.reserve(r.Context(), completionTimeout, userId, convId.String(), uuid.NewString())
+}
+
+// checkNotGenerating fails while an answer is still running in the
+// conversation: two answers at once would grow the same branch. It only
+// turns requests away early, before any work is done for them; the
+// conversation is held by reserveAnswer.
+func (h *MessageHandler) checkNotGenerating(convId string) error {
+	if job, ok := h.jobs.get(convId); ok && job.running() {
+		return utils.ErrGenerationRunning.Wrap(
+			fmt.Errorf("conversation %s: answer %s still running", convId, job.messageId),
+		)
+	}
+	return nil
+}
+
+// completionLLM retrieves the space's sources and the user's memories for
+// userMessage and creates the LLM that answers it, its system prompt, one of
+// the user's or the space's templates or a built-in prompt, rendered around
+// them.
+func (h *MessageHandler) completionLLM(ctx context.Context, userId, spaceId, userMessage string, params utils.GenerationParams) (llm.LLM, []models.Chunk, error) {
 	promptName := params.SystemPrompt
 	if promptName == "" {
 		promptName = "general"
 	}
 
-	sysPrompt, err := prompts.Render(promptName, prompts.Data{Now: time.Now()})
+	references := retrieveSources(ctx, h.ss, h.logger, spaceId, userMessage, params.RetrievalTopK)
+
+	sysPrompt, err := h.ps.Render(ctx, userId, spaceId, promptName, prompts.Data{
+		Now:      time.Now(),
+		Sources:  promptSources(references),
+		Memories: h.recallMemories(ctx, userId, userMessage),
+	})
 	if err != nil {
-		utils.HandleError(w, h.logger, err)
-		return
+		return nil, nil, err
 	}
 
 	llmInstance, err := h.llmFactory.CreateLLM(ctx, llm.ProviderType(params.Provider), params.Model)
@@ -211,40 +422,298 @@ func (h *MessageHandler) CompletionHandler(w http.ResponseWriter, r *http.Reques
 		h.logger.Error("Failed to create LLM instance", zap.Error(err),
 			zap.String("provider", params.Provider),
 			zap.String("model", params.Model))
-		// FIX:
-		// utils.HandleError(w, h.logger, utils.ErrInternal.Wrap(err).WithDetails(map[string]any{
-		// 	"provider": params.Provider,
-		// 	"model":    params.Model,
-		// }))
-		return
+		return nil, nil, utils.ErrLLMServiceUnavailable.Wrap(err)
 	}
 
 	// set system prompt
 	llmInstance.SetSystemPrompt(sysPrompt)
+	llmInstance.SetOptions(llm.Options{
+		Temperature:     params.Temperature,
+		MaxOutputTokens: params.MaxOutputTokens,
+		Tools:           params.Tools,
+	})
+	return llmInstance, references, nil
+}
 
+// recallMemories returns what is remembered about the user that relates to
+// userMessage. Like retrieval it is best effort.
+func (h *MessageHandler) recallMemories(ctx context.Context, userId, userMessage string) []string {
+	memories, err := h.memories.RecallMemories(ctx, userId, userMessage, memoryRecallLimit)
+	if err != nil {
+		h.logger.Warn("Memory recall failed, continuing without memories",
+			zap.Error(err),
+			zap.String("user_id", userId))
+		return nil
+	}
+	facts := make([]string, len(memories))
+	for i, memory := range memories {
+		facts[i] = memory.Content
+	}
+	return facts
+}
+
+// saveUserMessage saves a user message below parent, see
+// models.CreateMessageRequest.ParentMessageId.
+func (h *MessageHandler) saveUserMessage(ctx context.Context, convId uuid.UUID, parent *uuid.UUID, content, model string) (*models.ChatMessage, error) {
 	userMsg := &models.CreateMessageRequest{
-		ConversationId: conversationIdToUse,
-		Role:           models.RoleUser,
-		Content:        params.UserMessage,
-		Model:          params.Model,
+		ConversationId:  convId,
+		ParentMessageId: parent,
+		Role:            models.RoleUser,
+		Content:         content,
+		Model:           model,
+	}
+	if err := h.ms.CreateMessage(ctx, userMsg); err != nil {
+		return nil, err
+	}
+	return &models.ChatMessage{
+		MessageId:       userMsg.MessageId,
+		ConversationId:  convId,
+		ParentMessageId: userMsg.ParentMessageId,
+		Role:            models.RoleUser,
+		Content:         content,
+		Model:           model,
+		Status:          models.MessageStatusCompleted,
+	}, nil
+}
+
+// streamAnswer runs job, reserved with reserveAnswer, to generate the answer
+// to userMsg and streams it to the client. The answer is finished and saved
+// even if this request goes away; the client can pick it up again with
+// /c/completion/resume. contextWindow is the model's, 0 if unknown; the
+// history sent along is fitted into it. Once the answer is complete, the
+// facts about the user revealed by the latest exchanges may be remembered;
+// see service.MemoryService.ExtractMemories.
+func (h *MessageHandler) streamAnswer(w http.ResponseWriter, r *http.Request, job *generationJob, userMsg *models.ChatMessage, llmInstance llm.LLM, references []models.Chunk, model, provider string, contextWindow int) {
+	convId := userMsg.ConversationId
+	convIdStr := convId.String()
+	assistantMessageID := job.messageId
+	completionStreamHandler := NewCompletionStreamHandler(h.ms, h.history, h.logger, llmInstance, contextWindow)
+	h.jobs.run(job, func(ctx context.Context, job *generationJob) {
+		err := completionStreamHandler.HandleCompletionStream(ctx, convId, assistantMessageID, userMsg, model, provider, references, job)
+		if err != nil && err != context.Canceled && err != context.DeadlineExceeded {
+			// note: the error event has already been sent to the client within HandleCompletionStream.
+			h.logger.Error("error handling completion stream", zap.Error(err), zap.String("conv_id", convIdStr))
+		}
+		if err == nil {
+			h.memories.ExtractMemories(job.userId, assistantMessageID, llm.ProviderType(provider), model)
+		}
+	})
+
+	streamer, err := NewSSEStreamer(w, h.logger)
+	if err != nil {
+		utils.HandleError(w, h.logger, utils.ErrSSEStreamInitFailed.Wrap(err))
+		return
+	}
+
+	if err := job.follow(r.Context(), streamer, 0); err != nil {
+		h.logger.Info("Client stopped following completion", zap.Error(err), zap.String("conv_id", convIdStr))
+	}
+}
+
+// ResumeCompletionHandler replays the events of the conversation's running,
+// or just finished, answer that came after the client's Last-Event-ID, then
+// follows the answer live until it ends.
+func (h *MessageHandler) ResumeCompletionHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
 	}
 
-	if err = h.ms.CreateMessage(ctx, userMsg); err != nil {
+	convId := r.FormValue("conv_id")
+	if convId == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter conv_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "conv_id",
+			Message: "conv_id is required",
+		}))
+		return
+	}
+
+	lastEventID, err := lastEventID(r)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	if _, err := h.authz.AuthorizeConversation(r.Context(), claims.UserId, convId); err != nil {
 		utils.HandleError(w, h.logger, err)
 		return
 	}
 
+	job, ok := h.jobs.get(convId)
+	if !ok {
+		utils.HandleError(w, h.logger, utils.ErrNotFound.Wrap(
+			fmt.Errorf("conversation %s: no answer to resume", convId),
+		))
+		return
+	}
+
 	streamer, err := NewSSEStreamer(w, h.logger)
 	if err != nil {
 		utils.HandleError(w, h.logger, utils.ErrSSEStreamInitFailed.Wrap(err))
 		return
 	}
 
-	completionStreamHandler := NewCompletionStreamHandler(h.ms, h.logger, llmInstance)
-	err = completionStreamHandler.HandleCompletionStream(ctx, conversationIdToUse, params.UserMessage, params.Model, params.Provider, streamer)
-	if err != nil && err != context.Canceled && err != context.DeadlineExceeded {
-		// note: If HandleCompletionStream returns an error (that's not context cancellation/timeout), it means something went wrong internally in streaming logic,
-		// but error event to client should already be sent within HandleCompletionStream.
-		h.logger.Error("error handling completion stream", zap.Error(err), zap.String("conv_id", conversationIdToUse.String()))
+	if err := job.follow(r.Context(), streamer, lastEventID); err != nil {
+		h.logger.Info("Client stopped following completion", zap.Error(err), zap.String("conv_id", convId))
+	}
+}
+
+// StopCompletionHandler stops the answer running in a conversation, found by
+// conv_id or by the msg_id of the answer. It returns once the
+// part generated so far is saved as an interrupted message; clients following
+// the answer receive its final events with finish_reason "user_stopped".
+func (h *MessageHandler) StopCompletionHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	var job *generationJob
+	var found bool
+	switch {
+	case r.FormValue("conv_id") != "":
+		job, found = h.jobs.get(r.FormValue("conv_id"))
+	case r.FormValue("msg_id") != "":
+		job, found = h.jobs.getByMessage(r.FormValue("msg_id"))
+	default:
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter conv_id or msg_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "conv_id",
+			Message: "conv_id or msg_id is required",
+		}))
+		return
+	}
+
+	if found {
+		if _, err := h.authz.AuthorizeConversation(r.Context(), claims.UserId, job.convId); err != nil {
+			utils.HandleError(w, h.logger, err)
+			return
+		}
+	}
+	if !found || !job.running() {
+		utils.HandleError(w, h.logger, utils.ErrNotFound.Wrap(
+			fmt.Errorf("no answer running for %s", r.URL.RawQuery),
+		))
+		return
+	}
+
+	job.stop()
+	if err := job.wait(r.Context()); err != nil {
+		utils.HandleError(w, h.logger, utils.ErrInternal.Wrap(err))
+		return
+	}
+
+	h.logger.Info("Completion stopped by user",
+		zap.String("conv_id", job.convId),
+		zap.String("message_id", job.messageId))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lastEventID reads the id of the last event the client received. Browsers
+// send it as the Last-Event-ID header when an EventSource reconnects; a
+// reloaded page opening a new stream can pass it as last_event_id instead.
+func lastEventID(r *http.Request) (int, error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw == "" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id < 0 {
+		return 0, utils.ErrValidation.Wrap(
+			fmt.Errorf("invalid last event id %q", raw),
+		).WithDetails(utils.ValidationError{
+			Field:   "Last-Event-ID",
+			Message: "must be the id of an event received from this stream",
+		})
+	}
+	return id, nil
+}
+
+// authorizeCompletion checks, when continuing a conversation, that the
+// conversation is the user's and in the space, so sources of one space can
+// not be pulled into another's chat. The space itself was authorized when its
+// settings were read along with params.
+func (h *MessageHandler) authorizeCompletion(ctx context.Context, userId string, params *utils.CompletionRequestParams) error {
+	if params.IsNewConv {
+		return nil
+	}
+	conv, err := h.authz.AuthorizeConversation(ctx, userId, params.ConvID.String())
+	if err != nil {
+		return err
+	}
+	if conv.SpaceId != params.SpaceID {
+		return utils.ErrNotFound.Wrap(
+			fmt.Errorf("conversation %s is not in space %s", params.ConvID, params.SpaceID),
+		)
+	}
+	return nil
+}
+
+// validateModel checks the requested provider and model against the model
+// catalog before anything is written, so an unusable model fails the request
+// instead of the stream. It returns the model's catalog entry.
+func (h *MessageHandler) validateModel(ctx context.Context, provider, model string) (llm.ModelInfo, error) {
+	info, err := h.llmFactory.LookupModel(ctx, llm.ProviderType(provider), model)
+	switch {
+	case errors.Is(err, llm.ErrUnknownProvider):
+		return info, utils.ErrUnknownProvider.Wrap(err).WithDetails(utils.ValidationError{
+			Field:   "provider",
+			Message: fmt.Sprintf("provider %q is not configured", provider),
+		})
+	case errors.Is(err, llm.ErrUnknownModel):
+		return info, utils.ErrInvalidModel.Wrap(err).WithDetails(utils.ValidationError{
+			Field:   "model",
+			Message: fmt.Sprintf("model %q is not served by %s", model, provider),
+		})
+	case err != nil:
+		return info, utils.ErrLLMServiceUnavailable.Wrap(err)
+	case !info.Capabilities.Chat:
+		return info, utils.ErrUnsupportedModel.Wrap(
+			fmt.Errorf("model %q does not support chat", model),
+		).WithDetails(utils.ValidationError{
+			Field:   "model",
+			Message: fmt.Sprintf("model %q does not support chat", model),
+		})
+	}
+	return info, nil
+}
+
+// retrieveSources finds the topK, or retrievalTopK if 0, source chunks of the
+// space most relevant to the user message. Retrieval is best effort: if it
+// fails the completion still runs, just without grounding.
+func retrieveSources(ctx context.Context, ss service.SourceService, logger *zap.Logger, spaceId, userMessage string, topK int) []models.Chunk {
+	if topK == 0 {
+		topK = retrievalTopK
+	}
+	chunks, err := ss.SearchSpace(ctx, spaceId, userMessage, topK)
+	if err != nil {
+		logger.Warn("Source retrieval failed, continuing without context",
+			zap.Error(err),
+			zap.String("space_id", spaceId))
+		return nil
+	}
+	return chunks
+}
+
+func promptSources(chunks []models.Chunk) []prompts.Source {
+	sources := make([]prompts.Source, 0, len(chunks))
+	for i, chunk := range chunks {
+		source := prompts.Source{
+			Index:    i + 1,
+			Location: chunk.SourceLocation,
+			Section:  chunk.SectionTitle,
+			Text:     chunk.Text,
+		}
+		if chunk.PageNumber != nil {
+			source.Page = int(*chunk.PageNumber)
+		}
+		sources = append(sources, source)
 	}
+	return sources
 }
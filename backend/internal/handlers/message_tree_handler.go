@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/llm"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Conversations are trees of messages. Regenerating an answer or editing a
+// user message adds a sibling next to the original and makes its branch the
+// active one, which is what history and the conversation's messages follow.
+//
+// Routes:
+// 1. /c/regenerate - POST (SSE; msg_id of an assistant message, provider, model)
+// 2. /c/edit - POST (SSE; msg_id of a user message, user_message, provider, model)
+//
+// Like /c/completion, both fall back to the space's settings for the
+// provider, model and system_prompt a request leaves out.
+// 3. /msg/siblings - GET (msg_id; the message and its alternatives)
+// 4. /msg/branch - PUT (msg_id; make the branch through it the active one)
+
+// RegenerateHandler answers the user message an assistant message replied to
+// once more, as a new branch.
+func (h *MessageHandler) RegenerateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), completionTimeout)
+	defer cancel()
+
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	params, msg, conv, modelInfo, err := h.authorizeBranch(ctx, r, claims.UserId, models.RoleAssistant)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	// The answer may have used tools, saved between it and the user message.
+	path, err := h.ms.GetMessagePath(ctx, msg.MessageId.String())
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+	var userMsg *models.ChatMessage
+	for i := len(path) - 1; i >= 0 && userMsg == nil; i-- {
+		if path[i].Role == models.RoleUser {
+			userMsg = &path[i]
+		}
+	}
+	if userMsg == nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("message %s does not answer a user message", msg.MessageId),
+		).WithDetails(utils.ValidationError{
+			Field:   "msg_id",
+			Message: "the message does not answer a user message",
+		}))
+		return
+	}
+
+	llmInstance, references, err := h.completionLLM(ctx, claims.UserId, conv.SpaceId.String(), userMsg.Content, params.GenerationParams)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	job, err := h.reserveAnswer(r, claims.UserId, conv.ConversationId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+	// no user message is saved, so the request is counted on its own
+	h.recordRegeneration(ctx, claims.UserId, conv.ConversationId, params.Model)
+	h.streamAnswer(w, r, job, userMsg, llmInstance, references, params.Model, params.Provider, modelInfo.Capabilities.ContextWindow)
+}
+
+// recordRegeneration counts a regeneration as a request against the user's
+// daily quota, as the user message of a completion is. A failure is only
+// logged rather than turning the regeneration down.
+func (h *MessageHandler) recordRegeneration(ctx context.Context, userId string, convId uuid.UUID, model string) {
+	userUUID, err := uuid.Parse(userId)
+	if err == nil {
+		err = h.us.RecordUsage(ctx, &models.UsageRecord{
+			UserId:         userUUID,
+			ConversationId: &convId,
+			Kind:           models.UsageKindRegenerate,
+			Model:          model,
+		})
+	}
+	if err != nil {
+		h.logger.Error("Failed to record regeneration", zap.Error(err),
+			zap.String("user_id", userId), zap.String("conv_id", convId.String()))
+	}
+}
+
+// EditMessageHandler saves the new text of a user message next to the
+// original, as a new branch, and answers it.
+func (h *MessageHandler) EditMessageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), completionTimeout)
+	defer cancel()
+
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	params, msg, conv, modelInfo, err := h.authorizeBranch(ctx, r, claims.UserId, models.RoleUser)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	llmInstance, references, err := h.completionLLM(ctx, claims.UserId, conv.SpaceId.String(), params.UserMessage, params.GenerationParams)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	parent := msg.ParentMessageId
+	if parent == nil {
+		parent = &uuid.Nil // the first message: a new branch from the start
+	}
+	job, err := h.reserveAnswer(r, claims.UserId, conv.ConversationId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+	userMsg, err := h.saveUserMessage(ctx, conv.ConversationId, parent, params.UserMessage, params.Model)
+	if err != nil {
+		h.jobs.release(job)
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	h.streamAnswer(w, r, job, userMsg, llmInstance, references, params.Model, params.Provider, modelInfo.Capabilities.ContextWindow)
+}
+
+func (h *MessageHandler) GetMessageSiblingsHandler(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.requireMessage(w, r)
+	if !ok {
+		return
+	}
+
+	siblings, err := h.ms.GetMessageSiblings(r.Context(), msg.MessageId.String())
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, siblings)
+}
+
+// SwitchBranchHandler makes the branch through msg_id the active one, down to
+// its latest message, and returns the conversation's messages along it.
+func (h *MessageHandler) SwitchBranchHandler(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.requireMessage(w, r)
+	if !ok {
+		return
+	}
+
+	convId := msg.ConversationId.String()
+	if err := h.checkNotGenerating(convId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	if err := h.ms.SetActiveBranch(r.Context(), msg.MessageId.String()); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	msgs, err := h.ms.GetConversationUserMessages(r.Context(), convId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, msgs)
+}
+
+// authorizeBranch reads the parameters of a regenerate request, or of an
+// edit request when role is models.RoleUser, with the settings of the
+// conversation's space as defaults. It checks that the message is the
+// user's, has that role and that its conversation is idle, and validates the
+// model, returning its catalog entry.
+func (h *MessageHandler) authorizeBranch(ctx context.Context, r *http.Request, userId string, role models.Role) (*utils.BranchRequestParams, *models.ChatMessage, *models.Conversation, llm.ModelInfo, error) {
+	var msg *models.ChatMessage
+	var conv *models.Conversation
+	params, err := utils.ExtractBranchRequestParams(r, role == models.RoleUser, func(msgID uuid.UUID) (*models.SpaceSettings, error) {
+		var err error
+		msg, err = h.authz.AuthorizeMessage(ctx, userId, msgID.String())
+		if err != nil {
+			return nil, err
+		}
+		if msg.Role != role {
+			return nil, utils.ErrValidation.Wrap(
+				fmt.Errorf("message %s has role %s, want %s", msg.MessageId, msg.Role, role),
+			).WithDetails(utils.ValidationError{
+				Field:   "msg_id",
+				Message: fmt.Sprintf("msg_id must be a message of role %q", role),
+			})
+		}
+
+		conv, err = h.cs.GetConversation(ctx, msg.ConversationId.String())
+		if err != nil {
+			return nil, err
+		}
+		space, err := h.authz.AuthorizeSpace(ctx, userId, conv.SpaceId.String(), models.SpaceRoleViewer)
+		if err != nil {
+			return nil, err
+		}
+		return &space.Settings, nil
+	})
+	if err != nil {
+		return nil, nil, nil, llm.ModelInfo{}, err
+	}
+
+	info, err := h.validateModel(ctx, params.Provider, params.Model)
+	if err != nil {
+		return nil, nil, nil, llm.ModelInfo{}, err
+	}
+
+	if err := h.checkNotGenerating(conv.ConversationId.String()); err != nil {
+		return nil, nil, nil, llm.ModelInfo{}, err
+	}
+	return params, msg, conv, info, nil
+}
+
+// requireMessage reads msg_id and authorizes the message, handling the error
+// if either fails.
+func (h *MessageHandler) requireMessage(w http.ResponseWriter, r *http.Request) (*models.ChatMessage, bool) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return nil, false
+	}
+
+	msgId := r.FormValue("msg_id")
+	if msgId == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter msg_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "msg_id",
+			Message: "msg_id is required",
+		}))
+		return nil, false
+	}
+
+	msg, err := h.authz.AuthorizeMessage(r.Context(), claims.UserId, msgId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return nil, false
+	}
+	return msg, true
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/synntx/askmind/internal/llm"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+type ModelHandler struct {
+	llmFactory llm.LLMFactory
+	logger     *zap.Logger
+}
+
+func NewModelHandler(llmFactory llm.LLMFactory, logger *zap.Logger) *ModelHandler {
+	return &ModelHandler{llmFactory: llmFactory, logger: logger}
+}
+
+// Routes:
+// 1. /models - GET (configured providers, their models and capabilities)
+
+func (h *ModelHandler) ListModelsHandler(w http.ResponseWriter, r *http.Request) {
+	utils.SendResponse(w, http.StatusOK, h.llmFactory.ListModels(r.Context()))
+}
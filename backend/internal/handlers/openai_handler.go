@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/llm"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/processing"
+	"github.com/synntx/askmind/internal/prompts"
+	"github.com/synntx/askmind/internal/service"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+// OpenAIHandler serves a subset of the OpenAI API so existing clients and
+// SDKs can talk to AskMind. Completions run through the same LLMFactory, and
+// so the same tools, as /c/completion, but no conversation is stored: the
+// client sends the whole conversation every time, as it would to OpenAI.
+// Only the usage of each completion is recorded, for the usage endpoints and
+// the daily quota.
+type OpenAIHandler struct {
+	llmFactory llm.LLMFactory
+	ss         service.SourceService
+	us         service.UsageService
+	authz      service.Authorizer
+	logger     *zap.Logger
+}
+
+func NewOpenAIHandler(llmFactory llm.LLMFactory, ss service.SourceService, us service.UsageService, authz service.Authorizer, logger *zap.Logger) *OpenAIHandler {
+	return &OpenAIHandler{
+		llmFactory: llmFactory,
+		ss:         ss,
+		us:         us,
+		authz:      authz,
+		logger:     logger,
+	}
+}
+
+// Routes: (prefix : `/v1`, OpenAI-compatible)
+// 1. /v1/chat/completions - POST (json; model is "provider/model" or a bare model id)
+// 2. /v1/models - GET
+
+func (h *OpenAIHandler) ChatCompletionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	var req OpenAIChatRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		utils.HandleError(w, h.logger, openAIDecodeError(err))
+		return
+	}
+	options, err := h.openAIOptions(req)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	history, userMessage, systemPrompt, err := splitOpenAIMessages(req.Messages)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	provider, model, err := h.resolveModel(ctx, req.Model)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	if req.SpaceId != nil {
+		if _, err := h.authz.AuthorizeSpace(ctx, claims.UserId, req.SpaceId.String(), models.SpaceRoleViewer); err != nil {
+			utils.HandleError(w, h.logger, err)
+			return
+		}
+		references := retrieveSources(ctx, h.ss, h.logger, req.SpaceId.String(), userMessage, 0)
+		sources, err := prompts.RenderSources(prompts.Data{
+			Now:     time.Now(),
+			Sources: promptSources(references),
+		})
+		if err != nil {
+			utils.HandleError(w, h.logger, utils.ErrInternal.Wrap(err))
+			return
+		}
+		systemPrompt += sources
+	}
+
+	llmInstance, err := h.llmFactory.CreateLLM(ctx, provider, model)
+	if err != nil {
+		h.logger.Error("Failed to create LLM instance", zap.Error(err),
+			zap.String("provider", string(provider)),
+			zap.String("model", model))
+		utils.HandleError(w, h.logger, utils.ErrLLMServiceUnavailable.Wrap(err))
+		return
+	}
+	systemPrompt = strings.TrimSpace(systemPrompt)
+	llmInstance.SetSystemPrompt(systemPrompt)
+	llmInstance.SetOptions(options)
+
+	completion := openAICompletion{
+		id:      "chatcmpl-" + strings.ReplaceAll(uuid.NewString(), "-", ""),
+		created: time.Now().Unix(),
+		llm:     llmInstance,
+	}
+	chunks := llmInstance.GenerateContentStream(ctx, history, userMessage)
+
+	var answer string
+	var usage *llm.Usage
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		answer, usage = h.streamCompletion(ctx, w, completion, chunks, includeUsage)
+	} else {
+		answer, usage = h.sendCompletion(ctx, w, completion, chunks)
+	}
+
+	if usage == nil {
+		// the provider failed or was cut off before reporting usage
+		prompt := []string{systemPrompt, userMessage}
+		for _, msg := range history {
+			prompt = append(prompt, msg.Content)
+		}
+		usage = &llm.Usage{}
+		usage.Add(processing.EstimateTokens(strings.Join(prompt, "\n")), processing.EstimateTokens(answer))
+	}
+	// the client may be gone, the tokens are spent all the same
+	h.recordUsage(context.WithoutCancel(ctx), claims.UserId, llmInstance.GetModelName(), *usage)
+}
+
+// recordUsage counts a completion in the user's usage and daily quota. The
+// answer is already sent, so a failure is only logged.
+func (h *OpenAIHandler) recordUsage(ctx context.Context, userId, model string, usage llm.Usage) {
+	logger := h.logger.With(zap.String("user_id", userId), zap.String("model", model))
+	userUUID, err := uuid.Parse(userId)
+	if err != nil {
+		logger.Error("Failed to record OpenAI-compatible usage", zap.Error(err))
+		return
+	}
+	err = h.us.RecordUsage(ctx, &models.UsageRecord{
+		UserId:           userUUID,
+		Kind:             models.UsageKindAPI,
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	})
+	if err != nil {
+		logger.Error("Failed to record OpenAI-compatible usage", zap.Error(err))
+	}
+}
+
+// ListModelsHandler lists every chat model of the catalog as "provider/model".
+func (h *OpenAIHandler) ListModelsHandler(w http.ResponseWriter, r *http.Request) {
+	list := OpenAIModelList{Object: "list", Data: []OpenAIModel{}}
+	for _, provider := range h.llmFactory.ListModels(r.Context()) {
+		for _, model := range provider.Models {
+			if !model.Capabilities.Chat {
+				continue
+			}
+			list.Data = append(list.Data, OpenAIModel{
+				ID:      string(provider.Provider) + "/" + model.ID,
+				Object:  "model",
+				OwnedBy: string(provider.Provider),
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+type openAICompletion struct {
+	id      string
+	created int64
+	llm     llm.LLM
+}
+
+func (c openAICompletion) chunk(delta OpenAIChatResponseDelta, finishReason *string) OpenAIChatCompletionChunk {
+	return OpenAIChatCompletionChunk{
+		ID:      c.id,
+		Object:  "chat.completion.chunk",
+		Created: c.created,
+		Model:   c.llm.GetModelName(),
+		Choices: []OpenAIChunkChoice{{Delta: delta, FinishReason: finishReason}},
+	}
+}
+
+// streamCompletion relays the answer as chat.completion.chunk events ended
+// by "data: [DONE]". Tool calls run on the server and are not streamed. It
+// returns what was generated, all of it or up to the failure, and the usage
+// if the provider reported it.
+func (h *OpenAIHandler) streamCompletion(ctx context.Context, w http.ResponseWriter, c openAICompletion, chunks <-chan llm.ContentChunk, includeUsage bool) (string, *llm.Usage) {
+	streamer, err := NewSSEStreamer(w, h.logger)
+	if err != nil {
+		utils.HandleError(w, h.logger, utils.ErrSSEStreamInitFailed.Wrap(err))
+		return "", nil
+	}
+
+	var content strings.Builder
+	var usage *llm.Usage
+	if err := streamer.Send("", c.chunk(OpenAIChatResponseDelta{Role: "assistant"}, nil)); err != nil {
+		return "", nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.logger.Warn("OpenAI-compatible stream cancelled", zap.Error(ctx.Err()))
+			return content.String(), usage
+		case chunk, ok := <-chunks:
+			if !ok {
+				stop := "stop"
+				if err := streamer.Send("", c.chunk(OpenAIChatResponseDelta{}, &stop)); err != nil {
+					return content.String(), usage
+				}
+				if includeUsage && usage != nil {
+					final := c.chunk(OpenAIChatResponseDelta{}, nil)
+					final.Choices = []OpenAIChunkChoice{}
+					final.Usage = usage
+					if err := streamer.Send("", final); err != nil {
+						return content.String(), usage
+					}
+				}
+				streamer.SendRaw("", "[DONE]")
+				return content.String(), usage
+			}
+			if chunk.Err != nil {
+				h.logger.Error("LLM stream returned an error", zap.Error(chunk.Err))
+				streamer.Send("", openAIStreamError(chunk.Err))
+				return content.String(), usage
+			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			if chunk.Content == "" {
+				continue
+			}
+			content.WriteString(chunk.Content)
+			if err := streamer.Send("", c.chunk(OpenAIChatResponseDelta{Content: chunk.Content}, nil)); err != nil {
+				return content.String(), usage
+			}
+		}
+	}
+}
+
+// sendCompletion collects the whole answer into one chat.completion. Like
+// streamCompletion it returns what was generated and the reported usage.
+func (h *OpenAIHandler) sendCompletion(ctx context.Context, w http.ResponseWriter, c openAICompletion, chunks <-chan llm.ContentChunk) (string, *llm.Usage) {
+	var content strings.Builder
+	var usage *llm.Usage
+	for chunk := range chunks {
+		if chunk.Err != nil {
+			h.logger.Error("LLM stream returned an error", zap.Error(chunk.Err))
+			utils.HandleError(w, h.logger, llmAppError(chunk.Err))
+			return content.String(), usage
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		content.WriteString(chunk.Content)
+	}
+	if ctx.Err() != nil {
+		utils.HandleError(w, h.logger, utils.ErrLLMGenerationFailed.Wrap(ctx.Err()))
+		return content.String(), usage
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(OpenAIChatCompletion{
+		ID:      c.id,
+		Object:  "chat.completion",
+		Created: c.created,
+		Model:   c.llm.GetModelName(),
+		Choices: []OpenAIChatChoice{{
+			Message:      OpenAIChatResponseDelta{Role: "assistant", Content: content.String()},
+			FinishReason: "stop",
+		}},
+		Usage: usage,
+	})
+	return content.String(), usage
+}
+
+// openAIOptions checks the tuning fields of req and turns them into options
+// for the LLM.
+func (h *OpenAIHandler) openAIOptions(req OpenAIChatRequest) (llm.Options, error) {
+	invalid := func(field, message string) error {
+		return utils.ErrValidation.Wrap(fmt.Errorf("%s: %s", field, message)).WithDetails(utils.ValidationError{
+			Field:   field,
+			Message: message,
+		})
+	}
+
+	options := llm.Options{
+		Temperature:     req.Temperature,
+		MaxOutputTokens: req.MaxCompletionTokens,
+	}
+	if t := req.Temperature; t != nil && (*t < 0 || *t > 2) {
+		return llm.Options{}, invalid("temperature", "temperature must be between 0 and 2")
+	}
+	if req.MaxTokens < 0 || req.MaxCompletionTokens < 0 {
+		return llm.Options{}, invalid("max_completion_tokens", "max_completion_tokens can not be negative")
+	}
+	if options.MaxOutputTokens == 0 {
+		options.MaxOutputTokens = req.MaxTokens
+	}
+
+	if req.Tools != nil {
+		known := make(map[string]bool)
+		for _, tool := range h.llmFactory.ListTools() {
+			known[tool.Name()] = true
+		}
+		options.Tools = []string{}
+		for i, tool := range req.Tools {
+			if tool.Type != "function" {
+				return llm.Options{}, invalid(fmt.Sprintf("tools[%d].type", i), `type can only be "function"`)
+			}
+			if !known[tool.Function.Name] {
+				return llm.Options{}, invalid(fmt.Sprintf("tools[%d].function.name", i),
+					fmt.Sprintf("there is no server tool named %q; tools run by the client are not supported", tool.Function.Name))
+			}
+			options.Tools = append(options.Tools, tool.Function.Name)
+		}
+	}
+
+	switch req.ToolChoice {
+	case "", "auto":
+	case "none":
+		options.Tools = []string{}
+	default:
+		return llm.Options{}, invalid("tool_choice", `tool_choice can only be "auto" or "none"`)
+	}
+	return options, nil
+}
+
+// openAIDecodeError names the field a request can not be decoded for, in
+// particular the fields the facade does not support.
+func openAIDecodeError(err error) error {
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		return utils.ErrValidation.Wrap(err).WithDetails(utils.ValidationError{
+			Field:   field,
+			Message: fmt.Sprintf("%s is not supported", field),
+		})
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return utils.ErrValidation.Wrap(err).WithDetails(utils.ValidationError{
+			Field:   typeErr.Field,
+			Message: fmt.Sprintf("%s can not be a JSON %s", typeErr.Field, typeErr.Value),
+		})
+	}
+	return utils.ErrValidation.Wrap(err)
+}
+
+// resolveModel accepts "provider/model" or a bare model id, which is looked
+// up across every configured provider.
+func (h *OpenAIHandler) resolveModel(ctx context.Context, name string) (llm.ProviderType, string, error) {
+	invalid := func(err error) error {
+		return utils.ErrInvalidModel.Wrap(err).WithDetails(utils.ValidationError{
+			Field:   "model",
+			Message: fmt.Sprintf("model %q is not available; see /v1/models", name),
+		})
+	}
+	if name == "" {
+		return "", "", invalid(fmt.Errorf("missing model"))
+	}
+
+	if provider, model, ok := strings.Cut(name, "/"); ok {
+		info, err := h.llmFactory.LookupModel(ctx, llm.ProviderType(provider), model)
+		switch {
+		case err == nil:
+			return checkChatModel(info)
+		case errors.Is(err, llm.ErrUnknownProvider):
+			// a bare id containing a slash, e.g. "meta-llama/llama-3"
+		case errors.Is(err, llm.ErrUnknownModel):
+			return "", "", invalid(err)
+		default:
+			return "", "", utils.ErrLLMServiceUnavailable.Wrap(err)
+		}
+	}
+
+	for _, provider := range h.llmFactory.ListModels(ctx) {
+		for _, info := range provider.Models {
+			if info.ID == name {
+				return checkChatModel(info)
+			}
+		}
+	}
+	return "", "", invalid(fmt.Errorf("%w: %s", llm.ErrUnknownModel, name))
+}
+
+func checkChatModel(info llm.ModelInfo) (llm.ProviderType, string, error) {
+	if !info.Capabilities.Chat {
+		return "", "", utils.ErrUnsupportedModel.Wrap(
+			fmt.Errorf("model %q does not support chat", info.ID),
+		).WithDetails(utils.ValidationError{
+			Field:   "model",
+			Message: fmt.Sprintf("model %q does not support chat", info.ID),
+		})
+	}
+	return info.Provider, info.ID, nil
+}
+
+// splitOpenAIMessages turns an OpenAI message list into the history, latest
+// user message and system prompt an LLM takes. Tool messages belong to tools
+// run by the client, which the server can not replay, so they are dropped.
+func splitOpenAIMessages(messages []OpenAIChatMessage) ([]models.ChatMessage, string, string, error) {
+	if len(messages) == 0 || messages[len(messages)-1].Role != "user" {
+		return nil, "", "", utils.ErrValidation.Wrap(
+			fmt.Errorf("messages must end with a user message"),
+		).WithDetails(utils.ValidationError{
+			Field:   "messages",
+			Message: "messages must end with a message of role \"user\"",
+		})
+	}
+
+	var system []string
+	var history []models.ChatMessage
+	for i, msg := range messages[:len(messages)-1] {
+		switch msg.Role {
+		case "system", "developer":
+			system = append(system, string(msg.Content))
+		case "user":
+			history = append(history, models.ChatMessage{Role: models.RoleUser, Content: string(msg.Content)})
+		case "assistant":
+			if msg.Content != "" {
+				history = append(history, models.ChatMessage{Role: models.RoleAssistant, Content: string(msg.Content)})
+			}
+		case "tool", "function":
+		default:
+			return nil, "", "", utils.ErrValidation.Wrap(
+				fmt.Errorf("invalid role %q", msg.Role),
+			).WithDetails(utils.ValidationError{
+				Field:   fmt.Sprintf("messages[%d].role", i),
+				Message: `role can only be "system", "developer", "user", "assistant" or "tool"`,
+			})
+		}
+	}
+
+	return history, string(messages[len(messages)-1].Content), strings.Join(system, "\n\n"), nil
+}
+
+// llmAppError classifies a provider error by the prefix every provider puts
+// on it.
+func llmAppError(err error) utils.AppError {
+	if strings.Contains(err.Error(), "rate_limit_exceeded") {
+		return utils.ErrRateLimited.Wrap(err)
+	}
+	return utils.ErrLLMGenerationFailed.Wrap(err)
+}
+
+func openAIStreamError(err error) OpenAIStreamError {
+	appErr := llmAppError(err)
+	var payload OpenAIStreamError
+	payload.Error.Message = appErr.Message
+	payload.Error.Type = appErr.Code
+	payload.Error.Code = appErr.Code
+	return payload
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/llm"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/service"
+	"github.com/synntx/askmind/internal/tools"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+// scriptedLLM streams the chunks it is given and keeps the options set.
+type scriptedLLM struct {
+	llm.LLM
+	chunks  []llm.ContentChunk
+	options *llm.Options
+}
+
+func (m *scriptedLLM) GenerateContentStream(context.Context, []models.ChatMessage, string) <-chan llm.ContentChunk {
+	stream := make(chan llm.ContentChunk, len(m.chunks))
+	for _, chunk := range m.chunks {
+		stream <- chunk
+	}
+	close(stream)
+	return stream
+}
+
+func (m *scriptedLLM) GetModelName() string        { return "test-model" }
+func (m *scriptedLLM) SetSystemPrompt(string)      {}
+func (m *scriptedLLM) SetOptions(opts llm.Options) { m.options = &opts }
+
+// namedTool is a server tool of which only the name matters.
+type namedTool struct {
+	tools.Tool
+	name string
+}
+
+func (t namedTool) Name() string { return t.name }
+
+// scriptedFactory serves a single chat model, "test/test-model", which can
+// call web_search and read_url.
+type scriptedFactory struct {
+	llm.LLMFactory
+	model *scriptedLLM
+}
+
+func (f *scriptedFactory) LookupModel(_ context.Context, provider llm.ProviderType, model string) (llm.ModelInfo, error) {
+	if provider != "test" || model != "test-model" {
+		return llm.ModelInfo{}, llm.ErrUnknownModel
+	}
+	return llm.ModelInfo{ID: model, Provider: provider, Capabilities: llm.Capabilities{Chat: true}}, nil
+}
+
+func (f *scriptedFactory) CreateLLM(context.Context, llm.ProviderType, string) (llm.LLM, error) {
+	return f.model, nil
+}
+
+func (f *scriptedFactory) ListTools() []tools.Tool {
+	return []tools.Tool{namedTool{name: "web_search"}, namedTool{name: "read_url"}}
+}
+
+// recordingUsage records the usage records saved through RecordUsage.
+type recordingUsage struct {
+	service.UsageService
+	records []models.UsageRecord
+}
+
+func (u *recordingUsage) RecordUsage(_ context.Context, record *models.UsageRecord) error {
+	u.records = append(u.records, *record)
+	return nil
+}
+
+func postChatCompletion(h *OpenAIHandler, userId uuid.UUID, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), utils.ClaimsKey, &utils.Claims{UserId: userId.String()}))
+	w := httptest.NewRecorder()
+	h.ChatCompletionsHandler(w, r)
+	return w
+}
+
+// Every completion counts in the user's usage, so /v1 traffic is held to
+// the same daily quota as /c/completion.
+func TestChatCompletionsRecordsUsage(t *testing.T) {
+	reported := &llm.Usage{PromptTokens: 20, CompletionTokens: 5, TotalTokens: 25}
+
+	tests := []struct {
+		name   string
+		stream bool
+		chunks []llm.ContentChunk
+		status int
+		want   *llm.Usage // nil when estimated
+	}{
+		{
+			name:   "reported",
+			chunks: []llm.ContentChunk{{Content: "Hello"}, {Usage: reported}},
+			status: http.StatusOK,
+			want:   reported,
+		},
+		{
+			name:   "reported while streaming",
+			stream: true,
+			chunks: []llm.ContentChunk{{Content: "Hello"}, {Usage: reported}},
+			status: http.StatusOK,
+			want:   reported,
+		},
+		{
+			name:   "estimated after a failure",
+			chunks: []llm.ContentChunk{{Content: "Partial answer"}, {Err: errors.New("server_error: Overloaded")}},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "estimated after a failure while streaming",
+			stream: true,
+			chunks: []llm.ContentChunk{{Content: "Partial answer"}, {Err: errors.New("server_error: Overloaded")}},
+			status: http.StatusOK, // the headers went out with the first chunk
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage := &recordingUsage{}
+			h := NewOpenAIHandler(&scriptedFactory{model: &scriptedLLM{chunks: tt.chunks}}, nil, usage, nil, zap.NewNop())
+			userId := uuid.New()
+
+			body := `{"model": "test/test-model", "messages": [{"role": "user", "content": "Say hello"}]}`
+			if tt.stream {
+				body = `{"model": "test/test-model", "stream": true, "messages": [{"role": "user", "content": "Say hello"}]}`
+			}
+			w := postChatCompletion(h, userId, body)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+
+			if len(usage.records) != 1 {
+				t.Fatalf("recorded %d usage records, want one", len(usage.records))
+			}
+			record := usage.records[0]
+			if record.UserId != userId || record.Kind != models.UsageKindAPI || record.Model != "test-model" || record.ConversationId != nil {
+				t.Errorf("record = %+v, want an api record of the user for test-model", record)
+			}
+			if tt.want != nil {
+				if record.PromptTokens != tt.want.PromptTokens || record.CompletionTokens != tt.want.CompletionTokens || record.TotalTokens != tt.want.TotalTokens {
+					t.Errorf("tokens = %d/%d/%d, want %+v", record.PromptTokens, record.CompletionTokens, record.TotalTokens, *tt.want)
+				}
+			} else if record.PromptTokens <= 0 || record.CompletionTokens <= 0 || record.TotalTokens != record.PromptTokens+record.CompletionTokens {
+				t.Errorf("tokens = %d/%d/%d, want an estimate of the question and the partial answer", record.PromptTokens, record.CompletionTokens, record.TotalTokens)
+			}
+		})
+	}
+}
+
+func TestChatCompletionsOptions(t *testing.T) {
+	temperature := float32(0.2)
+
+	tests := []struct {
+		name   string
+		fields string // added to a valid request
+		want   llm.Options
+	}{
+		{
+			name: "defaults",
+			want: llm.Options{},
+		},
+		{
+			name:   "temperature and max_tokens",
+			fields: `"temperature": 0.2, "max_tokens": 100`,
+			want:   llm.Options{Temperature: &temperature, MaxOutputTokens: 100},
+		},
+		{
+			name:   "max_completion_tokens over max_tokens",
+			fields: `"max_tokens": 100, "max_completion_tokens": 50`,
+			want:   llm.Options{MaxOutputTokens: 50},
+		},
+		{
+			name:   "server tools",
+			fields: `"tools": [{"type": "function", "function": {"name": "web_search", "parameters": {"type": "object"}}}]`,
+			want:   llm.Options{Tools: []string{"web_search"}},
+		},
+		{
+			name:   "no tools",
+			fields: `"tools": []`,
+			want:   llm.Options{Tools: []string{}},
+		},
+		{
+			name:   "tools turned off",
+			fields: `"tools": [{"type": "function", "function": {"name": "web_search"}}], "tool_choice": "none"`,
+			want:   llm.Options{Tools: []string{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &scriptedLLM{chunks: []llm.ContentChunk{{Content: "Hello"}}}
+			h := NewOpenAIHandler(&scriptedFactory{model: model}, nil, &recordingUsage{}, nil, zap.NewNop())
+
+			w := postChatCompletion(h, uuid.New(), chatRequest(tt.fields))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			if model.options == nil {
+				t.Fatal("options were never set")
+			}
+			if !reflect.DeepEqual(*model.options, tt.want) {
+				t.Errorf("options = %+v, want %+v", *model.options, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatCompletionsRejectsUnsupported(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		field  string // named in the error details
+	}{
+		{"unknown field", `"top_p": 0.9`, "top_p"},
+		{"unknown string field", `"user": "user-1"`, "user"},
+		{"temperature out of range", `"temperature": 2.5`, "temperature"},
+		{"negative max_tokens", `"max_tokens": -1`, "max_completion_tokens"},
+		{"client tool", `"tools": [{"type": "function", "function": {"name": "get_weather"}}]`, "tools[0].function.name"},
+		{"required tool_choice", `"tool_choice": "required"`, "tool_choice"},
+		{"named tool_choice", `"tool_choice": {"type": "function", "function": {"name": "web_search"}}`, "tool_choice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage := &recordingUsage{}
+			h := NewOpenAIHandler(&scriptedFactory{model: &scriptedLLM{}}, nil, usage, nil, zap.NewNop())
+
+			w := postChatCompletion(h, uuid.New(), chatRequest(tt.fields))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+			var body struct {
+				Error struct {
+					Details []utils.ValidationError `json:"details"`
+				} `json:"error"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if d := body.Error.Details; len(d) != 1 || d[0].Field != tt.field {
+				t.Errorf("details = %+v, want one about %s", d, tt.field)
+			}
+			if len(usage.records) != 0 {
+				t.Errorf("recorded %d usage records for a rejected request", len(usage.records))
+			}
+		})
+	}
+}
+
+// chatRequest is a valid request to test/test-model with fields added.
+func chatRequest(fields string) string {
+	if fields != "" {
+		fields = ", " + fields
+	}
+	return `{"model": "test/test-model", "messages": [{"role": "user", "content": "Say hello"}]` + fields + `}`
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/llm"
+)
+
+// Request and response bodies of the OpenAI chat completions API, reduced to
+// the fields the /v1 facade understands. Requests with any other field are
+// rejected, so that clients do not count on options that are not applied.
+
+type OpenAIChatRequest struct {
+	Model         string              `json:"model"`
+	Messages      []OpenAIChatMessage `json:"messages"`
+	Stream        bool                `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+
+	Temperature         *float32 `json:"temperature,omitempty"`
+	MaxTokens           int      `json:"max_tokens,omitempty"` // deprecated by OpenAI for max_completion_tokens
+	MaxCompletionTokens int      `json:"max_completion_tokens,omitempty"`
+	// Tools restricts the model to these server tools; every tool when
+	// omitted. Tools run by the client are not supported.
+	Tools []OpenAITool `json:"tools,omitempty"`
+	// ToolChoice is "auto", the default, or "none" to turn tools off.
+	ToolChoice string `json:"tool_choice,omitempty"`
+
+	// AskMind extension: ground the answer in the sources of this space
+	SpaceId *uuid.UUID `json:"space_id,omitempty"`
+}
+
+// OpenAITool names a tool run by the server. Only the name is used: the
+// model is given the server's own description and parameters of the tool.
+type OpenAITool struct {
+	Type     string `json:"type"` // "function"
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+		Strict      *bool           `json:"strict,omitempty"`
+	} `json:"function"`
+}
+
+type OpenAIChatMessage struct {
+	Role    string        `json:"role"`
+	Content OpenAIContent `json:"content"`
+}
+
+// OpenAIContent is message content sent either as a string or as an array of
+// parts. Only text parts are kept.
+type OpenAIContent string
+
+func (c *OpenAIContent) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*c = ""
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = OpenAIContent(text)
+		return nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or an array of content parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	*c = OpenAIContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+type OpenAIChatCompletion struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"` // "chat.completion"
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []OpenAIChatChoice `json:"choices"`
+	Usage   *llm.Usage         `json:"usage,omitempty"`
+}
+
+type OpenAIChatChoice struct {
+	Index        int                     `json:"index"`
+	Message      OpenAIChatResponseDelta `json:"message"`
+	FinishReason string                  `json:"finish_reason"`
+}
+
+type OpenAIChatCompletionChunk struct {
+	ID      string              `json:"id"`
+	Object  string              `json:"object"` // "chat.completion.chunk"
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []OpenAIChunkChoice `json:"choices"`
+	Usage   *llm.Usage          `json:"usage,omitempty"`
+}
+
+type OpenAIChunkChoice struct {
+	Index        int                     `json:"index"`
+	Delta        OpenAIChatResponseDelta `json:"delta"`
+	FinishReason *string                 `json:"finish_reason"`
+}
+
+type OpenAIChatResponseDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content"`
+}
+
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"` // "model"
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type OpenAIModelList struct {
+	Object string        `json:"object"` // "list"
+	Data   []OpenAIModel `json:"data"`
+}
+
+// OpenAIStreamError is sent in place of a chunk when a stream fails midway.
+type OpenAIStreamError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    string `json:"code,omitempty"`
+	} `json:"error"`
+}
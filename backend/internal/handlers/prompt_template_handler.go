@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/service"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+type PromptTemplateHandler struct {
+	ps     service.PromptService
+	authz  service.Authorizer
+	logger *zap.Logger
+}
+
+func NewPromptTemplateHandler(ps service.PromptService, authz service.Authorizer, logger *zap.Logger) *PromptTemplateHandler {
+	return &PromptTemplateHandler{
+		ps:     ps,
+		authz:  authz,
+		logger: logger,
+	}
+}
+
+// Routes: (prefix : `/prompt`; personal templates, or shared with a space
+// whose editors manage them)
+// 1. /prompt - POST (json: name, description, content, space_id)
+// 2. /prompt/get?template_id= - GET
+// 3. /prompt/list?space_id= - GET (the user's templates, and the space's if given)
+// 4. /prompt/update?template_id= - PUT (json: name, description, content)
+// 5. /prompt/delete?template_id= - DELETE
+//
+// A template is used by passing its name as a completion's system_prompt.
+
+func (h *PromptTemplateHandler) CreateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	var req models.CreatePromptTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(err))
+		return
+	}
+
+	if req.SpaceId != nil {
+		if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, req.SpaceId.String(), models.SpaceRoleEditor); err != nil {
+			utils.HandleError(w, h.logger, err)
+			return
+		}
+	}
+
+	t, err := h.ps.CreateTemplate(r.Context(), claims.UserId, &req)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusCreated, t)
+}
+
+func (h *PromptTemplateHandler) GetTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.authorizeTemplate(w, r, models.SpaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, t)
+}
+
+func (h *PromptTemplateHandler) ListTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	spaceId := r.FormValue("space_id")
+	if spaceId != "" {
+		if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, spaceId, models.SpaceRoleViewer); err != nil {
+			utils.HandleError(w, h.logger, err)
+			return
+		}
+	}
+
+	templates, err := h.ps.ListTemplates(r.Context(), claims.UserId, spaceId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, templates)
+}
+
+func (h *PromptTemplateHandler) UpdateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.authorizeTemplate(w, r, models.SpaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	var req models.UpdatePromptTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(err))
+		return
+	}
+
+	updated, err := h.ps.UpdateTemplate(r.Context(), t, &req)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, updated)
+}
+
+func (h *PromptTemplateHandler) DeleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.authorizeTemplate(w, r, models.SpaceRoleEditor)
+	if !ok {
+		return
+	}
+
+	if err := h.ps.DeleteTemplate(r.Context(), t.TemplateId.String()); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendNoContent(w)
+}
+
+// authorizeTemplate reads template_id and authorizes the template, handling
+// the error if either fails.
+func (h *PromptTemplateHandler) authorizeTemplate(w http.ResponseWriter, r *http.Request, need models.SpaceRole) (*models.PromptTemplate, bool) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return nil, false
+	}
+
+	templateId := r.FormValue("template_id")
+	if templateId == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter template_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "template_id",
+			Message: "'template_id' is required",
+		}))
+		return nil, false
+	}
+
+	t, err := h.authz.AuthorizePromptTemplate(r.Context(), claims.UserId, templateId, need)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return nil, false
+	}
+	return t, true
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/service"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+const maxSourceUploadSize = 25 << 20 // 25 MB
+
+type SourceHandler struct {
+	ss     service.SourceService
+	authz  service.Authorizer
+	logger *zap.Logger
+}
+
+func NewSourceHandler(ss service.SourceService, authz service.Authorizer, logger *zap.Logger) *SourceHandler {
+	return &SourceHandler{
+		ss:     ss,
+		authz:  authz,
+		logger: logger,
+	}
+}
+
+// Routes: (prefix : `/source`)
+// 1. /source/url - POST (json: space_id, url)
+// 2. /source/file - POST (multipart: space_id, file)
+// 3. /source/get?source_id= - GET (poll status here)
+// 4. /source/list?space_id= - GET
+// 5. /source/delete?source_id= - DELETE
+
+func (h *SourceHandler) CreateWebSourceHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.ClaimsKey).(*utils.Claims)
+	if !ok || claims == nil {
+		utils.HandleError(w, h.logger, utils.ErrUnauthorized.Wrap(
+			fmt.Errorf("missing Claims in context"),
+		))
+		return
+	}
+
+	var req models.CreateWebSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(err))
+		return
+	}
+
+	if req.SpaceId == uuid.Nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required field space_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "space_id",
+			Message: "space_id is required and must be a valid UUID",
+		}))
+		return
+	}
+
+	if req.URL == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required field url"),
+		).WithDetails(utils.ValidationError{
+			Field:   "url",
+			Message: "url is required",
+		}))
+		return
+	}
+
+	if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, req.SpaceId.String(), models.SpaceRoleEditor); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	source, err := h.ss.CreateWebSource(r.Context(), claims.UserId, req.SpaceId, req.URL)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	h.logger.Info("source created",
+		zap.String("source_id", source.SourceId.String()),
+		zap.String("location", source.Location),
+		zap.String("event", "source_created"),
+	)
+
+	utils.SendResponse(w, http.StatusAccepted, source)
+}
+
+func (h *SourceHandler) CreateFileSourceHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.ClaimsKey).(*utils.Claims)
+	if !ok || claims == nil {
+		utils.HandleError(w, h.logger, utils.ErrUnauthorized.Wrap(
+			fmt.Errorf("missing Claims in context"),
+		))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSourceUploadSize)
+	if err := r.ParseMultipartForm(maxSourceUploadSize); err != nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(err).WithDetails(utils.ValidationError{
+			Field:   "file",
+			Message: fmt.Sprintf("file must be sent as multipart/form-data and be at most %d MB", maxSourceUploadSize>>20),
+		}))
+		return
+	}
+
+	spaceId, err := uuid.Parse(r.FormValue("space_id"))
+	if err != nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("failed to parse space_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "space_id",
+			Message: "space_id is required and must be a valid UUID",
+		}))
+		return
+	}
+
+	if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, spaceId.String(), models.SpaceRoleEditor); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(err).WithDetails(utils.ValidationError{
+			Field:   "file",
+			Message: "file is required",
+		}))
+		return
+	}
+	defer file.Close()
+
+	source, err := h.ss.CreateFileSource(r.Context(), claims.UserId, spaceId, header.Filename, header.Header.Get("Content-Type"), file)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	h.logger.Info("source created",
+		zap.String("source_id", source.SourceId.String()),
+		zap.String("location", source.Location),
+		zap.Int64("size", header.Size),
+		zap.String("event", "source_created"),
+	)
+
+	utils.SendResponse(w, http.StatusAccepted, source)
+}
+
+func (h *SourceHandler) GetSourceHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	sourceId := r.FormValue("source_id")
+	if sourceId == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter source_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "source_id",
+			Message: "source_id is required",
+		}))
+		return
+	}
+
+	source, err := h.authz.AuthorizeSource(r.Context(), claims.UserId, sourceId, models.SpaceRoleViewer)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, source)
+}
+
+func (h *SourceHandler) ListSourcesForSpaceHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	spaceId := r.FormValue("space_id")
+	if spaceId == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter space_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "space_id",
+			Message: "space_id is required",
+		}))
+		return
+	}
+
+	if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, spaceId, models.SpaceRoleViewer); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	sources, err := h.ss.ListSourcesForSpace(r.Context(), spaceId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, sources)
+}
+
+func (h *SourceHandler) DeleteSourceHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	sourceId := r.FormValue("source_id")
+	if sourceId == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter source_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "source_id",
+			Message: "source_id is required",
+		}))
+		return
+	}
+
+	if _, err := h.authz.AuthorizeSource(r.Context(), claims.UserId, sourceId, models.SpaceRoleEditor); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	if err := h.ss.DeleteSource(r.Context(), sourceId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendNoContent(w)
+}
@@ -14,11 +14,12 @@ import (
 
 type SpaceHandler struct {
 	spaceService service.SpaceService
+	authz        service.Authorizer
 	logger       *zap.Logger
 }
 
-func NewSpaceHandler(space service.SpaceService, logger *zap.Logger) *SpaceHandler {
-	return &SpaceHandler{spaceService: space, logger: logger}
+func NewSpaceHandler(space service.SpaceService, authz service.Authorizer, logger *zap.Logger) *SpaceHandler {
+	return &SpaceHandler{spaceService: space, authz: authz, logger: logger}
 }
 
 func (h *SpaceHandler) CreateSpaceHandler(w http.ResponseWriter, r *http.Request) {
@@ -88,6 +89,11 @@ func (h *SpaceHandler) CreateSpaceHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (h *SpaceHandler) GetSpaceHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	spaceId := r.FormValue("space_id")
 	if spaceId == "" {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
@@ -96,7 +102,7 @@ func (h *SpaceHandler) GetSpaceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	space, err := h.spaceService.GetSpace(r.Context(), spaceId)
+	space, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, spaceId, models.SpaceRoleViewer)
 	if err != nil {
 		utils.HandleError(w, h.logger, err)
 		return
@@ -124,6 +130,11 @@ func (h *SpaceHandler) ListSpacesForUserHandler(w http.ResponseWriter, r *http.R
 }
 
 func (h *SpaceHandler) UpdateSpaceHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	spaceId := r.FormValue("space_id")
 	if spaceId == "" {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
@@ -138,16 +149,21 @@ func (h *SpaceHandler) UpdateSpaceHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if req.Description == nil && req.Title == nil {
+	if req.Description == nil && req.Title == nil && req.Settings == nil {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
 			fmt.Errorf("missing required fields"),
 		).WithDetails(utils.ValidationError{
-			Field:   "title,description",
-			Message: "Please provide either a new title or description for the update",
+			Field:   "title,description,settings",
+			Message: "Please provide a new title, description or settings for the update",
 		}))
 		return
 	}
 
+	if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, spaceId, models.SpaceRoleEditor); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
 	req.SpaceId = spaceId
 
 	if err := h.spaceService.UpdateSpace(r.Context(), &req); err != nil {
@@ -159,6 +175,11 @@ func (h *SpaceHandler) UpdateSpaceHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (h *SpaceHandler) DeleteSpaceHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
 	spaceId := r.FormValue("space_id")
 	if spaceId == "" {
 		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
@@ -167,6 +188,11 @@ func (h *SpaceHandler) DeleteSpaceHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, spaceId, models.SpaceRoleOwner); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
 	if err := h.spaceService.DeleteSpace(r.Context(), spaceId); err != nil {
 		utils.HandleError(w, h.logger, err)
 		return
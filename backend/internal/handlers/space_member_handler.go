@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Routes: (prefix : `/space`)
+// 1. /space/members?space_id= - GET (any member)
+// 2. /space/members/invite - POST (json: space_id, email, role; owner only)
+// 3. /space/members/role?space_id=&user_id=&role= - PUT (owner only)
+// 4. /space/members/remove?space_id=&user_id= - DELETE (owner, or a member leaving)
+// 5. /space/invitations - GET (invitations of the current user)
+// 6. /space/invitations/accept?space_id= - POST
+// 7. /space/invitations/decline?space_id= - DELETE
+
+func (h *SpaceHandler) ListMembersHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	spaceId, ok := h.requireParam(w, r, "space_id")
+	if !ok {
+		return
+	}
+
+	if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, spaceId, models.SpaceRoleViewer); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	members, err := h.spaceService.ListMembers(r.Context(), spaceId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, members)
+}
+
+func (h *SpaceHandler) InviteMemberHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	var req models.InviteSpaceMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(err))
+		return
+	}
+
+	if req.SpaceId == uuid.Nil {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required field space_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "space_id",
+			Message: "space_id is required and must be a valid UUID",
+		}))
+		return
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required field email"),
+		).WithDetails(utils.ValidationError{
+			Field:   "email",
+			Message: "email is required",
+		}))
+		return
+	}
+
+	if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, req.SpaceId.String(), models.SpaceRoleOwner); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	member, err := h.spaceService.InviteMember(r.Context(), req.SpaceId.String(), req.Email, req.Role, claims.UserId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	h.logger.Info("space member invited",
+		zap.String("space_id", req.SpaceId.String()),
+		zap.String("user_id", member.UserId.String()),
+		zap.String("role", string(member.Role)),
+		zap.String("event", "space_member_invited"),
+	)
+
+	utils.SendResponse(w, http.StatusCreated, member)
+}
+
+func (h *SpaceHandler) UpdateMemberRoleHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	spaceId, ok := h.requireParam(w, r, "space_id")
+	if !ok {
+		return
+	}
+	userId, ok := h.requireParam(w, r, "user_id")
+	if !ok {
+		return
+	}
+	role, ok := h.requireParam(w, r, "role")
+	if !ok {
+		return
+	}
+
+	if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, spaceId, models.SpaceRoleOwner); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	if err := h.spaceService.UpdateMemberRole(r.Context(), spaceId, userId, models.SpaceRole(role)); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendNoContent(w)
+}
+
+// RemoveMemberHandler removes a member or withdraws an invitation. Members
+// may remove themselves to leave the space.
+func (h *SpaceHandler) RemoveMemberHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	spaceId, ok := h.requireParam(w, r, "space_id")
+	if !ok {
+		return
+	}
+	userId, ok := h.requireParam(w, r, "user_id")
+	if !ok {
+		return
+	}
+
+	need := models.SpaceRoleOwner
+	if userId == claims.UserId {
+		need = models.SpaceRoleViewer
+	}
+	if _, err := h.authz.AuthorizeSpace(r.Context(), claims.UserId, spaceId, need); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	if err := h.spaceService.RemoveMember(r.Context(), spaceId, userId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendNoContent(w)
+}
+
+func (h *SpaceHandler) ListInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	invitations, err := h.spaceService.ListInvitations(r.Context(), claims.UserId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, invitations)
+}
+
+func (h *SpaceHandler) AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	spaceId, ok := h.requireParam(w, r, "space_id")
+	if !ok {
+		return
+	}
+
+	if err := h.spaceService.AcceptInvitation(r.Context(), spaceId, claims.UserId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendNoContent(w)
+}
+
+func (h *SpaceHandler) DeclineInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireClaims(w, r, h.logger)
+	if !ok {
+		return
+	}
+
+	spaceId, ok := h.requireParam(w, r, "space_id")
+	if !ok {
+		return
+	}
+
+	if err := h.spaceService.DeclineInvitation(r.Context(), spaceId, claims.UserId); err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendNoContent(w)
+}
+
+func (h *SpaceHandler) requireParam(w http.ResponseWriter, r *http.Request, name string) (string, bool) {
+	value := r.FormValue(name)
+	if value == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter %s", name),
+		).WithDetails(utils.ValidationError{
+			Field:   name,
+			Message: fmt.Sprintf("'%s' is required", name),
+		}))
+		return "", false
+	}
+	return value, true
+}
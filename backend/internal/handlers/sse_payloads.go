@@ -22,6 +22,15 @@ const (
 	PathMessageMetadata    = "/message/metadata"
 )
 
+// Why an answer ended, reported as the finish_details type of the message and
+// the finish_reason of the completion event.
+const (
+	FinishReasonStop        = "stop" // the model finished its answer
+	FinishReasonUserStopped = "user_stopped"
+	FinishReasonTimeout     = "timeout"
+	FinishReasonError       = "error"
+)
+
 type Author struct {
 	Role     string         `json:"role"`
 	Name     *string        `json:"name"`
@@ -45,7 +54,7 @@ type Metadata struct {
 
 type FinishDetails struct {
 	Type       string `json:"type"`
-	StopTokens []int  `json:"stop_tokens"`
+	StopTokens []int  `json:"stop_tokens,omitempty"`
 }
 
 type Message struct {
@@ -84,6 +93,34 @@ type PatchOperation struct {
 type CompletionData struct {
 	Type           string `json:"type"`
 	ConversationID string `json:"conversation_id"`
+	FinishReason   string `json:"finish_reason"`
+}
+
+// ContentReference points the client at a retrieved source excerpt. Index
+// matches the [n] citation markers the model is asked to use.
+type ContentReference struct {
+	Index          int     `json:"index"`
+	ChunkID        string  `json:"chunk_id"`
+	SourceID       string  `json:"source_id"`
+	SourceLocation string  `json:"source_location"`
+	PageNumber     *int32  `json:"page_number,omitempty"`
+	SectionTitle   string  `json:"section_title,omitempty"`
+	RelevanceScore float64 `json:"relevance_score"`
+}
+
+// ToolCallEvent is the state of one tool call. It is appended to
+// PathMessageMetadataTC when the call starts and replaced at its index there
+// on every later status change.
+type ToolCallEvent struct {
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	Args            map[string]any `json:"args,omitempty"`
+	Status          string         `json:"status"` // START, PROCESSING or END
+	StartTime       float64        `json:"start_time"`
+	EndTime         *float64       `json:"end_time,omitempty"`
+	DurationMs      *int64         `json:"duration_ms,omitempty"`
+	Result          string         `json:"result,omitempty"` // first toolResultPreviewLen runes
+	ResultTruncated bool           `json:"result_truncated,omitempty"`
 }
 
 type ErrorDetails struct {
@@ -121,3 +158,19 @@ func NewInitialMessagePayload(convID, assistantMessageID, model string) DeltaPay
 		},
 	}
 }
+
+func NewContentReferences(chunks []models.Chunk) []ContentReference {
+	refs := make([]ContentReference, 0, len(chunks))
+	for i, chunk := range chunks {
+		refs = append(refs, ContentReference{
+			Index:          i + 1,
+			ChunkID:        chunk.ChunkId.String(),
+			SourceID:       chunk.SourceId.String(),
+			SourceLocation: chunk.SourceLocation,
+			PageNumber:     chunk.PageNumber,
+			SectionTitle:   chunk.SectionTitle,
+			RelevanceScore: chunk.Similarity,
+		})
+	}
+	return refs
+}
@@ -45,15 +45,24 @@ func (s *SSEStreamer) Send(event string, payload any) error {
 		s.logger.Error("error marshalling SSE payload", zap.String("event", event), zap.Error(err))
 		return err
 	}
-	return s.writeAndFlush(event, jsonData)
+	return s.writeAndFlush("", event, jsonData)
 }
 
 func (s *SSEStreamer) SendRaw(event string, rawData string) error {
-	return s.writeAndFlush(event, []byte(rawData))
+	return s.writeAndFlush("", event, []byte(rawData))
 }
 
-func (s *SSEStreamer) writeAndFlush(event string, data []byte) error {
+// SendWithID writes an already encoded event with an `id:` line, which the
+// client echoes back as Last-Event-ID when it reconnects.
+func (s *SSEStreamer) SendWithID(id, event string, data []byte) error {
+	return s.writeAndFlush(id, event, data)
+}
+
+func (s *SSEStreamer) writeAndFlush(id, event string, data []byte) error {
 	var buffer strings.Builder
+	if id != "" {
+		buffer.WriteString(fmt.Sprintf("id: %s\n", id))
+	}
 	if event != "" {
 		buffer.WriteString(fmt.Sprintf("event: %s\n", event))
 	}
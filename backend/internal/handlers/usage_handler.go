@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/synntx/askmind/internal/service"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+// days covered by /usage/daily when no range is given
+const defaultUsageDays = 30
+
+type UsageHandler struct {
+	us     service.UsageService
+	logger *zap.Logger
+}
+
+func NewUsageHandler(us service.UsageService, logger *zap.Logger) *UsageHandler {
+	return &UsageHandler{
+		us:     us,
+		logger: logger,
+	}
+}
+
+// Routes: (prefix : `/usage`)
+// 1. /usage/conversation?conv_id=... - GET
+// 2. /usage/space?space_id=... - GET
+// 3. /usage/daily?from=YYYY-MM-DD&to=YYYY-MM-DD - GET (per day and model, both ends inclusive)
+
+func (h *UsageHandler) GetConversationUsageHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.ClaimsKey).(*utils.Claims)
+	if !ok || claims == nil {
+		utils.HandleError(w, h.logger, utils.ErrUnauthorized.Wrap(
+			fmt.Errorf("missing Claims in context"),
+		))
+		return
+	}
+
+	convId := r.FormValue("conv_id")
+	if convId == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter conv_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "conv_id",
+			Message: "'conv_id' is required",
+		}))
+		return
+	}
+
+	usage, err := h.us.GetConversationUsage(r.Context(), claims.UserId, convId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, usage)
+}
+
+func (h *UsageHandler) GetSpaceUsageHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.ClaimsKey).(*utils.Claims)
+	if !ok || claims == nil {
+		utils.HandleError(w, h.logger, utils.ErrUnauthorized.Wrap(
+			fmt.Errorf("missing Claims in context"),
+		))
+		return
+	}
+
+	spaceId := r.FormValue("space_id")
+	if spaceId == "" {
+		utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required parameter space_id"),
+		).WithDetails(utils.ValidationError{
+			Field:   "space_id",
+			Message: "'space_id' is required",
+		}))
+		return
+	}
+
+	usage, err := h.us.GetSpaceUsage(r.Context(), claims.UserId, spaceId)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, usage)
+}
+
+func (h *UsageHandler) GetDailyUsageHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(utils.ClaimsKey).(*utils.Claims)
+	if !ok || claims == nil {
+		utils.HandleError(w, h.logger, utils.ErrUnauthorized.Wrap(
+			fmt.Errorf("missing Claims in context"),
+		))
+		return
+	}
+
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, 1-defaultUsageDays)
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		value := r.FormValue(param.name)
+		if value == "" {
+			continue
+		}
+		day, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			utils.HandleError(w, h.logger, utils.ErrValidation.Wrap(err).WithDetails(utils.ValidationError{
+				Field:   param.name,
+				Message: fmt.Sprintf("'%s' must be a date formatted as YYYY-MM-DD", param.name),
+			}))
+			return
+		}
+		*param.dst = day
+	}
+
+	days, err := h.us.GetDailyUsage(r.Context(), claims.UserId, from, to)
+	if err != nil {
+		utils.HandleError(w, h.logger, err)
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, days)
+}
@@ -0,0 +1,579 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/tools"
+	"go.uber.org/zap"
+)
+
+const (
+	anthropicAPIURL      = "https://api.anthropic.com/v1"
+	anthropicAPIVersion  = "2023-06-01"
+	anthropicMaxTokens   = 4096
+	anthropicMaxLineSize = 1 << 20 // tool_use inputs can be long single events
+)
+
+type Anthropic struct {
+	apiKey       string
+	baseURL      string
+	logger       *zap.Logger
+	modelName    string
+	httpClient   *http.Client
+	tools        []AnthropicTool
+	toolRegistry *tools.ToolRegistry
+	options      Options
+
+	SystemPrompt string
+}
+
+// Anthropic Messages API types
+type AnthropicMessage struct {
+	Role    models.Role             `json:"role"`
+	Content []AnthropicContentBlock `json:"content"`
+}
+
+// AnthropicContentBlock is a text, tool_use or tool_result block.
+type AnthropicContentBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+type AnthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type AnthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []AnthropicMessage `json:"messages"`
+	Tools       []AnthropicTool    `json:"tools,omitempty"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float32           `json:"temperature,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+type AnthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Content    []AnthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      AnthropicUsage          `json:"usage"`
+}
+
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// AnthropicStreamEvent is the data of one server-sent event. Which fields
+// are set depends on Type: message_start, content_block_start,
+// content_block_delta, content_block_stop, message_delta, message_stop,
+// ping or error.
+type AnthropicStreamEvent struct {
+	Type         string                 `json:"type"`
+	Index        int                    `json:"index"`
+	Message      *AnthropicResponse     `json:"message,omitempty"`
+	ContentBlock *AnthropicContentBlock `json:"content_block,omitempty"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *AnthropicUsage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func NewAnthropic(apiKey, baseURL string, logger *zap.Logger, modelName string, toolRegistry *tools.ToolRegistry) *Anthropic {
+	if baseURL == "" {
+		baseURL = anthropicAPIURL
+	}
+
+	anthropic := &Anthropic{
+		apiKey:       apiKey,
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		logger:       logger,
+		modelName:    modelName,
+		httpClient:   &http.Client{},
+		toolRegistry: toolRegistry,
+		SystemPrompt: "",
+	}
+
+	if toolRegistry != nil {
+		anthropic.tools = anthropic.convertToAnthropicTools()
+	}
+
+	return anthropic
+}
+
+func (a *Anthropic) GetProviderName() string {
+	return "anthropic"
+}
+
+func (a *Anthropic) GetModelName() string {
+	return a.modelName
+}
+
+func (a *Anthropic) SetSystemPrompt(p string) { a.SystemPrompt = p }
+
+func (a *Anthropic) SetOptions(opts Options) {
+	a.options = opts
+	if a.toolRegistry != nil {
+		a.tools = a.convertToAnthropicTools()
+	}
+}
+
+// maxTokens is the max_tokens of a request, which Anthropic requires.
+func (a *Anthropic) maxTokens() int {
+	if a.options.MaxOutputTokens > 0 {
+		return a.options.MaxOutputTokens
+	}
+	return anthropicMaxTokens
+}
+
+func (a *Anthropic) GenerateContent(ctx context.Context, input string) (string, error) {
+	request := AnthropicRequest{
+		Model:       a.modelName,
+		Messages:    []AnthropicMessage{anthropicText(models.RoleUser, input)},
+		MaxTokens:   a.maxTokens(),
+		Temperature: a.options.Temperature,
+	}
+
+	body, err := a.post(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	var resp AnthropicResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	var text strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no text in Anthropic response")
+	}
+	return text.String(), nil
+}
+
+func (a *Anthropic) GenerateEmbeddings(ctx context.Context, input string) ([]float32, error) {
+	// Anthropic has no embeddings endpoint
+	return nil, fmt.Errorf("anthropic does not support embeddings generation")
+}
+
+func (a *Anthropic) GenerateContentStream(ctx context.Context, history []models.ChatMessage, userMessage string) <-chan ContentChunk {
+	contentStream := make(chan ContentChunk, 10)
+
+	go func() {
+		defer close(contentStream)
+
+		messages := a.convertToAnthropicMessages(history)
+
+		// History usually ends with the question being answered, already saved
+		if n := len(messages); n > 0 && messages[n-1].Role == models.RoleUser &&
+			len(messages[n-1].Content) == 1 && messages[n-1].Content[0].Text == userMessage {
+			messages = messages[:n-1]
+		}
+		messages = append(messages, anthropicText(models.RoleUser, userMessage))
+
+		var usage Usage
+
+		// Tool calling loop
+		for i := 0; i < MAX_TOOL_CALL_ITERATIONS; i++ {
+			a.logger.Info("Starting Anthropic turn iteration", zap.Int("iteration", i))
+
+			request := AnthropicRequest{
+				Model:       a.modelName,
+				System:      a.SystemPrompt,
+				Messages:    messages,
+				Tools:       a.tools,
+				MaxTokens:   a.maxTokens(),
+				Temperature: a.options.Temperature,
+				Stream:      true,
+			}
+
+			stream, err := a.post(ctx, request)
+			if err != nil {
+				contentStream <- ContentChunk{Err: err}
+				return
+			}
+
+			blocks, err := a.readStream(ctx, stream, contentStream, &usage)
+			stream.Close()
+			if err != nil {
+				contentStream <- ContentChunk{Err: err}
+				return
+			}
+
+			var toolUses []AnthropicContentBlock
+			for _, block := range blocks {
+				if block.Type == "tool_use" {
+					toolUses = append(toolUses, block)
+				}
+			}
+
+			// If no tool calls, we're done
+			if len(toolUses) == 0 {
+				a.logger.Info("Anthropic interaction complete (no tool calls)", zap.Int("iteration", i))
+				contentStream <- ContentChunk{Usage: &usage}
+				return
+			}
+
+			// The assistant turn goes back verbatim, followed by one
+			// user turn with a tool_result block for every tool_use.
+			messages = append(messages, AnthropicMessage{Role: models.RoleAssistant, Content: blocks})
+
+			results := make([]AnthropicContentBlock, 0, len(toolUses))
+			for _, use := range toolUses {
+				results = append(results, a.executeTool(ctx, contentStream, use))
+			}
+			messages = append(messages, AnthropicMessage{Role: models.RoleUser, Content: results})
+		}
+
+		a.logger.Error("Max tool iterations reached")
+		contentStream <- ContentChunk{Err: fmt.Errorf("max_tool_iterations_reached: exceeded %d iterations", MAX_TOOL_CALL_ITERATIONS)}
+	}()
+
+	return contentStream
+}
+
+// readStream forwards text deltas and tool_use starts to contentStream and
+// returns the content blocks of the assistant turn once the message stops.
+func (a *Anthropic) readStream(ctx context.Context, stream io.Reader, contentStream chan<- ContentChunk, usage *Usage) ([]AnthropicContentBlock, error) {
+	var blocks []AnthropicContentBlock
+	var inputTokens, outputTokens int
+	var inputs []strings.Builder // partial tool_use input, per block
+
+	send := func(chunk ContentChunk) error {
+		select {
+		case contentStream <- chunk:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), anthropicMaxLineSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue // "event:" lines repeat the type that is also in the data
+		}
+
+		var event AnthropicStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+			a.logger.Error("Failed to parse Anthropic stream event", zap.Error(err))
+			continue
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				inputTokens = event.Message.Usage.InputTokens
+				outputTokens = event.Message.Usage.OutputTokens
+			}
+
+		case "content_block_start":
+			if event.ContentBlock == nil {
+				continue
+			}
+			for len(blocks) <= event.Index {
+				blocks = append(blocks, AnthropicContentBlock{})
+				inputs = append(inputs, strings.Builder{})
+			}
+			blocks[event.Index] = *event.ContentBlock
+			if event.ContentBlock.Type == "tool_use" {
+				blocks[event.Index].Input = nil // streamed through input_json_delta
+				err := send(ContentChunk{ToolInfo: &ToolInfo{
+					ID:     event.ContentBlock.ID,
+					Name:   event.ContentBlock.Name,
+					Status: StatusStart,
+				}})
+				if err != nil {
+					return nil, err
+				}
+			}
+
+		case "content_block_delta":
+			if event.Index >= len(blocks) {
+				continue
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				blocks[event.Index].Text += event.Delta.Text
+				if err := send(ContentChunk{Content: event.Delta.Text}); err != nil {
+					return nil, err
+				}
+			case "input_json_delta":
+				inputs[event.Index].WriteString(event.Delta.PartialJSON)
+			}
+
+		case "content_block_stop":
+			if event.Index < len(blocks) && blocks[event.Index].Type == "tool_use" {
+				input := strings.TrimSpace(inputs[event.Index].String())
+				if input == "" {
+					input = "{}" // tools without parameters
+				}
+				blocks[event.Index].Input = json.RawMessage(input)
+			}
+
+		case "message_delta":
+			if event.Usage != nil {
+				outputTokens = event.Usage.OutputTokens // cumulative
+			}
+			if event.Delta.StopReason == "max_tokens" {
+				a.logger.Warn("Anthropic response stopped at max_tokens", zap.Int("max_tokens", a.maxTokens()))
+			}
+
+		case "message_stop":
+			usage.Add(inputTokens, outputTokens)
+			return anthropicReplayable(blocks), nil
+
+		case "error":
+			if event.Error != nil {
+				if event.Error.Type == "overloaded_error" {
+					return nil, fmt.Errorf("server_error: %s", event.Error.Message)
+				}
+				return nil, fmt.Errorf("generation_error: %s: %s", event.Error.Type, event.Error.Message)
+			}
+			return nil, fmt.Errorf("generation_error: anthropic stream error")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("generation_error: %w", err)
+	}
+	return nil, fmt.Errorf("generation_error: anthropic stream ended before message_stop")
+}
+
+// anthropicReplayable drops blocks the API would reject when the turn is
+// sent back, such as empty text blocks.
+func anthropicReplayable(blocks []AnthropicContentBlock) []AnthropicContentBlock {
+	kept := blocks[:0]
+	for _, block := range blocks {
+		if block.Type == "" || (block.Type == "text" && block.Text == "") {
+			continue
+		}
+		kept = append(kept, block)
+	}
+	return kept
+}
+
+// executeTool runs one tool_use block and returns its tool_result block.
+func (a *Anthropic) executeTool(ctx context.Context, contentStream chan<- ContentChunk, use AnthropicContentBlock) AnthropicContentBlock {
+	a.logger.Info("Executing tool", zap.String("name", use.Name))
+
+	var args map[string]any
+	if err := json.Unmarshal(use.Input, &args); err != nil {
+		a.logger.Error("Failed to parse tool arguments", zap.Error(err))
+		return AnthropicContentBlock{
+			Type:      "tool_result",
+			ToolUseID: use.ID,
+			Content:   fmt.Sprintf("Error: invalid tool input: %v", err),
+			IsError:   true,
+		}
+	}
+
+	contentStream <- ContentChunk{ToolInfo: &ToolInfo{
+		ID:     use.ID,
+		Name:   use.Name,
+		Args:   args,
+		Status: StatusProcessing,
+	}}
+
+	var result string
+	var failed bool
+	tool, ok := a.toolRegistry.GetTool(use.Name)
+	if !ok || !a.options.AllowsTool(use.Name) {
+		a.logger.Error("Tool not found", zap.String("tool", use.Name))
+		result, failed = fmt.Sprintf("Tool '%s' not found", use.Name), true
+	} else {
+		var err error
+		result, err = tool.Execute(ctx, args)
+		if err != nil {
+			a.logger.Error("Tool execution failed", zap.Error(err))
+			result, failed = fmt.Sprintf("Error: %v", err), true
+		}
+	}
+
+	contentStream <- ContentChunk{ToolInfo: &ToolInfo{
+		ID:     use.ID,
+		Name:   use.Name,
+		Args:   args,
+		Result: result,
+		Status: StatusEnd,
+	}}
+
+	return AnthropicContentBlock{
+		Type:      "tool_result",
+		ToolUseID: use.ID,
+		Content:   result,
+		IsError:   failed,
+	}
+}
+
+func (a *Anthropic) post(ctx context.Context, request AnthropicRequest) (io.ReadCloser, error) {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("x-api-key", a.apiKey)
+	req.Header.Set("anthropic-version", anthropicAPIVersion)
+	req.Header.Set("Content-Type", "application/json")
+	if request.Stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, statusError("anthropic", resp.StatusCode, body)
+	}
+
+	return resp.Body, nil
+}
+
+func anthropicText(role models.Role, text string) AnthropicMessage {
+	return AnthropicMessage{
+		Role:    role,
+		Content: []AnthropicContentBlock{{Type: "text", Text: text}},
+	}
+}
+
+func (a *Anthropic) convertToAnthropicMessages(history []models.ChatMessage) []AnthropicMessage {
+	messages := make([]AnthropicMessage, 0, len(history))
+	for _, group := range toolCallGroups(history) {
+		msg := group[0]
+		switch msg.Role {
+		case models.RoleTool:
+			// An assistant turn with the tool_use blocks, then a user turn
+			// with their results
+			uses := make([]AnthropicContentBlock, len(group))
+			results := make([]AnthropicContentBlock, len(group))
+			for i, m := range group {
+				input, err := json.Marshal(m.ToolCall.Args)
+				if err != nil || m.ToolCall.Args == nil {
+					input = []byte("{}")
+				}
+				uses[i] = AnthropicContentBlock{Type: "tool_use", ID: m.ToolCall.Id, Name: m.ToolCall.Name, Input: input}
+				results[i] = AnthropicContentBlock{Type: "tool_result", ToolUseID: m.ToolCall.Id, Content: m.Content}
+			}
+			messages = append(messages,
+				AnthropicMessage{Role: models.RoleAssistant, Content: uses},
+				AnthropicMessage{Role: models.RoleUser, Content: results},
+			)
+		case models.RoleUser, models.RoleAssistant:
+			// The API rejects empty text blocks
+			if strings.TrimSpace(msg.Content) == "" {
+				continue
+			}
+			messages = append(messages, anthropicText(msg.Role, msg.Content))
+		default:
+			a.logger.Debug("Skipping message in history", zap.String("role", string(msg.Role)))
+		}
+	}
+	return messages
+}
+
+func (a *Anthropic) convertToAnthropicTools() []AnthropicTool {
+	var anthropicTools []AnthropicTool
+
+	for _, tool := range a.toolRegistry.GetAllTools() {
+		if !a.options.AllowsTool(tool.Name()) {
+			continue
+		}
+		properties := make(map[string]any)
+		required := []string{}
+
+		for _, param := range tool.Parameters() {
+			paramSchema := map[string]any{
+				"type":        a.convertTypeToAnthropic(param.Type),
+				"description": param.Description,
+			}
+
+			if len(param.Enum) > 0 {
+				paramSchema["enum"] = param.Enum
+			}
+
+			properties[param.Name] = paramSchema
+
+			if param.Required {
+				required = append(required, param.Name)
+			}
+		}
+
+		anthropicTools = append(anthropicTools, AnthropicTool{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			InputSchema: map[string]any{
+				"type":       "object",
+				"properties": properties,
+				"required":   required,
+			},
+		})
+	}
+	return anthropicTools
+}
+
+func (a *Anthropic) convertTypeToAnthropic(genaiType genai.Type) string {
+	switch genaiType {
+	case genai.TypeString:
+		return "string"
+	case genai.TypeNumber:
+		return "number"
+	case genai.TypeInteger:
+		return "integer"
+	case genai.TypeBoolean:
+		return "boolean"
+	case genai.TypeArray:
+		return "array"
+	case genai.TypeObject:
+		return "object"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,226 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/synntx/askmind/internal/tools"
+	"go.uber.org/zap"
+)
+
+// The streams in testdata/anthropic are Messages API responses as the API
+// sends them, ping events included.
+
+// echoTool returns its text argument.
+type echoTool struct{}
+
+func (echoTool) Name() string        { return "echo" }
+func (echoTool) Description() string { return "Repeats the text it is given." }
+func (echoTool) Parameters() []tools.Parameter {
+	return []tools.Parameter{{Name: "text", Description: "What to repeat", Type: genai.TypeString, Required: true}}
+}
+func (echoTool) Execute(_ context.Context, args map[string]any) (string, error) {
+	text, _ := args["text"].(string)
+	return text, nil
+}
+
+// replayServer answers the n-th request to /messages with the n-th stream
+// and records the requests.
+type replayServer struct {
+	t        *testing.T
+	streams  []string
+	mu       sync.Mutex
+	requests []AnthropicRequest
+}
+
+func (s *replayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/messages" || r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") != anthropicAPIVersion {
+		s.t.Errorf("unexpected request %s %s with headers %v", r.Method, r.URL.Path, r.Header)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var request AnthropicRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.t.Errorf("decode request: %v", err)
+	}
+
+	s.mu.Lock()
+	n := len(s.requests)
+	s.requests = append(s.requests, request)
+	s.mu.Unlock()
+	if n >= len(s.streams) {
+		s.t.Errorf("request %d, only %d streams recorded", n+1, len(s.streams))
+		http.Error(w, "no more streams", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join("testdata", "anthropic", s.streams[n]))
+	if err != nil {
+		s.t.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Write(data)
+}
+
+func newTestAnthropic(baseURL string) *Anthropic {
+	registry := tools.NewToolRegistry()
+	registry.Register(echoTool{})
+	return NewAnthropic("test-key", baseURL, zap.NewNop(), "claude-test", registry)
+}
+
+func collect(stream <-chan ContentChunk) []ContentChunk {
+	var chunks []ContentChunk
+	for chunk := range stream {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func TestAnthropicStream(t *testing.T) {
+	echo := func(status Status, args map[string]any, result string) ContentChunk {
+		return ContentChunk{ToolInfo: &ToolInfo{ID: "toolu_01Echo", Name: "echo", Args: args, Result: result, Status: status}}
+	}
+	args := map[string]any{"text": "hi there"}
+
+	tests := []struct {
+		name    string
+		streams []string
+		want    []ContentChunk
+		wantErr string // prefix of the error ending the stream
+	}{
+		{
+			name:    "text only",
+			streams: []string{"text.sse"},
+			want: []ContentChunk{
+				{Content: "Hello"},
+				{Content: ", world!"},
+				{Usage: &Usage{PromptTokens: 25, CompletionTokens: 6, TotalTokens: 31}},
+			},
+		},
+		{
+			name:    "tool use then tool result",
+			streams: []string{"tool_use.sse", "tool_result.sse"},
+			want: []ContentChunk{
+				{Content: "Let me check."},
+				echo(StatusStart, nil, ""),
+				echo(StatusProcessing, args, ""),
+				echo(StatusEnd, args, "hi there"),
+				{Content: "The tool said: "},
+				{Content: "hi there"},
+				// both turns of the tool calling loop
+				{Usage: &Usage{PromptTokens: 310 + 402, CompletionTokens: 48 + 9, TotalTokens: 769}},
+			},
+		},
+		{
+			name:    "overloaded mid stream",
+			streams: []string{"overloaded.sse"},
+			want:    []ContentChunk{{Content: "Partial"}, {}},
+			wantErr: "server_error: Overloaded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &replayServer{t: t, streams: tt.streams}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			got := collect(newTestAnthropic(ts.URL).GenerateContentStream(context.Background(), nil, "Say hi"))
+
+			var err error
+			if n := len(got); n > 0 {
+				err, got[n-1].Err = got[n-1].Err, nil
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("stream failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+				t.Fatalf("stream error = %v, want prefix %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunks:\n got %s\nwant %s", describeChunks(got), describeChunks(tt.want))
+			}
+			if len(server.requests) != len(tt.streams) {
+				t.Fatalf("%d requests, want %d", len(server.requests), len(tt.streams))
+			}
+			if first := server.requests[0]; !first.Stream || len(first.Tools) != 1 || first.Tools[0].Name != "echo" {
+				t.Errorf("first request: stream %v, tools %+v", first.Stream, first.Tools)
+			}
+		})
+	}
+}
+
+// The turn with the tool_use goes back verbatim, followed by its result.
+func TestAnthropicStreamSendsToolResult(t *testing.T) {
+	server := &replayServer{t: t, streams: []string{"tool_use.sse", "tool_result.sse"}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	collect(newTestAnthropic(ts.URL).GenerateContentStream(context.Background(), nil, "Say hi"))
+	if len(server.requests) != 2 {
+		t.Fatalf("%d requests, want 2", len(server.requests))
+	}
+
+	messages := server.requests[1].Messages
+	if len(messages) != 3 {
+		t.Fatalf("second request has %d messages, want question, tool use and tool result", len(messages))
+	}
+	use, result := messages[1], messages[2]
+
+	if use.Role != "assistant" || len(use.Content) != 2 ||
+		use.Content[0].Type != "text" || use.Content[0].Text != "Let me check." ||
+		use.Content[1].Type != "tool_use" || use.Content[1].ID != "toolu_01Echo" {
+		t.Errorf("assistant turn = %+v", use)
+	} else if input := string(use.Content[1].Input); input != `{"text":"hi there"}` {
+		t.Errorf("tool_use input = %s", input)
+	}
+
+	want := AnthropicContentBlock{Type: "tool_result", ToolUseID: "toolu_01Echo", Content: "hi there"}
+	if result.Role != "user" || len(result.Content) != 1 || !reflect.DeepEqual(result.Content[0], want) {
+		t.Errorf("tool result turn = %+v, want one %+v", result, want)
+	}
+}
+
+func TestAnthropicStreamOverloadedStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(529)
+		w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`))
+	}))
+	defer ts.Close()
+
+	got := collect(newTestAnthropic(ts.URL).GenerateContentStream(context.Background(), nil, "Say hi"))
+	if len(got) != 1 || got[0].Err == nil || !strings.HasPrefix(got[0].Err.Error(), "server_error:") {
+		t.Fatalf("chunks = %s, want a single server_error", describeChunks(got))
+	}
+}
+
+func describeChunks(chunks []ContentChunk) string {
+	var b strings.Builder
+	for _, c := range chunks {
+		b.WriteString("\n\t")
+		switch {
+		case c.Err != nil:
+			b.WriteString("error " + c.Err.Error())
+		case c.ToolInfo != nil:
+			data, _ := json.Marshal(c.ToolInfo)
+			b.WriteString("tool " + string(data))
+		case c.Usage != nil:
+			data, _ := json.Marshal(c.Usage)
+			b.WriteString("usage " + string(data))
+		default:
+			b.WriteString("content " + c.Content)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,403 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	ErrUnknownProvider     = errors.New("unknown provider")
+	ErrUnknownModel        = errors.New("unknown model")
+	ErrProviderUnavailable = errors.New("provider unavailable")
+)
+
+// Capabilities describes what a model can be used for.
+type Capabilities struct {
+	Chat          bool `json:"chat"`
+	Tools         bool `json:"tools"`
+	Vision        bool `json:"vision"`
+	Embeddings    bool `json:"embeddings"`
+	ContextWindow int  `json:"context_window,omitempty"` // in tokens; 0 when the provider does not say
+}
+
+type ModelInfo struct {
+	ID           string       `json:"id"`
+	Provider     ProviderType `json:"provider"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// ProviderInfo is one provider of the catalog. Error is set instead of
+// Models when the provider could not be reached.
+type ProviderInfo struct {
+	Provider ProviderType `json:"provider"`
+	Name     string       `json:"name,omitempty"`
+	Models   []ModelInfo  `json:"models"`
+	Error    string       `json:"error,omitempty"`
+}
+
+const (
+	catalogTTL      = 5 * time.Minute
+	catalogErrorTTL = 30 * time.Second // retry unreachable providers sooner
+	catalogTimeout  = 10 * time.Second
+
+	anthropicContextWindow = 200000
+)
+
+type catalogEntry struct {
+	models  []ModelInfo
+	err     error
+	expires time.Time
+}
+
+// modelCatalog caches the model lists fetched from providers, which change
+// rarely and are needed on every completion request.
+type modelCatalog struct {
+	mu         sync.Mutex
+	entries    map[ProviderType]catalogEntry
+	httpClient *http.Client
+}
+
+func newModelCatalog() *modelCatalog {
+	return &modelCatalog{
+		entries:    make(map[ProviderType]catalogEntry),
+		httpClient: &http.Client{Timeout: catalogTimeout},
+	}
+}
+
+// configuredProviders returns the providers that have the credentials they
+// need, in a stable order. Ollama needs none and is always listed.
+func (f *DefaultLLMFactory) configuredProviders() []ProviderType {
+	var providers []ProviderType
+	for _, p := range []ProviderType{ProviderGemini, ProviderGroq, ProviderAnthropic} {
+		if apiKey, _ := f.credentials(p); apiKey != "" {
+			providers = append(providers, p)
+		}
+	}
+	if f.openAICompatConfig().BaseURL != "" {
+		providers = append(providers, ProviderOpenAICompatible)
+	}
+	return append(providers, ProviderOllama)
+}
+
+// ListModels returns every configured provider with the models it serves.
+func (f *DefaultLLMFactory) ListModels(ctx context.Context) []ProviderInfo {
+	providers := f.configuredProviders()
+	infos := make([]ProviderInfo, len(providers))
+
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p ProviderType) {
+			defer wg.Done()
+			info := ProviderInfo{Provider: p, Models: []ModelInfo{}}
+			if p == ProviderOpenAICompatible {
+				info.Name = f.openAICompat.Name
+			}
+			models, err := f.providerModels(ctx, p)
+			if err != nil {
+				info.Error = err.Error()
+			} else {
+				info.Models = models
+			}
+			infos[i] = info
+		}(i, p)
+	}
+	wg.Wait()
+	return infos
+}
+
+// LookupModel returns the catalog entry of a model. The error wraps
+// ErrUnknownProvider, ErrUnknownModel or ErrProviderUnavailable.
+func (f *DefaultLLMFactory) LookupModel(ctx context.Context, providerType ProviderType, model string) (ModelInfo, error) {
+	if !slices.Contains(f.configuredProviders(), providerType) {
+		return ModelInfo{}, fmt.Errorf("%w: %q", ErrUnknownProvider, providerType)
+	}
+	models, err := f.providerModels(ctx, providerType)
+	if err != nil {
+		return ModelInfo{}, err
+	}
+	for _, m := range models {
+		// Ollama tags default to "latest", so "llama3" names "llama3:latest".
+		if m.ID == model || (providerType == ProviderOllama && m.ID == model+":latest") {
+			return m, nil
+		}
+	}
+	return ModelInfo{}, fmt.Errorf("%w: %q is not served by %s", ErrUnknownModel, model, providerType)
+}
+
+// providerModels returns the cached model list of a provider, fetching it
+// when missing or stale.
+func (f *DefaultLLMFactory) providerModels(ctx context.Context, providerType ProviderType) ([]ModelInfo, error) {
+	c := f.catalog
+	c.mu.Lock()
+	entry, ok := c.entries[providerType]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.models, entry.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, catalogTimeout)
+	defer cancel()
+	models, err := f.fetchModels(ctx, providerType)
+	if err != nil {
+		f.logger.Warn("Failed to list provider models", zap.String("provider", string(providerType)), zap.Error(err))
+		err = fmt.Errorf("%w: %s: %v", ErrProviderUnavailable, providerType, err)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+
+	entry = catalogEntry{models: models, err: err, expires: time.Now().Add(catalogTTL)}
+	if err != nil {
+		entry.expires = time.Now().Add(catalogErrorTTL)
+	}
+	c.mu.Lock()
+	c.entries[providerType] = entry
+	c.mu.Unlock()
+	return models, err
+}
+
+func (f *DefaultLLMFactory) fetchModels(ctx context.Context, providerType ProviderType) ([]ModelInfo, error) {
+	apiKey, baseURL := f.credentials(providerType)
+
+	switch providerType {
+	case ProviderGemini:
+		return f.fetchGeminiModels(ctx, apiKey)
+	case ProviderGroq:
+		return f.fetchOpenAIModels(ctx, providerType, GroqConfig(apiKey))
+	case ProviderOpenAICompatible:
+		return f.fetchOpenAIModels(ctx, providerType, f.openAICompatConfig())
+	case ProviderAnthropic:
+		return f.fetchAnthropicModels(ctx, apiKey, baseURL)
+	case ProviderOllama:
+		return f.fetchOllamaModels(ctx, baseURL)
+	default:
+		return nil, fmt.Errorf("unsupported provider: %s", providerType)
+	}
+}
+
+func (f *DefaultLLMFactory) fetchGeminiModels(ctx context.Context, apiKey string) ([]ModelInfo, error) {
+	client, err := NewGeminiClient(ctx, apiKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gemini client: %w", err)
+	}
+	defer client.Close()
+
+	var models []ModelInfo
+	it := client.ListModels(ctx)
+	for {
+		m, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, geminiModelInfo(m))
+	}
+	return models, nil
+}
+
+func geminiModelInfo(m *genai.ModelInfo) ModelInfo {
+	chat := slices.Contains(m.SupportedGenerationMethods, "generateContent")
+	return ModelInfo{
+		ID:       strings.TrimPrefix(m.Name, "models/"),
+		Provider: ProviderGemini,
+		Capabilities: Capabilities{
+			Chat:          chat,
+			Tools:         chat,
+			Vision:        chat, // every Gemini generation model accepts images
+			Embeddings:    slices.Contains(m.SupportedGenerationMethods, "embedContent"),
+			ContextWindow: int(m.InputTokenLimit),
+		},
+	}
+}
+
+// fetchOpenAIModels lists the models of an OpenAI-compatible endpoint. An
+// explicit model list in the config wins over the endpoint's /models, which
+// many self-hosted servers do not implement.
+func (f *DefaultLLMFactory) fetchOpenAIModels(ctx context.Context, providerType ProviderType, config OpenAICompatibleConfig) ([]ModelInfo, error) {
+	ids := config.Models
+	if len(ids) == 0 {
+		headers := map[string]string{}
+		for name, value := range config.Headers {
+			headers[name] = value
+		}
+		if config.APIKey != "" {
+			headers["Authorization"] = "Bearer " + config.APIKey
+		}
+		var list struct {
+			Data []struct {
+				ID            string `json:"id"`
+				ContextWindow int    `json:"context_window"` // Groq extension
+			} `json:"data"`
+		}
+		if err := f.catalog.getJSON(ctx, strings.TrimRight(config.BaseURL, "/")+"/models", headers, &list); err != nil {
+			return nil, err
+		}
+		models := make([]ModelInfo, 0, len(list.Data))
+		for _, m := range list.Data {
+			info := openAIModelInfo(providerType, m.ID, config)
+			info.Capabilities.ContextWindow = m.ContextWindow
+			models = append(models, info)
+		}
+		return models, nil
+	}
+
+	models := make([]ModelInfo, 0, len(ids))
+	for _, id := range ids {
+		models = append(models, openAIModelInfo(providerType, id, config))
+	}
+	return models, nil
+}
+
+// openAIModelInfo guesses capabilities from the model name, the only thing
+// the OpenAI /models route reports.
+func openAIModelInfo(providerType ProviderType, id string, config OpenAICompatibleConfig) ModelInfo {
+	name := strings.ToLower(id)
+	embeddings := strings.Contains(name, "embed")
+	chat := !embeddings && !strings.Contains(name, "whisper") && !strings.Contains(name, "tts")
+	return ModelInfo{
+		ID:       id,
+		Provider: providerType,
+		Capabilities: Capabilities{
+			Chat:       chat,
+			Tools:      chat,
+			Vision:     chat && (strings.Contains(name, "vision") || strings.Contains(name, "-vl") || strings.Contains(name, "gpt-4o")),
+			Embeddings: embeddings && !config.NoEmbeddings,
+		},
+	}
+}
+
+func (f *DefaultLLMFactory) fetchAnthropicModels(ctx context.Context, apiKey, baseURL string) ([]ModelInfo, error) {
+	if baseURL == "" {
+		baseURL = anthropicAPIURL
+	}
+	headers := map[string]string{
+		"x-api-key":         apiKey,
+		"anthropic-version": anthropicAPIVersion,
+	}
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := f.catalog.getJSON(ctx, strings.TrimRight(baseURL, "/")+"/models?limit=1000", headers, &list); err != nil {
+		return nil, err
+	}
+	models := make([]ModelInfo, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, ModelInfo{
+			ID:       m.ID,
+			Provider: ProviderAnthropic,
+			Capabilities: Capabilities{
+				Chat:          true,
+				Tools:         true,
+				Vision:        true,
+				ContextWindow: anthropicContextWindow,
+			},
+		})
+	}
+	return models, nil
+}
+
+// fetchOllamaModels lists the local models from /api/tags and asks /api/show
+// for each one's capabilities and context length.
+func (f *DefaultLLMFactory) fetchOllamaModels(ctx context.Context, baseURL string) ([]ModelInfo, error) {
+	baseURL = strings.TrimRight(baseURL, "/")
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := f.catalog.getJSON(ctx, baseURL+"/api/tags", nil, &tags); err != nil {
+		return nil, err
+	}
+
+	models := make([]ModelInfo, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		var show struct {
+			Capabilities []string       `json:"capabilities"`
+			ModelInfo    map[string]any `json:"model_info"`
+		}
+		body := strings.NewReader(fmt.Sprintf(`{"model":%q}`, m.Name))
+		if err := f.catalog.postJSON(ctx, baseURL+"/api/show", body, &show); err != nil {
+			// Older Ollama versions report no capabilities; assume a chat model.
+			f.logger.Debug("Failed to fetch Ollama model details", zap.String("model", m.Name), zap.Error(err))
+			show.Capabilities = []string{"completion"}
+		}
+		models = append(models, ollamaModelInfo(m.Name, show.Capabilities, show.ModelInfo))
+	}
+	return models, nil
+}
+
+func ollamaModelInfo(name string, capabilities []string, modelInfo map[string]any) ModelInfo {
+	if len(capabilities) == 0 {
+		capabilities = []string{"completion"}
+	}
+	info := ModelInfo{
+		ID:       name,
+		Provider: ProviderOllama,
+		Capabilities: Capabilities{
+			Chat:       slices.Contains(capabilities, "completion"),
+			Tools:      slices.Contains(capabilities, "tools"),
+			Vision:     slices.Contains(capabilities, "vision"),
+			Embeddings: slices.Contains(capabilities, "embedding"),
+		},
+	}
+	// The key is prefixed with the architecture, e.g. "llama.context_length".
+	for key, value := range modelInfo {
+		if n, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			info.Capabilities.ContextWindow = int(n)
+		}
+	}
+	return info
+}
+
+func (c *modelCatalog) getJSON(ctx context.Context, url string, headers map[string]string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return c.do(req, out)
+}
+
+func (c *modelCatalog) postJSON(ctx context.Context, url string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, out)
+}
+
+func (c *modelCatalog) do(req *http.Request, out any) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
 
 	"github.com/synntx/askmind/internal/tools"
 	"go.uber.org/zap"
@@ -12,14 +13,27 @@ import (
 type ProviderType string
 
 const (
-	ProviderGemini ProviderType = "gemini"
-	ProviderGroq   ProviderType = "groq"
-	ProviderOllama ProviderType = "ollama"
+	ProviderGemini    ProviderType = "gemini"
+	ProviderGroq      ProviderType = "groq"
+	ProviderOllama    ProviderType = "ollama"
+	ProviderAnthropic ProviderType = "anthropic"
+
+	// ProviderOpenAICompatible is any endpoint implementing the OpenAI chat
+	// completions API, configured with OpenAICompatibleConfig.
+	ProviderOpenAICompatible ProviderType = "openai_compatible"
 )
 
 // LLMFactory defines an interface for creating LLM instances.
 type LLMFactory interface {
 	CreateLLM(ctx context.Context, providerType ProviderType, model string) (LLM, error)
+
+	// ListModels returns every configured provider with the models it serves.
+	ListModels(ctx context.Context) []ProviderInfo
+	// LookupModel returns the catalog entry of a model. The error wraps
+	// ErrUnknownProvider, ErrUnknownModel or ErrProviderUnavailable.
+	LookupModel(ctx context.Context, providerType ProviderType, model string) (ModelInfo, error)
+	// ListTools returns the tools the LLMs it creates can call, by name.
+	ListTools() []tools.Tool
 }
 
 // DefaultLLMFactory implements the LLMFactory interface.
@@ -28,35 +42,107 @@ type DefaultLLMFactory struct {
 	toolRegistry *tools.ToolRegistry
 	apiKeys      map[ProviderType]string
 	baseUrls     map[ProviderType]string
+	openAICompat OpenAICompatibleConfig
+	fallback     FallbackConfig
+	catalog      *modelCatalog
 }
 
 // NewDefaultLLMFactory creates a new instance of DefaultLLMFactory.
 // It takes a map of API keys and base URLs for different providers,
-// allowing the factory to manage credentials and endpoints.
+// allowing the factory to manage credentials and endpoints, the
+// endpoint used for ProviderOpenAICompatible, and the retry and
+// failover policy applied to every LLM it creates.
 func NewDefaultLLMFactory(
 	logger *zap.Logger,
 	toolRegistry *tools.ToolRegistry,
 	apiKeys map[ProviderType]string,
 	baseUrls map[ProviderType]string,
+	openAICompat OpenAICompatibleConfig,
+	fallback FallbackConfig,
 ) *DefaultLLMFactory {
 	return &DefaultLLMFactory{
 		logger:       logger,
 		toolRegistry: toolRegistry,
 		apiKeys:      apiKeys,
 		baseUrls:     baseUrls,
+		openAICompat: openAICompat,
+		fallback:     fallback,
+		catalog:      newModelCatalog(),
+	}
+}
+
+// apiKeyEnv names the environment variable read when no key was passed to
+// NewDefaultLLMFactory.
+var apiKeyEnv = map[ProviderType]string{
+	ProviderGemini:    "GEMINI_API_KEY",
+	ProviderGroq:      "GROQ_API_KEY",
+	ProviderAnthropic: "ANTHROPIC_API_KEY",
+}
+
+// credentials returns the API key and base URL configured for a provider.
+func (f *DefaultLLMFactory) credentials(providerType ProviderType) (apiKey, baseURL string) {
+	apiKey = f.apiKeys[providerType]
+	if apiKey == "" && apiKeyEnv[providerType] != "" {
+		apiKey = os.Getenv(apiKeyEnv[providerType])
+	}
+	baseURL = f.baseUrls[providerType]
+	if providerType == ProviderOllama && baseURL == "" {
+		baseURL = os.Getenv("OLLAMA_BASE_URL")
+		if baseURL == "" {
+			baseURL = "http://localhost:11434" // TODO: put that in config
+		}
+	}
+	return apiKey, baseURL
+}
+
+// openAICompatConfig returns the endpoint used for ProviderOpenAICompatible.
+func (f *DefaultLLMFactory) openAICompatConfig() OpenAICompatibleConfig {
+	config := f.openAICompat
+	apiKey, baseURL := f.credentials(ProviderOpenAICompatible)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	if apiKey != "" {
+		config.APIKey = apiKey
 	}
+	return config
 }
 
-// CreateLLM creates an LLM instance based on the provided providerType and model.
+// CreateLLM creates an LLM instance based on the provided providerType and model,
+// wrapped in a FallbackLLM that retries it and fails over to the configured
+// fallback model.
 func (f *DefaultLLMFactory) CreateLLM(ctx context.Context, providerType ProviderType, model string) (LLM, error) {
-	apiKey := f.apiKeys[providerType]
-	baseURL := f.baseUrls[providerType]
+	primary, err := f.createLLM(ctx, providerType, model)
+	if err != nil {
+		return nil, err
+	}
+
+	var secondary LLM
+	fb := f.fallback
+	if fb.Provider != "" && (fb.Provider != providerType || fb.Model != model) {
+		secondary, err = f.createLLM(ctx, fb.Provider, fb.Model)
+		if err != nil {
+			f.logger.Warn("Failed to create fallback LLM, continuing without failover",
+				zap.String("provider", string(fb.Provider)),
+				zap.String("model", fb.Model),
+				zap.Error(err))
+			secondary = nil
+		}
+	}
+	return NewFallbackLLM(primary, secondary, fb.Retry, f.logger), nil
+}
+
+func (f *DefaultLLMFactory) ListTools() []tools.Tool {
+	list := f.toolRegistry.GetAllTools()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+func (f *DefaultLLMFactory) createLLM(ctx context.Context, providerType ProviderType, model string) (LLM, error) {
+	apiKey, baseURL := f.credentials(providerType)
 
 	switch providerType {
 	case ProviderGemini:
-		if apiKey == "" {
-			apiKey = os.Getenv("GEMINI_API_KEY")
-		}
 		if apiKey == "" {
 			return nil, fmt.Errorf("missing GEMINI_API_KEY for Gemini provider")
 		}
@@ -68,21 +154,28 @@ func (f *DefaultLLMFactory) CreateLLM(ctx context.Context, providerType Provider
 		return NewGemini(client, f.logger, model, genaiTools, f.toolRegistry), nil
 
 	case ProviderGroq:
-		if apiKey == "" {
-			apiKey = os.Getenv("GROQ_API_KEY")
-		}
 		if apiKey == "" {
 			return nil, fmt.Errorf("missing GROQ_API_KEY for Groq provider")
 		}
 		return NewGroq(apiKey, f.logger, model, f.toolRegistry), nil
 
-	case ProviderOllama:
-		if baseURL == "" {
-			baseURL = os.Getenv("OLLAMA_BASE_URL")
-			if baseURL == "" {
-				baseURL = "http://localhost:11434" // TODO: put that in config
-			}
+	case ProviderAnthropic:
+		if apiKey == "" {
+			return nil, fmt.Errorf("missing ANTHROPIC_API_KEY for Anthropic provider")
 		}
+		return NewAnthropic(apiKey, baseURL, f.logger, model, f.toolRegistry), nil
+
+	case ProviderOpenAICompatible:
+		config := f.openAICompatConfig()
+		if config.BaseURL == "" {
+			return nil, fmt.Errorf("missing OPENAI_COMPATIBLE_BASE_URL for OpenAI-compatible provider")
+		}
+		if !config.AllowsModel(model) {
+			return nil, fmt.Errorf("model %q is not served by the OpenAI-compatible endpoint", model)
+		}
+		return NewOpenAICompatible(config, f.logger, model, f.toolRegistry), nil
+
+	case ProviderOllama:
 		ollamaLLM := NewOllama(baseURL, f.logger, model, f.toolRegistry)
 
 		// Check for Gemini API key for embeddings fallback if Ollama is used
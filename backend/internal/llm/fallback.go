@@ -0,0 +1,256 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/synntx/askmind/internal/models"
+	"go.uber.org/zap"
+)
+
+// RetryPolicy controls how often FallbackLLM retries a provider before
+// moving on to the next one.
+type RetryPolicy struct {
+	MaxAttempts    int           // attempts per provider, including the first
+	InitialBackoff time.Duration // wait before the first retry, doubled for each one after
+	MaxBackoff     time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     8 * time.Second,
+}
+
+// backoff returns the wait before the given retry (1 for the first), with
+// jitter so clients rate limited together do not retry together.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// FallbackConfig names the provider and model FallbackLLM switches to once
+// the requested one keeps failing. An empty Provider disables the switch but
+// keeps the retries.
+type FallbackConfig struct {
+	Provider ProviderType
+	Model    string
+	Retry    RetryPolicy
+}
+
+// IsRetryable reports whether err is a transient provider failure: a rate
+// limit, a server error or a network error.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	msg := err.Error()
+	if strings.Contains(msg, "rate_limit_exceeded") || strings.Contains(msg, "server_error") {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// FallbackLLM retries the primary LLM with exponential backoff and, if it
+// keeps failing, switches to a secondary one. A stream is only retried or
+// switched while nothing has been sent from it, so an answer never mixes the
+// output of two attempts.
+type FallbackLLM struct {
+	LLM
+	secondary LLM
+	policy    RetryPolicy
+	logger    *zap.Logger
+
+	mu     sync.Mutex
+	active LLM // the LLM that produced the latest response
+}
+
+func NewFallbackLLM(primary LLM, secondary LLM, policy RetryPolicy, logger *zap.Logger) *FallbackLLM {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return &FallbackLLM{
+		LLM:       primary,
+		secondary: secondary,
+		policy:    policy,
+		logger:    logger,
+		active:    primary,
+	}
+}
+
+func (f *FallbackLLM) providers() []LLM {
+	if f.secondary == nil {
+		return []LLM{f.LLM}
+	}
+	return []LLM{f.LLM, f.secondary}
+}
+
+func (f *FallbackLLM) setActive(l LLM) {
+	f.mu.Lock()
+	f.active = l
+	f.mu.Unlock()
+}
+
+func (f *FallbackLLM) current() LLM {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active
+}
+
+// GetProviderName reports the provider that produced the latest response.
+func (f *FallbackLLM) GetProviderName() string {
+	return f.current().GetProviderName()
+}
+
+// GetModelName reports the model that produced the latest response.
+func (f *FallbackLLM) GetModelName() string {
+	return f.current().GetModelName()
+}
+
+func (f *FallbackLLM) SetSystemPrompt(prompt string) {
+	for _, l := range f.providers() {
+		l.SetSystemPrompt(prompt)
+	}
+}
+
+func (f *FallbackLLM) SetOptions(opts Options) {
+	for _, l := range f.providers() {
+		l.SetOptions(opts)
+	}
+}
+
+func (f *FallbackLLM) GenerateContent(ctx context.Context, input string) (string, error) {
+	var err error
+	for _, l := range f.providers() {
+		for attempt := 1; attempt <= f.policy.MaxAttempts; attempt++ {
+			if attempt > 1 {
+				if err := f.wait(ctx, attempt-1); err != nil {
+					return "", err
+				}
+			}
+			var content string
+			content, err = l.GenerateContent(ctx, input)
+			if err == nil {
+				f.setActive(l)
+				return content, nil
+			}
+			f.logAttemptFailed(l, attempt, err)
+			if !IsRetryable(err) {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+	return "", err
+}
+
+func (f *FallbackLLM) GenerateContentStream(ctx context.Context, history []models.ChatMessage, userMessage string) <-chan ContentChunk {
+	out := make(chan ContentChunk)
+
+	go func() {
+		defer close(out)
+		var err error
+		for _, l := range f.providers() {
+			for attempt := 1; attempt <= f.policy.MaxAttempts; attempt++ {
+				if attempt > 1 {
+					if err := f.wait(ctx, attempt-1); err != nil {
+						return
+					}
+				}
+				var started bool
+				started, err = f.relay(ctx, l, l.GenerateContentStream(ctx, history, userMessage), out)
+				if err == nil {
+					return
+				}
+				if started {
+					// Part of the answer is out; a retry would repeat it.
+					send(ctx, out, ContentChunk{Err: err})
+					return
+				}
+				f.logAttemptFailed(l, attempt, err)
+				if !IsRetryable(err) {
+					break
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+		send(ctx, out, ContentChunk{Err: err})
+	}()
+
+	return out
+}
+
+// relay forwards chunks from in to out until in is closed or fails. The
+// error is returned instead of forwarded so the caller can still retry;
+// started reports whether any content or tool call reached out.
+func (f *FallbackLLM) relay(ctx context.Context, l LLM, in <-chan ContentChunk, out chan<- ContentChunk) (started bool, err error) {
+	defer func() {
+		// Let the provider finish without blocking on a stream nobody reads.
+		go func() {
+			for range in {
+			}
+		}()
+	}()
+
+	for chunk := range in {
+		if chunk.Err != nil {
+			return started, chunk.Err
+		}
+		if !started && (chunk.Content != "" || chunk.ToolInfo != nil) {
+			f.setActive(l)
+			started = true
+		}
+		if !send(ctx, out, chunk) {
+			return started, ctx.Err()
+		}
+	}
+	return started, nil
+}
+
+func (f *FallbackLLM) wait(ctx context.Context, retry int) error {
+	timer := time.NewTimer(f.policy.backoff(retry))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (f *FallbackLLM) logAttemptFailed(l LLM, attempt int, err error) {
+	f.logger.Warn("LLM attempt failed",
+		zap.String("provider", l.GetProviderName()),
+		zap.String("model", l.GetModelName()),
+		zap.Int("attempt", attempt),
+		zap.Bool("retryable", IsRetryable(err)),
+		zap.Error(err))
+}
+
+func send(ctx context.Context, out chan<- ContentChunk, chunk ContentChunk) bool {
+	select {
+	case out <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
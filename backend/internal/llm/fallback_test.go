@@ -0,0 +1,156 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/synntx/askmind/internal/models"
+	"go.uber.org/zap"
+)
+
+// stubLLM answers the n-th stream request with the n-th of its streams, the
+// last one repeated once they run out.
+type stubLLM struct {
+	LLM
+	name    string
+	streams [][]ContentChunk
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *stubLLM) GenerateContentStream(context.Context, []models.ChatMessage, string) <-chan ContentChunk {
+	s.mu.Lock()
+	stream := s.streams[min(s.calls, len(s.streams)-1)]
+	s.calls++
+	s.mu.Unlock()
+
+	out := make(chan ContentChunk, len(stream))
+	for _, chunk := range stream {
+		out <- chunk
+	}
+	close(out)
+	return out
+}
+
+func (s *stubLLM) GetModelName() string    { return s.name }
+func (s *stubLLM) GetProviderName() string { return s.name }
+
+func (s *stubLLM) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestFallbackLLMStream(t *testing.T) {
+	var (
+		overloaded  = errors.New("server_error: Overloaded")
+		rateLimited = errors.New("rate_limit_exceeded: slow down")
+		badRequest  = errors.New("invalid_request_error: prompt is too long")
+	)
+	fail := func(err error) []ContentChunk { return []ContentChunk{{Err: err}} }
+	answer := []ContentChunk{{Content: "Hello"}, {Content: " world"}}
+
+	tests := []struct {
+		name          string
+		primary       [][]ContentChunk
+		secondary     [][]ContentChunk
+		wantContent   string
+		wantErr       error
+		wantPrimary   int // calls to each provider
+		wantSecondary int
+		wantModel     string
+	}{
+		{
+			name:          "retried, then recovered",
+			primary:       [][]ContentChunk{fail(rateLimited), answer},
+			secondary:     [][]ContentChunk{answer},
+			wantContent:   "Hello world",
+			wantPrimary:   2,
+			wantSecondary: 0,
+			wantModel:     "primary",
+		},
+		{
+			name:          "retried, then failed over",
+			primary:       [][]ContentChunk{fail(overloaded)},
+			secondary:     [][]ContentChunk{answer},
+			wantContent:   "Hello world",
+			wantPrimary:   3,
+			wantSecondary: 1,
+			wantModel:     "secondary",
+		},
+		{
+			name:          "failed after content",
+			primary:       [][]ContentChunk{{{Content: "Partial"}, {Err: overloaded}}},
+			secondary:     [][]ContentChunk{answer},
+			wantContent:   "Partial",
+			wantErr:       overloaded,
+			wantPrimary:   1,
+			wantSecondary: 0,
+			wantModel:     "primary",
+		},
+		{
+			name:          "not retryable",
+			primary:       [][]ContentChunk{fail(badRequest)},
+			secondary:     [][]ContentChunk{answer},
+			wantContent:   "Hello world",
+			wantPrimary:   1,
+			wantSecondary: 1,
+			wantModel:     "secondary",
+		},
+		{
+			name:          "all failed",
+			primary:       [][]ContentChunk{fail(overloaded)},
+			secondary:     [][]ContentChunk{fail(rateLimited)},
+			wantErr:       rateLimited,
+			wantPrimary:   3,
+			wantSecondary: 3,
+			wantModel:     "primary",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &stubLLM{name: "primary", streams: tt.primary}
+			secondary := &stubLLM{name: "secondary", streams: tt.secondary}
+			policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+			f := NewFallbackLLM(primary, secondary, policy, zap.NewNop())
+
+			var content strings.Builder
+			var errs []error
+			for chunk := range f.GenerateContentStream(context.Background(), nil, "Say hello") {
+				if chunk.Err != nil {
+					errs = append(errs, chunk.Err)
+					continue
+				}
+				if len(errs) > 0 {
+					t.Errorf("chunk %+v after the error", chunk)
+				}
+				content.WriteString(chunk.Content)
+			}
+
+			if got := content.String(); got != tt.wantContent {
+				t.Errorf("content %q, want %q", got, tt.wantContent)
+			}
+			switch {
+			case tt.wantErr == nil && len(errs) > 0:
+				t.Errorf("errors %v, want none", errs)
+			case tt.wantErr != nil && (len(errs) != 1 || !errors.Is(errs[0], tt.wantErr)):
+				t.Errorf("errors %v, want only %v", errs, tt.wantErr)
+			}
+			if got := primary.callCount(); got != tt.wantPrimary {
+				t.Errorf("primary called %d times, want %d", got, tt.wantPrimary)
+			}
+			if got := secondary.callCount(); got != tt.wantSecondary {
+				t.Errorf("secondary called %d times, want %d", got, tt.wantSecondary)
+			}
+			if got := f.GetModelName(); got != tt.wantModel {
+				t.Errorf("GetModelName() = %q, want %q", got, tt.wantModel)
+			}
+		})
+	}
+}
@@ -27,6 +27,7 @@ type Gemini struct {
 	ModelName    string
 	tools        []*genai.Tool
 	toolRegistry *tools.ToolRegistry
+	options      Options
 
 	SystemPrompt string
 }
@@ -79,9 +80,28 @@ func (g *Gemini) GetModelName() string {
 
 func (g *Gemini) SetSystemPrompt(p string) { g.SystemPrompt = p }
 
-func (g *Gemini) GenerateContent(ctx context.Context, input string) (string, error) {
+func (g *Gemini) SetOptions(opts Options) { g.options = opts }
+
+// generativeModel returns the model configured with the options and the
+// tools it may call.
+func (g *Gemini) generativeModel() *genai.GenerativeModel {
 	model := g.Client.GenerativeModel(g.ModelName)
-	model.Tools = g.tools
+	for _, tool := range g.tools {
+		if len(tool.FunctionDeclarations) > 0 && g.options.AllowsTool(tool.FunctionDeclarations[0].Name) {
+			model.Tools = append(model.Tools, tool)
+		}
+	}
+	if g.options.Temperature != nil {
+		model.SetTemperature(*g.options.Temperature)
+	}
+	if g.options.MaxOutputTokens > 0 {
+		model.SetMaxOutputTokens(int32(g.options.MaxOutputTokens))
+	}
+	return model
+}
+
+func (g *Gemini) GenerateContent(ctx context.Context, input string) (string, error) {
+	model := g.generativeModel()
 	resp, err := model.GenerateContent(ctx, genai.Text(input))
 	if err != nil {
 		g.logger.Error("Failed to generate content from Gemini", zap.Error(err), zap.String("input", input))
@@ -131,11 +151,11 @@ func (g *Gemini) GenerateContentStream(ctx context.Context, history []models.Cha
 			close(contentStream)
 		}()
 
-		model := g.Client.GenerativeModel(g.ModelName)
-		model.Tools = g.tools
+		model := g.generativeModel()
 
-		prompt := g.SystemPrompt
-		model.SystemInstruction = genai.NewUserContent(genai.Text(fmt.Sprintf(prompt, time.Now().UTC().UnixMilli())))
+		// The prompt is already rendered by the prompts package; passing it
+		// through Sprintf would mangle any '%' in retrieved source text.
+		model.SystemInstruction = genai.NewUserContent(genai.Text(g.SystemPrompt))
 
 		// model.SystemInstruction = genai.NewUserContent(genai.Text(researchAssistantSystemPrompt))
 		// model.SystemInstruction = genai.NewUserContent(genai.Text(fmt.Sprintf(prompts.RESEARCH_ASSISTANT_SYSTEM_PROMPT, time.Now().UTC().UnixMilli())))
@@ -171,11 +191,15 @@ func (g *Gemini) GenerateContentStream(ctx context.Context, history []models.Cha
 		)
 		partsToSendToGemini := []genai.Part{genai.Text(userMessage)}
 
+		var usage Usage
+
 		for i := range MAX_TOOL_CALL_ITERATIONS {
 			g.logger.Info("Starting LLM turn iteration", zap.Int("iteration", i), zap.Any("parts_sent_to_gemini", partsToSendToGemini))
 
 			stream := cs.SendMessageStream(ctx, partsToSendToGemini...)
 			var functionCalls []genai.FunctionCall
+			var callIDs []string
+			var turnUsage *genai.UsageMetadata // running totals, the last chunk has the final count
 
 			g.logger.Debug("Calling stream.Next() in loop")
 
@@ -183,6 +207,9 @@ func (g *Gemini) GenerateContentStream(ctx context.Context, history []models.Cha
 				resp, err := stream.Next()
 				if err == iterator.Done || err == io.EOF {
 					g.logger.Info("Gemini stream finished normally for this turn", zap.Int("iteration", i))
+					if turnUsage != nil {
+						usage.Add(int(turnUsage.PromptTokenCount), int(turnUsage.CandidatesTokenCount))
+					}
 					break
 				}
 				if err != nil {
@@ -213,6 +240,9 @@ func (g *Gemini) GenerateContentStream(ctx context.Context, history []models.Cha
 					return
 				}
 
+				if resp != nil && resp.UsageMetadata != nil {
+					turnUsage = resp.UsageMetadata
+				}
 				if resp == nil || len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
 					g.logger.Warn("Unexpected empty response or candidates from Gemini stream chunk", zap.Int("iteration", i))
 					continue
@@ -234,7 +264,9 @@ func (g *Gemini) GenerateContentStream(ctx context.Context, history []models.Cha
 					case genai.FunctionCall:
 						g.logger.Info("Received function call from Gemini", zap.String("name", p.Name), zap.Any("args", p.Args), zap.Int("iteration", i))
 						functionCalls = append(functionCalls, p)
+						callIDs = append(callIDs, newToolCallID())
 						contentStream <- ContentChunk{ToolInfo: &ToolInfo{
+							ID:     callIDs[len(callIDs)-1],
 							Name:   p.Name,
 							Args:   p.Args,
 							Result: "",
@@ -248,12 +280,13 @@ func (g *Gemini) GenerateContentStream(ctx context.Context, history []models.Cha
 
 			if len(functionCalls) == 0 {
 				g.logger.Info("LLM interaction complete (no function calls in final response)", zap.Int("iteration", i))
+				contentStream <- ContentChunk{Usage: &usage}
 				return
 			}
 
 			var functionResponses []genai.Part
 
-			partsToSendToGemini = g.executeToolsInParallel(ctx, contentStream, functionCalls)
+			partsToSendToGemini = g.executeToolsInParallel(ctx, contentStream, functionCalls, callIDs)
 
 			g.logger.Debug("Prepared batch of function responses for next turn", zap.Int("num_responses", len(functionResponses)), zap.Int("iteration", i))
 		}
@@ -269,7 +302,26 @@ func (g *Gemini) convertToGenaiContent(history []models.ChatMessage) []*genai.Co
 	var contents []*genai.Content
 
 	// First pass: convert and filter
-	for _, msg := range history {
+	for _, group := range toolCallGroups(history) {
+		msg := group[0]
+		if msg.Role == models.RoleTool {
+			// Replay the calls as a model turn and their results as the reply
+			calls := make([]genai.Part, 0, len(group))
+			responses := make([]genai.Part, 0, len(group))
+			for _, m := range group {
+				calls = append(calls, genai.FunctionCall{Name: m.ToolCall.Name, Args: m.ToolCall.Args})
+				responses = append(responses, genai.FunctionResponse{
+					Name:     m.ToolCall.Name,
+					Response: map[string]any{"content": m.Content},
+				})
+			}
+			contents = append(contents,
+				&genai.Content{Role: "model", Parts: calls},
+				&genai.Content{Role: "user", Parts: responses},
+			)
+			continue
+		}
+
 		// Skip empty messages
 		if strings.TrimSpace(msg.Content) == "" {
 			g.logger.Debug("Skipping empty message",
@@ -288,10 +340,6 @@ func (g *Gemini) convertToGenaiContent(history []models.ChatMessage) []*genai.Co
 			// Gemini doesn't support system role in history
 			g.logger.Debug("Skipping system message in history")
 			continue
-		case models.RoleTool:
-			// Tool responses need special handling
-			g.logger.Debug("Skipping tool message in history")
-			continue
 		default:
 			g.logger.Warn("Unknown role in history", zap.String("role", string(msg.Role)))
 			continue
@@ -318,6 +366,12 @@ func (g *Gemini) convertToGenaiContent(history []models.ChatMessage) []*genai.Co
 			continue
 		}
 
+		// Function results are only valid right after the calls they answer
+		if isFunctionResponses(content) && (len(cleaned) == 0 || !isFunctionCalls(cleaned[len(cleaned)-1])) {
+			g.logger.Debug("Function responses without their calls, skipping", zap.Int("index", i))
+			continue
+		}
+
 		// Check for consecutive same roles
 		if content.Role == lastRole {
 			g.logger.Debug("Consecutive same role detected, skipping",
@@ -335,6 +389,10 @@ func (g *Gemini) convertToGenaiContent(history []models.ChatMessage) []*genai.Co
 		g.logger.Debug("History ends with user message, removing it since we're adding a new user message")
 		cleaned = cleaned[:len(cleaned)-1]
 	}
+	// ...which must not leave function calls without their responses
+	if len(cleaned) > 0 && isFunctionCalls(cleaned[len(cleaned)-1]) {
+		cleaned = cleaned[:len(cleaned)-1]
+	}
 
 	g.logger.Info("Cleaned history",
 		zap.Int("original_count", len(history)),
@@ -344,7 +402,23 @@ func (g *Gemini) convertToGenaiContent(history []models.ChatMessage) []*genai.Co
 	return cleaned
 }
 
-func (g *Gemini) executeToolsInParallel(ctx context.Context, contentStream chan ContentChunk, functionCalls []genai.FunctionCall) []genai.Part {
+func isFunctionCalls(content *genai.Content) bool {
+	if len(content.Parts) == 0 {
+		return false
+	}
+	_, ok := content.Parts[0].(genai.FunctionCall)
+	return ok
+}
+
+func isFunctionResponses(content *genai.Content) bool {
+	if len(content.Parts) == 0 {
+		return false
+	}
+	_, ok := content.Parts[0].(genai.FunctionResponse)
+	return ok
+}
+
+func (g *Gemini) executeToolsInParallel(ctx context.Context, contentStream chan ContentChunk, functionCalls []genai.FunctionCall, callIDs []string) []genai.Part {
 	var wg sync.WaitGroup
 	resultChan := make(chan struct {
 		response genai.Part
@@ -359,6 +433,7 @@ func (g *Gemini) executeToolsInParallel(ctx context.Context, contentStream chan
 
 			select {
 			case contentStream <- ContentChunk{ToolInfo: &ToolInfo{
+				ID:     callIDs[idx],
 				Name:   fc.Name,
 				Args:   fc.Args,
 				Result: "",
@@ -372,9 +447,10 @@ func (g *Gemini) executeToolsInParallel(ctx context.Context, contentStream chan
 			defer cancel()
 
 			tool, ok := g.toolRegistry.GetTool(fc.Name)
-			if !ok {
+			if !ok || !g.options.AllowsTool(fc.Name) {
 				select {
 				case contentStream <- ContentChunk{ToolInfo: &ToolInfo{
+					ID:     callIDs[idx],
 					Name:   fc.Name,
 					Args:   fc.Args,
 					Result: fmt.Sprintf("Tool '%s' not found", fc.Name),
@@ -387,6 +463,10 @@ func (g *Gemini) executeToolsInParallel(ctx context.Context, contentStream chan
 					index    int
 					err      error
 				}{
+					response: genai.FunctionResponse{
+						Name:     fc.Name,
+						Response: map[string]any{"content": fmt.Sprintf("Tool '%s' not found", fc.Name)},
+					},
 					index: idx,
 					err:   fmt.Errorf("tool not found: %s", fc.Name),
 				}
@@ -394,9 +474,15 @@ func (g *Gemini) executeToolsInParallel(ctx context.Context, contentStream chan
 			}
 
 			result, err := tool.Execute(toolCtx, fc.Args)
+			if err != nil {
+				// The model gets the error as the result, as the other providers do
+				g.logger.Error("Tool execution failed", zap.String("tool", fc.Name), zap.Error(err))
+				result = fmt.Sprintf("Error: %v", err)
+			}
 
 			select {
 			case contentStream <- ContentChunk{ToolInfo: &ToolInfo{
+				ID:     callIDs[idx],
 				Name:   fc.Name,
 				Args:   fc.Args,
 				Result: result,
@@ -431,7 +517,6 @@ func (g *Gemini) executeToolsInParallel(ctx context.Context, contentStream chan
 	for result := range resultChan {
 		if result.err != nil {
 			errors = append(errors, result.err)
-			continue
 		}
 		responses[result.index] = result.response
 	}
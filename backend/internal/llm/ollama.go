@@ -23,6 +23,7 @@ type Ollama struct {
 	httpClient   *http.Client
 	tools        []OllamaTool
 	toolRegistry *tools.ToolRegistry
+	options      Options
 
 	SystemPrompt string
 }
@@ -32,6 +33,7 @@ type OllamaMessage struct {
 	Role      string           `json:"role"`
 	Content   string           `json:"content"`
 	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // on tool results
 }
 
 type OllamaToolCall struct {
@@ -75,8 +77,8 @@ type OllamaChatRequest struct {
 }
 
 type OllamaOptions struct {
-	Temperature float32 `json:"temperature,omitempty"`
-	NumPredict  int     `json:"num_predict,omitempty"`
+	Temperature *float32 `json:"temperature,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
 }
 
 type OllamaChatResponse struct {
@@ -131,6 +133,13 @@ func (o *Ollama) GetModelName() string {
 
 func (o *Ollama) SetSystemPrompt(p string) { o.SystemPrompt = p }
 
+func (o *Ollama) SetOptions(opts Options) {
+	o.options = opts
+	if o.toolRegistry != nil {
+		o.tools = o.convertToOllamaTools()
+	}
+}
+
 func (o *Ollama) GenerateContent(ctx context.Context, input string) (string, error) {
 	messages := []OllamaMessage{
 		{
@@ -144,6 +153,10 @@ func (o *Ollama) GenerateContent(ctx context.Context, input string) (string, err
 		Messages: messages,
 		Stream:   false,
 		Tools:    o.tools,
+		Options: OllamaOptions{
+			Temperature: o.options.Temperature,
+			NumPredict:  o.options.MaxOutputTokens,
+		},
 	}
 
 	resp, err := o.makeRequest(ctx, request)
@@ -199,7 +212,7 @@ func (o *Ollama) GenerateEmbeddings(ctx context.Context, input string) ([]float3
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, statusError("ollama", resp.StatusCode, body)
 	}
 
 	var embResp OllamaEmbeddingResponse
@@ -234,6 +247,13 @@ func (o *Ollama) GenerateContentStream(ctx context.Context, history []models.Cha
 			Content: userMessage,
 		})
 
+		var usage Usage
+
+		temperature := float32(0.7)
+		if o.options.Temperature != nil {
+			temperature = *o.options.Temperature
+		}
+
 		// Tool calling loop
 		for i := 0; i < MAX_TOOL_CALL_ITERATIONS; i++ {
 			o.logger.Info("Starting Ollama turn iteration", zap.Int("iteration", i))
@@ -244,7 +264,8 @@ func (o *Ollama) GenerateContentStream(ctx context.Context, history []models.Cha
 				Tools:    o.tools,
 				Stream:   true,
 				Options: OllamaOptions{
-					Temperature: 0.7,
+					Temperature: &temperature,
+					NumPredict:  o.options.MaxOutputTokens,
 				},
 			}
 
@@ -256,6 +277,7 @@ func (o *Ollama) GenerateContentStream(ctx context.Context, history []models.Cha
 
 			var currentMessage OllamaMessage
 			var toolCalls []OllamaToolCall
+			var callIDs []string // Ollama does not assign call ids
 
 			// Read stream
 			decoder := json.NewDecoder(stream)
@@ -281,8 +303,10 @@ func (o *Ollama) GenerateContentStream(ctx context.Context, history []models.Cha
 				if len(chunk.Message.ToolCalls) > 0 {
 					toolCalls = append(toolCalls, chunk.Message.ToolCalls...)
 					for _, tc := range chunk.Message.ToolCalls {
+						callIDs = append(callIDs, newToolCallID())
 						contentStream <- ContentChunk{
 							ToolInfo: &ToolInfo{
+								ID:     callIDs[len(callIDs)-1],
 								Name:   tc.Function.Name,
 								Status: StatusStart,
 							},
@@ -291,6 +315,7 @@ func (o *Ollama) GenerateContentStream(ctx context.Context, history []models.Cha
 				}
 
 				if chunk.Done {
+					usage.Add(chunk.PromptEvalCount, chunk.EvalCount)
 					break
 				}
 			}
@@ -300,6 +325,7 @@ func (o *Ollama) GenerateContentStream(ctx context.Context, history []models.Cha
 			// If no tool calls, we're done
 			if len(toolCalls) == 0 {
 				o.logger.Info("Ollama interaction complete (no tool calls)", zap.Int("iteration", i))
+				contentStream <- ContentChunk{Usage: &usage}
 				return
 			}
 
@@ -309,11 +335,12 @@ func (o *Ollama) GenerateContentStream(ctx context.Context, history []models.Cha
 			messages = append(messages, currentMessage)
 
 			// Execute tools
-			for _, tc := range toolCalls {
+			for j, tc := range toolCalls {
 				o.logger.Info("Executing tool", zap.String("name", tc.Function.Name))
 
 				contentStream <- ContentChunk{
 					ToolInfo: &ToolInfo{
+						ID:     callIDs[j],
 						Name:   tc.Function.Name,
 						Status: StatusProcessing,
 					},
@@ -321,7 +348,7 @@ func (o *Ollama) GenerateContentStream(ctx context.Context, history []models.Cha
 
 				// Execute tool
 				tool, ok := o.toolRegistry.GetTool(tc.Function.Name)
-				if !ok {
+				if !ok || !o.options.AllowsTool(tc.Function.Name) {
 					o.logger.Error("Tool not found", zap.String("tool", tc.Function.Name))
 					contentStream <- ContentChunk{Err: fmt.Errorf("tool not found: %s", tc.Function.Name)}
 					return
@@ -336,6 +363,7 @@ func (o *Ollama) GenerateContentStream(ctx context.Context, history []models.Cha
 				// Send tool result
 				contentStream <- ContentChunk{
 					ToolInfo: &ToolInfo{
+						ID:     callIDs[j],
 						Name:   tc.Function.Name,
 						Args:   tc.Function.Arguments,
 						Result: result,
@@ -344,10 +372,7 @@ func (o *Ollama) GenerateContentStream(ctx context.Context, history []models.Cha
 				}
 
 				// Add tool response message
-				messages = append(messages, OllamaMessage{
-					Role:    models.RoleTool,
-					Content: fmt.Sprintf("Tool '%s' result: %s", tc.Function.Name, result),
-				})
+				messages = append(messages, ollamaToolResult(tc.Function.Name, result))
 			}
 		}
 
@@ -379,7 +404,7 @@ func (o *Ollama) makeRequest(ctx context.Context, request OllamaChatRequest) (*O
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, statusError("ollama", resp.StatusCode, body)
 	}
 
 	var ollamaResp OllamaChatResponse
@@ -411,27 +436,57 @@ func (o *Ollama) makeStreamRequest(ctx context.Context, request OllamaChatReques
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("ollama API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, statusError("ollama", resp.StatusCode, body)
 	}
 
 	return resp.Body, nil
 }
 
 func (o *Ollama) convertToOllamaMessages(history []models.ChatMessage) []OllamaMessage {
-	messages := make([]OllamaMessage, len(history))
-	for i, msg := range history {
-		messages[i] = OllamaMessage{
-			Role:    string(msg.Role),
-			Content: msg.Content,
+	messages := make([]OllamaMessage, 0, len(history))
+	for _, group := range toolCallGroups(history) {
+		msg := group[0]
+		switch msg.Role {
+		case models.RoleTool:
+			// An assistant message carrying the calls, then one message per result
+			calls := make([]OllamaToolCall, len(group))
+			for i, m := range group {
+				calls[i].Function = OllamaFunctionCall{Name: m.ToolCall.Name, Arguments: m.ToolCall.Args}
+			}
+			messages = append(messages, OllamaMessage{Role: string(models.RoleAssistant), ToolCalls: calls})
+			for _, m := range group {
+				messages = append(messages, ollamaToolResult(m.ToolCall.Name, m.Content))
+			}
+		case models.RoleUser, models.RoleAssistant:
+			messages = append(messages, OllamaMessage{
+				Role:    string(msg.Role),
+				Content: msg.Content,
+			})
+		default:
+			o.logger.Debug("Skipping message in history", zap.String("role", string(msg.Role)))
 		}
 	}
 	return messages
 }
 
+// ollamaToolResult builds the message that returns a tool result to the
+// model. The tool name is repeated in the content for models that ignore
+// tool_name.
+func ollamaToolResult(name, result string) OllamaMessage {
+	return OllamaMessage{
+		Role:     string(models.RoleTool),
+		Content:  fmt.Sprintf("Tool '%s' result: %s", name, result),
+		ToolName: name,
+	}
+}
+
 func (o *Ollama) convertToOllamaTools() []OllamaTool {
 	var ollamaTools []OllamaTool
 
 	for _, tool := range o.toolRegistry.GetAllTools() {
+		if !o.options.AllowsTool(tool.Name()) {
+			continue
+		}
 		properties := make(map[string]OllamaParameterProperty)
 		required := []string{}
 
@@ -0,0 +1,591 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/tools"
+	"go.uber.org/zap"
+)
+
+// OpenAICompatibleConfig describes an endpoint that speaks the OpenAI chat
+// completions API: OpenAI itself, vLLM, LM Studio, llama.cpp server,
+// Together, OpenRouter, Groq and others.
+type OpenAICompatibleConfig struct {
+	Name    string            // reported by GetProviderName
+	BaseURL string            // up to and including the version, e.g. "http://localhost:8000/v1"
+	APIKey  string            // sent as a bearer token when set
+	Headers map[string]string // extra headers, e.g. OpenRouter's HTTP-Referer
+	Models  []string          // models the endpoint serves; empty allows any
+
+	NoEmbeddings bool // the endpoint has no /embeddings route
+}
+
+// AllowsModel reports whether model may be requested from the endpoint.
+func (c OpenAICompatibleConfig) AllowsModel(model string) bool {
+	return len(c.Models) == 0 || slices.Contains(c.Models, model)
+}
+
+// ParseHeaderList parses headers written as "Name: value, Name2: value2".
+func ParseHeaderList(s string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
+// ParseModelList parses a comma-separated list of model names.
+func ParseModelList(s string) []string {
+	var models []string
+	for _, model := range strings.Split(s, ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+type OpenAICompatible struct {
+	config       OpenAICompatibleConfig
+	logger       *zap.Logger
+	modelName    string
+	httpClient   *http.Client
+	tools        []OpenAITool
+	toolRegistry *tools.ToolRegistry
+	options      Options
+	SystemPrompt string
+}
+
+// OpenAI chat completions API types
+type OpenAIMessage struct {
+	Role       models.Role      `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type OpenAIToolCall struct {
+	Index    *int   `json:"index,omitempty"` // position of the call, only in stream deltas
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type OpenAITool struct {
+	Type     string                   `json:"type"`
+	Function OpenAIFunctionDefinition `json:"function"`
+}
+
+type OpenAIFunctionDefinition struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+type OpenAIChatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []OpenAIMessage `json:"messages"`
+	Tools          []OpenAITool    `json:"tools,omitempty"`
+	ToolChoice     string          `json:"tool_choice,omitempty"`
+	Temperature    *float32        `json:"temperature,omitempty"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+	StreamOptions  *StreamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat interface{}     `json:"response_format,omitempty"`
+}
+
+// StreamOptions asks for a final stream chunk carrying the usage, which
+// streamed responses otherwise leave out.
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type OpenAIChatResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index        int           `json:"index"`
+		Message      OpenAIMessage `json:"message"`
+		Delta        OpenAIMessage `json:"delta,omitempty"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+type OpenAIEmbeddingRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type OpenAIEmbeddingResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func NewOpenAICompatible(config OpenAICompatibleConfig, logger *zap.Logger, modelName string, toolRegistry *tools.ToolRegistry) *OpenAICompatible {
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	if config.Name == "" {
+		config.Name = string(ProviderOpenAICompatible)
+	}
+
+	client := &OpenAICompatible{
+		config:       config,
+		logger:       logger,
+		modelName:    modelName,
+		httpClient:   &http.Client{},
+		toolRegistry: toolRegistry,
+
+		SystemPrompt: "",
+	}
+
+	if toolRegistry != nil {
+		client.tools = client.convertToOpenAITools()
+	}
+
+	return client
+}
+
+func (g *OpenAICompatible) GetProviderName() string {
+	return g.config.Name
+}
+
+func (g *OpenAICompatible) GetModelName() string {
+	return g.modelName
+}
+
+func (g *OpenAICompatible) SetSystemPrompt(p string) { g.SystemPrompt = p }
+
+func (g *OpenAICompatible) SetOptions(opts Options) {
+	g.options = opts
+	if g.toolRegistry != nil {
+		g.tools = g.convertToOpenAITools()
+	}
+}
+
+func (g *OpenAICompatible) GenerateContent(ctx context.Context, input string) (string, error) {
+	messages := []OpenAIMessage{
+		{
+			Role:    models.RoleUser,
+			Content: input,
+		},
+	}
+
+	request := OpenAIChatRequest{
+		Model:       g.modelName,
+		Messages:    messages,
+		Tools:       g.tools,
+		Temperature: g.options.Temperature,
+		MaxTokens:   g.options.MaxOutputTokens,
+	}
+
+	resp, err := g.makeRequest(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no response from %s", g.config.Name)
+	}
+
+	return resp.Choices[0].Message.Content, nil
+}
+
+func (g *OpenAICompatible) GenerateEmbeddings(ctx context.Context, input string) ([]float32, error) {
+	if g.config.NoEmbeddings {
+		return nil, fmt.Errorf("%s does not support embeddings generation", g.config.Name)
+	}
+
+	body, err := g.post(ctx, "/embeddings", OpenAIEmbeddingRequest{Model: g.modelName, Input: input}, false)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var embResp OpenAIEmbeddingResponse
+	if err := json.NewDecoder(body).Decode(&embResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(embResp.Data) == 0 || len(embResp.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("no embeddings returned")
+	}
+
+	return embResp.Data[0].Embedding, nil
+}
+
+func (g *OpenAICompatible) GenerateContentStream(ctx context.Context, history []models.ChatMessage, userMessage string) <-chan ContentChunk {
+	contentStream := make(chan ContentChunk, 10)
+
+	go func() {
+		defer close(contentStream)
+
+		// Convert history to chat completions format
+		messages := g.convertToOpenAIMessages(history)
+
+		sysPrompt := g.SystemPrompt
+		messages = append([]OpenAIMessage{
+			{
+				Role:    (models.RoleSystem),
+				Content: sysPrompt,
+			},
+		}, messages...)
+
+		// Add user message
+		messages = append(messages, OpenAIMessage{
+			Role:    (models.RoleUser),
+			Content: userMessage,
+		})
+
+		var usage Usage
+
+		// Tool calling loop
+		for i := 0; i < MAX_TOOL_CALL_ITERATIONS; i++ {
+			g.logger.Info("Starting chat completions turn iteration", zap.String("provider", g.config.Name), zap.Int("iteration", i))
+
+			request := OpenAIChatRequest{
+				Model:         g.modelName,
+				Messages:      messages,
+				Tools:         g.tools,
+				Temperature:   g.options.Temperature,
+				MaxTokens:     g.options.MaxOutputTokens,
+				Stream:        true,
+				StreamOptions: &StreamOptions{IncludeUsage: true},
+			}
+
+			stream, err := g.makeStreamRequest(ctx, request)
+			if err != nil {
+				contentStream <- ContentChunk{Err: fmt.Errorf("%s stream error: %w", g.config.Name, err)}
+				return
+			}
+
+			var toolCalls []OpenAIToolCall
+			var currentContent strings.Builder
+
+			// Read stream
+			scanner := bufio.NewScanner(stream)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if !strings.HasPrefix(line, "data: ") {
+					continue
+				}
+
+				data := strings.TrimPrefix(line, "data: ")
+				if data == "[DONE]" {
+					break
+				}
+
+				var chunk OpenAIChatResponse
+				if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+					g.logger.Error("Failed to parse chat completions stream chunk", zap.Error(err))
+					continue
+				}
+
+				if chunk.Usage != nil {
+					usage.Add(chunk.Usage.PromptTokens, chunk.Usage.CompletionTokens)
+				}
+
+				if len(chunk.Choices) > 0 {
+					delta := chunk.Choices[0].Delta
+
+					// Handle content
+					if delta.Content != "" {
+						currentContent.WriteString(delta.Content)
+						contentStream <- ContentChunk{Content: delta.Content}
+					}
+
+					// Handle tool calls. Calls arrive in fragments: the first
+					// carries id and name, later ones more of the arguments.
+					for _, tc := range delta.ToolCalls {
+						if tc.Index != nil && *tc.Index < len(toolCalls) {
+							call := &toolCalls[*tc.Index]
+							call.Function.Arguments += tc.Function.Arguments
+							if tc.Function.Name != "" {
+								call.Function.Name = tc.Function.Name
+							}
+							continue
+						}
+						if tc.ID == "" {
+							tc.ID = newToolCallID()
+						}
+						tc.Index = nil
+						toolCalls = append(toolCalls, tc)
+						contentStream <- ContentChunk{
+							ToolInfo: &ToolInfo{
+								ID:     tc.ID,
+								Name:   tc.Function.Name,
+								Status: StatusStart,
+							},
+						}
+					}
+				}
+			}
+
+			stream.Close()
+
+			// If no tool calls, we're done
+			if len(toolCalls) == 0 {
+				g.logger.Info("Chat completions interaction complete (no tool calls)", zap.Int("iteration", i))
+				contentStream <- ContentChunk{Usage: &usage}
+				return
+			}
+
+			// Add assistant message with tool calls
+			for j := range toolCalls {
+				if strings.TrimSpace(toolCalls[j].Function.Arguments) == "" {
+					toolCalls[j].Function.Arguments = "{}" // calls without parameters
+				}
+			}
+			messages = append(messages, OpenAIMessage{
+				Role:      (models.RoleAssistant),
+				Content:   currentContent.String(),
+				ToolCalls: toolCalls,
+			})
+
+			// Execute tools
+			for _, tc := range toolCalls {
+				g.logger.Info("Executing tool", zap.String("name", tc.Function.Name))
+
+				contentStream <- ContentChunk{
+					ToolInfo: &ToolInfo{
+						ID:     tc.ID,
+						Name:   tc.Function.Name,
+						Status: StatusProcessing,
+					},
+				}
+
+				// Parse arguments
+				var args map[string]any
+				if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+					g.logger.Error("Failed to parse tool arguments", zap.Error(err))
+					contentStream <- ContentChunk{Err: fmt.Errorf("failed to parse tool arguments: %w", err)}
+					return
+				}
+
+				// Execute tool
+				tool, ok := g.toolRegistry.GetTool(tc.Function.Name)
+				if !ok || !g.options.AllowsTool(tc.Function.Name) {
+					g.logger.Error("Tool not found", zap.String("tool", tc.Function.Name))
+					contentStream <- ContentChunk{Err: fmt.Errorf("tool not found: %s", tc.Function.Name)}
+					return
+				}
+
+				result, err := tool.Execute(ctx, args)
+				if err != nil {
+					g.logger.Error("Tool execution failed", zap.Error(err))
+					result = fmt.Sprintf("Error: %v", err)
+				}
+
+				// Send tool result
+				contentStream <- ContentChunk{
+					ToolInfo: &ToolInfo{
+						ID:     tc.ID,
+						Name:   tc.Function.Name,
+						Args:   args,
+						Result: result,
+						Status: StatusEnd,
+					},
+				}
+
+				// Add tool response message
+				messages = append(messages, OpenAIMessage{
+					Role:       models.RoleTool,
+					Content:    result,
+					ToolCallID: tc.ID,
+				})
+			}
+		}
+
+		g.logger.Error("Max tool iterations reached")
+		contentStream <- ContentChunk{Err: fmt.Errorf("max tool iterations reached")}
+	}()
+
+	// log the content stream so i can debug
+	g.logger.Info("Content stream started")
+
+	return contentStream
+}
+
+func (g *OpenAICompatible) makeRequest(ctx context.Context, request OpenAIChatRequest) (*OpenAIChatResponse, error) {
+	body, err := g.post(ctx, "/chat/completions", request, false)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var chatResp OpenAIChatResponse
+	if err := json.NewDecoder(body).Decode(&chatResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &chatResp, nil
+}
+
+func (g *OpenAICompatible) makeStreamRequest(ctx context.Context, request OpenAIChatRequest) (io.ReadCloser, error) {
+	return g.post(ctx, "/chat/completions", request, true)
+}
+
+// post sends payload to path under the base URL and returns the body of a
+// successful response, which the caller must close.
+func (g *OpenAICompatible) post(ctx context.Context, path string, payload any, stream bool) (io.ReadCloser, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", g.config.BaseURL+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if g.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.config.APIKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	for name, value := range g.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, statusError(g.config.Name, resp.StatusCode, body)
+	}
+
+	return resp.Body, nil
+}
+
+func (g *OpenAICompatible) convertToOpenAIMessages(history []models.ChatMessage) []OpenAIMessage {
+	messages := make([]OpenAIMessage, 0, len(history))
+	for _, group := range toolCallGroups(history) {
+		msg := group[0]
+		switch msg.Role {
+		case models.RoleTool:
+			// An assistant message carrying the calls, then one message per result
+			calls := make([]OpenAIToolCall, len(group))
+			for i, m := range group {
+				calls[i].ID = m.ToolCall.Id
+				calls[i].Type = "function"
+				calls[i].Function.Name = m.ToolCall.Name
+				calls[i].Function.Arguments = toolArguments(m.ToolCall.Args)
+			}
+			messages = append(messages, OpenAIMessage{Role: models.RoleAssistant, ToolCalls: calls})
+			for _, m := range group {
+				messages = append(messages, OpenAIMessage{
+					Role:       models.RoleTool,
+					Content:    m.Content,
+					ToolCallID: m.ToolCall.Id,
+				})
+			}
+		case models.RoleUser, models.RoleAssistant:
+			messages = append(messages, OpenAIMessage{
+				Role:    msg.Role,
+				Content: msg.Content,
+			})
+		default:
+			g.logger.Debug("Skipping message in history", zap.String("role", string(msg.Role)))
+		}
+	}
+	return messages
+}
+
+// toolArguments encodes call arguments the way the chat completions API
+// returns them: as a JSON object in a string.
+func toolArguments(args map[string]any) string {
+	if args == nil {
+		return "{}"
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+func (g *OpenAICompatible) convertToOpenAITools() []OpenAITool {
+	var openAITools []OpenAITool
+
+	for _, tool := range g.toolRegistry.GetAllTools() {
+		if !g.options.AllowsTool(tool.Name()) {
+			continue
+		}
+		properties := make(map[string]interface{})
+		required := []string{}
+
+		for _, param := range tool.Parameters() {
+			paramSchema := map[string]interface{}{
+				"type":        g.convertTypeToOpenAI(param.Type),
+				"description": param.Description,
+			}
+
+			if len(param.Enum) > 0 {
+				paramSchema["enum"] = param.Enum
+			}
+
+			properties[param.Name] = paramSchema
+
+			if param.Required {
+				required = append(required, param.Name)
+			}
+		}
+
+		openAITools = append(openAITools, OpenAITool{
+			Type: "function",
+			Function: OpenAIFunctionDefinition{
+				Name:        tool.Name(),
+				Description: tool.Description(),
+				Parameters: map[string]interface{}{
+					"type":       "object",
+					"properties": properties,
+					"required":   required,
+				},
+			},
+		})
+	}
+	return openAITools
+}
+
+func (g *OpenAICompatible) convertTypeToOpenAI(genaiType genai.Type) string {
+	switch genaiType {
+	case genai.TypeString:
+		return "string"
+	case genai.TypeNumber:
+		return "number"
+	case genai.TypeInteger:
+		return "integer"
+	case genai.TypeBoolean:
+		return "boolean"
+	case genai.TypeArray:
+		return "array"
+	case genai.TypeObject:
+		return "object"
+	default:
+		return "string"
+	}
+}
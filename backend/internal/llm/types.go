@@ -2,7 +2,12 @@ package llm
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/synntx/askmind/internal/models"
 )
 
@@ -18,6 +23,21 @@ type LLM interface {
 
 	// Provider-specific methods
 	SetSystemPrompt(prompt string)
+	SetOptions(opts Options)
+}
+
+// Options tune the answers of an LLM. The zero value keeps the provider's
+// defaults and lets the model call every registered tool.
+type Options struct {
+	Temperature     *float32 // nil for the provider's default
+	MaxOutputTokens int      // 0 for the provider's default
+	Tools           []string // names of the tools the model may call; nil for all
+}
+
+// AllowsTool reports whether the model may call the named tool. Tools left
+// out are neither offered to the model nor run when it asks for them anyway.
+func (o Options) AllowsTool(name string) bool {
+	return o.Tools == nil || slices.Contains(o.Tools, name)
 }
 
 // // Provider-agnostic types
@@ -29,10 +49,26 @@ type LLM interface {
 type ContentChunk struct {
 	Content  string
 	ToolInfo *ToolInfo
+	Usage    *Usage // set once, on the last chunk of a successful stream
 	Err      error
 }
 
+// Usage counts the tokens spent on one answer, summed over every turn of
+// its tool calling loop.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u *Usage) Add(prompt, completion int) {
+	u.PromptTokens += prompt
+	u.CompletionTokens += completion
+	u.TotalTokens += prompt + completion
+}
+
 type ToolInfo struct {
+	ID     string // call id, stable across the START/PROCESSING/END events of one call
 	Name   string
 	Args   map[string]any
 	Result string
@@ -47,9 +83,47 @@ const (
 	StatusEnd        Status = "END"
 )
 
-// const (
-// 	RoleUser      = "user"
-// 	RoleAssistant = "assistant"
-// 	RoleSystem    = "system"
-// 	RoleTool      = "tool"
-// )
+// newToolCallID returns an id for providers whose API does not assign one.
+func newToolCallID() string {
+	return "call_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:24]
+}
+
+// toolCallGroups splits history into runs of consecutive tool messages and
+// single other messages, so each run of tool calls can be replayed as one
+// model turn followed by its results. Tool messages without a recorded call
+// cannot be replayed and are dropped.
+func toolCallGroups(history []models.ChatMessage) [][]models.ChatMessage {
+	var groups [][]models.ChatMessage
+	var calls []models.ChatMessage
+	for _, msg := range history {
+		if msg.Role == models.RoleTool {
+			if msg.ToolCall != nil {
+				calls = append(calls, msg)
+			}
+			continue
+		}
+		if len(calls) > 0 {
+			groups = append(groups, calls)
+			calls = nil
+		}
+		groups = append(groups, []models.ChatMessage{msg})
+	}
+	if len(calls) > 0 {
+		groups = append(groups, calls)
+	}
+	return groups
+}
+
+// statusError turns a failed provider response into an error carrying the
+// same prefixes as the Gemini provider, so handlers and FallbackLLM can tell
+// rate limits and server failures apart from bad requests.
+func statusError(provider string, status int, body []byte) error {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return fmt.Errorf("rate_limit_exceeded: %s API error (status %d): %s", provider, status, body)
+	case status >= 500:
+		return fmt.Errorf("server_error: %s API error (status %d): %s", provider, status, body)
+	default:
+		return fmt.Errorf("client_error: %s API error (status %d): %s", provider, status, body)
+	}
+}
@@ -2,11 +2,14 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/service"
 	"github.com/synntx/askmind/internal/utils"
 	"go.uber.org/zap"
 )
@@ -88,24 +91,51 @@ func LoggingMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 	}
 }
 
-func AuthMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
+// AuthMiddleware accepts a session JWT or an API key, either as a Bearer
+// token or in the X-API-Key header, and stores the resulting *utils.Claims in
+// the request context. API key claims carry the key's scopes; see
+// RequireScope.
+func AuthMiddleware(apiKeys service.APIKeyService, logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			tokenHeader := r.Header.Get("Authorization")
-			if tokenHeader == "" {
-				logger.Warn("missing authorization header")
-				utils.HandleError(w, logger, utils.ErrUnauthorized.Wrap(fmt.Errorf("missing token")))
-				return
+			token := r.Header.Get("X-API-Key")
+			if token == "" {
+				tokenHeader := r.Header.Get("Authorization")
+				if tokenHeader == "" {
+					logger.Warn("missing authorization header")
+					utils.HandleError(w, logger, utils.ErrUnauthorized.Wrap(fmt.Errorf("missing token")))
+					return
+				}
+
+				var err error
+				token, err = ExtractToken(tokenHeader)
+				if err != nil {
+					logger.Error("failed to extract token",
+						zap.Error(err),
+						zap.String("header_value", maskSensitive(tokenHeader)),
+					)
+
+					utils.HandleError(w, logger, utils.ErrUnauthorized.Wrap(err))
+					return
+				}
 			}
 
-			token, err := ExtractToken(tokenHeader)
-			if err != nil {
-				logger.Error("failed to extract token",
-					zap.Error(err),
-					zap.String("header_value", maskSensitive(tokenHeader)),
-				)
+			if strings.HasPrefix(token, service.APIKeyPrefix) {
+				claims, err := apiKeys.Authenticate(r.Context(), token)
+				if err != nil {
+					logger.Error("invalid API key",
+						zap.Error(err),
+						zap.String("token_prefix", tokenPrefix(token)),
+					)
+					if errors.Is(err, service.ErrInvalidAPIKey) {
+						err = utils.ErrUnauthorized.Wrap(err)
+					}
+					utils.HandleError(w, logger, err)
+					return
+				}
 
-				utils.HandleError(w, logger, utils.ErrUnauthorized.Wrap(err))
+				ctx := context.WithValue(r.Context(), utils.ClaimsKey, claims)
+				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
 
@@ -135,6 +165,36 @@ func AuthMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 	}
 }
 
+// RequireScope rejects requests authenticated with an API key that has none
+// of scopes; without scopes, every API key is rejected. Use it after
+// AuthMiddleware.
+func RequireScope(logger *zap.Logger, scopes ...models.APIKeyScope) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(utils.ClaimsKey).(*utils.Claims)
+			if !ok || claims == nil || claims.APIKeyId == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			for _, scope := range scopes {
+				if claims.HasScope(string(scope)) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			logger.Warn("API key scope denied",
+				zap.String("key_id", claims.APIKeyId),
+				zap.String("path", r.URL.Path),
+				zap.Strings("scopes", claims.Scopes),
+			)
+			utils.HandleError(w, logger, utils.ErrForbidden.Wrap(
+				fmt.Errorf("API key can not be used for %s %s", r.Method, r.URL.Path),
+			))
+		})
+	}
+}
+
 func ExtractToken(token string) (string, error) {
 	parts := strings.Split(token, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
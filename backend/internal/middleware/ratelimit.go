@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/synntx/askmind/internal/service"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// how long a key's bucket is kept after its last request
+const rateLimitIdleTTL = 10 * time.Minute
+
+// RateLimiter keeps one token bucket per key, such as a user or an IP
+// address. Buckets idle for rateLimitIdleTTL are dropped.
+type RateLimiter struct {
+	perMinute int
+	burst     int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter creates a limiter allowing perMinute requests a minute per
+// key, with bursts of up to burst requests. A burst of 0 equals perMinute.
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &RateLimiter{
+		perMinute: perMinute,
+		burst:     burst,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// take spends a token from key's bucket. When none is left it returns how
+// long until one is.
+func (rl *RateLimiter) take(key string, now time.Time) (ok bool, remaining int, retryAfter, reset time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if now.Sub(rl.lastSweep) > time.Minute {
+		for k, b := range rl.buckets {
+			if now.Sub(b.lastSeen) > rateLimitIdleTTL {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	b, found := rl.buckets[key]
+	if !found {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(float64(rl.perMinute)/60), rl.burst)}
+		rl.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	r := b.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, 0, delay, rl.untilFull(b.limiter, now)
+	}
+	tokens := b.limiter.TokensAt(now)
+	return true, int(math.Max(0, math.Floor(tokens))), 0, rl.untilFull(b.limiter, now)
+}
+
+func (rl *RateLimiter) untilFull(l *rate.Limiter, now time.Time) time.Duration {
+	missing := float64(rl.burst) - l.TokensAt(now)
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / float64(rl.perMinute) * float64(time.Minute))
+}
+
+// KeyFunc picks the bucket a request is counted against. An empty key
+// exempts the request.
+type KeyFunc func(r *http.Request) string
+
+// UserKey counts requests per authenticated user. Use it after
+// AuthMiddleware.
+func UserKey(r *http.Request) string {
+	claims, ok := r.Context().Value(utils.ClaimsKey).(*utils.Claims)
+	if !ok || claims == nil {
+		return ""
+	}
+	return "user:" + claims.UserId
+}
+
+// IPKey counts requests per client address. When trustProxy is set the
+// first X-Forwarded-For address is used, which only a reverse proxy that
+// overwrites the header makes safe.
+func IPKey(trustProxy bool) KeyFunc {
+	return func(r *http.Request) string {
+		if trustProxy {
+			if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+				ip, _, _ := strings.Cut(forwarded, ",")
+				return "ip:" + strings.TrimSpace(ip)
+			}
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return "ip:" + host
+	}
+}
+
+// RateLimit rejects requests with 429 once their key's bucket is empty. Every
+// response carries X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset (seconds until the bucket is full); rejections also carry
+// Retry-After.
+func RateLimit(rl *RateLimiter, key KeyFunc, logger *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" || rl.perMinute <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ok, remaining, retryAfter, reset := rl.take(k, time.Now())
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rl.burst))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+
+			if !ok {
+				logger.Warn("Rate limit exceeded",
+					zap.String("key", k),
+					zap.String("path", r.URL.Path),
+					zap.Duration("retry_after", retryAfter),
+				)
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+				utils.HandleError(w, logger, utils.ErrRateLimited.Wrap(
+					fmt.Errorf("rate limit of %d requests per minute exceeded", rl.perMinute),
+				))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// EnforceQuota rejects requests with 429 once the user has reached a daily
+// quota. Responses carry X-RateLimit-Requests-* and X-RateLimit-Tokens-*
+// headers for the limits that are set; rejections also carry Retry-After,
+// pointing at midnight UTC. Use it after AuthMiddleware.
+func EnforceQuota(us service.UsageService, logger *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(utils.ClaimsKey).(*utils.Claims)
+			if !ok || claims == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			status, err := us.CheckDailyQuota(r.Context(), claims.UserId)
+			if status != nil {
+				setQuotaHeaders(w.Header(), "Requests", status.RequestLimit, status.Requests)
+				setQuotaHeaders(w.Header(), "Tokens", status.TokenLimit, status.Tokens)
+			}
+			if err != nil {
+				if status != nil {
+					w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(time.Until(status.ResetAt))))
+				}
+				utils.HandleError(w, logger, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func setQuotaHeaders(h http.Header, name string, limit, used int64) {
+	if limit <= 0 {
+		return
+	}
+	h.Set("X-RateLimit-"+name+"-Limit", strconv.FormatInt(limit, 10))
+	h.Set("X-RateLimit-"+name+"-Remaining", strconv.FormatInt(max(0, limit-used), 10))
+}
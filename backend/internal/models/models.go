@@ -19,31 +19,188 @@ type User struct {
 	UpdatedAt  time.Time `json:"updated_at"`
 }
 
+// RefreshToken is a stored refresh token. Only a hash of the token is kept.
+// Tokens rotated from one login share a FamilyId, so reuse of a rotated
+// token can revoke every token of that login.
+type RefreshToken struct {
+	TokenId    uuid.UUID  `json:"token_id"`
+	UserId     uuid.UUID  `json:"user_id"`
+	FamilyId   uuid.UUID  `json:"family_id"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy *uuid.UUID `json:"replaced_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TokenPair is what a login or a refresh hands out.
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	AccessExpiresAt  time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// APIKeyScope limits what requests made with an API key may do.
+type APIKeyScope string
+
+const (
+	APIKeyScopeRead   APIKeyScope = "read"   // GET endpoints
+	APIKeyScopeChat   APIKeyScope = "chat"   // conversations and completions
+	APIKeyScopeIngest APIKeyScope = "ingest" // adding and removing sources
+)
+
+func (s APIKeyScope) Valid() bool {
+	switch s {
+	case APIKeyScopeRead, APIKeyScopeChat, APIKeyScopeIngest:
+		return true
+	default:
+		return false
+	}
+}
+
+// APIKey is a stored API key. Only a hash of the key is kept; Prefix is
+// enough of the key to recognise it in a list.
+type APIKey struct {
+	KeyId      uuid.UUID     `json:"key_id"`
+	UserId     uuid.UUID     `json:"user_id"`
+	Name       string        `json:"name"`
+	Prefix     string        `json:"prefix"`
+	KeyHash    string        `json:"-"`
+	Scopes     []APIKeyScope `json:"scopes"`
+	ExpiresAt  *time.Time    `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time    `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time    `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string        `json:"name"`
+	Scopes    []APIKeyScope `json:"scopes"`
+	ExpiresAt *time.Time    `json:"expires_at,omitempty"` // nil never expires
+}
+
+// CreatedAPIKey is returned once, when the key is created; the plain key can
+// not be retrieved afterwards.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
 type Space struct {
-	SpaceId     uuid.UUID `json:"space_id"`
-	UserId      uuid.UUID `json:"user_id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	SourceLimit int       `json:"source_limit"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	SpaceId     uuid.UUID     `json:"space_id"`
+	UserId      uuid.UUID     `json:"user_id"` // the owner
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	SourceLimit int           `json:"source_limit"`
+	Settings    SpaceSettings `json:"settings"`
+	Role        SpaceRole     `json:"role,omitempty"` // role of the requesting user, when known
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// SpaceSettings are the defaults of the completions in a space, used for
+// whatever a request leaves out. Zero values leave the app's own defaults.
+type SpaceSettings struct {
+	Provider        string   `json:"provider,omitempty"`
+	Model           string   `json:"model,omitempty"`
+	SystemPrompt    string   `json:"system_prompt,omitempty"` // a built-in prompt or a template of the space
+	Tools           []string `json:"tools"`                   // names of the tools the model may call; null for all
+	Temperature     *float32 `json:"temperature,omitempty"`
+	MaxOutputTokens int      `json:"max_output_tokens,omitempty"`
+	RetrievalTopK   int      `json:"retrieval_top_k,omitempty"` // source chunks given to the model
+}
+
+// SpaceRole is what a member may do in a space. Each role can do everything
+// the roles below it can: viewers read and chat, editors also manage
+// sources and space details, owners also manage members and delete the space.
+type SpaceRole string
+
+const (
+	SpaceRoleOwner  SpaceRole = "owner"
+	SpaceRoleEditor SpaceRole = "editor"
+	SpaceRoleViewer SpaceRole = "viewer"
+)
+
+func (r SpaceRole) rank() int {
+	switch r {
+	case SpaceRoleOwner:
+		return 3
+	case SpaceRoleEditor:
+		return 2
+	case SpaceRoleViewer:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (r SpaceRole) Valid() bool {
+	return r.rank() > 0
+}
+
+// Allows reports whether r grants everything need does.
+func (r SpaceRole) Allows(need SpaceRole) bool {
+	return r.Valid() && r.rank() >= need.rank()
+}
+
+// SpaceMember is a user's membership of a space. Invitations are members
+// whose AcceptedAt is still nil; they grant no access.
+type SpaceMember struct {
+	SpaceId    uuid.UUID  `json:"space_id"`
+	UserId     uuid.UUID  `json:"user_id"`
+	FirstName  string     `json:"first_name"`
+	LastName   string     `json:"last_name"`
+	Email      string     `json:"email"`
+	Role       SpaceRole  `json:"role"`
+	InvitedBy  *uuid.UUID `json:"invited_by,omitempty"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// SpaceInvitation is a pending invitation as seen by the invited user.
+type SpaceInvitation struct {
+	SpaceId     uuid.UUID  `json:"space_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Role        SpaceRole  `json:"role"`
+	InvitedBy   *uuid.UUID `json:"invited_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type InviteSpaceMemberRequest struct {
+	SpaceId uuid.UUID `json:"space_id"`
+	Email   string    `json:"email"`
+	Role    SpaceRole `json:"role"`
 }
 
 type SourceType string
 
 const (
 	SourceTypeWebPage SourceType = "webpage"
+	SourceTypeFile    SourceType = "file"
+)
+
+type SourceStatus string
+
+const (
+	SourceStatusPending    SourceStatus = "pending"
+	SourceStatusProcessing SourceStatus = "processing"
+	SourceStatusReady      SourceStatus = "ready"
+	SourceStatusFailed     SourceStatus = "failed"
 )
 
 type Source struct {
-	SourceId   uuid.UUID  `json:"source_id"`
-	SpaceId    uuid.UUID  `json:"space_id"`
-	SourceType SourceType `json:"source_type"`
-	Location   string     `json:"location"`
-	Metadata   JSONB      `json:"metadata"`
-	Text       string     `json:"text"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
+	SourceId     uuid.UUID    `json:"source_id"`
+	SpaceId      uuid.UUID    `json:"space_id"`
+	SourceType   SourceType   `json:"source_type"`
+	Location     string       `json:"location"`
+	Metadata     JSONB        `json:"metadata"`
+	Text         string       `json:"text,omitempty"`
+	Status       SourceStatus `json:"status"`
+	ErrorMessage string       `json:"error_message,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
 }
 
 type WebPageMetadata struct {
@@ -58,10 +215,66 @@ type Chunk struct {
 	ChunkId         uuid.UUID `json:"chunk_id"`
 	SourceId        uuid.UUID `json:"source_id"`
 	UserId          uuid.UUID `json:"user_id"`
+	SpaceId         uuid.UUID `json:"space_id"`
 	Text            string    `json:"text"`
 	ChunkIndex      int32     `json:"chunk_index"`
-	ChunkTokenCount int32     `json:"chunk_token_count"`
+	ChunkTokenCount int32     `json:"chunk_token_count"`     // as counted by the chunker, see processing.Chunker
+	PageNumber      *int32    `json:"page_number,omitempty"` // nil for sources without pages
+	SectionTitle    string    `json:"section_title,omitempty"`
 	Embedding       []float32 `json:"embedding,omitempty"`
+
+	// Populated by similarity search
+	SourceLocation string  `json:"source_location,omitempty"`
+	Similarity     float64 `json:"similarity,omitempty"`
+}
+
+// Memory is a fact about a user that AskMind remembers across conversations,
+// such as their stack or how they like answers written. Memories are
+// extracted from conversations or added by the user, who can review, edit
+// and delete them.
+type Memory struct {
+	MemoryId       uuid.UUID  `json:"memory_id"`
+	UserId         uuid.UUID  `json:"user_id"`
+	Content        string     `json:"content"`
+	ConversationId *uuid.UUID `json:"conversation_id,omitempty"` // where it was learned; nil if the user added it
+	Embedding      []float32  `json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Populated by similarity search
+	Similarity float64 `json:"similarity,omitempty"`
+}
+
+type MemoryRequest struct {
+	Content string `json:"content"`
+}
+
+// PromptTemplate is a system prompt written by a user, either for themselves
+// or for every member of a space. It is a text/template rendered like the
+// built-in prompts, and is picked by name over a built-in prompt of the same
+// name.
+type PromptTemplate struct {
+	TemplateId  uuid.UUID  `json:"template_id"`
+	UserId      *uuid.UUID `json:"user_id,omitempty"`  // owner of a personal template
+	SpaceId     *uuid.UUID `json:"space_id,omitempty"` // space of a shared template
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Content     string     `json:"content"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type CreatePromptTemplateRequest struct {
+	SpaceId     *uuid.UUID `json:"space_id,omitempty"` // nil for a personal template
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Content     string     `json:"content"`
+}
+
+type UpdatePromptTemplateRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Content     *string `json:"content,omitempty"`
 }
 
 type ConversationStatus string
@@ -77,8 +290,15 @@ type Conversation struct {
 	UserId         uuid.UUID          `json:"user_id"`
 	Title          string             `json:"title"`
 	Status         ConversationStatus `json:"status"`
-	CreatedAt      time.Time          `json:"created_at"`
-	UpdatedAt      time.Time          `json:"updated_at"`
+	// ActiveMessageId is the last message of the branch the conversation
+	// shows and continues from; nil while it has no messages.
+	ActiveMessageId *uuid.UUID `json:"active_message_id"`
+	// Summary condenses the messages of the active branch up to and
+	// including SummaryMessageId, which no longer fit the context window.
+	Summary          string     `json:"summary,omitempty"`
+	SummaryMessageId *uuid.UUID `json:"summary_message_id,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 }
 
 type Role string
@@ -88,27 +308,58 @@ const (
 	RoleAssistant Role = "assistant"
 	RoleSystem    Role = "system"
 	RoleError     Role = "error"
-	RoleTool           = "tool"
+	RoleTool      Role = "tool"
 )
 
+// ToolCall is a function call the model made while answering. It is stored
+// on the RoleTool message whose Content holds the tool's result.
+type ToolCall struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Args JSONB  `json:"args"`
+}
+
+// ChatMessage is a node of its conversation's message tree: answers that were
+// regenerated and user messages that were edited are siblings under the same
+// parent.
 type ChatMessage struct {
-	MessageId      uuid.UUID `json:"message_id"`
-	ConversationId uuid.UUID `json:"conversation_id"`
-	Role           Role      `json:"role"`
-	Content        string    `json:"content"`
-	TokensUsed     *int      `json:"tokens_used"`
-	Model          string    `json:"model,omitempty"`
-	Metadata       JSONB     `json:"metadata"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	MessageId       uuid.UUID  `json:"message_id"`
+	ConversationId  uuid.UUID  `json:"conversation_id"`
+	ParentMessageId *uuid.UUID `json:"parent_message_id"` // nil for the first message of a branch from the start
+
+	Role             Role          `json:"role"`
+	Content          string        `json:"content"`
+	TokensUsed       *int          `json:"tokens_used"` // prompt plus completion tokens of an assistant answer
+	PromptTokens     *int          `json:"prompt_tokens,omitempty"`
+	CompletionTokens *int          `json:"completion_tokens,omitempty"`
+	Model            string        `json:"model,omitempty"`
+	Metadata         JSONB         `json:"metadata"`
+	ToolCall         *ToolCall     `json:"tool_call,omitempty"` // set on RoleTool messages
+	Status           MessageStatus `json:"status"`
+	CreatedAt        time.Time     `json:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at"`
 }
 
+type MessageStatus string
+
+const (
+	MessageStatusCompleted   MessageStatus = "completed"
+	MessageStatusInterrupted MessageStatus = "interrupted" // the answer ended early: stopped, timed out or failed
+)
+
 type MessageReference struct {
 	ReferenceId    uuid.UUID `json:"reference_id"`
 	MessageId      uuid.UUID `json:"message_id"`
 	ChunkId        uuid.UUID `json:"chunk_id"`
 	RelevanceScore float64   `json:"relevance_score"`
 	CreatedAt      time.Time `json:"created_at"`
+
+	// Joined from the referenced chunk when listing
+	SourceId       uuid.UUID `json:"source_id"`
+	SourceLocation string    `json:"source_location,omitempty"`
+	PageNumber     *int32    `json:"page_number,omitempty"`
+	SectionTitle   string    `json:"section_title,omitempty"`
+	Text           string    `json:"text,omitempty"`
 }
 
 type UpdateName struct {
@@ -117,9 +368,10 @@ type UpdateName struct {
 }
 
 type UpdateSpace struct {
-	SpaceId     string  `json:"space_id"` // required
-	Title       *string `json:"title,omitempty"`
-	Description *string `json:"description,omitempty"`
+	SpaceId     string         `json:"space_id"` // required
+	Title       *string        `json:"title,omitempty"`
+	Description *string        `json:"description,omitempty"`
+	Settings    *SpaceSettings `json:"settings,omitempty"` // replaces the settings as a whole
 }
 
 type CreateSpace struct {
@@ -135,16 +387,82 @@ type ChunkFilters struct {
 	SourceID *string `json:"sourceId,omitempty"`
 }
 
+type CreateWebSourceRequest struct {
+	SpaceId uuid.UUID `json:"space_id"`
+	URL     string    `json:"url"`
+}
+
 type CreateConversationRequest struct {
 	SpaceId uuid.UUID `json:"space_id"`
 	Title   string    `json:"title"`
 }
 
 type CreateMessageRequest struct {
+	MessageId      uuid.UUID `json:"message_id,omitempty"` // generated when empty
 	ConversationId uuid.UUID `json:"conversation_id"`
-	Role           Role      `json:"role"`
-	Content        string    `json:"content"`
-	TokensUsed     *int      `json:"tokens_used"`
-	Model          string    `json:"model,omitempty"`
-	Metadata       JSONB     `json:"metadata"`
+	// ParentMessageId defaults to the conversation's active message;
+	// uuid.Nil starts a new branch from the beginning of the conversation.
+	// The new message becomes the active one.
+	ParentMessageId  *uuid.UUID    `json:"parent_message_id,omitempty"`
+	Role             Role          `json:"role"`
+	Content          string        `json:"content"`
+	TokensUsed       *int          `json:"tokens_used"`
+	PromptTokens     *int          `json:"prompt_tokens,omitempty"`
+	CompletionTokens *int          `json:"completion_tokens,omitempty"`
+	Model            string        `json:"model,omitempty"`
+	Metadata         JSONB         `json:"metadata"`
+	ToolCall         *ToolCall     `json:"tool_call,omitempty"`
+	Status           MessageStatus `json:"status,omitempty"` // completed when empty
+}
+
+// TokenUsage sums the tokens of the assistant messages in a conversation,
+// space or day, and of the usage records made there. Messages counts both.
+type TokenUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+	Messages         int64 `json:"messages"`
+}
+
+type UsageKind string
+
+const (
+	UsageKindMemoryExtraction UsageKind = "memory_extraction"
+	UsageKindAPI              UsageKind = "api"        // a /v1 completion; counts as a request
+	UsageKindRegenerate       UsageKind = "regenerate" // counts as a request; its answer carries the tokens
+)
+
+// UsageRecord counts in usage and quotas what messages do not: model calls
+// that leave no assistant message behind, and requests that save no user
+// message. Records without tokens only count as a request.
+type UsageRecord struct {
+	UsageId          uuid.UUID  `json:"usage_id"`
+	UserId           uuid.UUID  `json:"user_id"`
+	ConversationId   *uuid.UUID `json:"conversation_id,omitempty"`
+	Kind             UsageKind  `json:"kind"`
+	Model            string     `json:"model"`
+	PromptTokens     int        `json:"prompt_tokens"`
+	CompletionTokens int        `json:"completion_tokens"`
+	TotalTokens      int        `json:"total_tokens"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// DailyQuota caps what one user may spend per UTC day. Zero means no cap.
+type DailyQuota struct {
+	Requests int64
+	Tokens   int64
+}
+
+type QuotaStatus struct {
+	Requests     int64     `json:"requests"`
+	RequestLimit int64     `json:"request_limit,omitempty"`
+	Tokens       int64     `json:"tokens"`
+	TokenLimit   int64     `json:"token_limit,omitempty"`
+	ResetAt      time.Time `json:"reset_at"`
+}
+
+type DailyTokenUsage struct {
+	Day   string `json:"day"` // YYYY-MM-DD, UTC
+	Model string `json:"model"`
+	TokenUsage
 }
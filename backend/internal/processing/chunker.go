@@ -0,0 +1,361 @@
+package processing
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	DefaultChunkTokens  = 512
+	DefaultChunkOverlap = 64
+)
+
+// Chunker splits documents into chunks that fit a token budget. It never
+// crosses a section boundary and prefers to break between paragraphs, then
+// between sentences, then between words. Fenced code blocks are kept whole
+// when they fit. Consecutive chunks of a section share up to Overlap tokens
+// of trailing sentences so an answer spanning a boundary is still retrievable.
+type Chunker struct {
+	MaxTokens   int
+	Overlap     int
+	CountTokens func(text string) int
+}
+
+// TextChunk is one chunk of a document.
+type TextChunk struct {
+	Text       string
+	Title      string // heading path of the section, e.g. "Guide > Install"
+	Page       int
+	TokenCount int // of Text, as counted by the Chunker's CountTokens
+}
+
+// NewChunker returns a chunker using EstimateTokens; set CountTokens to count
+// with the embedding model's tokenizer instead, such as a WordPiece.
+// Non-positive values fall back to the defaults; overlap is capped at half
+// the budget.
+func NewChunker(maxTokens, overlap int) *Chunker {
+	if maxTokens <= 0 {
+		maxTokens = DefaultChunkTokens
+	}
+	if overlap < 0 {
+		overlap = DefaultChunkOverlap
+	}
+	return &Chunker{
+		MaxTokens:   maxTokens,
+		Overlap:     min(overlap, maxTokens/2),
+		CountTokens: EstimateTokens,
+	}
+}
+
+// unit is an indivisible piece of text together with the separator that
+// joins it to the piece before it.
+type unit struct {
+	text string
+	sep  string
+}
+
+// Chunk splits every section of doc on its own and labels the chunks with
+// the path of headings they fall under.
+func (c *Chunker) Chunk(doc *Document) []TextChunk {
+	var chunks []TextChunk
+	var headings []Section // open headings, outermost first
+
+	for _, section := range doc.Sections {
+		if section.Title != "" {
+			level := section.Level
+			if level <= 0 {
+				level = 1
+			}
+			for len(headings) > 0 && headings[len(headings)-1].Level >= level {
+				headings = headings[:len(headings)-1]
+			}
+			headings = append(headings, Section{Title: section.Title, Level: level})
+		}
+
+		title := headingPath(headings)
+		for _, text := range c.pack(c.units(section.Text)) {
+			chunks = append(chunks, TextChunk{
+				Text:       text,
+				Title:      title,
+				Page:       section.Page,
+				TokenCount: c.CountTokens(text),
+			})
+		}
+	}
+	return chunks
+}
+
+func headingPath(headings []Section) string {
+	titles := make([]string, len(headings))
+	for i, h := range headings {
+		titles[i] = h.Title
+	}
+	return strings.Join(titles, " > ")
+}
+
+// units breaks text into paragraphs, and paragraphs that exceed the budget
+// into sentences (or lines, for code) and finally word windows.
+func (c *Chunker) units(text string) []unit {
+	var units []unit
+	for _, block := range splitBlocks(text) {
+		if c.CountTokens(block) <= c.MaxTokens {
+			units = append(units, unit{text: block, sep: "\n\n"})
+			continue
+		}
+
+		pieces, sep := splitSentences(block), " "
+		if isFence(block) {
+			pieces, sep = strings.Split(block, "\n"), "\n"
+		}
+		for i, piece := range pieces {
+			pieceSep := sep
+			if i == 0 {
+				pieceSep = "\n\n"
+			}
+			for j, part := range c.splitWords(piece) {
+				if j > 0 {
+					pieceSep = " "
+				}
+				units = append(units, unit{text: part, sep: pieceSep})
+			}
+		}
+	}
+	return units
+}
+
+// pack joins units greedily into chunks within the budget. Chunks are
+// measured whole, separators included, as counts do not add up across them.
+func (c *Chunker) pack(units []unit) []string {
+	var chunks []string
+	var current []unit
+
+	for _, u := range units {
+		if len(current) > 0 && !c.fits(current, u) {
+			if text := joinUnits(current); text != "" {
+				chunks = append(chunks, text)
+			}
+			current = c.overlap(current)
+			// drop overlap that leaves no room for the next unit
+			for len(current) > 0 && !c.fits(current, u) {
+				current = current[1:]
+			}
+		}
+		current = append(current, u)
+	}
+	if text := joinUnits(current); text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// fits reports whether units followed by u stay within the budget.
+func (c *Chunker) fits(units []unit, u unit) bool {
+	return c.CountTokens(joinUnits(append(units[:len(units):len(units)], u))) <= c.MaxTokens
+}
+
+func joinUnits(units []unit) string {
+	var b strings.Builder
+	for i, u := range units {
+		if i > 0 {
+			b.WriteString(u.sep)
+		}
+		b.WriteString(u.text)
+	}
+	// only newlines are trimmed, to keep the indentation of code
+	text := strings.Trim(b.String(), "\n")
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	return text
+}
+
+// overlap returns the trailing sentences of an emitted chunk, up to the
+// overlap budget, to start the next chunk with.
+func (c *Chunker) overlap(previous []unit) []unit {
+	if c.Overlap <= 0 {
+		return nil
+	}
+	within := func(units []unit) bool {
+		return c.CountTokens(joinUnits(units)) <= c.Overlap
+	}
+	var tail []unit
+
+	for i := len(previous) - 1; i >= 0; i-- {
+		if candidate := append([]unit{previous[i]}, tail...); within(candidate) {
+			tail = candidate
+			continue
+		}
+		// take what fits from the end of a longer unit, sentence by sentence
+		sentences := splitSentences(previous[i].text)
+		for j := len(sentences) - 1; j > 0; j-- {
+			candidate := append([]unit{{text: sentences[j], sep: " "}}, tail...)
+			if !within(candidate) {
+				break
+			}
+			tail = candidate
+		}
+		break
+	}
+
+	if len(tail) > 0 {
+		tail[0].sep = "\n\n"
+	}
+	return tail
+}
+
+// splitWords cuts a piece that is still over budget into word windows.
+// Words over budget on their own, such as long URLs or encoded data, are
+// cut between characters.
+func (c *Chunker) splitWords(piece string) []string {
+	if c.CountTokens(piece) <= c.MaxTokens {
+		return []string{piece}
+	}
+
+	var parts []string
+	var current []string
+	flush := func() {
+		if len(current) > 0 {
+			parts = append(parts, strings.Join(current, " "))
+			current = nil
+		}
+	}
+	for _, word := range strings.Fields(piece) {
+		if c.CountTokens(word) > c.MaxTokens {
+			flush()
+			parts = append(parts, c.splitLongWord(word)...)
+			continue
+		}
+		if len(current) > 0 && c.CountTokens(strings.Join(append(current[:len(current):len(current)], word), " ")) > c.MaxTokens {
+			flush()
+		}
+		current = append(current, word)
+	}
+	flush()
+	return parts
+}
+
+// splitLongWord cuts word into the longest runs of characters within the
+// budget, found by bisection.
+func (c *Chunker) splitLongWord(word string) []string {
+	runes := []rune(word)
+	var parts []string
+	for len(runes) > 0 {
+		// at least one character per part, so that this ends
+		lo, hi := 1, len(runes)
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			if c.CountTokens(string(runes[:mid])) <= c.MaxTokens {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		parts = append(parts, string(runes[:lo]))
+		runes = runes[lo:]
+	}
+	return parts
+}
+
+// splitBlocks splits text at blank lines, keeping fenced code blocks intact.
+func splitBlocks(text string) []string {
+	var blocks []string
+	var current []string
+	inFence := false
+
+	flush := func() {
+		if block := strings.Trim(strings.Join(current, "\n"), "\n"); strings.TrimSpace(block) != "" {
+			blocks = append(blocks, block)
+		}
+		current = current[:0]
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			if !inFence {
+				flush()
+			}
+			current = append(current, line)
+			if inFence {
+				flush()
+			}
+			inFence = !inFence
+			continue
+		}
+		if !inFence && trimmed == "" {
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+	return blocks
+}
+
+func isFence(block string) bool {
+	trimmed := strings.TrimSpace(block)
+	return strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")
+}
+
+// splitSentences breaks a paragraph after ., ! or ? (optionally followed by
+// closing quotes or brackets) when whitespace and an upper-case letter,
+// digit or opening quote follow. Common abbreviations do not end sentences.
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		if r != '.' && r != '!' && r != '?' && r != '。' {
+			continue
+		}
+
+		end := i
+		for end < len(text) && strings.ContainsRune(`"')]`, rune(text[end])) {
+			end++
+		}
+		next := end
+		for next < len(text) && (text[next] == ' ' || text[next] == '\n' || text[next] == '\t') {
+			next++
+		}
+		if r != '。' && (next == end || next >= len(text)) {
+			continue
+		}
+		if next < len(text) {
+			nr, _ := utf8.DecodeRuneInString(text[next:])
+			if !unicode.IsUpper(nr) && !unicode.IsDigit(nr) && !strings.ContainsRune(`"'(“‘`, nr) && r != '。' {
+				continue
+			}
+		}
+		if r == '.' && isAbbreviation(text[start:i]) {
+			continue
+		}
+
+		if s := strings.TrimSpace(text[start:end]); s != "" {
+			sentences = append(sentences, s)
+		}
+		start = next
+		i = next
+	}
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
+
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true,
+	"st": true, "vs": true, "etc": true, "e.g": true, "i.e": true, "fig": true, "no": true,
+	"vol": true, "approx": true, "inc": true, "ltd": true, "co": true, "al": true,
+}
+
+func isAbbreviation(sentence string) bool {
+	s := strings.TrimSuffix(sentence, ".")
+	word := s[strings.LastIndexAny(s, " \n\t(")+1:]
+	if utf8.RuneCountInString(word) == 1 {
+		return true // initials such as "J. Smith"
+	}
+	return abbreviations[strings.ToLower(word)]
+}
@@ -0,0 +1,145 @@
+package processing
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func sentences(n int) string {
+	var parts []string
+	for i := 1; i <= n; i++ {
+		parts = append(parts, fmt.Sprintf("Sentence number %d is about splitting text.", i))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestChunkerBudget(t *testing.T) {
+	var code []string
+	code = append(code, "```go")
+	for i := 0; i < 400; i++ {
+		code = append(code, fmt.Sprintf("\tx%d++", i))
+	}
+	code = append(code, "```")
+	longWord := strings.Repeat("abcdefghij", 500)
+
+	tests := []struct {
+		name     string
+		text     string
+		max      int
+		overlap  int
+		rejoin   bool   // whether the chunks put back together give the text
+		joinedBy string // with this between them
+	}{
+		{name: "prose", text: sentences(60), max: 50, overlap: 10},
+		{name: "code lines", text: strings.Join(code, "\n"), max: 100, rejoin: true, joinedBy: "\n"},
+		{name: "long word", text: longWord, max: 100, rejoin: true},
+		{name: "long word in prose", text: "See " + longWord + " for details.", max: 100},
+		{name: "paragraphs", text: sentences(3) + "\n\n" + sentences(4) + "\n\n" + sentences(2), max: 40, overlap: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChunker(tt.max, tt.overlap)
+			chunks := c.Chunk(&Document{Sections: []Section{{Text: tt.text}}})
+			if len(chunks) < 2 {
+				t.Fatalf("got %d chunks, want the text split", len(chunks))
+			}
+
+			var texts []string
+			for i, chunk := range chunks {
+				if got := c.CountTokens(chunk.Text); got > tt.max {
+					t.Errorf("chunk %d has %d tokens, over the budget of %d", i, got, tt.max)
+				}
+				if chunk.TokenCount != c.CountTokens(chunk.Text) {
+					t.Errorf("chunk %d: TokenCount = %d, want %d", i, chunk.TokenCount, c.CountTokens(chunk.Text))
+				}
+				texts = append(texts, chunk.Text)
+			}
+
+			all := strings.Join(texts, " ")
+			for _, word := range strings.Fields(tt.text) {
+				if len(word) < 100 && !strings.Contains(all, word) {
+					t.Errorf("word %q lost", word)
+				}
+			}
+			if tt.rejoin {
+				if got := strings.Join(texts, tt.joinedBy); got != strings.TrimSpace(tt.text) {
+					t.Errorf("chunks do not put the text back together without overlap")
+				}
+			}
+		})
+	}
+}
+
+func TestChunkerOverlap(t *testing.T) {
+	c := NewChunker(40, 15)
+	chunks := c.Chunk(&Document{Sections: []Section{{Text: sentences(20)}}})
+	if len(chunks) < 3 {
+		t.Fatalf("got %d chunks, want at least 3", len(chunks))
+	}
+
+	for i := 1; i < len(chunks); i++ {
+		first := splitSentences(chunks[i].Text)[0]
+		if !strings.HasSuffix(chunks[i-1].Text, first) {
+			t.Errorf("chunk %d starts with %q, which does not end chunk %d", i, first, i-1)
+		}
+		if got := c.CountTokens(first); got > c.Overlap {
+			t.Errorf("chunk %d repeats %d tokens, over the overlap of %d", i, got, c.Overlap)
+		}
+	}
+
+	c.Overlap = 0
+	chunks = c.Chunk(&Document{Sections: []Section{{Text: sentences(20)}}})
+	for i := 1; i < len(chunks); i++ {
+		first := splitSentences(chunks[i].Text)[0]
+		if strings.Contains(chunks[i-1].Text, first) {
+			t.Errorf("chunk %d repeats %q without overlap", i, first)
+		}
+	}
+}
+
+func TestChunkerHeadingPaths(t *testing.T) {
+	doc := &Document{Sections: []Section{
+		{Text: "Preface."},
+		{Title: "Guide", Level: 1, Text: "About the guide."},
+		{Title: "Install", Level: 2, Text: "How to install."},
+		{Title: "Linux", Level: 3, Text: "On Linux."},
+		{Title: "Usage", Level: 2, Text: "How to use."},
+		{Title: "API", Level: 1, Text: "The API."},
+		{Title: "Untitled level", Text: "Level 0 counts as 1."},
+	}}
+
+	want := []string{"", "Guide", "Guide > Install", "Guide > Install > Linux", "Guide > Usage", "API", "Untitled level"}
+	chunks := NewChunker(0, 0).Chunk(doc)
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks, want %d", len(chunks), len(want))
+	}
+	for i, chunk := range chunks {
+		if chunk.Title != want[i] {
+			t.Errorf("chunk %d (%q): title %q, want %q", i, chunk.Text, chunk.Title, want[i])
+		}
+	}
+}
+
+func TestChunkerFencedCode(t *testing.T) {
+	fence := "```go\nfunc main() {\n\n\tfmt.Println(\"hi\")\n}\n```"
+	text := sentences(4) + "\n\n" + fence + "\n\n" + sentences(3)
+
+	// room for the fence, but not for the fence and the prose around it
+	c := NewChunker(EstimateTokens(fence)+5, 0)
+	chunks := c.Chunk(&Document{Sections: []Section{{Text: text}}})
+
+	found := false
+	for _, chunk := range chunks {
+		if strings.Contains(chunk.Text, "```go") {
+			found = true
+			if !strings.Contains(chunk.Text, fence) {
+				t.Errorf("fence split across chunks, chunk is %q", chunk.Text)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("fence missing from the chunks")
+	}
+}
@@ -0,0 +1,89 @@
+package processing
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvRowsPerSection keeps sections small enough that a retrieved chunk still
+// carries its own column names.
+const csvRowsPerSection = 50
+
+// CSVLoader returns a loader for delimiter-separated files. The first row is
+// taken as the header and every following row is written as
+// "column: value" pairs, so each row can be understood on its own.
+func CSVLoader(delimiter rune) Loader {
+	return LoaderFunc(func(r io.Reader) (*Document, error) {
+		data, err := readAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("read csv: %w", err)
+		}
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+
+		cr := csv.NewReader(bytes.NewReader(data))
+		cr.Comma = delimiter
+		cr.FieldsPerRecord = -1
+		cr.LazyQuotes = true
+		cr.TrimLeadingSpace = true
+
+		header, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return &Document{}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse csv: %w", err)
+		}
+
+		doc := &Document{}
+		var rows []string
+		first := 1
+		flush := func(last int) {
+			if len(rows) > 0 {
+				doc.Sections = append(doc.Sections, Section{
+					Title: fmt.Sprintf("Rows %d-%d", first, last),
+					Text:  strings.Join(rows, "\n"),
+				})
+				rows = rows[:0]
+			}
+			first = last + 1
+		}
+
+		rowNum := 0
+		for {
+			record, err := cr.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("parse csv: %w", err)
+			}
+			rowNum++
+
+			pairs := make([]string, 0, len(record))
+			for i, value := range record {
+				value = strings.TrimSpace(value)
+				if value == "" {
+					continue
+				}
+				column := fmt.Sprintf("column %d", i+1)
+				if i < len(header) && strings.TrimSpace(header[i]) != "" {
+					column = strings.TrimSpace(header[i])
+				}
+				pairs = append(pairs, column+": "+value)
+			}
+			if len(pairs) > 0 {
+				rows = append(rows, strings.Join(pairs, "; "))
+			}
+			if rowNum%csvRowsPerSection == 0 {
+				flush(rowNum)
+			}
+		}
+		flush(rowNum)
+
+		return doc, nil
+	})
+}
@@ -0,0 +1,193 @@
+package processing
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// loadDOCX reads the main part of a Word document. Paragraphs styled as
+// headings (or with an outline level) start new sections; tables are kept as
+// one line per row.
+func loadDOCX(r io.Reader) (*Document, error) {
+	data, err := readAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read docx: %w", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open docx: %w", err)
+	}
+
+	headingLevels := map[string]int{}
+	if styles, err := readZipFile(zr, "word/styles.xml"); err == nil {
+		headingLevels = docxHeadingStyles(styles)
+	}
+
+	body, err := readZipFile(zr, "word/document.xml")
+	if err != nil {
+		return nil, fmt.Errorf("docx: %w", err)
+	}
+
+	doc := &Document{}
+	if core, err := readZipFile(zr, "docProps/core.xml"); err == nil {
+		doc.Title = docxCoreTitle(core)
+	}
+
+	current := Section{}
+	var blocks []string
+	flush := func() {
+		text := strings.Join(blocks, "\n\n")
+		if text != "" || current.Title != "" {
+			current.Text = text
+			doc.Sections = append(doc.Sections, current)
+		}
+		blocks = blocks[:0]
+	}
+
+	var (
+		para       strings.Builder
+		paraLevel  int
+		row        []string
+		tableDepth int
+	)
+
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse docx: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				paraLevel = 0
+			case "pStyle":
+				paraLevel = headingLevels[xmlAttr(t, "val")]
+			case "outlineLvl":
+				if lvl, err := strconv.Atoi(xmlAttr(t, "val")); err == nil && lvl < 9 {
+					paraLevel = lvl + 1
+				}
+			case "t":
+				var text string
+				if err := dec.DecodeElement(&text, &t); err == nil {
+					para.WriteString(text)
+				}
+			case "tab":
+				para.WriteByte('\t')
+			case "br", "cr":
+				para.WriteByte('\n')
+			case "tbl":
+				tableDepth++
+			case "tr":
+				row = row[:0]
+			case "tc":
+				row = append(row, "")
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				text := strings.TrimSpace(para.String())
+				switch {
+				case text == "":
+				case tableDepth > 0:
+					if n := len(row); n > 0 {
+						row[n-1] = strings.TrimSpace(row[n-1] + " " + collapseSpace(text))
+					}
+				case paraLevel > 0:
+					flush()
+					current = Section{Title: collapseSpace(text), Level: paraLevel}
+				default:
+					blocks = append(blocks, text)
+				}
+			case "tr":
+				if line := strings.Join(row, " | "); strings.Trim(line, " |") != "" {
+					blocks = append(blocks, line)
+				}
+			case "tbl":
+				tableDepth--
+			}
+		}
+	}
+	flush()
+
+	return doc, nil
+}
+
+// docxHeadingStyles maps style ids to heading levels. Built-in heading styles
+// have localized ids ("Heading1", "berschrift1", ...) but stable names
+// ("heading 1") and usually an outline level.
+func docxHeadingStyles(styles []byte) map[string]int {
+	levels := map[string]int{}
+	dec := xml.NewDecoder(bytes.NewReader(styles))
+
+	var styleID string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return levels
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "style":
+			styleID = xmlAttr(start, "styleId")
+		case "name":
+			name := strings.ToLower(xmlAttr(start, "val"))
+			if name == "title" {
+				levels[styleID] = 1
+			} else if n, ok := strings.CutPrefix(name, "heading "); ok {
+				if lvl, err := strconv.Atoi(n); err == nil {
+					levels[styleID] = lvl
+				}
+			}
+		case "outlineLvl":
+			if lvl, err := strconv.Atoi(xmlAttr(start, "val")); err == nil && lvl < 9 && styleID != "" {
+				if _, named := levels[styleID]; !named {
+					levels[styleID] = lvl + 1
+				}
+			}
+		}
+	}
+}
+
+func docxCoreTitle(core []byte) string {
+	var props struct {
+		Title string `xml:"title"`
+	}
+	if err := xml.Unmarshal(core, &props); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(props.Title)
+}
+
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readAll(f)
+}
+
+func xmlAttr(el xml.StartElement, local string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package processing
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// loadEPUB reads the chapters of an EPUB in spine (reading) order. Each
+// chapter is split at its headings like an HTML file; chapters without
+// headings use their <title> as section title.
+func loadEPUB(r io.Reader) (*Document, error) {
+	data, err := readAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read epub: %w", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open epub: %w", err)
+	}
+
+	opfPath, err := epubPackagePath(zr)
+	if err != nil {
+		return nil, err
+	}
+	opfData, err := readZipFile(zr, opfPath)
+	if err != nil {
+		return nil, fmt.Errorf("epub: %w", err)
+	}
+
+	var pkg struct {
+		Title    string `xml:"metadata>title"`
+		Manifest []struct {
+			ID        string `xml:"id,attr"`
+			Href      string `xml:"href,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}
+	if err := xml.Unmarshal(opfData, &pkg); err != nil {
+		return nil, fmt.Errorf("parse epub package: %w", err)
+	}
+
+	hrefs := map[string]string{}
+	for _, item := range pkg.Manifest {
+		if item.MediaType == "application/xhtml+xml" || item.MediaType == "text/html" {
+			hrefs[item.ID] = item.Href
+		}
+	}
+
+	doc := &Document{Title: strings.TrimSpace(pkg.Title)}
+	base := path.Dir(opfPath)
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+		chapter, err := readZipFile(zr, path.Join(base, href))
+		if err != nil {
+			continue // a broken manifest entry should not lose the whole book
+		}
+
+		page, err := goquery.NewDocumentFromReader(bytes.NewReader(chapter))
+		if err != nil {
+			continue
+		}
+		sections := htmlSections(page.Find("body").First()).Sections
+		if len(sections) > 0 && sections[0].Title == "" {
+			sections[0].Title = collapseSpace(page.Find("title").First().Text())
+		}
+		doc.Sections = append(doc.Sections, sections...)
+	}
+
+	if len(doc.Sections) == 0 {
+		return nil, errors.New("epub: no readable chapters")
+	}
+	return doc, nil
+}
+
+// epubPackagePath returns the location of the OPF package document from
+// META-INF/container.xml.
+func epubPackagePath(zr *zip.Reader) (string, error) {
+	data, err := readZipFile(zr, "META-INF/container.xml")
+	if err != nil {
+		return "", fmt.Errorf("epub: %w", err)
+	}
+
+	var container struct {
+		Rootfiles []struct {
+			FullPath  string `xml:"full-path,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := xml.Unmarshal(data, &container); err != nil {
+		return "", fmt.Errorf("parse epub container: %w", err)
+	}
+	for _, rf := range container.Rootfiles {
+		if rf.MediaType == "" || rf.MediaType == "application/oebps-package+xml" {
+			return rf.FullPath, nil
+		}
+	}
+	return "", errors.New("epub: package document not found")
+}
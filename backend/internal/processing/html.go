@@ -0,0 +1,108 @@
+package processing
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/synntx/askmind/internal/tools"
+)
+
+const (
+	htmlBlockSelector = "h1, h2, h3, h4, h5, h6, p, li, pre, blockquote, tr, dt, dd, figcaption, div"
+	// blocks nested in one of these are part of the outer block's text
+	htmlContainerSelector = "p, li, pre, blockquote, tr, dt, dd, figcaption"
+	htmlBlockChildren     = "p, div, ul, ol, table, pre, blockquote, section, article, h1, h2, h3, h4, h5, h6"
+)
+
+// loadHTML keeps the page's main content, using the same detection as the
+// web page analyzer tool, and splits it into one section per heading.
+func loadHTML(r io.Reader) (*Document, error) {
+	data, err := readAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read html: %w", err)
+	}
+
+	page, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse html: %w", err)
+	}
+
+	doc := htmlSections(tools.MainContent(page))
+	doc.Title = collapseSpace(page.Find("title").First().Text())
+	return doc, nil
+}
+
+// htmlSections walks the block elements under root in document order and
+// starts a new section at every heading.
+func htmlSections(root *goquery.Selection) *Document {
+	doc := &Document{}
+	current := Section{}
+	var blocks []string
+
+	flush := func() {
+		text := strings.Join(blocks, "\n\n")
+		if text != "" || current.Title != "" {
+			current.Text = text
+			doc.Sections = append(doc.Sections, current)
+		}
+		blocks = blocks[:0]
+	}
+
+	root.Find(htmlBlockSelector).Each(func(_ int, s *goquery.Selection) {
+		if s.ParentsFiltered(htmlContainerSelector).Length() > 0 {
+			return
+		}
+
+		switch tag := goquery.NodeName(s); tag {
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			if title := collapseSpace(s.Text()); title != "" {
+				flush()
+				current = Section{Title: title, Level: int(tag[1] - '0')}
+			}
+		case "pre":
+			if text := strings.Trim(s.Text(), "\n"); strings.TrimSpace(text) != "" {
+				blocks = append(blocks, text)
+			}
+		case "tr":
+			var cells []string
+			s.Find("th, td").Each(func(_ int, cell *goquery.Selection) {
+				cells = append(cells, collapseSpace(cell.Text()))
+			})
+			if row := strings.Join(cells, " | "); strings.Trim(row, " |") != "" {
+				blocks = append(blocks, row)
+			}
+		case "div":
+			// only divs used as paragraphs; containers are handled through
+			// their children
+			if s.ChildrenFiltered(htmlBlockChildren).Length() > 0 {
+				return
+			}
+			if text := collapseSpace(s.Text()); text != "" {
+				blocks = append(blocks, text)
+			}
+		case "li":
+			if text := collapseSpace(s.Text()); text != "" {
+				blocks = append(blocks, "- "+text)
+			}
+		default:
+			if text := collapseSpace(s.Text()); text != "" {
+				blocks = append(blocks, text)
+			}
+		}
+	})
+	flush()
+
+	if len(doc.Sections) == 0 {
+		if text := collapseSpace(root.Text()); text != "" {
+			doc.Sections = []Section{{Text: text}}
+		}
+	}
+	return doc
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,119 @@
+package processing
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/synntx/askmind/internal/processing/pdf"
+)
+
+// maxLoaderInput bounds how much of a file loaders read into memory.
+const maxLoaderInput = 64 << 20 // 64 MB
+
+// Loader extracts a Document from one file format.
+type Loader interface {
+	Load(r io.Reader) (*Document, error)
+}
+
+// LoaderFunc adapts a function to the Loader interface.
+type LoaderFunc func(r io.Reader) (*Document, error)
+
+func (f LoaderFunc) Load(r io.Reader) (*Document, error) {
+	return f(r)
+}
+
+type registry struct {
+	mu          sync.RWMutex
+	byExtension map[string]Loader
+	byMIMEType  map[string]Loader
+}
+
+var loaders = &registry{
+	byExtension: map[string]Loader{},
+	byMIMEType:  map[string]Loader{},
+}
+
+func init() {
+	Register(LoaderFunc(loadText), []string{".txt", ".text", ".log"}, []string{"text/plain"})
+	Register(LoaderFunc(loadPDF), []string{".pdf"}, []string{"application/pdf"})
+	Register(LoaderFunc(loadMarkdown), []string{".md", ".markdown"}, []string{"text/markdown", "text/x-markdown"})
+	Register(LoaderFunc(loadHTML), []string{".html", ".htm", ".xhtml"}, []string{"text/html", "application/xhtml+xml"})
+	Register(LoaderFunc(loadDOCX), []string{".docx"}, []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"})
+	Register(CSVLoader(','), []string{".csv"}, []string{"text/csv"})
+	Register(CSVLoader('\t'), []string{".tsv", ".tab"}, []string{"text/tab-separated-values"})
+	Register(LoaderFunc(loadEPUB), []string{".epub"}, []string{"application/epub+zip"})
+}
+
+// Register makes loader available for the given extensions (with the leading
+// dot) and MIME types, replacing any loader registered for them before.
+func Register(loader Loader, extensions []string, mimeTypes []string) {
+	loaders.mu.Lock()
+	defer loaders.mu.Unlock()
+
+	for _, ext := range extensions {
+		loaders.byExtension[strings.ToLower(ext)] = loader
+	}
+	for _, mt := range mimeTypes {
+		loaders.byMIMEType[strings.ToLower(mt)] = loader
+	}
+}
+
+// LoaderFor returns the loader for a file. The extension wins over the MIME
+// type because browsers often upload files as application/octet-stream or
+// text/plain.
+func LoaderFor(fileName string, contentType string) (Loader, bool) {
+	loaders.mu.RLock()
+	defer loaders.mu.RUnlock()
+
+	if loader, ok := loaders.byExtension[strings.ToLower(filepath.Ext(fileName))]; ok {
+		return loader, true
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if loader, ok := loaders.byMIMEType[mediaType]; ok {
+			return loader, true
+		}
+	}
+	return nil, false
+}
+
+func readAll(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxLoaderInput+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxLoaderInput {
+		return nil, fmt.Errorf("file is larger than %d MB", maxLoaderInput>>20)
+	}
+	return data, nil
+}
+
+func loadText(r io.Reader) (*Document, error) {
+	data, err := readAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read text: %w", err)
+	}
+	return &Document{Sections: []Section{{Text: string(data)}}}, nil
+}
+
+// loadPDF extracts the text layer of a PDF, one section per page.
+func loadPDF(r io.Reader) (*Document, error) {
+	data, err := readAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read pdf: %w", err)
+	}
+
+	pages, err := pdf.ExtractPages(data)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Sections: make([]Section, 0, len(pages))}
+	for _, page := range pages {
+		doc.Sections = append(doc.Sections, Section{Page: page.Number, Text: page.Text})
+	}
+	return doc, nil
+}
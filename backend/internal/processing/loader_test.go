@@ -0,0 +1,193 @@
+package processing
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPDFChunksKeepPageNumbers(t *testing.T) {
+	doc, err := ProcessFile("pdf/testdata/pages.pdf", "application/pdf")
+	if err != nil {
+		t.Fatalf("ProcessFile: %v", err)
+	}
+
+	// the blank third page yields no chunk but keeps the fourth one numbered 4
+	want := []TextChunk{
+		{Text: "First page", Page: 1},
+		{Text: "Second page", Page: 2},
+		{Text: "Fourth page", Page: 4},
+	}
+	chunks := NewChunker(0, 0).Chunk(doc)
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks, want %d: %+v", len(chunks), len(want), chunks)
+	}
+	for i, chunk := range chunks {
+		if chunk.Text != want[i].Text || chunk.Page != want[i].Page {
+			t.Errorf("chunk %d = {%q, page %d}, want {%q, page %d}", i, chunk.Text, chunk.Page, want[i].Text, want[i].Page)
+		}
+	}
+}
+
+func TestLoaders(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want *Document
+	}{
+		{
+			name: "markdown",
+			path: "testdata/guide.md",
+			want: &Document{Title: "User Guide", Sections: []Section{
+				{Text: "Read this first."},
+				{Title: "User Guide", Level: 1, Text: "Welcome to the guide."},
+				{Title: "Installation", Level: 2, Text: "Run the installer.\n\n```sh\n# not a heading\nmake install\n```"},
+				{Title: "Linux", Level: 3, Text: "Use the package manager."},
+			}},
+		},
+		{
+			name: "html",
+			path: "testdata/release.html",
+			want: &Document{Title: "Release Notes", Sections: []Section{
+				{Title: "Version 2.0", Level: 1, Text: "This release adds search.\n\nIt also fixes bugs."},
+				{Title: "Changes", Level: 2, Text: "- Faster indexing\n\n- New API\n\nFlag | Default\n\n--fast | off"},
+				{Title: "Example", Level: 2, Text: "askmind --fast\n  search \"term\"\n\nQuoted text."},
+			}},
+		},
+		{
+			name: "csv",
+			path: "testdata/people.csv",
+			want: &Document{Sections: []Section{
+				{Title: "Rows 1-3", Text: "name: Ada; city: London; note: Wrote the first program, 1843\n" +
+					"name: Alan\n" +
+					"name: Grace; city: Arlington; note: Navy; column 4: extra"},
+			}},
+		},
+		{
+			name: "docx",
+			path: writeZip(t, "report.docx", docxFixture),
+			want: &Document{Title: "Quarterly Report", Sections: []Section{
+				{Text: "Draft."},
+				{Title: "Summary", Level: 1, Text: "Sales grew.\n\nRegion | Growth\n\nNorth | 5%"},
+				{Title: "Outlook", Level: 2, Text: "More of the same,\nnext year."},
+				{Title: "Risks", Level: 3, Text: "Costs\trise."},
+			}},
+		},
+		{
+			name: "epub",
+			path: writeZip(t, "book.epub", epubFixture),
+			want: &Document{Title: "A Short Book", Sections: []Section{
+				{Title: "Chapter One", Level: 1, Text: "It began."},
+				{Title: "A Scene", Level: 2, Text: "Rain fell."},
+				{Title: "Interlude", Text: "A pause."},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ProcessFile(tt.path, "application/octet-stream")
+			if err != nil {
+				t.Fatalf("ProcessFile: %v", err)
+			}
+			if doc.Title != tt.want.Title {
+				t.Errorf("title %q, want %q", doc.Title, tt.want.Title)
+			}
+			if len(doc.Sections) != len(tt.want.Sections) {
+				t.Fatalf("got %d sections, want %d: %+v", len(doc.Sections), len(tt.want.Sections), doc.Sections)
+			}
+			for i, section := range doc.Sections {
+				if section != tt.want.Sections[i] {
+					t.Errorf("section %d = %+v, want %+v", i, section, tt.want.Sections[i])
+				}
+			}
+		})
+	}
+}
+
+// docxFixture uses a heading style named in English, one with a localized
+// id, one known only by its outline level and a paragraph-level outline.
+var docxFixture = map[string]string{
+	"word/styles.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+  <w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/></w:style>
+  <w:style w:type="paragraph" w:styleId="berschrift2"><w:name w:val="Heading 2"/></w:style>
+  <w:style w:type="paragraph" w:styleId="Custom"><w:name w:val="Custom"/><w:pPr><w:outlineLvl w:val="2"/></w:pPr></w:style>
+</w:styles>`,
+	"word/document.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+  <w:body>
+    <w:p><w:r><w:t>Draft.</w:t></w:r></w:p>
+    <w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Summary</w:t></w:r></w:p>
+    <w:p><w:r><w:t xml:space="preserve">Sales </w:t></w:r><w:r><w:t>grew.</w:t></w:r></w:p>
+    <w:p></w:p>
+    <w:tbl>
+      <w:tr><w:tc><w:p><w:r><w:t>Region</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Growth</w:t></w:r></w:p></w:tc></w:tr>
+      <w:tr><w:tc><w:p><w:r><w:t>North</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>5%</w:t></w:r></w:p></w:tc></w:tr>
+    </w:tbl>
+    <w:p><w:pPr><w:pStyle w:val="berschrift2"/></w:pPr><w:r><w:t>Outlook</w:t></w:r></w:p>
+    <w:p><w:r><w:t>More of the same,</w:t><w:br/><w:t>next year.</w:t></w:r></w:p>
+    <w:p><w:pPr><w:pStyle w:val="Custom"/></w:pPr><w:r><w:t>Risks</w:t></w:r></w:p>
+    <w:p><w:r><w:t>Costs</w:t><w:tab/><w:t>rise.</w:t></w:r></w:p>
+  </w:body>
+</w:document>`,
+	"docProps/core.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <dc:title> Quarterly Report </dc:title>
+</cp:coreProperties>`,
+}
+
+// epubFixture lists its chapters out of spine order, with an escaped href,
+// a chapter without headings and a spine entry missing from the archive.
+var epubFixture = map[string]string{
+	"mimetype": "application/epub+zip",
+	"META-INF/container.xml": `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+	"OEBPS/content.opf": `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>A Short Book</dc:title></metadata>
+  <manifest>
+    <item id="interlude" href="text/inter%20lude.xhtml" media-type="application/xhtml+xml"/>
+    <item id="missing" href="text/missing.xhtml" media-type="application/xhtml+xml"/>
+    <item id="one" href="text/one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="css" href="style.css" media-type="text/css"/>
+  </manifest>
+  <spine><itemref idref="one"/><itemref idref="missing"/><itemref idref="css"/><itemref idref="interlude"/></spine>
+</package>`,
+	"OEBPS/text/one.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><head><title>One</title></head>
+<body><h1>Chapter One</h1><p>It began.</p><h2>A Scene</h2><p>Rain fell.</p></body></html>`,
+	"OEBPS/text/inter lude.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Interlude</title></head>
+<body><p>A pause.</p></body></html>`,
+	"OEBPS/style.css": `p { margin: 0 }`,
+}
+
+// writeZip writes files into a zip archive named name in a temporary
+// directory and returns its path.
+func writeZip(t *testing.T, name string, files map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for fileName, content := range files {
+		w, err := zw.Create(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
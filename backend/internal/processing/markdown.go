@@ -0,0 +1,126 @@
+package processing
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// loadMarkdown splits a Markdown file into one section per heading. ATX
+// ("## Title") and setext (underlined) headings are recognised; anything
+// inside fenced code blocks is left alone. The text keeps its Markdown syntax,
+// which models read well.
+func loadMarkdown(r io.Reader) (*Document, error) {
+	data, err := readAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read markdown: %w", err)
+	}
+
+	doc := &Document{}
+	current := Section{}
+	var body []string
+
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(body, "\n"))
+		if text != "" || current.Title != "" {
+			current.Text = text
+			doc.Sections = append(doc.Sections, current)
+		}
+		body = body[:0]
+	}
+	startSection := func(title string, level int) {
+		flush()
+		current = Section{Title: title, Level: level}
+		if doc.Title == "" && level == 1 {
+			doc.Title = title
+		}
+	}
+
+	var fence string
+	frontMatter := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for lineNo := 0; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		// YAML front matter is metadata, not content
+		if lineNo == 0 && trimmed == "---" {
+			frontMatter = true
+			continue
+		}
+		if frontMatter {
+			frontMatter = trimmed != "---" && trimmed != "..."
+			continue
+		}
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			body = append(body, line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			body = append(body, line)
+			continue
+		}
+
+		if title, level, ok := atxHeading(line); ok {
+			startSection(title, level)
+			continue
+		}
+		if level := setextLevel(trimmed); level > 0 && len(body) > 0 {
+			if title := strings.TrimSpace(body[len(body)-1]); title != "" {
+				body = body[:len(body)-1]
+				startSection(title, level)
+				continue
+			}
+		}
+		body = append(body, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read markdown: %w", err)
+	}
+	flush()
+
+	return doc, nil
+}
+
+// atxHeading parses "# Title", allowing up to three spaces of indentation and
+// an optional closing sequence of #s.
+func atxHeading(line string) (string, int, bool) {
+	s := strings.TrimLeft(line, " ")
+	if len(line)-len(s) > 3 {
+		return "", 0, false
+	}
+	level := 0
+	for level < len(s) && s[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(s) && s[level] != ' ' && s[level] != '\t') {
+		return "", 0, false
+	}
+	title := strings.TrimSpace(s[level:])
+	if stripped := strings.TrimRight(title, "#"); stripped != title && (stripped == "" || strings.HasSuffix(stripped, " ")) {
+		title = strings.TrimSpace(stripped)
+	}
+	return title, level, title != ""
+}
+
+// setextLevel reports 1 for "===" and 2 for "---" underlines.
+func setextLevel(trimmed string) int {
+	if trimmed == "" {
+		return 0
+	}
+	switch {
+	case strings.Trim(trimmed, "=") == "":
+		return 1
+	case strings.Trim(trimmed, "-") == "" && len(trimmed) >= 2:
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,309 @@
+package pdf
+
+import "math"
+
+const maxFormDepth = 8
+
+// matrix is a PDF transformation matrix [a b c d e f].
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+func toMatrix(ops []object) (matrix, bool) {
+	if len(ops) < 6 {
+		return identity, false
+	}
+	var m matrix
+	for i := range m {
+		m[i] = toFloat(ops[len(ops)-6+i])
+	}
+	return m, true
+}
+
+// char is a positioned glyph in page space.
+type char struct {
+	x0, x1 float64
+	y      float64 // baseline
+	size   float64 // effective font size
+	text   string
+}
+
+type gstate struct {
+	ctm      matrix
+	font     *font
+	fontSize float64
+	charSp   float64
+	wordSp   float64
+	hScale   float64
+	leading  float64
+	rise     float64
+}
+
+// interpreter runs a page's content streams and collects its glyphs.
+type interpreter struct {
+	r     *Reader
+	chars []char
+	gs    gstate
+	stack []gstate
+	tm    matrix
+	tlm   matrix
+}
+
+func (r *Reader) pageChars(page dict) []char {
+	in := &interpreter{r: r, gs: gstate{ctm: identity, hScale: 1}}
+	resources := r.resolveDict(page["Resources"])
+
+	var content []byte
+	switch c := r.resolve(page["Contents"]).(type) {
+	case *stream:
+		content, _ = r.decodeStream(c)
+	case array:
+		// a page's streams are concatenated; operators may span them
+		for _, part := range c {
+			if st, ok := r.resolve(part).(*stream); ok {
+				if data, err := r.decodeStream(st); err == nil {
+					content = append(content, data...)
+					content = append(content, '\n')
+				}
+			}
+		}
+	}
+
+	in.run(content, resources, 0)
+	return in.chars
+}
+
+func (in *interpreter) run(content []byte, resources dict, depth int) {
+	lex := newLexer(content, 0)
+	var ops []object
+
+	for {
+		obj, err := lex.readObject()
+		if err != nil {
+			return
+		}
+		op, isOp := obj.(keyword)
+		if !isOp {
+			ops = append(ops, obj)
+			continue
+		}
+
+		switch op {
+		case "q":
+			in.stack = append(in.stack, in.gs)
+		case "Q":
+			if n := len(in.stack); n > 0 {
+				in.gs = in.stack[n-1]
+				in.stack = in.stack[:n-1]
+			}
+		case "cm":
+			if m, ok := toMatrix(ops); ok {
+				in.gs.ctm = m.mul(in.gs.ctm)
+			}
+		case "BT":
+			in.tm, in.tlm = identity, identity
+		case "Tf":
+			if len(ops) >= 2 {
+				fonts := in.r.resolveDict(resources["Font"])
+				if fn, ok := ops[len(ops)-2].(name); ok && fonts != nil {
+					in.gs.font = in.r.loadFont(fonts[fn])
+				}
+				in.gs.fontSize = toFloat(ops[len(ops)-1])
+			}
+		case "Tc":
+			in.gs.charSp = lastFloat(ops)
+		case "Tw":
+			in.gs.wordSp = lastFloat(ops)
+		case "Tz":
+			in.gs.hScale = lastFloat(ops) / 100
+		case "TL":
+			in.gs.leading = lastFloat(ops)
+		case "Ts":
+			in.gs.rise = lastFloat(ops)
+		case "Td", "TD":
+			if len(ops) >= 2 {
+				tx, ty := toFloat(ops[len(ops)-2]), toFloat(ops[len(ops)-1])
+				if op == "TD" {
+					in.gs.leading = -ty
+				}
+				in.tlm = matrix{1, 0, 0, 1, tx, ty}.mul(in.tlm)
+				in.tm = in.tlm
+			}
+		case "Tm":
+			if m, ok := toMatrix(ops); ok {
+				in.tm, in.tlm = m, m
+			}
+		case "T*":
+			in.nextLine()
+		case "Tj":
+			if s, ok := lastString(ops); ok {
+				in.show(s)
+			}
+		case "'":
+			in.nextLine()
+			if s, ok := lastString(ops); ok {
+				in.show(s)
+			}
+		case "\"":
+			if len(ops) >= 3 {
+				in.gs.wordSp = toFloat(ops[len(ops)-3])
+				in.gs.charSp = toFloat(ops[len(ops)-2])
+			}
+			in.nextLine()
+			if s, ok := lastString(ops); ok {
+				in.show(s)
+			}
+		case "TJ":
+			if len(ops) > 0 {
+				if arr, ok := ops[len(ops)-1].(array); ok {
+					for _, item := range arr {
+						switch v := item.(type) {
+						case string:
+							in.show(v)
+						case int64, float64:
+							in.advance(-toFloat(v) / 1000 * in.gs.fontSize * in.gs.hScale)
+						}
+					}
+				}
+			}
+		case "Do":
+			if len(ops) > 0 && depth < maxFormDepth {
+				if xn, ok := ops[len(ops)-1].(name); ok {
+					in.doXObject(xn, resources, depth)
+				}
+			}
+		case "BI":
+			skipInlineImage(lex)
+		}
+		ops = ops[:0]
+	}
+}
+
+func (in *interpreter) doXObject(xn name, resources dict, depth int) {
+	xobjects := in.r.resolveDict(resources["XObject"])
+	if xobjects == nil {
+		return
+	}
+	st, ok := in.r.resolve(xobjects[xn]).(*stream)
+	if !ok {
+		return
+	}
+	if subtype, _ := in.r.resolve(st.hdr["Subtype"]).(name); subtype != "Form" {
+		return
+	}
+	data, err := in.r.decodeStream(st)
+	if err != nil {
+		return
+	}
+
+	formResources := in.r.resolveDict(st.hdr["Resources"])
+	if formResources == nil {
+		formResources = resources
+	}
+
+	saved, savedTm, savedTlm := in.gs, in.tm, in.tlm
+	if m, ok := in.r.resolve(st.hdr["Matrix"]).(array); ok {
+		ops := make([]object, len(m))
+		for i, v := range m {
+			ops[i] = in.r.resolve(v)
+		}
+		if fm, ok := toMatrix(ops); ok {
+			in.gs.ctm = fm.mul(in.gs.ctm)
+		}
+	}
+	in.run(data, formResources, depth+1)
+	in.gs, in.tm, in.tlm = saved, savedTm, savedTlm
+}
+
+func (in *interpreter) nextLine() {
+	in.tlm = matrix{1, 0, 0, 1, 0, -in.gs.leading}.mul(in.tlm)
+	in.tm = in.tlm
+}
+
+func (in *interpreter) advance(tx float64) {
+	in.tm = matrix{1, 0, 0, 1, tx, 0}.mul(in.tm)
+}
+
+func (in *interpreter) show(s string) {
+	f := in.gs.font
+	if f == nil {
+		f = in.r.loadFont(nil)
+		in.gs.font = f
+	}
+	fs := in.gs.fontSize
+
+	for _, g := range f.decode(s) {
+		trm := matrix{fs * in.gs.hScale, 0, 0, fs, 0, in.gs.rise}.mul(in.tm).mul(in.gs.ctm)
+		x0, y := trm.apply(0, 0)
+		x1, _ := trm.apply(g.width, 0)
+		size := math.Hypot(trm[2], trm[3])
+
+		if g.text != "" {
+			in.chars = append(in.chars, char{
+				x0:   math.Min(x0, x1),
+				x1:   math.Max(x0, x1),
+				y:    y,
+				size: size,
+				text: g.text,
+			})
+		}
+
+		tx := g.width*fs + in.gs.charSp
+		if g.isSpace {
+			tx += in.gs.wordSp
+		}
+		in.advance(tx * in.gs.hScale)
+	}
+}
+
+// skipInlineImage moves past the binary data between "ID" and "EI".
+func skipInlineImage(lex *lexer) {
+	for {
+		obj, err := lex.readObject()
+		if err != nil {
+			return
+		}
+		if k, ok := obj.(keyword); ok && k == "ID" {
+			break
+		}
+	}
+	data := lex.data
+	for i := lex.pos + 1; i+2 <= len(data); i++ {
+		if data[i] == 'E' && data[i+1] == 'I' && isWhite(data[i-1]) &&
+			(i+2 == len(data) || isWhite(data[i+2])) {
+			lex.pos = i + 2
+			return
+		}
+	}
+	lex.pos = len(data)
+}
+
+func lastFloat(ops []object) float64 {
+	if len(ops) == 0 {
+		return 0
+	}
+	return toFloat(ops[len(ops)-1])
+}
+
+func lastString(ops []object) (string, bool) {
+	if len(ops) == 0 {
+		return "", false
+	}
+	s, ok := ops[len(ops)-1].(string)
+	return s, ok
+}
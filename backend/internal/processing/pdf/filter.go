@@ -0,0 +1,235 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// decodeStream applies the stream's /Filter chain. Image-only filters such as
+// DCTDecode are left undecoded since they never carry text.
+func (r *Reader) decodeStream(st *stream) ([]byte, error) {
+	data := st.data
+
+	var filters []name
+	switch f := r.resolve(st.hdr["Filter"]).(type) {
+	case name:
+		filters = []name{f}
+	case array:
+		for _, v := range f {
+			if n, ok := r.resolve(v).(name); ok {
+				filters = append(filters, n)
+			}
+		}
+	}
+
+	var params []dict
+	switch p := r.resolve(st.hdr["DecodeParms"]).(type) {
+	case dict:
+		params = []dict{p}
+	case array:
+		for _, v := range p {
+			params = append(params, r.resolveDict(v))
+		}
+	}
+
+	for i, f := range filters {
+		var parm dict
+		if i < len(params) {
+			parm = params[i]
+		}
+
+		var err error
+		switch f {
+		case "FlateDecode", "Fl":
+			data, err = r.inflate(data)
+			if err == nil {
+				data, err = r.unpredict(data, parm)
+			}
+		case "ASCIIHexDecode", "AHx":
+			data = asciiHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		default:
+			return nil, fmt.Errorf("pdf: unsupported filter %s", f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pdf: %s: %w", f, err)
+		}
+	}
+	return data, nil
+}
+
+// inflate decompresses zlib data, keeping whatever was recovered from
+// truncated streams, which are common in the wild. Every stream of the
+// document draws on the same maxDecodedSize budget; once it is spent the
+// document fails with ErrTooLarge.
+func (r *Reader) inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	budget := maxDecodedSize - r.decoded
+	out, err := io.ReadAll(io.LimitReader(zr, int64(budget)+1))
+	if len(out) > budget {
+		r.err = ErrTooLarge
+		return nil, ErrTooLarge
+	}
+	r.decoded += len(out)
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// unpredict reverses PNG predictors (/Predictor >= 10), which are used by
+// most cross-reference streams.
+func (r *Reader) unpredict(data []byte, parm dict) ([]byte, error) {
+	if parm == nil {
+		return data, nil
+	}
+	predictor := int(toFloat(r.resolve(parm["Predictor"])))
+	if predictor < 10 {
+		if predictor == 2 {
+			return nil, errors.New("TIFF predictor is not supported")
+		}
+		return data, nil
+	}
+
+	columns := 1
+	if c := int(toFloat(r.resolve(parm["Columns"]))); c > 0 {
+		columns = c
+	}
+	colors := 1
+	if c := int(toFloat(r.resolve(parm["Colors"]))); c > 0 {
+		colors = c
+	}
+	bpc := 8
+	if b := int(toFloat(r.resolve(parm["BitsPerComponent"]))); b > 0 {
+		bpc = b
+	}
+
+	bpp := max(1, colors*bpc/8)
+	rowLen := (columns*colors*bpc + 7) / 8
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	row := make([]byte, rowLen)
+
+	for pos := 0; pos+1+rowLen <= len(data); pos += 1 + rowLen {
+		ft := data[pos]
+		copy(row, data[pos+1:pos+1+rowLen])
+		for i := range row {
+			var left, up, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up = prev[i]
+			switch ft {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev, row = row, prev
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func asciiHexDecode(data []byte) []byte {
+	out := make([]byte, 0, len(data)/2)
+	var hi byte
+	haveHi := false
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		v, ok := unhex(c)
+		if !ok {
+			continue
+		}
+		if haveHi {
+			out = append(out, hi<<4|v)
+		} else {
+			hi = v
+		}
+		haveHi = !haveHi
+	}
+	if haveHi {
+		out = append(out, hi<<4)
+	}
+	return out
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data)*4/5)
+	var group [5]byte
+	n := 0
+
+	flush := func(count int) {
+		var v uint32
+		for i := 0; i < 5; i++ {
+			v = v*85 + uint32(group[i])
+		}
+		b := [4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+		out = append(out, b[:count]...)
+	}
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case isWhite(c):
+			continue
+		case c == '~':
+			i = len(data) // end of data marker "~>"
+			continue
+		case c == 'z' && n == 0:
+			out = append(out, 0, 0, 0, 0)
+			continue
+		case c < '!' || c > 'u':
+			return nil, fmt.Errorf("invalid ASCII85 byte %q", c)
+		}
+		group[n] = c - '!'
+		n++
+		if n == 5 {
+			flush(4)
+			n = 0
+		}
+	}
+	if n > 0 {
+		for i := n; i < 5; i++ {
+			group[i] = 84
+		}
+		flush(n - 1)
+	}
+	return out, nil
+}
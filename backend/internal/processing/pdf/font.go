@@ -0,0 +1,518 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// font maps the bytes of a shown string to text and glyph widths.
+type font struct {
+	cmap     *cmap           // ToUnicode, if present
+	encoding [256]string     // simple fonts: code -> text
+	twoByte  bool            // Type0 fonts without a codespace range
+	ucs2     bool            // Type0 fonts using a predefined Unicode CMap
+	widths   map[int]float64 // code or CID -> width in glyph units (1/1000 em)
+	dw       float64         // default width
+	scale    float64         // glyph units -> text space
+}
+
+// glyph is one decoded character code.
+type glyph struct {
+	text    string
+	width   float64 // in text space units, before scaling by font size
+	isSpace bool    // single byte code 32, which receives word spacing
+}
+
+func (r *Reader) loadFont(obj object) *font {
+	ref, isRef := obj.(objRef)
+	if isRef {
+		if f, ok := r.fonts[ref]; ok {
+			return f
+		}
+	}
+
+	f := &font{widths: map[int]float64{}, dw: 500, scale: 0.001}
+	if isRef {
+		r.fonts[ref] = f
+	}
+
+	d := r.resolveDict(obj)
+	if d == nil {
+		f.encoding = standardEncoding()
+		return f
+	}
+
+	if st, ok := r.resolve(d["ToUnicode"]).(*stream); ok {
+		if data, err := r.decodeStream(st); err == nil {
+			f.cmap = parseCMap(data)
+		}
+	}
+
+	subtype, _ := r.resolve(d["Subtype"]).(name)
+	if subtype == "Type0" {
+		r.loadCIDFont(f, d)
+		return f
+	}
+
+	f.encoding = r.simpleEncoding(d)
+
+	if subtype == "Type3" {
+		if m, ok := r.resolve(d["FontMatrix"]).(array); ok && len(m) == 6 {
+			f.scale = toFloat(r.resolve(m[0]))
+		}
+	}
+
+	if fd := r.resolveDict(d["FontDescriptor"]); fd != nil {
+		if mw := toFloat(r.resolve(fd["MissingWidth"])); mw > 0 {
+			f.dw = mw
+		}
+	}
+	first := int(toFloat(r.resolve(d["FirstChar"])))
+	if ws, ok := r.resolve(d["Widths"]).(array); ok {
+		for i, w := range ws {
+			f.widths[first+i] = toFloat(r.resolve(w))
+		}
+	} else {
+		// standard 14 fonts come without widths; a narrow space keeps word
+		// gaps recognisable
+		f.widths[32] = 250
+	}
+	return f
+}
+
+func (r *Reader) loadCIDFont(f *font, d dict) {
+	f.twoByte = true
+	f.dw = 1000
+
+	if enc, ok := r.resolve(d["Encoding"]).(name); ok {
+		s := string(enc)
+		f.ucs2 = strings.HasPrefix(s, "Uni") && (strings.Contains(s, "UCS2") || strings.Contains(s, "UTF16"))
+	}
+
+	descendants, _ := r.resolve(d["DescendantFonts"]).(array)
+	if len(descendants) == 0 {
+		return
+	}
+	cid := r.resolveDict(descendants[0])
+	if cid == nil {
+		return
+	}
+	if dw, ok := r.resolve(cid["DW"]).(int64); ok {
+		f.dw = float64(dw)
+	} else if dw, ok := r.resolve(cid["DW"]).(float64); ok {
+		f.dw = dw
+	}
+
+	// /W is a list of "c [w1 w2 ...]" and "cFirst cLast w" entries
+	w, _ := r.resolve(cid["W"]).(array)
+	for i := 0; i < len(w); {
+		start := int(toFloat(r.resolve(w[i])))
+		if i+1 >= len(w) {
+			break
+		}
+		if ws, ok := r.resolve(w[i+1]).(array); ok {
+			for j, v := range ws {
+				f.widths[start+j] = toFloat(r.resolve(v))
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			break
+		}
+		end := int(toFloat(r.resolve(w[i+1])))
+		width := toFloat(r.resolve(w[i+2]))
+		for c := start; c <= end && c-start < 1<<16; c++ {
+			f.widths[c] = width
+		}
+		i += 3
+	}
+}
+
+func (r *Reader) simpleEncoding(d dict) [256]string {
+	enc := standardEncoding()
+
+	var diffs array
+	switch e := r.resolve(d["Encoding"]).(type) {
+	case name:
+		enc = namedEncoding(e, enc)
+	case dict:
+		if base, ok := r.resolve(e["BaseEncoding"]).(name); ok {
+			enc = namedEncoding(base, enc)
+		}
+		diffs, _ = r.resolve(e["Differences"]).(array)
+	}
+
+	code := 0
+	for _, v := range diffs {
+		switch v := r.resolve(v).(type) {
+		case int64:
+			code = int(v)
+		case name:
+			if code >= 0 && code < 256 {
+				enc[code] = glyphText(string(v))
+			}
+			code++
+		}
+	}
+	return enc
+}
+
+func namedEncoding(n name, fallback [256]string) [256]string {
+	var cm *charmap.Charmap
+	switch n {
+	case "WinAnsiEncoding":
+		cm = charmap.Windows1252
+	case "MacRomanEncoding":
+		cm = charmap.Macintosh
+	case "StandardEncoding":
+		return standardEncoding()
+	default:
+		return fallback
+	}
+	var enc [256]string
+	for i := 32; i < 256; i++ {
+		if r := cm.DecodeByte(byte(i)); r != '�' {
+			enc[i] = string(r)
+		}
+	}
+	return enc
+}
+
+// standardEncoding is Adobe StandardEncoding: ASCII with curly quotes plus a
+// handful of typographic characters in the upper half.
+func standardEncoding() [256]string {
+	var enc [256]string
+	for i := 32; i < 127; i++ {
+		enc[i] = string(rune(i))
+	}
+	enc['\''] = "’"
+	enc['`'] = "‘"
+	for code, s := range map[int]string{
+		0xa1: "¡", 0xa2: "¢", 0xa3: "£", 0xa4: "⁄", 0xa5: "¥", 0xa6: "ƒ", 0xa7: "§",
+		0xa8: "¤", 0xa9: "'", 0xaa: "“", 0xab: "«", 0xac: "‹", 0xad: "›", 0xae: "fi",
+		0xaf: "fl", 0xb1: "–", 0xb2: "†", 0xb3: "‡", 0xb4: "·", 0xb6: "¶", 0xb7: "•",
+		0xb8: "‚", 0xb9: "„", 0xba: "”", 0xbb: "»", 0xbc: "…", 0xbd: "‰", 0xbf: "¿",
+		0xc1: "`", 0xc2: "´", 0xc3: "ˆ", 0xc4: "˜", 0xc5: "¯", 0xc8: "¨", 0xd0: "—",
+		0xe1: "Æ", 0xe8: "Ł", 0xe9: "Ø", 0xea: "Œ", 0xf1: "æ", 0xf5: "ı", 0xf8: "ł",
+		0xf9: "ø", 0xfa: "œ", 0xfb: "ß",
+	} {
+		enc[code] = s
+	}
+	return enc
+}
+
+// decode splits a shown string into glyphs.
+func (f *font) decode(s string) []glyph {
+	var glyphs []glyph
+	for i := 0; i < len(s); {
+		n := 1
+		if f.cmap != nil {
+			n = f.cmap.codeLen(s[i:], f.twoByte)
+		} else if f.twoByte {
+			n = 2
+		}
+		if i+n > len(s) {
+			n = len(s) - i
+		}
+		raw := s[i : i+n]
+		i += n
+
+		code := 0
+		for j := 0; j < len(raw); j++ {
+			code = code<<8 | int(raw[j])
+		}
+
+		var text string
+		if f.cmap != nil {
+			text, _ = f.cmap.lookup(raw)
+		}
+		// some producers map glyphs to U+0000; the encoding usually knows better
+		if strings.Trim(text, "\x00") == "" {
+			switch {
+			case f.ucs2:
+				text = string(rune(code))
+			case !f.twoByte:
+				text = f.encoding[code&0xff]
+			}
+		}
+
+		w, ok := f.widths[code]
+		if !ok {
+			w = f.dw
+		}
+		glyphs = append(glyphs, glyph{
+			text:    ligatures.Replace(text),
+			width:   w * f.scale,
+			isSpace: n == 1 && code == 32,
+		})
+	}
+	return glyphs
+}
+
+// cmap is a parsed ToUnicode CMap.
+type cmap struct {
+	codespaces []codespace
+	chars      map[string]string
+	ranges     []cmapRange
+}
+
+type codespace struct {
+	lo, hi []byte
+}
+
+type cmapRange struct {
+	lo, hi []byte
+	dst    string   // UTF-16BE of the first code; later codes increment it
+	dstArr []string // explicit destinations
+}
+
+func parseCMap(data []byte) *cmap {
+	cm := &cmap{chars: map[string]string{}}
+	lex := newLexer(data, 0)
+
+	var operands []object
+	for {
+		obj, err := lex.readObject()
+		if err != nil {
+			break
+		}
+		kw, ok := obj.(keyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(string)
+				hi, ok2 := operands[i+1].(string)
+				if ok1 && ok2 && len(lo) == len(hi) {
+					cm.codespaces = append(cm.codespaces, codespace{lo: []byte(lo), hi: []byte(hi)})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok := operands[i].(string)
+				if !ok {
+					continue
+				}
+				switch dst := operands[i+1].(type) {
+				case string:
+					cm.chars[src] = decodeUTF16(dst)
+				case name:
+					cm.chars[src] = glyphText(string(dst))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(string)
+				hi, ok2 := operands[i+1].(string)
+				if !ok1 || !ok2 || len(lo) != len(hi) {
+					continue
+				}
+				rg := cmapRange{lo: []byte(lo), hi: []byte(hi)}
+				switch dst := operands[i+2].(type) {
+				case string:
+					rg.dst = dst
+				case array:
+					for _, d := range dst {
+						s, _ := d.(string)
+						rg.dstArr = append(rg.dstArr, decodeUTF16(s))
+					}
+				}
+				cm.ranges = append(cm.ranges, rg)
+			}
+		}
+		operands = operands[:0]
+	}
+	return cm
+}
+
+// codeLen returns how many bytes of s form the next character code.
+func (cm *cmap) codeLen(s string, twoByte bool) int {
+	for n := 1; n <= 4 && n <= len(s); n++ {
+		for _, cs := range cm.codespaces {
+			if len(cs.lo) == n && inRange(s[:n], cs.lo, cs.hi) {
+				return n
+			}
+		}
+	}
+	if len(cm.codespaces) > 0 {
+		return len(cm.codespaces[0].lo)
+	}
+	if twoByte {
+		return 2
+	}
+	return 1
+}
+
+func (cm *cmap) lookup(code string) (string, bool) {
+	if s, ok := cm.chars[code]; ok {
+		return s, true
+	}
+	for _, rg := range cm.ranges {
+		if len(rg.lo) != len(code) || !inRange(code, rg.lo, rg.hi) {
+			continue
+		}
+		offset := bytesToInt([]byte(code)) - bytesToInt(rg.lo)
+		if rg.dstArr != nil {
+			if offset < len(rg.dstArr) {
+				return rg.dstArr[offset], true
+			}
+			return "", false
+		}
+		dst := []byte(rg.dst)
+		if len(dst) == 0 {
+			return "", false
+		}
+		// the offset is added to the last UTF-16 unit
+		units := toUTF16(dst)
+		units[len(units)-1] += uint16(offset)
+		return string(utf16.Decode(units)), true
+	}
+	return "", false
+}
+
+// inRange compares byte by byte, as codespace ranges are defined per byte.
+func inRange(code string, lo, hi []byte) bool {
+	for i := 0; i < len(code); i++ {
+		if code[i] < lo[i] || code[i] > hi[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func bytesToInt(b []byte) int {
+	v := 0
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+func toUTF16(b []byte) []uint16 {
+	if len(b)%2 == 1 {
+		b = append([]byte{0}, b...)
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return units
+}
+
+func decodeUTF16(s string) string {
+	if s == "" {
+		return ""
+	}
+	return string(utf16.Decode(toUTF16([]byte(s))))
+}
+
+// glyphText maps a glyph name to text following the Adobe Glyph List
+// conventions: known names, uniXXXX/uXXXX forms, ligatures joined with "_"
+// and variants with a "." suffix.
+func glyphText(glyphName string) string {
+	if i := strings.IndexByte(glyphName, '.'); i > 0 {
+		glyphName = glyphName[:i]
+	}
+	if strings.Contains(glyphName, "_") {
+		var b strings.Builder
+		for _, part := range strings.Split(glyphName, "_") {
+			b.WriteString(glyphText(part))
+		}
+		return b.String()
+	}
+
+	if s, ok := glyphNames[glyphName]; ok {
+		return s
+	}
+	if len(glyphName) == 1 {
+		return glyphName
+	}
+	if strings.HasPrefix(glyphName, "uni") && len(glyphName) >= 7 && (len(glyphName)-3)%4 == 0 {
+		var units []uint16
+		for i := 3; i < len(glyphName); i += 4 {
+			v, err := strconv.ParseUint(glyphName[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			units = append(units, uint16(v))
+		}
+		return string(utf16.Decode(units))
+	}
+	if strings.HasPrefix(glyphName, "u") && len(glyphName) >= 5 && len(glyphName) <= 7 {
+		if v, err := strconv.ParseUint(glyphName[1:], 16, 32); err == nil {
+			return string(rune(v))
+		}
+	}
+
+	// accented letters such as "eacute" or "Ccedilla"
+	for suffix, mark := range accentMarks {
+		if base, ok := strings.CutSuffix(glyphName, suffix); ok && len(base) == 1 {
+			return norm.NFC.String(base + mark)
+		}
+	}
+	return ""
+}
+
+// ligatures are spelled out so extracted words match what users type.
+var ligatures = strings.NewReplacer(
+	"\ufb00", "ff", "\ufb01", "fi", "\ufb02", "fl", "\ufb03", "ffi", "\ufb04", "ffl",
+	"\ufb05", "st", "\ufb06", "st",
+)
+
+var accentMarks = map[string]string{
+	"grave":        "̀",
+	"acute":        "́",
+	"circumflex":   "̂",
+	"tilde":        "̃",
+	"macron":       "̄",
+	"breve":        "̆",
+	"dotaccent":    "̇",
+	"dieresis":     "̈",
+	"ring":         "̊",
+	"hungarumlaut": "̋",
+	"caron":        "̌",
+	"cedilla":      "̧",
+	"ogonek":       "̨",
+}
+
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$",
+	"percent": "%", "ampersand": "&", "quotesingle": "'", "parenleft": "(", "parenright": ")",
+	"asterisk": "*", "plus": "+", "comma": ",", "hyphen": "-", "period": ".", "slash": "/",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4", "five": "5", "six": "6",
+	"seven": "7", "eight": "8", "nine": "9", "colon": ":", "semicolon": ";", "less": "<",
+	"equal": "=", "greater": ">", "question": "?", "at": "@", "bracketleft": "[",
+	"backslash": "\\", "bracketright": "]", "asciicircum": "^", "underscore": "_",
+	"grave": "`", "braceleft": "{", "bar": "|", "braceright": "}", "asciitilde": "~",
+	"quoteleft": "‘", "quoteright": "’", "quotedblleft": "“", "quotedblright": "”",
+	"quotesinglbase": "‚", "quotedblbase": "„", "guillemotleft": "«", "guillemotright": "»",
+	"guilsinglleft": "‹", "guilsinglright": "›", "endash": "–", "emdash": "—", "bullet": "•",
+	"ellipsis": "…", "dagger": "†", "daggerdbl": "‡", "periodcentered": "·", "minus": "−",
+	"multiply": "×", "divide": "÷", "plusminus": "±", "degree": "°", "section": "§",
+	"paragraph": "¶", "copyright": "©", "registered": "®", "trademark": "™",
+	"perthousand": "‰", "fraction": "⁄", "exclamdown": "¡", "questiondown": "¿",
+	"cent": "¢", "sterling": "£", "yen": "¥", "Euro": "€", "florin": "ƒ", "currency": "¤",
+	"brokenbar": "¦", "ordfeminine": "ª", "ordmasculine": "º", "mu": "µ", "onehalf": "½",
+	"onequarter": "¼", "threequarters": "¾", "onesuperior": "¹", "twosuperior": "²",
+	"threesuperior": "³", "logicalnot": "¬", "nbspace": " ", "sfthyphen": "-",
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+	"germandbls": "ß", "ae": "æ", "AE": "Æ", "oe": "œ", "OE": "Œ", "oslash": "ø",
+	"Oslash": "Ø", "eth": "ð", "Eth": "Ð", "thorn": "þ", "Thorn": "Þ", "dotlessi": "ı",
+	"lslash": "ł", "Lslash": "Ł", "dieresis": "¨", "acute": "´", "cedilla": "¸",
+	"circumflex": "ˆ", "tilde": "˜", "macron": "¯", "ring": "˚", "caron": "ˇ",
+	"breve": "˘", "dotaccent": "˙", "ogonek": "˛", "hungarumlaut": "˝",
+	"arrowright": "→", "arrowleft": "←", "arrowup": "↑", "arrowdown": "↓",
+	"lessequal": "≤", "greaterequal": "≥", "notequal": "≠", "infinity": "∞",
+	"approxequal": "≈", "summation": "∑", "product": "∏", "radical": "√",
+	"integral": "∫", "partialdiff": "∂", "Delta": "∆", "Omega": "Ω", "pi": "π",
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ε",
+	"lambda": "λ", "sigma": "σ", "theta": "θ", "omega": "ω", "checkmark": "✓",
+}
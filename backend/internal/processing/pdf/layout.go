@@ -0,0 +1,310 @@
+package pdf
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// pages with fewer lines are too sparse to tell a gutter by how little text
+// crosses it
+const sparsePageLines = 6
+
+// segment is a run of characters on one baseline without a column-sized gap.
+type segment struct {
+	x0, x1 float64
+	y      float64
+	size   float64
+	text   strings.Builder
+	space  bool // an explicit space was shown after the last character
+}
+
+// line is a set of segments sharing a baseline, ordered left to right.
+type line struct {
+	y        float64
+	size     float64
+	segments []*segment
+}
+
+// layoutText turns the glyphs of a page into reading-order text. Lines are
+// grouped by baseline; when the page has column gutters, consecutive lines
+// that do not cross a gutter are read column by column.
+func layoutText(chars []char) string {
+	segments := buildSegments(chars)
+	if len(segments) == 0 {
+		return ""
+	}
+
+	lines := groupLines(segments)
+	gutters := findGutters(lines)
+
+	var out []*line
+	var block []*line
+	flush := func() {
+		out = append(out, splitColumns(block, gutters)...)
+		block = block[:0]
+	}
+	for _, l := range lines {
+		if crossesGutter(l, gutters) {
+			flush()
+			out = append(out, l)
+			continue
+		}
+		block = append(block, l)
+	}
+	flush()
+
+	return joinLines(out)
+}
+
+// buildSegments merges characters in content order. Producers nearly always
+// emit words left to right, so a backwards jump, a baseline change or a wide
+// gap starts a new segment.
+func buildSegments(chars []char) []*segment {
+	var segments []*segment
+	var cur *segment
+
+	for _, c := range chars {
+		if strings.TrimSpace(c.text) == "" {
+			if cur != nil {
+				cur.space = true
+			}
+			continue
+		}
+		size := math.Max(c.size, 1)
+
+		if cur != nil {
+			gap := c.x0 - cur.x1
+			sameLine := math.Abs(c.y-cur.y) < 0.3*size
+			if sameLine && gap > -0.5*size && gap < 1.5*size {
+				if cur.space || gap > 0.15*size {
+					cur.text.WriteByte(' ')
+				}
+				cur.text.WriteString(c.text)
+				cur.space = false
+				cur.x1 = math.Max(cur.x1, c.x1)
+				cur.size = math.Max(cur.size, size)
+				continue
+			}
+		}
+
+		cur = &segment{x0: c.x0, x1: c.x1, y: c.y, size: size}
+		cur.text.WriteString(c.text)
+		segments = append(segments, cur)
+	}
+	return segments
+}
+
+func groupLines(segments []*segment) []*line {
+	sorted := make([]*segment, len(segments))
+	copy(sorted, segments)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].y > sorted[j].y })
+
+	var lines []*line
+	for _, s := range sorted {
+		if n := len(lines); n > 0 {
+			l := lines[n-1]
+			if math.Abs(l.y-s.y) < 0.4*math.Min(l.size, s.size) {
+				l.segments = append(l.segments, s)
+				l.size = math.Max(l.size, s.size)
+				continue
+			}
+		}
+		lines = append(lines, &line{y: s.y, size: s.size, segments: []*segment{s}})
+	}
+	for _, l := range lines {
+		sort.SliceStable(l.segments, func(i, j int) bool { return l.segments[i].x0 < l.segments[j].x0 })
+	}
+	return lines
+}
+
+// findGutters looks for vertical bands that almost no text crosses and that
+// have body text on both sides. It returns the band centres, left to right.
+// Dense pages tolerate headings and captions crossing a gutter; on pages
+// with only a few lines no segment may cross it.
+func findGutters(lines []*line) []float64 {
+	if len(lines) < 2 {
+		return nil
+	}
+
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	var sizes []float64
+	for _, l := range lines {
+		for _, s := range l.segments {
+			minX = math.Min(minX, s.x0)
+			maxX = math.Max(maxX, s.x1)
+		}
+		sizes = append(sizes, l.size)
+	}
+	width := int(maxX - minX)
+	if width <= 0 || width > 10000 {
+		return nil
+	}
+	sort.Float64s(sizes)
+	bodySize := sizes[len(sizes)/2]
+
+	coverage := make([]int, width+1)
+	for _, l := range lines {
+		for _, s := range l.segments {
+			for x := int(s.x0 - minX); x < int(s.x1-minX) && x <= width; x++ {
+				coverage[x]++
+			}
+		}
+	}
+
+	// headings and captions may cross a gutter; body text may not
+	threshold, minSide := max(2, len(lines)/5), 3
+	if len(lines) < sparsePageLines {
+		threshold, minSide = 0, 2
+	}
+	minGap := int(math.Max(bodySize, 8))
+
+	var gutters []float64
+	for x := 0; x <= width; {
+		if coverage[x] > threshold {
+			x++
+			continue
+		}
+		start := x
+		for x <= width && coverage[x] <= threshold {
+			x++
+		}
+		if start == 0 || x > width || x-start < minGap {
+			continue
+		}
+		center := minX + float64(start+x)/2
+		if isColumnGap(lines, center, gutters, minSide) {
+			gutters = append(gutters, center)
+		}
+	}
+	return gutters
+}
+
+// isColumnGap rejects gaps that only separate short items such as table
+// cells: both sides need minSide lines of text spanning most of the column.
+func isColumnGap(lines []*line, center float64, previous []float64, minSide int) bool {
+	left := math.Inf(-1)
+	if len(previous) > 0 {
+		left = previous[len(previous)-1]
+	}
+
+	var leftWidths, rightWidths []float64
+	leftStart, leftEnd := math.Inf(1), math.Inf(-1)
+	rightStart, rightEnd := math.Inf(1), math.Inf(-1)
+	for _, l := range lines {
+		for _, s := range l.segments {
+			switch {
+			case s.x1 <= center && s.x0 >= left:
+				leftWidths = append(leftWidths, s.x1-s.x0)
+				leftStart, leftEnd = math.Min(leftStart, s.x0), math.Max(leftEnd, s.x1)
+			case s.x0 >= center:
+				rightWidths = append(rightWidths, s.x1-s.x0)
+				rightStart, rightEnd = math.Min(rightStart, s.x0), math.Max(rightEnd, s.x1)
+			}
+		}
+	}
+	if len(leftWidths) < minSide || len(rightWidths) < minSide {
+		return false
+	}
+	return median(leftWidths) >= 0.5*(leftEnd-leftStart) &&
+		median(rightWidths) >= 0.5*(rightEnd-rightStart)
+}
+
+func median(v []float64) float64 {
+	sorted := make([]float64, len(v))
+	copy(sorted, v)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+func crossesGutter(l *line, gutters []float64) bool {
+	for _, s := range l.segments {
+		for _, g := range gutters {
+			if s.x0 < g && s.x1 > g {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitColumns reorders a block of lines so each column is read top to
+// bottom before the next one.
+func splitColumns(block []*line, gutters []float64) []*line {
+	if len(gutters) == 0 {
+		return append([]*line(nil), block...)
+	}
+
+	columns := make([][]*line, len(gutters)+1)
+	for _, l := range block {
+		parts := make([]*line, len(columns))
+		for _, s := range l.segments {
+			col := sort.SearchFloat64s(gutters, s.x0)
+			if parts[col] == nil {
+				parts[col] = &line{y: l.y, size: s.size}
+			}
+			parts[col].segments = append(parts[col].segments, s)
+			parts[col].size = math.Max(parts[col].size, s.size)
+		}
+		for i, p := range parts {
+			if p != nil {
+				columns[i] = append(columns[i], p)
+			}
+		}
+	}
+
+	var out []*line
+	for _, col := range columns {
+		out = append(out, col...)
+	}
+	return out
+}
+
+// joinLines renders lines, separating paragraphs by a blank line when the
+// vertical gap is clearly larger than the line spacing and joining words
+// hyphenated across lines.
+func joinLines(lines []*line) string {
+	var b strings.Builder
+	for i, l := range lines {
+		text := lineText(l)
+		if text == "" {
+			continue
+		}
+
+		if b.Len() > 0 {
+			prev := lines[i-1]
+			gap := prev.y - l.y
+			current := b.String()
+			switch {
+			case gap < 0 || gap > 1.8*math.Max(prev.size, l.size):
+				// new paragraph, or the start of the next column
+				b.WriteString("\n\n")
+			case strings.HasSuffix(current, "-") && startsLower(text):
+				trimmed := strings.TrimSuffix(current, "-")
+				b.Reset()
+				b.WriteString(trimmed)
+			default:
+				b.WriteByte('\n')
+			}
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+func lineText(l *line) string {
+	parts := make([]string, 0, len(l.segments))
+	for _, s := range l.segments {
+		if t := strings.TrimSpace(s.text.String()); t != "" {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func startsLower(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLower(r)
+}
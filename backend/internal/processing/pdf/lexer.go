@@ -0,0 +1,355 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// PDF object model. Strings keep their raw bytes; how they map to text
+// depends on the font they are shown with.
+type (
+	object  any
+	name    string
+	dict    map[name]object
+	array   []object
+	keyword string
+	objRef  struct{ id, gen int }
+	stream  struct {
+		hdr  dict
+		data []byte // raw, still encoded
+	}
+)
+
+// lexer tokenizes PDF syntax. It is used both for the file structure and for
+// page content streams.
+type lexer struct {
+	data   []byte
+	pos    int
+	peeked []object
+}
+
+func newLexer(data []byte, pos int) *lexer {
+	return &lexer{data: data, pos: pos}
+}
+
+func isWhite(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhite(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		break
+	}
+}
+
+func (l *lexer) unread(tok object) {
+	l.peeked = append(l.peeked, tok)
+}
+
+// next returns the next token: a keyword, name, string, number, bool, nil,
+// or one of the delimiter keywords "[", "]", "<<", ">>". It returns io.EOF
+// style end as (nil, false).
+func (l *lexer) next() (object, bool) {
+	if n := len(l.peeked); n > 0 {
+		tok := l.peeked[n-1]
+		l.peeked = l.peeked[:n-1]
+		return tok, true
+	}
+
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		l.pos++
+		return keyword(c), true
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return keyword("<<"), true
+		}
+		return l.readHexString(), true
+	case c == '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return keyword(">>"), true
+		}
+		l.pos++
+		return keyword(">"), true
+	case c == '(':
+		return l.readLiteralString(), true
+	case c == '/':
+		return l.readName(), true
+	case c == ')':
+		l.pos++
+		return keyword(")"), true
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isWhite(l.data[l.pos]) && !isDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+
+	switch word {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	case "null":
+		return nil, true
+	}
+	if isNumeric(word) {
+		if i, err := strconv.ParseInt(word, 10, 64); err == nil {
+			return i, true
+		}
+		if f, err := strconv.ParseFloat(word, 64); err == nil {
+			return f, true
+		}
+		// malformed numbers such as "--5" or "1.2.3" are read as zero
+		return int64(0), true
+	}
+	return keyword(word), true
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && c != '.' && c != '-' && c != '+' {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *lexer) readName() name {
+	l.pos++ // '/'
+	var b bytes.Buffer
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhite(c) || isDelim(c) {
+			break
+		}
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		b.WriteByte(c)
+		l.pos++
+	}
+	return name(b.String())
+}
+
+func (l *lexer) readHexString() string {
+	l.pos++ // '<'
+	var b bytes.Buffer
+	var hi byte
+	haveHi := false
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			break
+		}
+		v, ok := unhex(c)
+		if !ok {
+			continue
+		}
+		if haveHi {
+			b.WriteByte(hi<<4 | v)
+			haveHi = false
+		} else {
+			hi = v
+			haveHi = true
+		}
+	}
+	if haveHi {
+		b.WriteByte(hi << 4)
+	}
+	return b.String()
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func (l *lexer) readLiteralString() string {
+	l.pos++ // '('
+	var b bytes.Buffer
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b.String()
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b.String()
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case '\r':
+				// line continuation
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+				// line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					b.WriteByte(byte(v))
+				} else {
+					b.WriteByte(e)
+				}
+			}
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// readObject reads one complete object, resolving the "id gen R" reference
+// syntax. Keywords that are not part of an object are returned as-is so the
+// caller can act on them (e.g. "obj", "stream", content operators).
+func (l *lexer) readObject() (object, error) {
+	tok, ok := l.next()
+	if !ok {
+		return nil, errEOF
+	}
+
+	switch t := tok.(type) {
+	case keyword:
+		switch t {
+		case "[":
+			var arr array
+			for {
+				tok, ok := l.next()
+				if !ok {
+					return arr, errEOF
+				}
+				if k, isKw := tok.(keyword); isKw && k == "]" {
+					return arr, nil
+				}
+				l.unread(tok)
+				obj, err := l.readObject()
+				if err != nil {
+					return arr, err
+				}
+				arr = append(arr, obj)
+			}
+		case "<<":
+			d := dict{}
+			for {
+				tok, ok := l.next()
+				if !ok {
+					return d, errEOF
+				}
+				if k, isKw := tok.(keyword); isKw && k == ">>" {
+					return d, nil
+				}
+				key, isName := tok.(name)
+				if !isName {
+					// tolerate garbage keys by skipping them
+					continue
+				}
+				val, err := l.readObject()
+				if err != nil {
+					return d, err
+				}
+				if k, isKw := val.(keyword); isKw && k == ">>" {
+					d[key] = nil
+					return d, nil
+				}
+				d[key] = val
+			}
+		}
+		return t, nil
+	case int64:
+		// look ahead for "gen R"
+		tok2, ok2 := l.next()
+		if !ok2 {
+			return t, nil
+		}
+		gen, isInt := tok2.(int64)
+		if !isInt {
+			l.unread(tok2)
+			return t, nil
+		}
+		tok3, ok3 := l.next()
+		if ok3 {
+			if k, isKw := tok3.(keyword); isKw && k == "R" {
+				return objRef{id: int(t), gen: int(gen)}, nil
+			}
+			l.unread(tok3)
+		}
+		l.unread(tok2)
+		return t, nil
+	}
+	return tok, nil
+}
+
+var errEOF = fmt.Errorf("pdf: unexpected end of data")
@@ -0,0 +1,110 @@
+// Package pdf extracts plain text from PDF documents, page by page and in
+// reading order. It understands classic and compressed cross-reference
+// tables, object streams, the common stream filters and font encodings
+// including ToUnicode maps. Encrypted documents and scanned pages (images
+// without a text layer) yield no text.
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const maxPageTreeDepth = 64
+
+// Page is the text of one page. Number is 1-based and follows the page order
+// of the document, not printed page labels.
+type Page struct {
+	Number int
+	Text   string
+}
+
+// ExtractPages returns the text of every page in data, including pages
+// without text so page numbers stay aligned.
+func ExtractPages(data []byte) (pages []Page, err error) {
+	// malformed files should fail the document, not the process
+	defer func() {
+		if rec := recover(); rec != nil {
+			pages, err = nil, fmt.Errorf("pdf: malformed document: %v", rec)
+		}
+	}()
+
+	r, err := NewReader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root := r.resolveDict(r.trailer["Root"])
+	if root == nil {
+		return nil, errors.New("pdf: document catalog not found")
+	}
+
+	for i, page := range r.pages(root["Pages"]) {
+		text := layoutText(r.pageChars(page))
+		if r.err != nil {
+			return nil, r.err
+		}
+		pages = append(pages, Page{
+			Number: i + 1,
+			Text:   strings.TrimSpace(text),
+		})
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(pages) == 0 {
+		return nil, errors.New("pdf: document has no pages")
+	}
+	return pages, nil
+}
+
+// pages flattens the page tree. Inheritable attributes are copied onto each
+// page so it can be processed on its own.
+func (r *Reader) pages(root object) []dict {
+	var out []dict
+	visited := map[objRef]bool{}
+
+	var walk func(node object, inherited dict, depth int)
+	walk = func(node object, inherited dict, depth int) {
+		if ref, ok := node.(objRef); ok {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+		d := r.resolveDict(node)
+		if d == nil || depth > maxPageTreeDepth {
+			return
+		}
+
+		attrs := dict{}
+		for k, v := range inherited {
+			attrs[k] = v
+		}
+		for _, key := range []name{"Resources", "MediaBox", "CropBox", "Rotate"} {
+			if v, ok := d[key]; ok {
+				attrs[key] = v
+			}
+		}
+
+		kids, isNode := r.resolve(d["Kids"]).(array)
+		if typ, _ := r.resolve(d["Type"]).(name); typ == "Page" || !isNode {
+			page := dict{}
+			for k, v := range d {
+				page[k] = v
+			}
+			for k, v := range attrs {
+				page[k] = v
+			}
+			out = append(out, page)
+			return
+		}
+		for _, kid := range kids {
+			walk(kid, attrs, depth+1)
+		}
+	}
+
+	walk(root, nil, 0)
+	return out
+}
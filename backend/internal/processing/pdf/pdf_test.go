@@ -0,0 +1,139 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The fixtures in testdata are written by testdata/generate.go.
+
+func TestExtractPages(t *testing.T) {
+	tests := []struct {
+		file string
+		want []string // text of each page, in order
+	}{
+		{
+			file: "pages.pdf",
+			want: []string{"First page", "Second page", "", "Fourth page"},
+		},
+		{
+			file: "columns.pdf",
+			want: []string{
+				"A Study of Columns\n\n" +
+					"Left column line 1\nLeft column line 2\nLeft column line 3\nLeft column line 4\n" +
+					"Left column line 5\nLeft column line 6\nLeft column line 7\nLeft column line 8\n\n" +
+					"Right column line 1\nRight column line 2\nRight column line 3\nRight column line 4\n" +
+					"Right column line 5\nRight column line 6\nRight column line 7\nRight column line 8",
+				"Left column one\nLeft column two\n\nRight column one\nRight column two",
+			},
+		},
+		{
+			file: "encodings.pdf",
+			want: []string{
+				"Café crème “quoted”", // WinAnsiEncoding
+				"éßC",                 // Differences
+				"Hi abc 日本",           // Identity-H with ToUnicode
+				"Mac Café",            // MacRomanEncoding
+				"Compressed stream text",
+				"Hex and flate text",
+			},
+		},
+		{
+			file: "xrefstream.pdf",
+			want: []string{"Stored in an object stream"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pages, err := ExtractPages(data)
+			if err != nil {
+				t.Fatalf("ExtractPages: %v", err)
+			}
+			if len(pages) != len(tt.want) {
+				t.Fatalf("got %d pages, want %d", len(pages), len(tt.want))
+			}
+			for i, page := range pages {
+				if page.Number != i+1 {
+					t.Errorf("page %d: Number = %d", i+1, page.Number)
+				}
+				if page.Text != tt.want[i] {
+					t.Errorf("page %d:\n got %q\nwant %q", i+1, page.Text, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExtractPagesDecompressionBomb(t *testing.T) {
+	var content bytes.Buffer
+	zw := zlib.NewWriter(&content)
+	zw.Write(bytes.Repeat([]byte(" "), maxDecodedSize+1))
+	zw.Close()
+
+	// no cross-reference table: the reader finds the objects by scanning
+	var doc bytes.Buffer
+	doc.WriteString("%PDF-1.4\n")
+	doc.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	doc.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n")
+	doc.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>\nendobj\n")
+	fmt.Fprintf(&doc, "4 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", content.Len())
+	doc.Write(content.Bytes())
+	doc.WriteString("\nendstream\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n")
+
+	_, err := ExtractPages(doc.Bytes())
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("ExtractPages error = %v, want ErrTooLarge", err)
+	}
+}
+
+// A damaged xref header must not keep the reader looping past the end of the
+// file; the objects are then found by scanning, as without a table.
+func TestExtractPagesDamagedXref(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "pages.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, header := range []string{"0 1000000015", "0 40", "0 -14"} {
+		t.Run(header, func(t *testing.T) {
+			damaged := bytes.Replace(data, []byte("xref\n0 14\n"), []byte("xref\n"+header+"\n"), 1)
+			if bytes.Equal(damaged, data) {
+				t.Fatal("xref header not found in pages.pdf")
+			}
+
+			done := make(chan []Page, 1)
+			go func() {
+				pages, err := ExtractPages(damaged)
+				if err != nil {
+					t.Errorf("ExtractPages: %v", err)
+				}
+				done <- pages
+			}()
+			select {
+			case pages := <-done:
+				var texts []string
+				for _, page := range pages {
+					texts = append(texts, page.Text)
+				}
+				if got := strings.Join(texts, "|"); got != "First page|Second page||Fourth page" {
+					t.Errorf("pages = %q", got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("ExtractPages still running after 5s")
+			}
+		})
+	}
+}
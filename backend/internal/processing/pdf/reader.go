@@ -0,0 +1,441 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ErrEncrypted is returned for password protected documents, which this
+// package does not decrypt.
+var ErrEncrypted = errors.New("pdf: encrypted documents are not supported")
+
+// ErrTooLarge is returned for documents whose streams decompress to more than
+// maxDecodedSize in total, which guards against decompression bombs.
+var ErrTooLarge = fmt.Errorf("pdf: document decompresses to more than %d MB", maxDecodedSize>>20)
+
+// most bytes the streams of one document may decompress to, the limit the
+// loaders put on any file
+const maxDecodedSize = 64 << 20
+
+type xrefEntry struct {
+	offset   int  // byte offset for plain objects
+	inStream bool // stored inside an object stream
+	stream   int  // object stream id
+	index    int  // index inside the object stream
+}
+
+// Reader gives access to the objects of a PDF file held in memory.
+type Reader struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	trailer dict
+	cache   map[int]object
+	objStms map[int]*objectStream
+	fonts   map[objRef]*font
+	decoded int   // bytes decompressed so far, see inflate
+	err     error // sticky error that fails the document
+}
+
+type objectStream struct {
+	data    []byte
+	offsets map[int]int // object id -> offset in data
+}
+
+// NewReader parses the cross-reference information of a PDF file. Files with
+// damaged cross-reference tables are recovered by scanning for objects.
+func NewReader(data []byte) (*Reader, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data[:min(len(data), 1024)], "\x00\t\r\n "), []byte("%PDF")) &&
+		!bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF")) {
+		return nil, errors.New("pdf: missing %PDF header")
+	}
+
+	r := &Reader{
+		data:    data,
+		xref:    map[int]xrefEntry{},
+		cache:   map[int]object{},
+		objStms: map[int]*objectStream{},
+		fonts:   map[objRef]*font{},
+	}
+
+	if err := r.readXrefChain(); err != nil || r.trailer == nil || r.trailer["Root"] == nil {
+		r.xref = map[int]xrefEntry{}
+		r.trailer = nil
+		if err := r.rebuildXref(); err != nil {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if r.trailer["Encrypt"] != nil {
+		return nil, ErrEncrypted
+	}
+	return r, nil
+}
+
+func (r *Reader) readXrefChain() error {
+	idx := bytes.LastIndex(r.data, []byte("startxref"))
+	if idx < 0 {
+		return errors.New("pdf: startxref not found")
+	}
+	lex := newLexer(r.data, idx+len("startxref"))
+	tok, _ := lex.next()
+	offset, ok := tok.(int64)
+	if !ok {
+		return errors.New("pdf: invalid startxref")
+	}
+
+	seen := map[int]bool{}
+	for off := int(offset); off > 0 && !seen[off]; {
+		seen[off] = true
+		if off >= len(r.data) {
+			return errors.New("pdf: xref offset out of range")
+		}
+		trailer, err := r.readXrefSection(off)
+		if err != nil {
+			return err
+		}
+		if r.trailer == nil {
+			r.trailer = trailer
+		}
+		// hybrid files keep part of the table in a cross-reference stream
+		if stm, ok := trailer["XRefStm"].(int64); ok && !seen[int(stm)] {
+			seen[int(stm)] = true
+			if _, err := r.readXrefSection(int(stm)); err != nil {
+				return err
+			}
+		}
+		prev, ok := trailer["Prev"].(int64)
+		if !ok {
+			break
+		}
+		off = int(prev)
+	}
+	return nil
+}
+
+// readXrefSection reads either a classic "xref" table or a cross-reference
+// stream at off. Entries already known from a newer section win.
+func (r *Reader) readXrefSection(off int) (dict, error) {
+	lex := newLexer(r.data, off)
+	tok, ok := lex.next()
+	if !ok {
+		return nil, errEOF
+	}
+	if k, isKw := tok.(keyword); isKw && k == "xref" {
+		return r.readXrefTable(lex)
+	}
+	lex.unread(tok)
+	return r.readXrefStream(lex)
+}
+
+// minXrefEntrySize is the shortest an xref table entry can be written, as in
+// "0 0 n\n". The specification has them 20 bytes long.
+const minXrefEntrySize = 6
+
+func (r *Reader) readXrefTable(lex *lexer) (dict, error) {
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			return nil, errEOF
+		}
+		if k, isKw := tok.(keyword); isKw && k == "trailer" {
+			obj, err := lex.readObject()
+			if err != nil {
+				return nil, err
+			}
+			trailer, ok := obj.(dict)
+			if !ok {
+				return nil, errors.New("pdf: malformed trailer")
+			}
+			return trailer, nil
+		}
+		start, ok1 := tok.(int64)
+		tok, _ = lex.next()
+		count, ok2 := tok.(int64)
+		if !ok1 || !ok2 || start < 0 || count < 0 {
+			return nil, errors.New("pdf: malformed xref subsection")
+		}
+		// a header can claim any count; the entries must fit in what is left
+		if count > int64((len(lex.data)-lex.pos)/minXrefEntrySize) {
+			return nil, fmt.Errorf("pdf: xref subsection of %d entries overruns the file", count)
+		}
+		for i := 0; i < int(count); i++ {
+			offTok, ok1 := lex.next()
+			_, ok2 := lex.next() // generation
+			kindTok, ok3 := lex.next()
+			if !ok1 || !ok2 || !ok3 {
+				return nil, errEOF
+			}
+			id := int(start) + i
+			offset, _ := offTok.(int64)
+			if k, _ := kindTok.(keyword); k == "n" {
+				if _, exists := r.xref[id]; !exists {
+					r.xref[id] = xrefEntry{offset: int(offset)}
+				}
+			}
+		}
+	}
+}
+
+func (r *Reader) readXrefStream(lex *lexer) (dict, error) {
+	obj, err := r.readIndirect(lex)
+	if err != nil {
+		return nil, err
+	}
+	st, ok := obj.(*stream)
+	if !ok {
+		return nil, errors.New("pdf: xref is not a stream")
+	}
+	data, err := r.decodeStream(st)
+	if err != nil {
+		return nil, fmt.Errorf("pdf: decode xref stream: %w", err)
+	}
+
+	w, _ := r.resolve(st.hdr["W"]).(array)
+	if len(w) != 3 {
+		return nil, errors.New("pdf: invalid xref stream /W")
+	}
+	widths := [3]int{}
+	rowLen := 0
+	for i := range widths {
+		widths[i] = int(toFloat(r.resolve(w[i])))
+		rowLen += widths[i]
+	}
+	if rowLen == 0 {
+		return nil, errors.New("pdf: invalid xref stream /W")
+	}
+
+	size := int(toFloat(r.resolve(st.hdr["Size"])))
+	index := []int{0, size}
+	if idx, ok := r.resolve(st.hdr["Index"]).(array); ok && len(idx)%2 == 0 {
+		index = index[:0]
+		for _, v := range idx {
+			index = append(index, int(toFloat(r.resolve(v))))
+		}
+	}
+
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		for id := index[i]; id < index[i]+index[i+1]; id++ {
+			if pos+rowLen > len(data) {
+				return st.hdr, nil
+			}
+			var fields [3]int
+			for f := 0; f < 3; f++ {
+				for b := 0; b < widths[f]; b++ {
+					fields[f] = fields[f]<<8 | int(data[pos])
+					pos++
+				}
+			}
+			if widths[0] == 0 {
+				fields[0] = 1 // type defaults to "in use"
+			}
+			if _, exists := r.xref[id]; exists {
+				continue
+			}
+			switch fields[0] {
+			case 1:
+				r.xref[id] = xrefEntry{offset: fields[1]}
+			case 2:
+				r.xref[id] = xrefEntry{inStream: true, stream: fields[1], index: fields[2]}
+			}
+		}
+	}
+	return st.hdr, nil
+}
+
+var objHeader = regexp.MustCompile(`(?m)(\d+)\s+(\d+)\s+obj\b`)
+
+// rebuildXref recovers a damaged file by locating every "id gen obj" header.
+// Later definitions of the same object override earlier ones, matching
+// incremental updates.
+func (r *Reader) rebuildXref() error {
+	for _, m := range objHeader.FindAllSubmatchIndex(r.data, -1) {
+		id, err := strconv.Atoi(string(r.data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		r.xref[id] = xrefEntry{offset: m[0]}
+	}
+	if len(r.xref) == 0 {
+		return errors.New("pdf: no objects found")
+	}
+
+	// prefer an explicit trailer, then any cross-reference stream dictionary
+	if idx := bytes.LastIndex(r.data, []byte("trailer")); idx >= 0 {
+		lex := newLexer(r.data, idx+len("trailer"))
+		if obj, err := lex.readObject(); err == nil {
+			if d, ok := obj.(dict); ok && d["Root"] != nil {
+				r.trailer = d
+				return nil
+			}
+		}
+	}
+	for id := range r.xref {
+		obj := r.getObject(id)
+		if st, ok := obj.(*stream); ok && st.hdr["Root"] != nil {
+			r.trailer = st.hdr
+			return nil
+		}
+		if d, ok := obj.(dict); ok && d["Type"] == name("Catalog") {
+			r.trailer = dict{"Root": objRef{id: id}}
+			return nil
+		}
+	}
+	return errors.New("pdf: document catalog not found")
+}
+
+// readIndirect reads "id gen obj <object> [stream ... endstream] endobj".
+func (r *Reader) readIndirect(lex *lexer) (object, error) {
+	lex.next() // id
+	lex.next() // gen
+	tok, ok := lex.next()
+	if k, isKw := tok.(keyword); !ok || !isKw || k != "obj" {
+		return nil, errors.New("pdf: expected obj keyword")
+	}
+	obj, err := lex.readObject()
+	if err != nil {
+		return nil, err
+	}
+
+	hdr, isDict := obj.(dict)
+	if !isDict {
+		return obj, nil
+	}
+	tok, ok = lex.next()
+	if k, isKw := tok.(keyword); !ok || !isKw || k != "stream" {
+		return obj, nil
+	}
+
+	// stream data starts after the EOL that follows the keyword
+	pos := lex.pos
+	if pos < len(r.data) && r.data[pos] == '\r' {
+		pos++
+	}
+	if pos < len(r.data) && r.data[pos] == '\n' {
+		pos++
+	}
+
+	length := -1
+	if l, ok := r.resolve(hdr["Length"]).(int64); ok {
+		length = int(l)
+	}
+	end := pos + length
+	if length < 0 || end > len(r.data) || !bytes.Contains(r.data[end:min(end+32, len(r.data))], []byte("endstream")) {
+		// /Length is missing or wrong; fall back to searching for the terminator
+		idx := bytes.Index(r.data[pos:], []byte("endstream"))
+		if idx < 0 {
+			return nil, errors.New("pdf: unterminated stream")
+		}
+		end = pos + idx
+		for end > pos && (r.data[end-1] == '\n' || r.data[end-1] == '\r') {
+			end--
+		}
+	}
+	return &stream{hdr: hdr, data: r.data[pos:end]}, nil
+}
+
+// getObject returns object id, or nil if it does not exist or is damaged.
+func (r *Reader) getObject(id int) object {
+	if obj, ok := r.cache[id]; ok {
+		return obj
+	}
+	// guard against reference cycles while loading
+	r.cache[id] = nil
+
+	entry, ok := r.xref[id]
+	if !ok {
+		return nil
+	}
+
+	var obj object
+	if entry.inStream {
+		obj = r.getFromObjectStream(entry.stream, id)
+	} else if entry.offset < len(r.data) {
+		lex := newLexer(r.data, entry.offset)
+		obj, _ = r.readIndirect(lex)
+	}
+	r.cache[id] = obj
+	return obj
+}
+
+func (r *Reader) getFromObjectStream(streamID, id int) object {
+	os, ok := r.objStms[streamID]
+	if !ok {
+		os = &objectStream{offsets: map[int]int{}}
+		r.objStms[streamID] = os
+
+		st, isStream := r.getObject(streamID).(*stream)
+		if !isStream {
+			return nil
+		}
+		data, err := r.decodeStream(st)
+		if err != nil {
+			return nil
+		}
+		n := int(toFloat(r.resolve(st.hdr["N"])))
+		first := int(toFloat(r.resolve(st.hdr["First"])))
+		if first > len(data) {
+			return nil
+		}
+		lex := newLexer(data, 0)
+		for i := 0; i < n; i++ {
+			idTok, _ := lex.next()
+			offTok, _ := lex.next()
+			objID, ok1 := idTok.(int64)
+			off, ok2 := offTok.(int64)
+			if !ok1 || !ok2 {
+				break
+			}
+			os.offsets[int(objID)] = first + int(off)
+		}
+		os.data = data
+	}
+
+	off, ok := os.offsets[id]
+	if !ok || off >= len(os.data) {
+		return nil
+	}
+	obj, err := newLexer(os.data, off).readObject()
+	if err != nil {
+		return nil
+	}
+	return obj
+}
+
+// resolve follows indirect references.
+func (r *Reader) resolve(obj object) object {
+	for i := 0; i < 32; i++ {
+		ref, ok := obj.(objRef)
+		if !ok {
+			return obj
+		}
+		obj = r.getObject(ref.id)
+	}
+	return nil
+}
+
+func (r *Reader) resolveDict(obj object) dict {
+	switch v := r.resolve(obj).(type) {
+	case dict:
+		return v
+	case *stream:
+		return v.hdr
+	}
+	return nil
+}
+
+func toFloat(obj object) float64 {
+	switch v := obj.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
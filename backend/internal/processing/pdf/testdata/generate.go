@@ -0,0 +1,283 @@
+//go:build ignore
+
+// generate writes the PDF fixtures of the package tests. The files are small
+// enough to read in a text editor, except for the compressed streams.
+//
+//	go run testdata/generate.go
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	fixtures := map[string][]byte{
+		"pages.pdf":      pagesPDF(),
+		"columns.pdf":    columnsPDF(),
+		"encodings.pdf":  encodingsPDF(),
+		"xrefstream.pdf": xrefStreamPDF(),
+	}
+	for name, data := range fixtures {
+		if err := os.WriteFile(filepath.Join("testdata", name), data, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// document collects numbered objects; object n is objects[n-1].
+type document struct {
+	objects []string
+}
+
+func (d *document) add(body string) int {
+	d.objects = append(d.objects, body)
+	return len(d.objects)
+}
+
+// reserve adds a placeholder so objects can refer to each other.
+func (d *document) reserve() int { return d.add("null") }
+
+func (d *document) set(n int, body string) { d.objects[n-1] = body }
+
+func stream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func ref(n int) string { return fmt.Sprintf("%d 0 R", n) }
+
+// bytes writes the document with a classic cross-reference table.
+func (d *document) bytes(root int) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(d.objects))
+	for i, body := range d.objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root %s >>\nstartxref\n%d\n%%%%EOF\n", len(d.objects)+1, ref(root), xref)
+	return b.Bytes()
+}
+
+// text shows s at (x, y) with font /F1.
+func text(x, y, size float64, s string) string {
+	return fmt.Sprintf("BT /F1 %g Tf %g %g Td (%s) Tj ET\n", size, x, y, s)
+}
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+	return b.Bytes()
+}
+
+const helvetica = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>"
+
+// pagesPDF has four pages in a two level page tree, the third one blank.
+// Resources and MediaBox are inherited from the root of the tree.
+func pagesPDF() []byte {
+	d := &document{}
+	catalog := d.reserve()
+	root := d.reserve()
+	first := d.reserve()
+	second := d.reserve()
+	font := d.add(helvetica)
+
+	var pages []int
+	for _, s := range []string{"First page", "Second page", "", "Fourth page"} {
+		content := ""
+		if s != "" {
+			content = text(72, 720, 12, s)
+		}
+		contents := d.add(stream("", []byte(content)))
+		parent := first
+		if len(pages) >= 2 {
+			parent = second
+		}
+		pages = append(pages, d.add(fmt.Sprintf("<< /Type /Page /Parent %s /Contents %s >>", ref(parent), ref(contents))))
+	}
+
+	d.set(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %s >>", ref(root)))
+	d.set(root, fmt.Sprintf("<< /Type /Pages /Kids [%s %s] /Count 4 /MediaBox [0 0 612 792] /Resources << /Font << /F1 %s >> >> >>",
+		ref(first), ref(second), ref(font)))
+	d.set(first, fmt.Sprintf("<< /Type /Pages /Parent %s /Kids [%s %s] /Count 2 >>", ref(root), ref(pages[0]), ref(pages[1])))
+	d.set(second, fmt.Sprintf("<< /Type /Pages /Parent %s /Kids [%s %s] /Count 2 >>", ref(root), ref(pages[2]), ref(pages[3])))
+	return d.bytes(catalog)
+}
+
+// columnsPDF has a dense two column page under a heading spanning both
+// columns, and a sparse two column page of two lines. Lines are drawn row by
+// row, left then right, as many producers do.
+func columnsPDF() []byte {
+	var dense strings.Builder
+	dense.WriteString(text(200, 740, 16, "A Study of Columns"))
+	for i := 1; i <= 8; i++ {
+		y := float64(700 - 14*(i-1))
+		dense.WriteString(text(72, y, 10, fmt.Sprintf("Left column line %d", i)))
+		dense.WriteString(text(320, y, 10, fmt.Sprintf("Right column line %d", i)))
+	}
+
+	var sparse strings.Builder
+	for i, row := range []string{"one", "two"} {
+		y := float64(700 - 14*i)
+		sparse.WriteString(text(72, y, 10, "Left column "+row))
+		sparse.WriteString(text(320, y, 10, "Right column "+row))
+	}
+
+	return singleFontDocument(helvetica, []string{dense.String(), sparse.String()})
+}
+
+func singleFontDocument(font string, contents []string) []byte {
+	d := &document{}
+	catalog := d.reserve()
+	root := d.reserve()
+	fontObj := d.add(font)
+
+	var kids []string
+	for _, content := range contents {
+		c := d.add(stream("", []byte(content)))
+		kids = append(kids, ref(d.add(fmt.Sprintf("<< /Type /Page /Parent %s /MediaBox [0 0 612 792] /Resources << /Font << /F1 %s >> >> /Contents %s >>",
+			ref(root), ref(fontObj), ref(c)))))
+	}
+
+	d.set(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %s >>", ref(root)))
+	d.set(root, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	return d.bytes(catalog)
+}
+
+const toUnicode = `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CMapName /Fixture-UCS def
+/CMapType 2 def
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+5 beginbfchar
+<0001> <0048>
+<0002> <0069>
+<0006> <0020>
+<0010> <65E5>
+<0011> <672C>
+endbfchar
+1 beginbfrange
+<0003> <0005> <0061>
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`
+
+// encodingsPDF has one page per supported way of encoding text: WinAnsi,
+// a Differences array, an Identity-H font with a ToUnicode map, MacRoman, and
+// content streams compressed with FlateDecode and ASCIIHexDecode.
+func encodingsPDF() []byte {
+	d := &document{}
+	catalog := d.reserve()
+	root := d.reserve()
+
+	winAnsi := d.add(helvetica)
+	differences := d.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding << /Type /Encoding /BaseEncoding /WinAnsiEncoding /Differences [65 /eacute /germandbls] >> >>")
+	macRoman := d.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /MacRomanEncoding >>")
+	cmap := d.add(stream("", []byte(toUnicode)))
+	cidFont := d.add("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /Fixture /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /DW 600 >>")
+	identity := d.add(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /Fixture /Encoding /Identity-H /DescendantFonts [%s] /ToUnicode %s >>",
+		ref(cidFont), ref(cmap)))
+
+	hexFlate := []byte(hex.EncodeToString(deflate([]byte(text(72, 720, 12, "Hex and flate text")))) + ">")
+
+	pages := []struct {
+		font    int
+		content string
+	}{
+		{winAnsi, stream("", []byte(text(72, 720, 12, `Caf\351 cr\350me \223quoted\224`)))},
+		{differences, stream("", []byte(text(72, 720, 12, "ABC")))},
+		{identity, stream("", []byte("BT /F1 12 Tf 72 720 Td <000100020006000300040005000600100011> Tj ET\n"))},
+		{macRoman, stream("", []byte(text(72, 720, 12, `Mac Caf\216`)))},
+		{winAnsi, stream("/Filter /FlateDecode", deflate([]byte(text(72, 720, 12, "Compressed stream text"))))},
+		{winAnsi, stream("/Filter [/ASCIIHexDecode /FlateDecode]", hexFlate)},
+	}
+
+	var kids []string
+	for _, p := range pages {
+		c := d.add(p.content)
+		kids = append(kids, ref(d.add(fmt.Sprintf("<< /Type /Page /Parent %s /MediaBox [0 0 612 792] /Resources << /Font << /F1 %s >> >> /Contents %s >>",
+			ref(root), ref(p.font), ref(c)))))
+	}
+
+	d.set(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %s >>", ref(root)))
+	d.set(root, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	return d.bytes(catalog)
+}
+
+// xrefStreamPDF stores its dictionaries in an object stream and its
+// cross-reference table in a stream using the PNG Up predictor, as PDF 1.5
+// producers do.
+func xrefStreamPDF() []byte {
+	// objects 1-3 live in object stream 5; 4 is the content stream
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 6 0 R >> >> /Contents 4 0 R >>",
+	}
+	var header, body strings.Builder
+	for i, o := range objs {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(o + "\n")
+	}
+	objStm := header.String() + "\n" + body.String()
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n%\xe2\xe3\xcf\xd3\n")
+	offsets := map[int]int{}
+	write := func(n int, s string) {
+		offsets[n] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", n, s)
+	}
+	write(4, stream("", []byte(text(72, 720, 12, "Stored in an object stream"))))
+	write(5, stream(fmt.Sprintf("/Type /ObjStm /N %d /First %d /Filter /FlateDecode", len(objs), len(header.String())+1),
+		deflate([]byte(objStm))))
+	write(6, helvetica)
+
+	// rows: type (1 byte), offset or object stream (4), generation or index (2)
+	rows := [][]byte{row(0, 0, 0xffff)}
+	for i := range objs {
+		rows = append(rows, row(2, 5, i))
+	}
+	rows = append(rows, row(1, offsets[4], 0), row(1, offsets[5], 0), row(1, offsets[6], 0))
+	xrefOffset := b.Len()
+	rows = append(rows, row(1, xrefOffset, 0))
+
+	var predicted []byte
+	prev := make([]byte, 7)
+	for _, r := range rows {
+		predicted = append(predicted, 2) // PNG Up
+		for i := range r {
+			predicted = append(predicted, r[i]-prev[i])
+		}
+		prev = r
+	}
+	write(7, stream("/Type /XRef /Size 8 /W [1 4 2] /Root 1 0 R /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 7 >>",
+		deflate(predicted)))
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+	return b.Bytes()
+}
+
+func row(typ byte, field2, field3 int) []byte {
+	r := []byte{typ}
+	r = binary.BigEndian.AppendUint32(r, uint32(field2))
+	return binary.BigEndian.AppendUint16(r, uint16(field3))
+}
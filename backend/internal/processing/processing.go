@@ -8,29 +8,60 @@ import (
 	"strings"
 )
 
-func ProcessFile(filePath string) (string, error) {
-	fileExtension := filepath.Ext(filePath)
-	switch {
-	case fileExtension == ".txt":
-		return readFile(filePath)
-	case fileExtension == ".pdf":
-		return readPDF(filePath)
-	default:
-		return "", fmt.Errorf("unsupported file type: %s", fileExtension)
+// Section is a part of a document that can be cited on its own, such as a
+// PDF page or the text under a heading.
+type Section struct {
+	Title string // heading of the section, empty when untitled
+	Level int    // heading depth of Title (1 = top level), 0 when untitled
+	Page  int    // 1-based page number, 0 when the format has no pages
+	Text  string
+}
+
+// Document is the text extracted from a file.
+type Document struct {
+	Title    string
+	Sections []Section
+}
+
+// Text returns the text of all sections separated by blank lines.
+func (d *Document) Text() string {
+	parts := make([]string, 0, len(d.Sections))
+	for _, s := range d.Sections {
+		if s.Title != "" {
+			parts = append(parts, s.Title)
+		}
+		if s.Text != "" {
+			parts = append(parts, s.Text)
+		}
 	}
+	return strings.Join(parts, "\n\n")
 }
 
-// readFile reads the file given in input as arg (filePath)
-func readFile(filePath string) (string, error) {
-	content, err := os.ReadFile(filePath)
+// ProcessFile extracts the document in filePath with the loader registered
+// for its extension or, failing that, its MIME type.
+func ProcessFile(filePath string, contentType string) (*Document, error) {
+	loader, ok := LoaderFor(filePath, contentType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported file type: %s", filepath.Ext(filePath))
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("ProcessFile: error opening file '%s': %w", filePath, err)
+	}
+	defer file.Close()
+
+	doc, err := loader.Load(file)
 	if err != nil {
-		return "", fmt.Errorf("readFile: error reading file '%s': %w", filePath, err)
+		return nil, fmt.Errorf("ProcessFile: %w", err)
 	}
-	return string(content), nil
+	return doc, nil
 }
 
-func readPDF(pdfPath string) (string, error) {
-	return fmt.Sprintf("Text extracted from PDF (%s)", pdfPath), nil
+// IsSupported reports whether ProcessFile can extract text from the file.
+func IsSupported(filePath string, contentType string) bool {
+	_, ok := LoaderFor(filePath, contentType)
+	return ok
 }
 
 // simulateGemini returns the output generated by gemini
@@ -40,19 +71,3 @@ func SimulateGemini(prompt string) (string, error) {
 	}
 	return fmt.Sprintf("Simulated Summary: This document contains the following information: %s", prompt), nil
 }
-
-func ChunkText(text string, chunkSize int) []string {
-	var chunks []string
-
-	words := strings.Fields(text)
-
-	for i := 0; i < len(words); i += chunkSize {
-		end := i + chunkSize
-		if end > len(words) {
-			end = len(words)
-		}
-		chunks = append(chunks, strings.Join(words[i:end], " "))
-	}
-
-	return chunks
-}
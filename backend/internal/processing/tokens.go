@@ -0,0 +1,73 @@
+package processing
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// pretokenizer follows the split pattern of the cl100k/o200k tokenizers:
+// contractions, words with one leading non-letter, numbers in groups of up
+// to three digits, punctuation runs and whitespace.
+var pretokenizer = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// EstimateTokens approximates how many tokens text takes in the BPE
+// tokenizers used by current chat and embedding models. The text is split
+// the way those tokenizers split it before merging, and each piece is
+// costed by its script and length: common words are one token, long or
+// rare words several, CJK roughly one per character.
+//
+// It is only an estimate: no vocabulary is loaded, and the embedding models
+// we support (Gemini, nomic-embed-text) and the chat models all tokenize
+// differently. It tracks English prose reasonably well; code and CJK text
+// drift further. Use it to budget chunk and context sizes with some
+// headroom, never where an exact count matters: chunks are counted exactly
+// by a WordPiece loaded with the embedding model's vocabulary.
+func EstimateTokens(text string) int {
+	tokens := 0
+	for _, piece := range pretokenizer.FindAllString(text, -1) {
+		tokens += pieceTokens(piece)
+	}
+	return tokens
+}
+
+func pieceTokens(piece string) int {
+	first, _ := utf8.DecodeRuneInString(piece)
+	switch {
+	case unicode.IsSpace(first) && isBlank(piece):
+		return 1
+	case unicode.IsDigit(first):
+		return 1
+	}
+
+	var letters, ideographs, other int
+	for _, r := range piece {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			ideographs++
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || r == '\''):
+			letters++
+		case unicode.IsLetter(r):
+			// non-Latin alphabets are split into much smaller pieces
+			other += 2
+		case r != ' ':
+			other++
+		}
+	}
+
+	tokens := ideographs + (other+1)/2
+	if letters > 0 {
+		// most words up to ~8 letters are a single token
+		tokens += 1 + (letters-1)/8
+	}
+	return max(tokens, 1)
+}
+
+func isBlank(s string) bool {
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
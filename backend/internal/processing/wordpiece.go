@@ -0,0 +1,147 @@
+package processing
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// longer words are a single [UNK], as in BERT's tokenizer
+const maxWordPieceRunes = 100
+
+// WordPiece counts tokens exactly as BERT-style embedding models, such as
+// nomic-embed-text, tokenize their input. Plug its CountTokens into a
+// Chunker to budget chunks with the embedding model's own vocabulary
+// instead of EstimateTokens.
+type WordPiece struct {
+	vocab     map[string]bool
+	lowercase bool
+}
+
+// LoadWordPiece reads a WordPiece vocabulary, the vocab.txt shipped with
+// the model's tokenizer: one token per line, continuations prefixed "##".
+func LoadWordPiece(path string) (*WordPiece, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open vocabulary: %w", err)
+	}
+	defer f.Close()
+
+	var vocab []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if token := strings.TrimRight(scanner.Text(), "\r"); token != "" {
+			vocab = append(vocab, token)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read vocabulary %s: %w", path, err)
+	}
+	if len(vocab) == 0 {
+		return nil, fmt.Errorf("vocabulary %s is empty", path)
+	}
+	return NewWordPiece(vocab), nil
+}
+
+// NewWordPiece returns a tokenizer for vocab. A vocabulary without
+// upper-case tokens, special tokens aside, is uncased: text is lower-cased
+// and stripped of accents before it is split, as uncased BERT models do.
+func NewWordPiece(vocab []string) *WordPiece {
+	wp := &WordPiece{vocab: make(map[string]bool, len(vocab)), lowercase: true}
+	for _, token := range vocab {
+		wp.vocab[token] = true
+		if !strings.HasPrefix(token, "[") && strings.ToLower(token) != token {
+			wp.lowercase = false
+		}
+	}
+	return wp
+}
+
+// CountTokens returns how many tokens text takes, leaving out the [CLS]
+// and [SEP] the model adds around every input.
+func (wp *WordPiece) CountTokens(text string) int {
+	tokens := 0
+	for _, word := range wp.words(text) {
+		tokens += wp.pieces(word)
+	}
+	return tokens
+}
+
+// words splits text as BERT's basic tokenizer does: at whitespace, around
+// every punctuation mark and around every CJK ideograph.
+func (wp *WordPiece) words(text string) []string {
+	if wp.lowercase {
+		var b strings.Builder
+		for _, r := range norm.NFD.String(strings.ToLower(text)) {
+			if !unicode.Is(unicode.Mn, r) {
+				b.WriteRune(r)
+			}
+		}
+		text = b.String()
+	}
+
+	var words []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			words = append(words, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case r == 0 || r == unicode.ReplacementChar || unicode.IsControl(r):
+			// dropped by BERT's text cleaning
+		case isBERTPunct(r) || unicode.Is(unicode.Han, r):
+			flush()
+			words = append(words, string(r))
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return words
+}
+
+// pieces returns how many vocabulary entries word is split into, matching
+// the longest known prefix first. A word that can not be split is [UNK].
+func (wp *WordPiece) pieces(word string) int {
+	runes := []rune(word)
+	if len(runes) > maxWordPieceRunes {
+		return 1
+	}
+
+	pieces := 0
+	for start := 0; start < len(runes); pieces++ {
+		end := len(runes)
+		for ; end > start; end-- {
+			piece := string(runes[start:end])
+			if start > 0 {
+				piece = "##" + piece
+			}
+			if wp.vocab[piece] {
+				break
+			}
+		}
+		if end == start {
+			return 1
+		}
+		start = end
+	}
+	return pieces
+}
+
+// isBERTPunct counts every non-alphanumeric ASCII character as punctuation,
+// as BERT does, along with Unicode punctuation.
+func isBERTPunct(r rune) bool {
+	if (r >= 33 && r <= 47) || (r >= 58 && r <= 64) || (r >= 91 && r <= 96) || (r >= 123 && r <= 126) {
+		return true
+	}
+	return unicode.IsPunct(r)
+}
@@ -0,0 +1,61 @@
+package processing
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWordPieceCountTokens(t *testing.T) {
+	uncased := NewWordPiece([]string{
+		"[PAD]", "[UNK]", "[CLS]", "[SEP]",
+		"hello", "world", "un", "##aff", "##able", "cafe", "日", ",", "!", "'", "s",
+	})
+	cased := NewWordPiece([]string{"[UNK]", "Hello", "hello", "world"})
+
+	tests := []struct {
+		name string
+		wp   *WordPiece
+		text string
+		want int
+	}{
+		{"words", uncased, "hello world", 2},
+		{"punctuation", uncased, "hello, world!", 4},
+		{"continuations", uncased, "unaffable", 3},
+		{"lower-cased", uncased, "Hello WORLD", 2},
+		{"accents stripped", uncased, "Café", 1},
+		{"unknown word", uncased, "unaffordable", 1},
+		{"apostrophe", uncased, "world's", 3},
+		{"ideographs", uncased, "日本", 2},
+		{"long word", uncased, strings.Repeat("un", 60), 1},
+		{"control characters", uncased, "hello\x00\x07", 1},
+		{"cased", cased, "Hello hello", 2},
+		{"cased unknown", cased, "HELLO", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.wp.CountTokens(tt.text); got != tt.want {
+				t.Errorf("CountTokens(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadWordPiece(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vocab.txt")
+	if err := os.WriteFile(path, []byte("[UNK]\r\nhello\r\n##s\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wp, err := LoadWordPiece(path)
+	if err != nil {
+		t.Fatalf("LoadWordPiece: %v", err)
+	}
+	if got := wp.CountTokens("hellos"); got != 2 {
+		t.Errorf("CountTokens(hellos) = %d, want 2", got)
+	}
+
+	if _, err := LoadWordPiece(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadWordPiece of a missing file succeeded")
+	}
+}
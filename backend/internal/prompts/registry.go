@@ -4,11 +4,12 @@ package prompts
 import (
 	"bytes"
 	"embed"
+	"errors"
 	"fmt"
-	"html/template"
 	"path/filepath"
 	"sort"
 	"strings"
+	"text/template"
 	"time"
 )
 
@@ -17,6 +18,9 @@ import (
 //go:embed general.tmpl research.tmpl
 var fs embed.FS
 
+// ErrUnknownPrompt is returned by Render for a name no template has.
+var ErrUnknownPrompt = errors.New("unknown prompt")
+
 // Template cache
 var tpl = template.Must(
 	template.
@@ -29,20 +33,189 @@ var tpl = template.Must(
 		ParseFS(fs, "*.tmpl"),
 )
 
+// sourcesTpl is appended to every prompt when retrieved sources are present.
+// It is named without the .tmpl suffix so List does not offer it as a prompt.
+var sourcesTpl = template.Must(tpl.New("sources").Parse(`
+
+Space Sources:
+The user has added documents to this space. The excerpts below were retrieved because they are likely relevant to the latest message.
+*   Prefer these excerpts over your own knowledge when they answer the question, and cite them inline as [1], [2], ... matching the numbers below.
+*   If the excerpts are not relevant, ignore them and do not mention them.
+{{ range .Sources }}
+[{{ .Index }}] {{ .Location }}{{ if .Section }} - {{ .Section }}{{ end }}{{ if .Page }} (page {{ .Page }}){{ end }}
+{{ .Text }}
+{{ end }}`))
+
+// memoriesTpl is appended to every prompt when the user has memories relevant
+// to the latest message. Like sourcesTpl it is not a prompt List offers.
+var memoriesTpl = template.Must(tpl.New("memories").Parse(`
+
+About the User:
+You remember these facts about the user from earlier conversations. Use them to tailor your answer where they matter, without mentioning that you remember them unless asked.
+{{ range .Memories }}
+*   {{ . }}
+{{- end }}`))
+
+// memoryExtractionTpl asks a model for the lasting facts about the user that
+// the latest exchanges reveal.
+var memoryExtractionTpl = template.Must(tpl.New("memory_extraction").Parse(`You pick out facts about a user worth remembering in future conversations with an AI assistant: who they are, their work, tools and stack, their preferences for how answers are written, and long-running goals or projects.
+{{ if .Known }}
+Already remembered:
+{{ range .Known }}- {{ . }}
+{{ end }}{{ end }}
+Latest exchanges:
+{{ .Transcript }}
+
+List new facts about the user stated or clearly implied in the latest exchanges, at most {{ .MaxFacts }}. Write each as one short sentence in the third person ("The user ..."). Leave out what is already remembered unless it changed, one-off requests, facts about anything other than the user, and anything sensitive such as health, passwords or financial details. Reply with a JSON array of strings only, [] if there is nothing to remember.`))
+
+// summaryTpl asks a model to fold the turns that no longer fit the context
+// window into the conversation's rolling summary. Like sourcesTpl it is not a
+// prompt List offers.
+var summaryTpl = template.Must(tpl.New("summary").Parse(`You maintain a running summary of a conversation between a user and an AI assistant. The summary replaces the messages it covers, which the assistant will no longer see.
+{{ if .Previous }}
+Summary so far:
+{{ .Previous }}
+{{ end }}
+Messages to add to the summary:
+{{ .Transcript }}
+
+Write the updated summary in at most {{ .MaxWords }} words. Keep the user's goals, preferences and constraints, decisions made, facts and figures established, open questions and anything the user asked the assistant to remember. Drop greetings and repetition. Write plain prose in the third person ("The user ...", "The assistant ..."). Reply with the summary only.`))
+
+// SummaryData is the input of RenderSummary.
+type SummaryData struct {
+	Previous   string // the summary of the messages before Transcript, if any
+	Transcript string
+	MaxWords   int
+}
+
+// MemoryExtractionData is the input of RenderMemoryExtraction.
+type MemoryExtractionData struct {
+	Known      []string // memories related to the exchanges
+	Transcript string
+	MaxFacts   int
+}
+
 type Data struct {
-	Now time.Time
+	Now          time.Time
+	UserName     string
+	SpaceTitle   string
+	SpaceSources []string // locations of the space's ready sources, whether retrieved or not
+	Tools        []Tool   // tools the model can call
+	Sources      []Source // excerpts retrieved for the latest message
+	Memories     []string // facts remembered about the user
+}
+
+// Tool is a tool the model can call while answering.
+type Tool struct {
+	Name        string
+	Description string
+}
+
+// Source is a retrieved excerpt from one of the space's sources.
+type Source struct {
+	Index    int
+	Location string
+	Section  string
+	Page     int // 0 when the source has no pages
+	Text     string
+}
+
+// sampleData is what user-defined prompts are test rendered with when they
+// are saved, so that they fail then rather than when used.
+var sampleData = Data{
+	Now:          time.Now(),
+	UserName:     "Ada Lovelace",
+	SpaceTitle:   "Analytical Engine",
+	SpaceSources: []string{"notes.pdf", "https://example.com/article"},
+	Tools:        []Tool{{Name: "web_search_extract", Description: "Searches the web."}},
+	Sources:      []Source{{Index: 1, Location: "notes.pdf", Section: "Introduction", Page: 1, Text: "An excerpt."}},
+	Memories:     []string{"The user prefers terse answers."},
 }
 
 // Render returns the rendered prompt text.
 func Render(name string, data Data) (string, error) {
-	var buf bytes.Buffer
 	t := tpl.Lookup(name + ".tmpl")
 	if t == nil {
-		return "", fmt.Errorf("unknown prompt %q", name)
+		return "", fmt.Errorf("%w %q", ErrUnknownPrompt, name)
+	}
+	return render(t, data)
+}
+
+// RenderText renders a user-defined prompt the way Render does a built-in
+// one. The prompt has the same functions and data as the built-in prompts and
+// can include them, as in {{ template "general.tmpl" . }}.
+func RenderText(text string, data Data) (string, error) {
+	t, err := parse(text)
+	if err != nil {
+		return "", err
 	}
+	return render(t, data)
+}
+
+// Validate checks that a user-defined prompt parses and renders.
+func Validate(text string) error {
+	_, err := RenderText(text, sampleData)
+	return err
+}
+
+// parse parses a user-defined prompt into a copy of the built-in templates, so
+// templates it defines can not replace them for anyone else.
+func parse(text string) (*template.Template, error) {
+	base, err := tpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return base.New("custom").Parse(text)
+}
+
+func render(t *template.Template, data Data) (string, error) {
+	var buf bytes.Buffer
 	if err := t.Execute(&buf, data); err != nil {
 		return "", err
 	}
+	if len(data.Memories) > 0 {
+		if err := memoriesTpl.Execute(&buf, data); err != nil {
+			return "", err
+		}
+	}
+	if len(data.Sources) > 0 {
+		if err := sourcesTpl.Execute(&buf, data); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+// RenderSources returns the sources section Render appends to a prompt, or
+// an empty string when there are no sources. It is meant for system prompts
+// that do not come from a template.
+func RenderSources(data Data) (string, error) {
+	if len(data.Sources) == 0 {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := sourcesTpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// RenderSummary returns the request for an updated conversation summary.
+func RenderSummary(data SummaryData) (string, error) {
+	var buf bytes.Buffer
+	if err := summaryTpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// RenderMemoryExtraction returns the request for the facts to remember from
+// the latest exchanges.
+func RenderMemoryExtraction(data MemoryExtractionData) (string, error) {
+	var buf bytes.Buffer
+	if err := memoryExtractionTpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
 	return buf.String(), nil
 }
 
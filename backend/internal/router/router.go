@@ -4,12 +4,16 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/synntx/askmind/internal/db/postgres"
 	"github.com/synntx/askmind/internal/handlers"
 	"github.com/synntx/askmind/internal/llm"
 	mw "github.com/synntx/askmind/internal/middleware"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/processing"
 	"github.com/synntx/askmind/internal/service"
 	"go.uber.org/zap"
 )
@@ -19,6 +23,9 @@ type Router struct {
 	pepper     string
 	logger     *zap.Logger
 	llmFactory llm.LLMFactory
+
+	// background work that outlives requests, set by CreateRoutes
+	memories service.MemoryService
 }
 
 func NewRouter(dbURL, pepper string, logger *zap.Logger, llmFactory llm.LLMFactory) *Router {
@@ -47,18 +54,75 @@ func (r *Router) CreateRoutes(ctx context.Context) *http.ServeMux {
 	// init services
 	// - bcrypt handles per-user salts automatically 🧂
 	// - Pepper is our secret spice added BEFORE bcrypt hashing 🌶️
-	authService := service.NewAuthService(db, r.pepper, r.logger)
+	// - access tokens are short lived, refresh tokens rotate on every use 🔄
+	accessTTL := envDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+	refreshTTL := envDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	authService := service.NewAuthService(db, r.pepper, accessTTL, refreshTTL, r.logger)
 	userService := service.NewUserService(db, r.logger)
-	spaceService := service.NewSpaceService(db, r.logger)
+	spaceService := service.NewSpaceService(db, r.llmFactory, r.logger)
 	convService := service.NewConversationService(db, r.logger)
 	msgService := service.NewMessageService(db, r.logger)
+	authz := service.NewAuthorizer(db, r.logger)
+	apiKeyService := service.NewAPIKeyService(db, r.logger)
+	usageService := service.NewUsageService(db, models.DailyQuota{
+		Requests: int64(envInt("DAILY_REQUEST_QUOTA", 0)),
+		Tokens:   int64(envInt("DAILY_TOKEN_QUOTA", 0)),
+	}, r.logger)
+	// history sent with a completion is capped at this many tokens, however
+	// large the model's context window; 0 leaves only the window's limit
+	historyBudgeter := service.NewHistoryBudgeter(db, envInt("HISTORY_MAX_TOKENS", 16000), r.logger)
+
+	// sources are embedded with a fixed provider so every chunk in a space
+	// lives in the same vector space, whatever model the chat uses
+	embeddingProvider := llm.ProviderType(os.Getenv("EMBEDDING_PROVIDER"))
+	if embeddingProvider == "" {
+		embeddingProvider = llm.ProviderGemini
+	}
+	embeddingModel := os.Getenv("EMBEDDING_MODEL")
+	if embeddingModel == "" {
+		embeddingModel = "text-embedding-004"
+	}
+	chunkTokens, _ := strconv.Atoi(os.Getenv("CHUNK_MAX_TOKENS"))
+	chunkOverlap, err := strconv.Atoi(os.Getenv("CHUNK_OVERLAP_TOKENS"))
+	if err != nil {
+		chunkOverlap = processing.DefaultChunkOverlap
+	}
+	chunker := processing.NewChunker(chunkTokens, chunkOverlap)
+	// chunks are counted in the embedding model's own tokens when its
+	// WordPiece vocabulary is given, e.g. nomic-embed-text's vocab.txt
+	if vocab := os.Getenv("CHUNK_TOKENIZER_VOCAB"); vocab != "" {
+		tokenizer, err := processing.LoadWordPiece(vocab)
+		if err != nil {
+			r.logger.Fatal("failed to load the chunk tokenizer", zap.Error(err))
+		}
+		chunker.CountTokens = tokenizer.CountTokens
+	}
+	sourceService := service.NewSourceService(db, r.llmFactory, embeddingProvider, embeddingModel, chunker, r.logger)
+	if err := sourceService.FailInterruptedSources(ctx); err != nil {
+		r.logger.Error("failed to mark interrupted sources failed", zap.Error(err))
+	}
+	memoryService := service.NewMemoryService(db, usageService, r.llmFactory, embeddingProvider, embeddingModel, r.logger)
+	r.memories = memoryService
+	promptService := service.NewPromptService(db, r.llmFactory, r.logger)
 
 	// HTTP handlers 🚦
 	authHandlers := handlers.NewAuthHandlers(authService, r.logger)
 	userHandlers := handlers.NewUserHandlers(userService, r.logger)
-	spaceHandlers := handlers.NewSpaceHandler(spaceService, r.logger)
-	convHandlers := handlers.NewConversationService(convService, r.logger)
-	msgHandlers := handlers.NewMessageHandler(msgService, convService, r.logger, r.llmFactory)
+	spaceHandlers := handlers.NewSpaceHandler(spaceService, authz, r.logger)
+	convHandlers := handlers.NewConversationService(convService, authz, r.logger)
+	msgHandlers := handlers.NewMessageHandler(msgService, convService, sourceService, authz, memoryService, promptService, historyBudgeter, usageService, r.logger, r.llmFactory)
+	sourceHandlers := handlers.NewSourceHandler(sourceService, authz, r.logger)
+	modelHandlers := handlers.NewModelHandler(r.llmFactory, r.logger)
+	usageHandlers := handlers.NewUsageHandler(usageService, r.logger)
+	apiKeyHandlers := handlers.NewAPIKeyHandler(apiKeyService, r.logger)
+	memoryHandlers := handlers.NewMemoryHandler(memoryService, r.logger)
+	promptHandlers := handlers.NewPromptTemplateHandler(promptService, authz, r.logger)
+	openAIHandlers := handlers.NewOpenAIHandler(r.llmFactory, sourceService, usageService, authz, r.logger)
+
+	// Rate limits, per minute: completions per user, public routes per IP
+	completionLimiter := mw.NewRateLimiter(envInt("COMPLETION_RATE_LIMIT", 10), envInt("COMPLETION_RATE_BURST", 0))
+	publicLimiter := mw.NewRateLimiter(envInt("PUBLIC_RATE_LIMIT", 20), envInt("PUBLIC_RATE_BURST", 0))
+	ipKey := mw.IPKey(os.Getenv("TRUST_PROXY_HEADERS") == "true")
 
 	mux := http.NewServeMux()
 
@@ -73,127 +137,288 @@ func (r *Router) CreateRoutes(ctx context.Context) *http.ServeMux {
 		mw.RecoverPanic(r.logger),
 	))
 
-	// Auth routes (public)
+	// Auth routes (public, rate limited per IP)
 	// Only `POST` method allowed
-	// TODO: Public access, maybe rate limit later
 	mux.Handle("/auth/register", publicRoute(
 		http.HandlerFunc(authHandlers.RegisterHandler),
-		http.MethodPost, r.logger))
+		http.MethodPost, r.logger,
+		mw.RateLimit(publicLimiter, ipKey, r.logger)))
 
 	mux.Handle("/auth/login", publicRoute(
 		http.HandlerFunc(authHandlers.LoginHandler),
-		http.MethodPost, r.logger))
+		http.MethodPost, r.logger,
+		mw.RateLimit(publicLimiter, ipKey, r.logger)))
+
+	// Public as well: the access token may have expired already
+	mux.Handle("/auth/refresh", publicRoute(
+		http.HandlerFunc(authHandlers.RefreshHandler),
+		http.MethodPost, r.logger,
+		mw.RateLimit(publicLimiter, ipKey, r.logger)))
+
+	mux.Handle("/auth/logout", publicRoute(
+		http.HandlerFunc(authHandlers.LogoutHandler),
+		http.MethodPost, r.logger,
+		mw.RateLimit(publicLimiter, ipKey, r.logger)))
 
 	// Protected route
 	mux.Handle("/auth/password", protectedRoute(
 		http.HandlerFunc(authHandlers.UpdatePasswordHandler),
-		http.MethodPut, r.logger))
+		http.MethodPut, r.logger, apiKeyService))
+
+	// API keys for scripts; only a session token can create or revoke them
+	mux.Handle("/keys", protectedRoute(
+		http.HandlerFunc(apiKeyHandlers.CreateAPIKeyHandler),
+		http.MethodPost, r.logger, apiKeyService))
+
+	mux.Handle("/keys/list", protectedRoute(
+		http.HandlerFunc(apiKeyHandlers.ListAPIKeysHandler),
+		http.MethodGet, r.logger, apiKeyService))
+
+	mux.Handle("/keys/revoke", protectedRoute(
+		http.HandlerFunc(apiKeyHandlers.RevokeAPIKeyHandler),
+		http.MethodDelete, r.logger, apiKeyService))
 
 	// user profile routes
 	mux.Handle("/me/get", protectedRoute(
 		http.HandlerFunc(userHandlers.GetUserHandler),
-		http.MethodGet, r.logger))
+		http.MethodGet, r.logger, apiKeyService))
 
 	mux.Handle("/me/name", protectedRoute(
 		http.HandlerFunc(userHandlers.UpdateNameHandler),
-		http.MethodPut, r.logger))
+		http.MethodPut, r.logger, apiKeyService))
 
 	// TODO: Add email confirmation
 	mux.Handle("/me/email", protectedRoute(
 		http.HandlerFunc(userHandlers.UpdateEmailHandler),
-		http.MethodPut, r.logger))
+		http.MethodPut, r.logger, apiKeyService))
 
 	mux.Handle("/me/delete", protectedRoute(
 		http.HandlerFunc(userHandlers.DeleteUserHandler),
-		http.MethodDelete, r.logger))
+		http.MethodDelete, r.logger, apiKeyService))
+
+	// What AskMind remembers about the user, learned from conversations
+	mux.Handle("/memory", protectedRoute(
+		http.HandlerFunc(memoryHandlers.CreateMemoryHandler),
+		http.MethodPost, r.logger, apiKeyService))
+
+	mux.Handle("/memory/list", protectedRoute(
+		http.HandlerFunc(memoryHandlers.ListMemoriesHandler),
+		http.MethodGet, r.logger, apiKeyService))
+
+	mux.Handle("/memory/update", protectedRoute(
+		http.HandlerFunc(memoryHandlers.UpdateMemoryHandler),
+		http.MethodPut, r.logger, apiKeyService))
+
+	mux.Handle("/memory/delete", protectedRoute(
+		http.HandlerFunc(memoryHandlers.DeleteMemoryHandler),
+		http.MethodDelete, r.logger, apiKeyService))
+
+	mux.Handle("/memory/clear", protectedRoute(
+		http.HandlerFunc(memoryHandlers.ClearMemoriesHandler),
+		http.MethodDelete, r.logger, apiKeyService))
 
 	// SPACE ROUTES
 	mux.Handle("/space", protectedRoute(
 		http.HandlerFunc(spaceHandlers.CreateSpaceHandler),
-		http.MethodPost, r.logger))
+		http.MethodPost, r.logger, apiKeyService))
 
 	mux.Handle("/space/get", protectedRoute(
 		http.HandlerFunc(spaceHandlers.GetSpaceHandler),
-		http.MethodGet, r.logger))
+		http.MethodGet, r.logger, apiKeyService))
 
 	mux.Handle("/space/list", protectedRoute(
 		http.HandlerFunc(spaceHandlers.ListSpacesForUserHandler),
-		http.MethodGet, r.logger))
+		http.MethodGet, r.logger, apiKeyService))
 
 	mux.Handle("/space/update", protectedRoute(
 		http.HandlerFunc(spaceHandlers.UpdateSpaceHandler),
-		http.MethodPut, r.logger))
+		http.MethodPut, r.logger, apiKeyService))
 
 	mux.Handle("/space/delete", protectedRoute(
 		http.HandlerFunc(spaceHandlers.DeleteSpaceHandler),
-		http.MethodDelete, r.logger))
+		http.MethodDelete, r.logger, apiKeyService))
+
+	// Space members and invitations
+	mux.Handle("/space/members", protectedRoute(
+		http.HandlerFunc(spaceHandlers.ListMembersHandler),
+		http.MethodGet, r.logger, apiKeyService))
+
+	mux.Handle("/space/members/invite", protectedRoute(
+		http.HandlerFunc(spaceHandlers.InviteMemberHandler),
+		http.MethodPost, r.logger, apiKeyService))
+
+	mux.Handle("/space/members/role", protectedRoute(
+		http.HandlerFunc(spaceHandlers.UpdateMemberRoleHandler),
+		http.MethodPut, r.logger, apiKeyService))
+
+	mux.Handle("/space/members/remove", protectedRoute(
+		http.HandlerFunc(spaceHandlers.RemoveMemberHandler),
+		http.MethodDelete, r.logger, apiKeyService))
+
+	mux.Handle("/space/invitations", protectedRoute(
+		http.HandlerFunc(spaceHandlers.ListInvitationsHandler),
+		http.MethodGet, r.logger, apiKeyService))
+
+	mux.Handle("/space/invitations/accept", protectedRoute(
+		http.HandlerFunc(spaceHandlers.AcceptInvitationHandler),
+		http.MethodPost, r.logger, apiKeyService))
+
+	mux.Handle("/space/invitations/decline", protectedRoute(
+		http.HandlerFunc(spaceHandlers.DeclineInvitationHandler),
+		http.MethodDelete, r.logger, apiKeyService))
+
+	// Prompt templates, personal or shared with a space
+	mux.Handle("/prompt", protectedRoute(
+		http.HandlerFunc(promptHandlers.CreateTemplateHandler),
+		http.MethodPost, r.logger, apiKeyService))
+
+	mux.Handle("/prompt/get", protectedRoute(
+		http.HandlerFunc(promptHandlers.GetTemplateHandler),
+		http.MethodGet, r.logger, apiKeyService))
+
+	mux.Handle("/prompt/list", protectedRoute(
+		http.HandlerFunc(promptHandlers.ListTemplatesHandler),
+		http.MethodGet, r.logger, apiKeyService))
+
+	mux.Handle("/prompt/update", protectedRoute(
+		http.HandlerFunc(promptHandlers.UpdateTemplateHandler),
+		http.MethodPut, r.logger, apiKeyService))
+
+	mux.Handle("/prompt/delete", protectedRoute(
+		http.HandlerFunc(promptHandlers.DeleteTemplateHandler),
+		http.MethodDelete, r.logger, apiKeyService))
+
+	// Source Routes
+	mux.Handle("/source/url", protectedRoute(
+		http.HandlerFunc(sourceHandlers.CreateWebSourceHandler),
+		http.MethodPost,
+		r.logger, apiKeyService, models.APIKeyScopeIngest))
+
+	mux.Handle("/source/file", protectedRoute(
+		http.HandlerFunc(sourceHandlers.CreateFileSourceHandler),
+		http.MethodPost,
+		r.logger, apiKeyService, models.APIKeyScopeIngest))
+
+	mux.Handle("/source/get", protectedRoute(
+		http.HandlerFunc(sourceHandlers.GetSourceHandler),
+		http.MethodGet,
+		r.logger, apiKeyService))
+
+	mux.Handle("/source/list", protectedRoute(
+		http.HandlerFunc(sourceHandlers.ListSourcesForSpaceHandler),
+		http.MethodGet,
+		r.logger, apiKeyService))
+
+	mux.Handle("/source/delete", protectedRoute(
+		http.HandlerFunc(sourceHandlers.DeleteSourceHandler),
+		http.MethodDelete,
+		r.logger, apiKeyService, models.APIKeyScopeIngest))
 
 	// Conversation Routes
 	mux.Handle("/c/create", protectedRoute(
 		http.HandlerFunc(convHandlers.CreateConversationHandler),
 		http.MethodPost,
-		r.logger))
+		r.logger, apiKeyService, models.APIKeyScopeChat))
 
 	mux.Handle("/c/get", protectedRoute(
 		http.HandlerFunc(convHandlers.GetConversationHandler),
 		http.MethodGet,
-		r.logger))
+		r.logger, apiKeyService))
 
 	mux.Handle("/c/update/title", protectedRoute(
 		http.HandlerFunc(convHandlers.UpdateConversationTitleHandler),
 		http.MethodPut,
-		r.logger))
+		r.logger, apiKeyService))
 
 	mux.Handle("/c/update/status", protectedRoute(
 		http.HandlerFunc(convHandlers.UpdateConversationStatusHandler),
 		http.MethodPut,
-		r.logger))
+		r.logger, apiKeyService))
 
 	mux.Handle("/c/delete", protectedRoute(
 		http.HandlerFunc(convHandlers.DeleteConversationHandler),
 		http.MethodDelete,
-		r.logger))
+		r.logger, apiKeyService))
 
 	mux.Handle("/c/list/space", protectedRoute(
 		http.HandlerFunc(convHandlers.ListConversationsForSpaceHandler),
 		http.MethodGet,
-		r.logger))
+		r.logger, apiKeyService))
 
 	mux.Handle("/c/list/user", protectedRoute(
 		http.HandlerFunc(convHandlers.ListActiveConversationsForUserHandler),
 		http.MethodGet,
-		r.logger))
+		r.logger, apiKeyService))
 
 	// Message Routes
 	mux.Handle("/msg/create", protectedRoute(
 		http.HandlerFunc(msgHandlers.CreateMessageHandler),
 		http.MethodPost,
-		r.logger))
+		r.logger, apiKeyService, models.APIKeyScopeChat))
 
 	mux.Handle("/msg/create/messages", protectedRoute(
 		http.HandlerFunc(msgHandlers.CreateMessagesHandler),
 		http.MethodPost,
-		r.logger))
+		r.logger, apiKeyService, models.APIKeyScopeChat))
 
 	mux.Handle("/msg/get", protectedRoute(
 		http.HandlerFunc(msgHandlers.GetMessageHandler),
 		http.MethodGet,
-		r.logger))
+		r.logger, apiKeyService))
 
 	mux.Handle("/msg/get/msgs", protectedRoute(
 		http.HandlerFunc(msgHandlers.GetConvUserMessageHandler),
 		http.MethodGet,
-		r.logger))
+		r.logger, apiKeyService))
 
 	mux.Handle("/msg/get/all-msgs", protectedRoute(
 		http.HandlerFunc(msgHandlers.GetConvMessageHandler),
 		http.MethodGet,
-		r.logger))
+		r.logger, apiKeyService))
+
+	mux.Handle("/msg/references", protectedRoute(
+		http.HandlerFunc(msgHandlers.GetMessageReferencesHandler),
+		http.MethodGet,
+		r.logger, apiKeyService))
+
+	mux.Handle("/msg/siblings", protectedRoute(
+		http.HandlerFunc(msgHandlers.GetMessageSiblingsHandler),
+		http.MethodGet,
+		r.logger, apiKeyService))
+
+	mux.Handle("/msg/branch", protectedRoute(
+		http.HandlerFunc(msgHandlers.SwitchBranchHandler),
+		http.MethodPut,
+		r.logger, apiKeyService, models.APIKeyScopeChat))
 
 	mux.Handle("/msg/list-prompts", protectedRoute(
 		http.HandlerFunc(msgHandlers.ListPromptsHandler),
 		http.MethodGet,
-		r.logger,
+		r.logger, apiKeyService,
+	))
+
+	// Model catalog
+	mux.Handle("/models", protectedRoute(
+		http.HandlerFunc(modelHandlers.ListModelsHandler),
+		http.MethodGet,
+		r.logger, apiKeyService,
+	))
+
+	// Token usage
+	mux.Handle("/usage/conversation", protectedRoute(
+		http.HandlerFunc(usageHandlers.GetConversationUsageHandler),
+		http.MethodGet,
+		r.logger, apiKeyService,
+	))
+	mux.Handle("/usage/space", protectedRoute(
+		http.HandlerFunc(usageHandlers.GetSpaceUsageHandler),
+		http.MethodGet,
+		r.logger, apiKeyService,
+	))
+	mux.Handle("/usage/daily", protectedRoute(
+		http.HandlerFunc(usageHandlers.GetDailyUsageHandler),
+		http.MethodGet,
+		r.logger, apiKeyService,
 	))
 	corsConfig := mw.NewCORSConfig()
 	defaultOrigins := []string{"http://localhost:3000", "http://172.22.181.121:3000"}
@@ -220,15 +445,85 @@ func (r *Router) CreateRoutes(ctx context.Context) *http.ServeMux {
 
 	mux.Handle("/c/completion", middlewareChain(
 		http.HandlerFunc(msgHandlers.CompletionHandler),
-		mw.AuthMiddleware(r.logger),
+		mw.EnforceQuota(usageService, r.logger),
+		mw.RateLimit(completionLimiter, mw.UserKey, r.logger),
+		mw.RequireScope(r.logger, models.APIKeyScopeChat),
+		mw.AuthMiddleware(apiKeyService, r.logger),
+		mw.RequireMethod(http.MethodPost, r.logger),
+		mw.RecoverPanic(r.logger),
+		mw.CORSWithConfig(corsConfig, r.logger),
+	))
+
+	// Regenerating and editing answer again, so they are limited like /c/completion
+	mux.Handle("/c/regenerate", middlewareChain(
+		http.HandlerFunc(msgHandlers.RegenerateHandler),
+		mw.EnforceQuota(usageService, r.logger),
+		mw.RateLimit(completionLimiter, mw.UserKey, r.logger),
+		mw.RequireScope(r.logger, models.APIKeyScopeChat),
+		mw.AuthMiddleware(apiKeyService, r.logger),
+		mw.RequireMethod(http.MethodPost, r.logger),
+		mw.RecoverPanic(r.logger),
+		mw.CORSWithConfig(corsConfig, r.logger),
+	))
+
+	mux.Handle("/c/edit", middlewareChain(
+		http.HandlerFunc(msgHandlers.EditMessageHandler),
+		mw.EnforceQuota(usageService, r.logger),
+		mw.RateLimit(completionLimiter, mw.UserKey, r.logger),
+		mw.RequireScope(r.logger, models.APIKeyScopeChat),
+		mw.AuthMiddleware(apiKeyService, r.logger),
 		mw.RequireMethod(http.MethodPost, r.logger),
 		mw.RecoverPanic(r.logger),
 		mw.CORSWithConfig(corsConfig, r.logger),
 	))
 
+	// Reconnecting to an answer costs nothing new, so it is neither rate
+	// limited nor counted against the quota
+	mux.Handle("/c/completion/resume", middlewareChain(
+		http.HandlerFunc(msgHandlers.ResumeCompletionHandler),
+		mw.RequireScope(r.logger, models.APIKeyScopeChat),
+		mw.AuthMiddleware(apiKeyService, r.logger),
+		mw.RequireMethod(http.MethodGet, r.logger),
+		mw.RecoverPanic(r.logger),
+		mw.CORSWithConfig(corsConfig, r.logger),
+	))
+
+	mux.Handle("/c/stop", protectedRoute(
+		http.HandlerFunc(msgHandlers.StopCompletionHandler),
+		http.MethodPost,
+		r.logger, apiKeyService, models.APIKeyScopeChat,
+	))
+
+	// OpenAI-compatible API, limited like /c/completion
+	mux.Handle("/v1/chat/completions", middlewareChain(
+		http.HandlerFunc(openAIHandlers.ChatCompletionsHandler),
+		mw.EnforceQuota(usageService, r.logger),
+		mw.RateLimit(completionLimiter, mw.UserKey, r.logger),
+		mw.RequireScope(r.logger, models.APIKeyScopeChat),
+		mw.AuthMiddleware(apiKeyService, r.logger),
+		mw.RequireMethod(http.MethodPost, r.logger),
+		mw.RecoverPanic(r.logger),
+		mw.CORSWithConfig(corsConfig, r.logger),
+	))
+
+	mux.Handle("/v1/models", protectedRoute(
+		http.HandlerFunc(openAIHandlers.ListModelsHandler),
+		http.MethodGet,
+		r.logger, apiKeyService,
+	))
+
 	return mux
 }
 
+// Shutdown waits for the background work started by requests, such as
+// memory extraction, until ctx is done.
+func (r *Router) Shutdown(ctx context.Context) error {
+	if r.memories == nil {
+		return nil
+	}
+	return r.memories.Wait(ctx)
+}
+
 func middlewareChain(h http.Handler, middlewares ...mw.Middleware) http.Handler {
 	for _, mw := range middlewares {
 		h = mw(h)
@@ -236,12 +531,14 @@ func middlewareChain(h http.Handler, middlewares ...mw.Middleware) http.Handler
 	return h
 }
 
-func publicRoute(h http.Handler, method string, logger *zap.Logger) http.Handler {
+// publicRoute wraps an unauthenticated handler. Extra middlewares, such as a
+// rate limit, run after the method check.
+func publicRoute(h http.Handler, method string, logger *zap.Logger, extra ...mw.Middleware) http.Handler {
 	corsConfig := mw.NewCORSConfig()
 	corsConfig.AllowedOrigins = []string{"http://localhost:3000", "http://172.22.181.121:3000"}
 
 	return middlewareChain(
-		h,
+		middlewareChain(h, extra...),
 		mw.RequireMethod(method, logger),
 		mw.LoggingMiddleware(logger),
 		mw.RecoverPanic(logger),
@@ -249,16 +546,44 @@ func publicRoute(h http.Handler, method string, logger *zap.Logger) http.Handler
 	)
 }
 
-func protectedRoute(h http.Handler, method string, logger *zap.Logger) http.Handler {
+// protectedRoute wraps a handler that needs a session token or an API key.
+// API keys are let through when they have one of scopes; without scopes, GET
+// routes take the read scope and every other route takes session tokens only.
+func protectedRoute(h http.Handler, method string, logger *zap.Logger, apiKeys service.APIKeyService, scopes ...models.APIKeyScope) http.Handler {
 	corsConfig := mw.NewCORSConfig()
 	corsConfig.AllowedOrigins = []string{"http://localhost:3000", "http://172.22.181.121:3000"}
 
+	if len(scopes) == 0 && method == http.MethodGet {
+		scopes = []models.APIKeyScope{models.APIKeyScopeRead}
+	}
+
 	return middlewareChain(
 		h,
-		mw.AuthMiddleware(logger),
+		mw.RequireScope(logger, scopes...),
+		mw.AuthMiddleware(apiKeys, logger),
 		mw.RequireMethod(method, logger),
 		mw.LoggingMiddleware(logger),
 		mw.RecoverPanic(logger),
 		mw.CORSWithConfig(corsConfig, logger),
 	)
 }
+
+// envInt reads an integer setting, falling back to def when it is unset or
+// malformed.
+func envInt(name string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// envDuration reads a duration setting such as "15m", falling back to def
+// when it is unset or malformed.
+func envDuration(name string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/db"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+// APIKeyPrefix starts every API key, telling them apart from JWTs.
+const APIKeyPrefix = "amk_"
+
+// number of characters of a key kept in the clear to recognise it
+const apiKeyDisplayLen = len(APIKeyPrefix) + 6
+
+var ErrInvalidAPIKey = errors.New("invalid, expired or revoked API key")
+
+type APIKeyService interface {
+	// CreateAPIKey returns the new key in plain text; only its hash is stored.
+	CreateAPIKey(ctx context.Context, userId string, req *models.CreateAPIKeyRequest) (*models.CreatedAPIKey, error)
+	ListAPIKeys(ctx context.Context, userId string) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userId, keyId string) error
+	// Authenticate maps a key onto the claims a session token would carry,
+	// limited to the key's scopes. It fails with ErrInvalidAPIKey.
+	Authenticate(ctx context.Context, key string) (*utils.Claims, error)
+}
+
+type apiKeyService struct {
+	db     db.DB
+	logger *zap.Logger
+}
+
+func NewAPIKeyService(db db.DB, logger *zap.Logger) *apiKeyService {
+	return &apiKeyService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (s *apiKeyService) CreateAPIKey(ctx context.Context, userId string, req *models.CreateAPIKeyRequest) (*models.CreatedAPIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required field name"),
+		).WithDetails(utils.ValidationError{
+			Field:   "name",
+			Message: "'name' is required",
+		})
+	}
+
+	if len(req.Scopes) == 0 {
+		return nil, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required field scopes"),
+		).WithDetails(utils.ValidationError{
+			Field:   "scopes",
+			Message: `at least one scope of "read", "chat" or "ingest" is required`,
+		})
+	}
+	var scopes []models.APIKeyScope
+	for _, scope := range req.Scopes {
+		if !scope.Valid() {
+			return nil, utils.ErrValidation.Wrap(
+				fmt.Errorf("invalid scope %q", scope),
+			).WithDetails(utils.ValidationError{
+				Field:   "scopes",
+				Message: `scopes can only be "read", "chat" or "ingest"`,
+			})
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, utils.ErrValidation.Wrap(
+			fmt.Errorf("expires_at is in the past"),
+		).WithDetails(utils.ValidationError{
+			Field:   "expires_at",
+			Message: "expires_at must be in the future",
+		})
+	}
+
+	uid, err := uuid.Parse(userId)
+	if err != nil {
+		return nil, utils.ErrUnauthorized.Wrap(err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, utils.ErrInternal.Wrap(fmt.Errorf("generating API key: %w", err))
+	}
+	plain := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := models.APIKey{
+		UserId:    uid,
+		Name:      name,
+		Prefix:    plain[:apiKeyDisplayLen],
+		KeyHash:   hashToken(plain),
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.db.CreateAPIKey(ctx, &key); err != nil {
+		return nil, err
+	}
+
+	return &models.CreatedAPIKey{APIKey: key, Key: plain}, nil
+}
+
+func (s *apiKeyService) ListAPIKeys(ctx context.Context, userId string) ([]models.APIKey, error) {
+	return s.db.ListAPIKeys(ctx, userId)
+}
+
+func (s *apiKeyService) RevokeAPIKey(ctx context.Context, userId, keyId string) error {
+	return s.db.RevokeAPIKey(ctx, userId, keyId)
+}
+
+func (s *apiKeyService) Authenticate(ctx context.Context, plain string) (*utils.Claims, error) {
+	if !strings.HasPrefix(plain, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.db.GetAPIKeyByHash(ctx, hashToken(plain))
+	if err != nil {
+		if errors.Is(err, utils.ErrNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now())) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Losing a last-used timestamp is no reason to fail the request
+	if err := s.db.TouchAPIKey(ctx, key.KeyId.String()); err != nil {
+		s.logger.Warn("Failed to record API key use",
+			zap.String("key_id", key.KeyId.String()),
+			zap.Error(err))
+	}
+
+	claims := &utils.Claims{
+		UserId: key.UserId.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: key.UserId.String(),
+		},
+		APIKeyId: key.KeyId.String(),
+		Scopes:   make([]string, len(key.Scopes)),
+	}
+	if key.ExpiresAt != nil {
+		claims.ExpiresAt = jwt.NewNumericDate(*key.ExpiresAt)
+	}
+	for i, scope := range key.Scopes {
+		claims.Scopes[i] = string(scope)
+	}
+	return claims, nil
+}
@@ -2,37 +2,60 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/synntx/askmind/internal/db"
 	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrInvalidCredentials = errors.New("invalid email or password")
-	ErrEmailExists        = errors.New("email already registered")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrEmailExists         = errors.New("email already registered")
+	ErrInvalidRefreshToken = errors.New("invalid, expired or revoked refresh token")
 )
 
 type AuthService interface {
 	Register(ctx context.Context, user *models.User) error
 	Login(ctx context.Context, email, password string) (*models.User, error)
+	// UpdatePassword also revokes every refresh token of the user.
 	UpdatePassword(ctx context.Context, userID, oldPassword, newPassword string) error
+
+	// IssueTokens starts a session: an access token and a refresh token of
+	// a new token family.
+	IssueTokens(ctx context.Context, userId string) (*models.TokenPair, error)
+	// RefreshTokens trades a refresh token for a new pair. Presenting a token
+	// that was already traded revokes its whole family, since one of the two
+	// holders must have stolen it.
+	RefreshTokens(ctx context.Context, refreshToken string) (*models.TokenPair, error)
+	// Logout revokes the family of the refresh token. Unknown tokens are ignored.
+	Logout(ctx context.Context, refreshToken string) error
 }
 
 type authService struct {
-	db     db.DB
-	pepper string
-	logger *zap.Logger
+	db         db.DB
+	pepper     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	logger     *zap.Logger
 }
 
-func NewAuthService(db db.DB, pepper string, logger *zap.Logger) *authService {
+func NewAuthService(db db.DB, pepper string, accessTTL, refreshTTL time.Duration, logger *zap.Logger) *authService {
 	return &authService{
-		db:     db,
-		pepper: pepper,
-		logger: logger,
+		db:         db,
+		pepper:     pepper,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+		logger:     logger,
 	}
 }
 
@@ -93,5 +116,105 @@ func (a *authService) UpdatePassword(ctx context.Context, userID, oldPassword, n
 		return fmt.Errorf("password hashing failed: %w", err)
 	}
 
-	return a.db.UpdatePassword(ctx, userID, string(hashedPassword))
+	if err := a.db.UpdatePassword(ctx, userID, string(hashedPassword)); err != nil {
+		return err
+	}
+	return a.db.RevokeUserRefreshTokens(ctx, userID)
+}
+
+func (a *authService) IssueTokens(ctx context.Context, userId string) (*models.TokenPair, error) {
+	userUUID, err := uuid.Parse(userId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id: %w", err)
+	}
+	return a.issue(ctx, userUUID, uuid.New(), nil)
+}
+
+func (a *authService) RefreshTokens(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	stored, err := a.db.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, utils.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if stored.RevokedAt != nil {
+		if stored.ReplacedBy != nil {
+			a.logger.Warn("Rotated refresh token reused, revoking its family",
+				zap.String("user_id", stored.UserId.String()),
+				zap.String("family_id", stored.FamilyId.String()),
+			)
+			if err := a.db.RevokeRefreshTokenFamily(ctx, stored.FamilyId.String()); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	pair, err := a.issue(ctx, stored.UserId, stored.FamilyId, &stored.TokenId)
+	if errors.Is(err, utils.ErrUnauthorized) {
+		return nil, ErrInvalidRefreshToken // lost a race with another refresh of the same token
+	}
+	return pair, err
+}
+
+func (a *authService) Logout(ctx context.Context, refreshToken string) error {
+	stored, err := a.db.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, utils.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	return a.db.RevokeRefreshTokenFamily(ctx, stored.FamilyId.String())
+}
+
+// issue creates a token pair in familyId, replacing the refresh token
+// previous when set.
+func (a *authService) issue(ctx context.Context, userId, familyId uuid.UUID, previous *uuid.UUID) (*models.TokenPair, error) {
+	now := time.Now()
+	pair := &models.TokenPair{
+		AccessExpiresAt:  now.Add(a.accessTTL),
+		RefreshExpiresAt: now.Add(a.refreshTTL),
+	}
+
+	accessToken, err := utils.GenerateToken(userId.String(), pair.AccessExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("signing access token: %w", err)
+	}
+	pair.AccessToken = accessToken
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generating refresh token: %w", err)
+	}
+	pair.RefreshToken = base64.RawURLEncoding.EncodeToString(secret)
+
+	token := &models.RefreshToken{
+		TokenId:   uuid.New(),
+		UserId:    userId,
+		FamilyId:  familyId,
+		TokenHash: hashToken(pair.RefreshToken),
+		ExpiresAt: pair.RefreshExpiresAt,
+	}
+	if previous != nil {
+		err = a.db.RotateRefreshToken(ctx, previous.String(), token)
+	} else {
+		err = a.db.CreateRefreshToken(ctx, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Refresh tokens and API keys are random, so an unsalted hash is enough to
+// keep a database leak from handing them out.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/synntx/askmind/internal/db"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Authorizer checks a user's access to a resource before a handler touches
+// it. Spaces and sources are shared with the space's members according to
+// their role; conversations and messages stay private to the member who
+// started them. A resource the user can not see is reported as
+// utils.ErrNotFound, exactly like a missing one, so IDs can not be probed; a
+// member whose role is too low gets utils.ErrForbidden.
+type Authorizer interface {
+	// AuthorizeSpace returns the space with Role set to the user's role,
+	// provided that role allows need.
+	AuthorizeSpace(ctx context.Context, userId, spaceId string, need models.SpaceRole) (*models.Space, error)
+	AuthorizeConversation(ctx context.Context, userId, convId string) (*models.Conversation, error)
+	AuthorizeMessage(ctx context.Context, userId, messageId string) (*models.ChatMessage, error)
+	AuthorizeSource(ctx context.Context, userId, sourceId string, need models.SpaceRole) (*models.Source, error)
+	AuthorizePromptTemplate(ctx context.Context, userId, templateId string, need models.SpaceRole) (*models.PromptTemplate, error)
+}
+
+type authorizer struct {
+	db     db.DB
+	logger *zap.Logger
+}
+
+func NewAuthorizer(db db.DB, logger *zap.Logger) *authorizer {
+	return &authorizer{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (a *authorizer) AuthorizeSpace(ctx context.Context, userId, spaceId string, need models.SpaceRole) (*models.Space, error) {
+	role, err := a.spaceRole(ctx, userId, spaceId)
+	if err != nil {
+		return nil, err
+	}
+	if !role.Allows(need) {
+		a.logger.Warn("Space action denied for member role",
+			zap.String("user_id", userId),
+			zap.String("space_id", spaceId),
+			zap.String("role", string(role)),
+			zap.String("required_role", string(need)))
+		return nil, utils.ErrForbidden.Wrap(
+			fmt.Errorf("space %s: role %s required, user is %s", spaceId, need, role),
+		)
+	}
+
+	space, err := a.db.GetSpace(ctx, spaceId)
+	if err != nil {
+		return nil, err
+	}
+	space.Role = role
+	return space, nil
+}
+
+// AuthorizeConversation allows the member who started the conversation, as
+// long as they are still a member of its space.
+func (a *authorizer) AuthorizeConversation(ctx context.Context, userId, convId string) (*models.Conversation, error) {
+	conv, err := a.db.GetConversation(ctx, convId)
+	if err != nil {
+		return nil, err
+	}
+	if conv.UserId.String() != userId {
+		a.denied(userId, "conversation", convId)
+		return nil, utils.ErrNotFound.Wrap(fmt.Errorf("conversation %s: not found", convId))
+	}
+	if _, err := a.spaceRole(ctx, userId, conv.SpaceId.String()); err != nil {
+		if errors.Is(err, utils.ErrNotFound) {
+			return nil, utils.ErrNotFound.Wrap(fmt.Errorf("conversation %s: not found", convId))
+		}
+		return nil, err
+	}
+	return conv, nil
+}
+
+// AuthorizeMessage authorizes a message through the conversation it is in.
+func (a *authorizer) AuthorizeMessage(ctx context.Context, userId, messageId string) (*models.ChatMessage, error) {
+	msg, err := a.db.GetMessage(ctx, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.AuthorizeConversation(ctx, userId, msg.ConversationId.String()); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// AuthorizeSource authorizes a source through the space it belongs to.
+func (a *authorizer) AuthorizeSource(ctx context.Context, userId, sourceId string, need models.SpaceRole) (*models.Source, error) {
+	source, err := a.db.GetSource(ctx, sourceId)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.AuthorizeSpace(ctx, userId, source.SpaceId.String(), need); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// AuthorizePromptTemplate allows the owner of a personal template, and the
+// members of a shared template's space according to need.
+func (a *authorizer) AuthorizePromptTemplate(ctx context.Context, userId, templateId string, need models.SpaceRole) (*models.PromptTemplate, error) {
+	t, err := a.db.GetPromptTemplate(ctx, templateId)
+	if err != nil {
+		return nil, err
+	}
+	if t.SpaceId == nil {
+		if t.UserId == nil || t.UserId.String() != userId {
+			a.denied(userId, "prompt_template", templateId)
+			return nil, utils.ErrNotFound.Wrap(fmt.Errorf("prompt template %s: not found", templateId))
+		}
+		return t, nil
+	}
+	if _, err := a.AuthorizeSpace(ctx, userId, t.SpaceId.String(), need); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// spaceRole returns the user's role in a space. Pending invitations grant
+// nothing, so they count as no membership.
+func (a *authorizer) spaceRole(ctx context.Context, userId, spaceId string) (models.SpaceRole, error) {
+	member, err := a.db.GetSpaceMember(ctx, spaceId, userId)
+	if err != nil && !errors.Is(err, utils.ErrNotFound) {
+		return "", err
+	}
+	if err != nil || member.AcceptedAt == nil {
+		a.denied(userId, "space", spaceId)
+		return "", utils.ErrNotFound.Wrap(fmt.Errorf("space %s: not found", spaceId))
+	}
+	return member.Role, nil
+}
+
+func (a *authorizer) denied(userId, kind, id string) {
+	a.logger.Warn("Access to resource denied",
+		zap.String("user_id", userId),
+		zap.String("resource", kind),
+		zap.String("resource_id", id))
+}
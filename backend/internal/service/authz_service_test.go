@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/db"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+// authzDB holds the few records the authorizer reads. Records it does not
+// hold are not found, as in the database.
+type authzDB struct {
+	db.DB
+	members       map[[2]uuid.UUID]models.SpaceMember // by space and user
+	spaces        map[uuid.UUID]models.Space
+	conversations map[uuid.UUID]models.Conversation
+	messages      map[uuid.UUID]models.ChatMessage
+	sources       map[uuid.UUID]models.Source
+	templates     map[uuid.UUID]models.PromptTemplate
+}
+
+func notFound(op string) error {
+	return utils.ErrNotFound.Wrap(fmt.Errorf("%s: no rows", op))
+}
+
+func find[T any](records map[uuid.UUID]T, id, op string) (*T, error) {
+	key, err := uuid.Parse(id)
+	if err != nil {
+		return nil, notFound(op)
+	}
+	record, ok := records[key]
+	if !ok {
+		return nil, notFound(op)
+	}
+	return &record, nil
+}
+
+func (d *authzDB) GetSpaceMember(_ context.Context, spaceId, userId string) (*models.SpaceMember, error) {
+	member, ok := d.members[[2]uuid.UUID{uuid.MustParse(spaceId), uuid.MustParse(userId)}]
+	if !ok {
+		return nil, notFound("GetSpaceMember")
+	}
+	return &member, nil
+}
+
+func (d *authzDB) GetSpace(_ context.Context, spaceId string) (*models.Space, error) {
+	return find(d.spaces, spaceId, "GetSpace")
+}
+
+func (d *authzDB) GetConversation(_ context.Context, convId string) (*models.Conversation, error) {
+	return find(d.conversations, convId, "GetConversation")
+}
+
+func (d *authzDB) GetMessage(_ context.Context, messageId string) (*models.ChatMessage, error) {
+	return find(d.messages, messageId, "GetMessage")
+}
+
+func (d *authzDB) GetSource(_ context.Context, sourceId string) (*models.Source, error) {
+	return find(d.sources, sourceId, "GetSource")
+}
+
+func (d *authzDB) GetPromptTemplate(_ context.Context, templateId string) (*models.PromptTemplate, error) {
+	return find(d.templates, templateId, "GetPromptTemplate")
+}
+
+// expected HTTP status per user; 200 when access is granted
+type access struct {
+	owner, editor, viewer, invited, stranger int
+}
+
+const (
+	granted   = http.StatusOK
+	forbidden = http.StatusForbidden
+	hidden    = http.StatusNotFound // as if it did not exist
+)
+
+func TestAuthorizer(t *testing.T) {
+	owner, editor, viewer, invited, stranger, former := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	users := []struct {
+		name string
+		id   uuid.UUID
+		want func(access) int
+	}{
+		{"owner", owner, func(a access) int { return a.owner }},
+		{"editor", editor, func(a access) int { return a.editor }},
+		{"viewer", viewer, func(a access) int { return a.viewer }},
+		{"invited", invited, func(a access) int { return a.invited }},
+		{"stranger", stranger, func(a access) int { return a.stranger }},
+	}
+
+	space, otherSpace := uuid.New(), uuid.New()
+	accepted := time.Now()
+	member := func(user uuid.UUID, role models.SpaceRole, acceptedAt *time.Time) models.SpaceMember {
+		return models.SpaceMember{SpaceId: space, UserId: user, Role: role, AcceptedAt: acceptedAt}
+	}
+
+	editorsConv, formersConv := uuid.New(), uuid.New()
+	editorsMsg := uuid.New()
+	source := uuid.New()
+	sharedTemplate, personalTemplate := uuid.New(), uuid.New()
+
+	fake := &authzDB{
+		members: map[[2]uuid.UUID]models.SpaceMember{
+			{space, owner}:   member(owner, models.SpaceRoleOwner, &accepted),
+			{space, editor}:  member(editor, models.SpaceRoleEditor, &accepted),
+			{space, viewer}:  member(viewer, models.SpaceRoleViewer, &accepted),
+			{space, invited}: member(invited, models.SpaceRoleEditor, nil),
+			// the stranger owns a space of their own
+			{otherSpace, stranger}: {SpaceId: otherSpace, UserId: stranger, Role: models.SpaceRoleOwner, AcceptedAt: &accepted},
+		},
+		spaces: map[uuid.UUID]models.Space{
+			space:      {SpaceId: space, UserId: owner},
+			otherSpace: {SpaceId: otherSpace, UserId: stranger},
+		},
+		conversations: map[uuid.UUID]models.Conversation{
+			editorsConv: {ConversationId: editorsConv, SpaceId: space, UserId: editor},
+			// started by a member who has since left the space
+			formersConv: {ConversationId: formersConv, SpaceId: space, UserId: former},
+		},
+		messages: map[uuid.UUID]models.ChatMessage{
+			editorsMsg: {MessageId: editorsMsg, ConversationId: editorsConv},
+		},
+		sources: map[uuid.UUID]models.Source{
+			source: {SourceId: source, SpaceId: space},
+		},
+		templates: map[uuid.UUID]models.PromptTemplate{
+			sharedTemplate:   {TemplateId: sharedTemplate, SpaceId: &space},
+			personalTemplate: {TemplateId: personalTemplate, UserId: &viewer},
+		},
+	}
+	authz := NewAuthorizer(fake, zap.NewNop())
+	missing := uuid.NewString()
+
+	type check func(ctx context.Context, userId string) error
+	spaceAction := func(id string, need models.SpaceRole) check {
+		return func(ctx context.Context, userId string) error {
+			space, err := authz.AuthorizeSpace(ctx, userId, id, need)
+			if err == nil && space.Role == "" {
+				return errors.New("space returned without the user's role")
+			}
+			return err
+		}
+	}
+	sourceAction := func(id string, need models.SpaceRole) check {
+		return func(ctx context.Context, userId string) error {
+			_, err := authz.AuthorizeSource(ctx, userId, id, need)
+			return err
+		}
+	}
+	templateAction := func(id string, need models.SpaceRole) check {
+		return func(ctx context.Context, userId string) error {
+			_, err := authz.AuthorizePromptTemplate(ctx, userId, id, need)
+			return err
+		}
+	}
+	conversation := func(id string) check {
+		return func(ctx context.Context, userId string) error {
+			_, err := authz.AuthorizeConversation(ctx, userId, id)
+			return err
+		}
+	}
+	message := func(id string) check {
+		return func(ctx context.Context, userId string) error {
+			_, err := authz.AuthorizeMessage(ctx, userId, id)
+			return err
+		}
+	}
+
+	// what every role of a space may do to it and what belongs to it
+	read := access{owner: granted, editor: granted, viewer: granted, invited: hidden, stranger: hidden}
+	write := access{owner: granted, editor: granted, viewer: forbidden, invited: hidden, stranger: hidden}
+	manage := access{owner: granted, editor: forbidden, viewer: forbidden, invited: hidden, stranger: hidden}
+	nobody := access{owner: hidden, editor: hidden, viewer: hidden, invited: hidden, stranger: hidden}
+
+	tests := []struct {
+		name  string
+		check check
+		want  access
+	}{
+		{"read space", spaceAction(space.String(), models.SpaceRoleViewer), read},
+		{"edit space", spaceAction(space.String(), models.SpaceRoleEditor), write},
+		{"manage space", spaceAction(space.String(), models.SpaceRoleOwner), manage},
+		{"missing space", spaceAction(missing, models.SpaceRoleViewer), nobody},
+
+		{"read source", sourceAction(source.String(), models.SpaceRoleViewer), read},
+		{"edit source", sourceAction(source.String(), models.SpaceRoleEditor), write},
+		{"missing source", sourceAction(missing, models.SpaceRoleViewer), nobody},
+
+		{"use shared template", templateAction(sharedTemplate.String(), models.SpaceRoleViewer), read},
+		{"edit shared template", templateAction(sharedTemplate.String(), models.SpaceRoleEditor), write},
+		// personal templates belong to their owner only, whatever the role asked
+		{"use personal template", templateAction(personalTemplate.String(), models.SpaceRoleViewer),
+			access{owner: hidden, editor: hidden, viewer: granted, invited: hidden, stranger: hidden}},
+		{"edit personal template", templateAction(personalTemplate.String(), models.SpaceRoleEditor),
+			access{owner: hidden, editor: hidden, viewer: granted, invited: hidden, stranger: hidden}},
+		{"missing template", templateAction(missing, models.SpaceRoleViewer), nobody},
+
+		// conversations are private to the member who started them, even
+		// from the space's owner
+		{"own conversation", conversation(editorsConv.String()),
+			access{owner: hidden, editor: granted, viewer: hidden, invited: hidden, stranger: hidden}},
+		{"message of own conversation", message(editorsMsg.String()),
+			access{owner: hidden, editor: granted, viewer: hidden, invited: hidden, stranger: hidden}},
+		{"conversation of a former member", conversation(formersConv.String()), nobody},
+		{"missing conversation", conversation(missing), nobody},
+		{"missing message", message(missing), nobody},
+	}
+
+	for _, tt := range tests {
+		for _, user := range users {
+			t.Run(tt.name+"/"+user.name, func(t *testing.T) {
+				got := status(tt.check(context.Background(), user.id.String()))
+				if want := user.want(tt.want); got != want {
+					t.Errorf("status %d, want %d", got, want)
+				}
+			})
+		}
+	}
+
+	// once out of the space, its former members lose their own conversations too
+	if got := status(conversation(formersConv.String())(context.Background(), former.String())); got != hidden {
+		t.Errorf("former member's own conversation: status %d, want %d", got, hidden)
+	}
+}
+
+// status is the HTTP status utils.HandleError answers err with.
+func status(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	var appErr utils.AppError
+	if !errors.As(err, &appErr) {
+		return http.StatusInternalServerError
+	}
+	return appErr.HTTPStatus
+}
@@ -14,7 +14,7 @@ type ConversationService interface {
 	UpdateConversationTitle(ctx context.Context, convId string, title string) error
 	UpdateConversationStatus(ctx context.Context, convId string, status models.ConversationStatus) error
 	DeleteConversation(ctx context.Context, convId string) error
-	ListConversationsForSpace(ctx context.Context, spaceId string) ([]models.Conversation, error)
+	ListConversationsForSpace(ctx context.Context, userId, spaceId string) ([]models.Conversation, error)
 	ListActiveConversationsForUser(ctx context.Context, userId string) ([]models.Conversation, error)
 }
 
@@ -50,8 +50,8 @@ func (c *conversationService) DeleteConversation(ctx context.Context, convId str
 	return c.db.DeleteConversation(ctx, convId)
 }
 
-func (c *conversationService) ListConversationsForSpace(ctx context.Context, spaceId string) ([]models.Conversation, error) {
-	return c.db.ListConversationsForSpace(ctx, spaceId)
+func (c *conversationService) ListConversationsForSpace(ctx context.Context, userId, spaceId string) ([]models.Conversation, error) {
+	return c.db.ListConversationsForSpace(ctx, userId, spaceId)
 }
 
 func (c *conversationService) ListActiveConversationsForUser(ctx context.Context, userId string) ([]models.Conversation, error) {
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/synntx/askmind/internal/db"
+	"github.com/synntx/askmind/internal/llm"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/processing"
+	"github.com/synntx/askmind/internal/prompts"
+	"go.uber.org/zap"
+)
+
+const (
+	// context window assumed for models whose provider does not report one
+	defaultContextWindow = 8192
+	// role and framing tokens each message costs on top of its content
+	messageOverheadTokens = 4
+	// longest message, in runes, given to the summarizer; tool results in
+	// particular can be whole pages
+	summaryMessageRunes = 2000
+	// the question the summary answers when it is put in front of history
+	summaryRequest = "Summarize our conversation so far."
+)
+
+// HistoryBudgeter fits a conversation's history into the share of a model's
+// context window set aside for it: half the window, the rest being left to
+// the system prompt, retrieved sources, tool results and the answer.
+//
+// The latest turns are kept verbatim. The turns before them are folded into a
+// rolling summary, written by the answering model and stored on the
+// conversation along with the last message it covers, so later turns only
+// summarize what has newly fallen out of the window.
+type HistoryBudgeter interface {
+	// Fit returns history unchanged if it fits, otherwise its latest turns
+	// preceded by the summary of the earlier ones as a question and answer.
+	// contextWindow is 0 when unknown. Summarizing is best effort: if it
+	// fails, the earlier turns are dropped.
+	Fit(ctx context.Context, convId string, history []models.ChatMessage, contextWindow int, summarizer llm.LLM) []models.ChatMessage
+}
+
+type historyBudgeter struct {
+	db        db.DB
+	maxTokens int // cap on the history budget, however large the window; 0 for none
+	logger    *zap.Logger
+}
+
+func NewHistoryBudgeter(db db.DB, maxTokens int, logger *zap.Logger) *historyBudgeter {
+	return &historyBudgeter{
+		db:        db,
+		maxTokens: maxTokens,
+		logger:    logger,
+	}
+}
+
+func (hb *historyBudgeter) Fit(ctx context.Context, convId string, history []models.ChatMessage, contextWindow int, summarizer llm.LLM) []models.ChatMessage {
+	budget := hb.budget(contextWindow)
+	if historyTokens(history) <= budget {
+		return history
+	}
+
+	// A quarter of the budget is left for the summary.
+	summaryBudget := budget / 4
+	cut := keepFrom(history, budget-summaryBudget)
+	dropped, kept := history[:cut], history[cut:]
+
+	summary := hb.summarize(ctx, convId, dropped, budget, summaryBudget, summarizer)
+	hb.logger.Info("History over budget",
+		zap.String("conv_id", convId),
+		zap.Int("budget_tokens", budget),
+		zap.Int("summarized_messages", len(dropped)),
+		zap.Int("kept_messages", len(kept)),
+		zap.Bool("summary", summary != ""))
+	if summary == "" {
+		return kept
+	}
+
+	fitted := make([]models.ChatMessage, 0, len(kept)+2)
+	fitted = append(fitted,
+		models.ChatMessage{Role: models.RoleUser, Content: summaryRequest},
+		models.ChatMessage{Role: models.RoleAssistant, Content: summary},
+	)
+	return append(fitted, kept...)
+}
+
+func (hb *historyBudgeter) budget(contextWindow int) int {
+	if contextWindow <= 0 {
+		contextWindow = defaultContextWindow
+	}
+	budget := contextWindow / 2
+	if hb.maxTokens > 0 && budget > hb.maxTokens {
+		budget = hb.maxTokens
+	}
+	return budget
+}
+
+// summarize returns the conversation's summary brought up to date with
+// dropped, the messages that no longer fit, or "" if there is none.
+func (hb *historyBudgeter) summarize(ctx context.Context, convId string, dropped []models.ChatMessage, transcriptBudget, summaryBudget int, summarizer llm.LLM) string {
+	if len(dropped) == 0 {
+		return ""
+	}
+
+	conv, err := hb.db.GetConversation(ctx, convId)
+	if err != nil {
+		hb.logger.Warn("Failed to load conversation summary", zap.Error(err), zap.String("conv_id", convId))
+		return ""
+	}
+
+	// The stored summary only helps if it covers the start of dropped: the
+	// active branch may have changed since it was written.
+	previous, from := "", 0
+	if conv.Summary != "" && conv.SummaryMessageId != nil {
+		for i, msg := range dropped {
+			if msg.MessageId == *conv.SummaryMessageId {
+				previous, from = conv.Summary, i+1
+				break
+			}
+		}
+	}
+	if from == len(dropped) {
+		return previous
+	}
+
+	prompt, err := prompts.RenderSummary(prompts.SummaryData{
+		Previous:   previous,
+		Transcript: transcript(dropped[from:], transcriptBudget),
+		MaxWords:   summaryBudget * 3 / 4,
+	})
+	if err != nil {
+		hb.logger.Error("Failed to render summary prompt", zap.Error(err))
+		return previous
+	}
+
+	summary, err := summarizer.GenerateContent(ctx, prompt)
+	summary = strings.TrimSpace(summary)
+	if err != nil || summary == "" {
+		// an outdated summary is still better than none
+		hb.logger.Warn("Failed to summarize history", zap.Error(err), zap.String("conv_id", convId))
+		return previous
+	}
+
+	through := dropped[len(dropped)-1].MessageId.String()
+	if err := hb.db.UpdateConversationSummary(ctx, convId, summary, through); err != nil {
+		hb.logger.Warn("Failed to save conversation summary", zap.Error(err), zap.String("conv_id", convId))
+	}
+	return summary
+}
+
+// keepFrom returns the index of the first message to keep: the start of the
+// oldest turn from which the rest of history fits within budget, or
+// len(history) if not even the last turn does.
+func keepFrom(history []models.ChatMessage, budget int) int {
+	cut, used := len(history), 0
+	for i := len(history) - 1; i >= 0; i-- {
+		used += messageTokens(history[i])
+		if used > budget {
+			break
+		}
+		if history[i].Role == models.RoleUser {
+			cut = i
+		}
+	}
+	return cut
+}
+
+// transcript renders messages for the summarizer, newest kept first when they
+// do not all fit within budget.
+func transcript(messages []models.ChatMessage, budget int) string {
+	var lines []string
+	used := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		line := transcriptLine(messages[i])
+		used += processing.EstimateTokens(line)
+		if used > budget {
+			lines = append(lines, "(earlier messages omitted)")
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return strings.Join(lines, "\n\n")
+}
+
+func transcriptLine(msg models.ChatMessage) string {
+	content := msg.Content
+	if utf8.RuneCountInString(content) > summaryMessageRunes {
+		content = string([]rune(content)[:summaryMessageRunes]) + " [...]"
+	}
+	switch msg.Role {
+	case models.RoleUser:
+		return "User: " + content
+	case models.RoleAssistant:
+		return "Assistant: " + content
+	case models.RoleTool:
+		if msg.ToolCall != nil {
+			return fmt.Sprintf("Tool %s returned: %s", msg.ToolCall.Name, content)
+		}
+		return "Tool returned: " + content
+	default:
+		return fmt.Sprintf("%s: %s", msg.Role, content)
+	}
+}
+
+func historyTokens(history []models.ChatMessage) int {
+	tokens := 0
+	for _, msg := range history {
+		tokens += messageTokens(msg)
+	}
+	return tokens
+}
+
+func messageTokens(msg models.ChatMessage) int {
+	return processing.EstimateTokens(msg.Content) + messageOverheadTokens
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/db"
+	"github.com/synntx/askmind/internal/llm"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/processing"
+	"github.com/synntx/askmind/internal/prompts"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	memoryExtractionTimeout = 2 * time.Minute
+	// memories are extracted after the first exchange of a conversation,
+	// then from every this many exchanges
+	memoryExtractionTurns = 4
+	// longest memory, in runes, a user may write or a model may extract
+	maxMemoryLength = 500
+	// most facts remembered from one extraction
+	maxExtractedMemories = 5
+	// memories shown to the extractor so it does not repeat them
+	knownMemoriesLimit = 10
+	// an extracted fact this similar to a memory replaces it instead of being
+	// added next to it: it is the same fact, possibly changed
+	duplicateMemorySimilarity = 0.9
+)
+
+type MemoryService interface {
+	ListMemories(ctx context.Context, userId string) ([]models.Memory, error)
+	CreateMemory(ctx context.Context, userId string, req *models.MemoryRequest) (*models.Memory, error)
+	UpdateMemory(ctx context.Context, userId, memoryId string, req *models.MemoryRequest) (*models.Memory, error)
+	DeleteMemory(ctx context.Context, userId, memoryId string) error
+	DeleteAllMemories(ctx context.Context, userId string) error
+	// RecallMemories returns the user's memories most related to query.
+	RecallMemories(ctx context.Context, userId, query string, limit int) ([]models.Memory, error)
+	// ExtractMemories remembers the facts about the user revealed by the
+	// exchanges since the last extraction, when the assistant message
+	// messageId ends the first exchange of its branch or one in every
+	// memoryExtractionTurns after that. It asks the given model, counting the
+	// tokens in the user's usage, unless the user is over their daily quota.
+	// It runs in the background; failures are logged.
+	ExtractMemories(userId, messageId string, provider llm.ProviderType, model string)
+	// Wait blocks until the running extractions are done or ctx is.
+	Wait(ctx context.Context) error
+}
+
+type memoryService struct {
+	db                db.DB
+	usage             UsageService
+	llmFactory        llm.LLMFactory
+	embeddingProvider llm.ProviderType
+	embeddingModel    string
+	running           sync.WaitGroup
+	logger            *zap.Logger
+}
+
+// NewMemoryService embeds memories with the same model as sources, so both
+// live in vectors of the same size.
+func NewMemoryService(db db.DB, usage UsageService, llmFactory llm.LLMFactory, embeddingProvider llm.ProviderType, embeddingModel string, logger *zap.Logger) *memoryService {
+	return &memoryService{
+		db:                db,
+		usage:             usage,
+		llmFactory:        llmFactory,
+		embeddingProvider: embeddingProvider,
+		embeddingModel:    embeddingModel,
+		logger:            logger,
+	}
+}
+
+func (s *memoryService) ListMemories(ctx context.Context, userId string) ([]models.Memory, error) {
+	return s.db.ListMemories(ctx, userId)
+}
+
+func (s *memoryService) CreateMemory(ctx context.Context, userId string, req *models.MemoryRequest) (*models.Memory, error) {
+	content, err := validateMemoryContent(req.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	userUUID, err := uuid.Parse(userId)
+	if err != nil {
+		return nil, utils.ErrUnauthorized.Wrap(err)
+	}
+
+	embedding, err := s.embed(ctx, content)
+	if err != nil {
+		return nil, utils.ErrLLMServiceUnavailable.Wrap(err)
+	}
+
+	memory := &models.Memory{
+		UserId:    userUUID,
+		Content:   content,
+		Embedding: embedding,
+	}
+	if err := s.db.CreateMemory(ctx, memory); err != nil {
+		return nil, err
+	}
+	return memory, nil
+}
+
+func (s *memoryService) UpdateMemory(ctx context.Context, userId, memoryId string, req *models.MemoryRequest) (*models.Memory, error) {
+	content, err := validateMemoryContent(req.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	embedding, err := s.embed(ctx, content)
+	if err != nil {
+		return nil, utils.ErrLLMServiceUnavailable.Wrap(err)
+	}
+
+	return s.db.UpdateMemory(ctx, userId, memoryId, content, embedding)
+}
+
+func (s *memoryService) DeleteMemory(ctx context.Context, userId, memoryId string) error {
+	return s.db.DeleteMemory(ctx, userId, memoryId)
+}
+
+func (s *memoryService) DeleteAllMemories(ctx context.Context, userId string) error {
+	return s.db.DeleteUserMemories(ctx, userId)
+}
+
+func (s *memoryService) RecallMemories(ctx context.Context, userId, query string, limit int) ([]models.Memory, error) {
+	embedding, err := s.embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+	return s.db.FindSimilarMemories(ctx, userId, embedding, limit)
+}
+
+func (s *memoryService) ExtractMemories(userId, messageId string, provider llm.ProviderType, model string) {
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		s.extract(userId, messageId, provider, model)
+	}()
+}
+
+func (s *memoryService) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// extract runs detached from the completion that triggered it, so it uses its
+// own context.
+func (s *memoryService) extract(userId, messageId string, provider llm.ProviderType, model string) {
+	ctx, cancel := context.WithTimeout(context.Background(), memoryExtractionTimeout)
+	defer cancel()
+
+	logger := s.logger.With(zap.String("user_id", userId), zap.String("message_id", messageId))
+
+	path, err := s.db.GetMessagePath(ctx, messageId)
+	if err != nil {
+		logger.Warn("Memory extraction: failed to load exchange", zap.Error(err))
+		return
+	}
+	exchanges := exchangesToExtract(path, memoryExtractionTurns)
+	if len(exchanges) == 0 {
+		return
+	}
+	if _, err := s.usage.CheckDailyQuota(ctx, userId); err != nil {
+		logger.Info("Memory extraction skipped", zap.Error(err))
+		return
+	}
+
+	var userMessages []string
+	for _, msg := range exchanges {
+		if msg.Role == models.RoleUser {
+			userMessages = append(userMessages, msg.Content)
+		}
+	}
+	queryEmbedding, err := s.embed(ctx, strings.Join(userMessages, "\n\n"))
+	if err != nil {
+		logger.Warn("Memory extraction: failed to embed user messages", zap.Error(err))
+		return
+	}
+	related, err := s.db.FindSimilarMemories(ctx, userId, queryEmbedding, knownMemoriesLimit)
+	if err != nil {
+		logger.Warn("Memory extraction: failed to load known memories", zap.Error(err))
+		return
+	}
+	known := make([]string, len(related))
+	for i, memory := range related {
+		known[i] = memory.Content
+	}
+
+	lines := make([]string, len(exchanges))
+	for i, msg := range exchanges {
+		lines[i] = transcriptLine(msg)
+	}
+	prompt, err := prompts.RenderMemoryExtraction(prompts.MemoryExtractionData{
+		Known:      known,
+		Transcript: strings.Join(lines, "\n\n"),
+		MaxFacts:   maxExtractedMemories,
+	})
+	if err != nil {
+		logger.Error("Memory extraction: failed to render prompt", zap.Error(err))
+		return
+	}
+
+	extractor, err := s.llmFactory.CreateLLM(ctx, provider, model)
+	if err != nil {
+		logger.Warn("Memory extraction: failed to create LLM", zap.Error(err))
+		return
+	}
+	conversationId := exchanges[0].ConversationId
+	reply, usage, err := generate(ctx, extractor, prompt)
+	s.recordUsage(ctx, logger, userId, conversationId, extractor.GetModelName(), usage)
+	if err != nil {
+		logger.Warn("Memory extraction: LLM failed", zap.Error(err))
+		return
+	}
+	facts, err := parseFacts(reply)
+	if err != nil {
+		logger.Warn("Memory extraction: unexpected reply", zap.Error(err))
+		return
+	}
+
+	remembered := 0
+	for _, fact := range facts {
+		if err := s.remember(ctx, userId, conversationId, fact); err != nil {
+			logger.Warn("Memory extraction: failed to save memory", zap.Error(err))
+			continue
+		}
+		remembered++
+	}
+	if remembered > 0 {
+		logger.Info("Memories extracted", zap.Int("count", remembered))
+	}
+}
+
+// generate returns the reply of m to prompt. It goes through the streaming
+// API, the one that reports the tokens used, with tools turned off. The
+// usage is estimated if the provider does not report it.
+func generate(ctx context.Context, m llm.LLM, prompt string) (string, llm.Usage, error) {
+	m.SetOptions(llm.Options{Tools: []string{}})
+
+	var reply strings.Builder
+	var usage *llm.Usage
+	var err error
+	for chunk := range m.GenerateContentStream(ctx, nil, prompt) {
+		if chunk.Err != nil {
+			err = chunk.Err
+			break
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		reply.WriteString(chunk.Content)
+	}
+
+	if usage == nil {
+		usage = &llm.Usage{}
+		usage.Add(processing.EstimateTokens(prompt), processing.EstimateTokens(reply.String()))
+	}
+	return reply.String(), *usage, err
+}
+
+// recordUsage counts the tokens of an extraction in the user's usage. The
+// memories are worth keeping even if this fails, so it is only logged.
+func (s *memoryService) recordUsage(ctx context.Context, logger *zap.Logger, userId string, conversationId uuid.UUID, model string, usage llm.Usage) {
+	userUUID, err := uuid.Parse(userId)
+	if err != nil {
+		logger.Warn("Memory extraction: failed to record usage", zap.Error(err))
+		return
+	}
+	err = s.db.RecordUsage(ctx, &models.UsageRecord{
+		UserId:           userUUID,
+		ConversationId:   &conversationId,
+		Kind:             models.UsageKindMemoryExtraction,
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	})
+	if err != nil {
+		logger.Warn("Memory extraction: failed to record usage", zap.Error(err))
+	}
+}
+
+// remember saves an extracted fact, replacing the memory it restates if
+// there is one.
+func (s *memoryService) remember(ctx context.Context, userId string, conversationId uuid.UUID, fact string) error {
+	embedding, err := s.embed(ctx, fact)
+	if err != nil {
+		return err
+	}
+
+	nearest, err := s.db.FindSimilarMemories(ctx, userId, embedding, 1)
+	if err != nil {
+		return err
+	}
+	if len(nearest) > 0 && nearest[0].Similarity >= duplicateMemorySimilarity {
+		_, err := s.db.UpdateMemory(ctx, userId, nearest[0].MemoryId.String(), fact, embedding)
+		return err
+	}
+
+	userUUID, err := uuid.Parse(userId)
+	if err != nil {
+		return err
+	}
+	return s.db.CreateMemory(ctx, &models.Memory{
+		UserId:         userUUID,
+		Content:        fact,
+		ConversationId: &conversationId,
+		Embedding:      embedding,
+	})
+}
+
+func (s *memoryService) embed(ctx context.Context, text string) ([]float32, error) {
+	embedder, err := s.llmFactory.CreateLLM(ctx, s.embeddingProvider, s.embeddingModel)
+	if err != nil {
+		return nil, fmt.Errorf("create embedding model: %w", err)
+	}
+	return embedder.GenerateEmbeddings(ctx, text)
+}
+
+// exchangesToExtract returns the user and assistant messages to extract
+// memories from when path ends with an answer: the first exchange, then every
+// `every` exchanges those since the previous extraction. For the exchanges in
+// between it returns nil. Tool results are left out: they are about the
+// world, not the user.
+func exchangesToExtract(path []models.ChatMessage, every int) []models.ChatMessage {
+	var starts []int
+	for i, msg := range path {
+		if msg.Role == models.RoleUser {
+			starts = append(starts, i)
+		}
+	}
+	turns := len(starts)
+	if turns == 0 || (turns-1)%every != 0 {
+		return nil
+	}
+
+	var exchanges []models.ChatMessage
+	for _, msg := range path[starts[max(0, turns-every)]:] {
+		if msg.Role == models.RoleUser || msg.Role == models.RoleAssistant {
+			exchanges = append(exchanges, msg)
+		}
+	}
+	return exchanges
+}
+
+// parseFacts reads the JSON array of facts the extraction prompt asks for,
+// tolerating text or a code fence around it.
+func parseFacts(reply string) ([]string, error) {
+	start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON array in %q", reply)
+	}
+
+	var raw []string
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("parse facts: %w", err)
+	}
+
+	var facts []string
+	for _, fact := range raw {
+		fact = strings.TrimSpace(fact)
+		if fact == "" || utf8.RuneCountInString(fact) > maxMemoryLength {
+			continue
+		}
+		facts = append(facts, fact)
+		if len(facts) == maxExtractedMemories {
+			break
+		}
+	}
+	return facts, nil
+}
+
+func validateMemoryContent(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required field content"),
+		).WithDetails(utils.ValidationError{
+			Field:   "content",
+			Message: "'content' is required",
+		})
+	}
+	if utf8.RuneCountInString(content) > maxMemoryLength {
+		return "", utils.ErrValidation.Wrap(
+			fmt.Errorf("memory too long"),
+		).WithDetails(utils.ValidationError{
+			Field:   "content",
+			Message: fmt.Sprintf("'content' can be at most %d characters", maxMemoryLength),
+		})
+	}
+	return content, nil
+}
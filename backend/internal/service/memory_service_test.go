@@ -0,0 +1,60 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/synntx/askmind/internal/models"
+)
+
+// conversation returns a branch of n exchanges, the first and fourth of
+// which used a tool.
+func conversation(n int) []models.ChatMessage {
+	var path []models.ChatMessage
+	for i := 1; i <= n; i++ {
+		path = append(path, models.ChatMessage{Role: models.RoleUser, Content: fmt.Sprintf("question %d", i)})
+		if i == 1 || i == 4 {
+			path = append(path, models.ChatMessage{Role: models.RoleTool, Content: "tool result"})
+		}
+		path = append(path, models.ChatMessage{Role: models.RoleAssistant, Content: fmt.Sprintf("answer %d", i)})
+	}
+	return path
+}
+
+func TestExchangesToExtract(t *testing.T) {
+	tests := []struct {
+		turns int
+		want  []string // contents of the messages to extract from, nil to skip
+	}{
+		{turns: 1, want: []string{"question 1", "answer 1"}},
+		{turns: 2},
+		{turns: 3},
+		{turns: 4},
+		{turns: 5, want: []string{
+			"question 2", "answer 2", "question 3", "answer 3",
+			"question 4", "answer 4", "question 5", "answer 5",
+		}},
+		{turns: 6},
+		{turns: 9, want: []string{
+			"question 6", "answer 6", "question 7", "answer 7",
+			"question 8", "answer 8", "question 9", "answer 9",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d turns", tt.turns), func(t *testing.T) {
+			var got []string
+			for _, msg := range exchangesToExtract(conversation(tt.turns), 4) {
+				got = append(got, msg.Content)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := exchangesToExtract(nil, 4); got != nil {
+		t.Errorf("empty path: got %v, want nil", got)
+	}
+}
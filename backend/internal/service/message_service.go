@@ -14,6 +14,11 @@ type MessageService interface {
 	GetMessage(ctx context.Context, messageId string) (*models.ChatMessage, error)
 	GetConversationMessages(ctx context.Context, convId string) ([]models.ChatMessage, error)
 	GetConversationUserMessages(ctx context.Context, convId string) ([]models.ChatMessage, error)
+	GetMessagePath(ctx context.Context, messageId string) ([]models.ChatMessage, error)
+	GetMessageSiblings(ctx context.Context, messageId string) ([]models.ChatMessage, error)
+	SetActiveBranch(ctx context.Context, messageId string) error
+	CreateMessageReferences(ctx context.Context, refs []models.MessageReference) error
+	GetMessageReferences(ctx context.Context, messageId string) ([]models.MessageReference, error)
 }
 
 type messageService struct {
@@ -47,3 +52,26 @@ func (ms *messageService) GetConversationMessages(ctx context.Context, convId st
 func (ms *messageService) GetConversationUserMessages(ctx context.Context, convId string) ([]models.ChatMessage, error) {
 	return ms.db.GetConversationUserMessages(ctx, convId)
 }
+
+func (ms *messageService) GetMessagePath(ctx context.Context, messageId string) ([]models.ChatMessage, error) {
+	return ms.db.GetMessagePath(ctx, messageId)
+}
+
+func (ms *messageService) GetMessageSiblings(ctx context.Context, messageId string) ([]models.ChatMessage, error) {
+	return ms.db.GetMessageSiblings(ctx, messageId)
+}
+
+func (ms *messageService) SetActiveBranch(ctx context.Context, messageId string) error {
+	return ms.db.SetActiveBranch(ctx, messageId)
+}
+
+func (ms *messageService) CreateMessageReferences(ctx context.Context, refs []models.MessageReference) error {
+	if len(refs) == 0 {
+		return nil
+	}
+	return ms.db.CreateMessageReferences(ctx, refs)
+}
+
+func (ms *messageService) GetMessageReferences(ctx context.Context, messageId string) ([]models.MessageReference, error) {
+	return ms.db.GetMessageReferences(ctx, messageId)
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/db"
+	"github.com/synntx/askmind/internal/llm"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/prompts"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+// longest prompt template, in runes
+const maxPromptTemplateLength = 20000
+
+// prompt names are what completions pass as system_prompt
+var promptNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+type PromptService interface {
+	// CreateTemplate creates a personal template, or a shared one when
+	// req.SpaceId is set; the caller checks the user may edit that space.
+	CreateTemplate(ctx context.Context, userId string, req *models.CreatePromptTemplateRequest) (*models.PromptTemplate, error)
+	// ListTemplates returns the user's templates and, when spaceId is not
+	// empty, the space's.
+	ListTemplates(ctx context.Context, userId, spaceId string) ([]models.PromptTemplate, error)
+	UpdateTemplate(ctx context.Context, t *models.PromptTemplate, req *models.UpdatePromptTemplateRequest) (*models.PromptTemplate, error)
+	DeleteTemplate(ctx context.Context, templateId string) error
+	// ListPromptNames returns every name a completion in the space can use as
+	// its system prompt: the built-in prompts and the templates of
+	// ListTemplates.
+	ListPromptNames(ctx context.Context, userId, spaceId string) ([]string, error)
+	// Render renders the prompt called name for a completion of the user in
+	// the space: their own template of that name, else the space's, else the
+	// built-in one. The user, space and tools of data are filled in.
+	Render(ctx context.Context, userId, spaceId, name string, data prompts.Data) (string, error)
+}
+
+type promptService struct {
+	db         db.DB
+	llmFactory llm.LLMFactory
+	logger     *zap.Logger
+}
+
+func NewPromptService(db db.DB, llmFactory llm.LLMFactory, logger *zap.Logger) *promptService {
+	return &promptService{
+		db:         db,
+		llmFactory: llmFactory,
+		logger:     logger,
+	}
+}
+
+func (s *promptService) CreateTemplate(ctx context.Context, userId string, req *models.CreatePromptTemplateRequest) (*models.PromptTemplate, error) {
+	t := &models.PromptTemplate{
+		SpaceId:     req.SpaceId,
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		Content:     req.Content,
+	}
+	if t.SpaceId == nil {
+		userUUID, err := uuid.Parse(userId)
+		if err != nil {
+			return nil, utils.ErrUnauthorized.Wrap(err)
+		}
+		t.UserId = &userUUID
+	}
+	if err := validatePromptTemplate(t); err != nil {
+		return nil, err
+	}
+
+	created, err := s.db.CreatePromptTemplate(ctx, t)
+	if err != nil {
+		return nil, promptNameConflict(err, t.Name)
+	}
+	return created, nil
+}
+
+func (s *promptService) ListTemplates(ctx context.Context, userId, spaceId string) ([]models.PromptTemplate, error) {
+	return s.db.ListPromptTemplates(ctx, userId, spaceId)
+}
+
+func (s *promptService) UpdateTemplate(ctx context.Context, t *models.PromptTemplate, req *models.UpdatePromptTemplateRequest) (*models.PromptTemplate, error) {
+	if req.Name == nil && req.Description == nil && req.Content == nil {
+		return nil, utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required fields"),
+		).WithDetails(utils.ValidationError{
+			Field:   "name,description,content",
+			Message: "Please provide a new name, description or content for the update",
+		})
+	}
+
+	updated := *t
+	if req.Name != nil {
+		updated.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		updated.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Content != nil {
+		updated.Content = *req.Content
+	}
+	if err := validatePromptTemplate(&updated); err != nil {
+		return nil, err
+	}
+
+	saved, err := s.db.UpdatePromptTemplate(ctx, &updated)
+	if err != nil {
+		return nil, promptNameConflict(err, updated.Name)
+	}
+	return saved, nil
+}
+
+func (s *promptService) DeleteTemplate(ctx context.Context, templateId string) error {
+	return s.db.DeletePromptTemplate(ctx, templateId)
+}
+
+func (s *promptService) ListPromptNames(ctx context.Context, userId, spaceId string) ([]string, error) {
+	templates, err := s.db.ListPromptTemplates(ctx, userId, spaceId)
+	if err != nil {
+		return nil, err
+	}
+	names := prompts.List()
+	for _, t := range templates {
+		names = append(names, t.Name)
+	}
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
+
+func (s *promptService) Render(ctx context.Context, userId, spaceId, name string, data prompts.Data) (string, error) {
+	t, err := s.db.FindPromptTemplate(ctx, userId, spaceId, name)
+	if err != nil && !errors.Is(err, utils.ErrNotFound) {
+		return "", err
+	}
+
+	s.fillContext(ctx, userId, spaceId, &data)
+
+	if t == nil {
+		text, err := prompts.Render(name, data)
+		if errors.Is(err, prompts.ErrUnknownPrompt) {
+			return "", utils.ErrValidation.Wrap(err).WithDetails(utils.ValidationError{
+				Field:   "system_prompt",
+				Message: fmt.Sprintf("there is no prompt named %q", name),
+			})
+		}
+		if err != nil {
+			return "", utils.ErrInternal.Wrap(err)
+		}
+		return text, nil
+	}
+
+	text, err := prompts.RenderText(t.Content, data)
+	if err != nil {
+		return "", utils.ErrValidation.Wrap(
+			fmt.Errorf("render prompt template %s: %w", t.TemplateId, err),
+		).WithDetails(utils.ValidationError{
+			Field:   "system_prompt",
+			Message: fmt.Sprintf("prompt %q could not be rendered: %v", name, err),
+		})
+	}
+	return text, nil
+}
+
+// fillContext sets what prompts may say about the user, the space and the
+// tools. It is best effort: a prompt rendered without them still works.
+func (s *promptService) fillContext(ctx context.Context, userId, spaceId string, data *prompts.Data) {
+	if user, err := s.db.GetUser(ctx, userId); err == nil {
+		data.UserName = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	} else {
+		s.logger.Warn("Failed to load user for prompt", zap.Error(err), zap.String("user_id", userId))
+	}
+
+	if spaceId != "" {
+		if space, err := s.db.GetSpace(ctx, spaceId); err == nil {
+			data.SpaceTitle = space.Title
+		} else {
+			s.logger.Warn("Failed to load space for prompt", zap.Error(err), zap.String("space_id", spaceId))
+		}
+
+		if sources, err := s.db.ListSourcesForSpace(ctx, spaceId); err == nil {
+			for _, source := range sources {
+				if source.Status == models.SourceStatusReady {
+					data.SpaceSources = append(data.SpaceSources, source.Location)
+				}
+			}
+		} else {
+			s.logger.Warn("Failed to list sources for prompt", zap.Error(err), zap.String("space_id", spaceId))
+		}
+	}
+
+	for _, tool := range s.llmFactory.ListTools() {
+		data.Tools = append(data.Tools, prompts.Tool{Name: tool.Name(), Description: tool.Description()})
+	}
+}
+
+func validatePromptTemplate(t *models.PromptTemplate) error {
+	if !promptNamePattern.MatchString(t.Name) {
+		return utils.ErrValidation.Wrap(
+			fmt.Errorf("invalid prompt name %q", t.Name),
+		).WithDetails(utils.ValidationError{
+			Field:   "name",
+			Message: "'name' must be 1 to 64 lowercase letters, digits, '-' or '_', starting with a letter or digit",
+		})
+	}
+
+	if strings.TrimSpace(t.Content) == "" {
+		return utils.ErrValidation.Wrap(
+			fmt.Errorf("missing required field content"),
+		).WithDetails(utils.ValidationError{
+			Field:   "content",
+			Message: "'content' is required",
+		})
+	}
+	if utf8.RuneCountInString(t.Content) > maxPromptTemplateLength {
+		return utils.ErrValidation.Wrap(
+			fmt.Errorf("prompt template too long"),
+		).WithDetails(utils.ValidationError{
+			Field:   "content",
+			Message: fmt.Sprintf("'content' can be at most %d characters", maxPromptTemplateLength),
+		})
+	}
+	if err := prompts.Validate(t.Content); err != nil {
+		return utils.ErrValidation.Wrap(err).WithDetails(utils.ValidationError{
+			Field:   "content",
+			Message: fmt.Sprintf("'content' is not a valid template: %v", err),
+		})
+	}
+	return nil
+}
+
+func promptNameConflict(err error, name string) error {
+	if errors.Is(err, utils.ErrUniqueConflict) {
+		return utils.ErrUniqueConflict.Wrap(err).WithDetails(utils.ValidationError{
+			Field:   "name",
+			Message: fmt.Sprintf("a prompt named %q already exists", name),
+		})
+	}
+	return err
+}
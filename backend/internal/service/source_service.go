@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/db"
+	"github.com/synntx/askmind/internal/llm"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/processing"
+	"github.com/synntx/askmind/internal/tools"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+const sourceIngestTimeout = 10 * time.Minute
+
+type SourceService interface {
+	CreateWebSource(ctx context.Context, userId string, spaceId uuid.UUID, pageURL string) (*models.Source, error)
+	CreateFileSource(ctx context.Context, userId string, spaceId uuid.UUID, fileName string, contentType string, file io.Reader) (*models.Source, error)
+	GetSource(ctx context.Context, sourceId string) (*models.Source, error)
+	ListSourcesForSpace(ctx context.Context, spaceId string) ([]models.Source, error)
+	DeleteSource(ctx context.Context, sourceId string) error
+	SearchSpace(ctx context.Context, spaceId string, query string, limit int) ([]models.Chunk, error)
+	// FailInterruptedSources marks the sources whose ingestion was cut short
+	// by a restart failed. Ingestion runs in the process that accepted the
+	// source and uploaded files are not kept, so it is called once at startup,
+	// before any source is accepted.
+	FailInterruptedSources(ctx context.Context) error
+}
+
+type sourceService struct {
+	db                db.DB
+	llmFactory        llm.LLMFactory
+	embeddingProvider llm.ProviderType
+	embeddingModel    string
+	chunker           *processing.Chunker
+	pageAnalyzer      *tools.WebPageStructureAnalyzerTool
+	logger            *zap.Logger
+}
+
+// extractFunc returns the document and metadata of a source once it is picked
+// up for processing.
+type extractFunc func(ctx context.Context) (*processing.Document, models.JSONB, error)
+
+func NewSourceService(db db.DB, llmFactory llm.LLMFactory, embeddingProvider llm.ProviderType, embeddingModel string, chunker *processing.Chunker, logger *zap.Logger) *sourceService {
+	return &sourceService{
+		db:                db,
+		llmFactory:        llmFactory,
+		embeddingProvider: embeddingProvider,
+		embeddingModel:    embeddingModel,
+		chunker:           chunker,
+		pageAnalyzer:      tools.NewWebPageStructureAnalyzerTool(),
+		logger:            logger,
+	}
+}
+
+func (s *sourceService) CreateWebSource(ctx context.Context, userId string, spaceId uuid.UUID, pageURL string) (*models.Source, error) {
+	parsedURL, err := url.ParseRequestURI(strings.TrimSpace(pageURL))
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		return nil, utils.ErrValidation.Wrap(
+			fmt.Errorf("invalid source url %q", pageURL),
+		).WithDetails(utils.ValidationError{
+			Field:   "url",
+			Message: "url must be a valid http or https URL",
+		})
+	}
+
+	if err := s.checkSourceLimit(ctx, spaceId.String()); err != nil {
+		return nil, err
+	}
+
+	source, err := s.db.CreateSource(ctx, &models.Source{
+		SpaceId:    spaceId,
+		SourceType: models.SourceTypeWebPage,
+		Location:   parsedURL.String(),
+		Metadata:   models.JSONB{},
+		Status:     models.SourceStatusPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go s.ingest(source, userId, func(ctx context.Context) (*processing.Document, models.JSONB, error) {
+		return s.extractWebPage(ctx, source.Location)
+	}, nil)
+
+	return source, nil
+}
+
+func (s *sourceService) CreateFileSource(ctx context.Context, userId string, spaceId uuid.UUID, fileName string, contentType string, file io.Reader) (*models.Source, error) {
+	if !processing.IsSupported(fileName, contentType) {
+		return nil, utils.ErrUnsupportedFileType.Wrap(
+			fmt.Errorf("unsupported file type: %s", filepath.Ext(fileName)),
+		).WithDetails(utils.ValidationError{
+			Field:   "file",
+			Message: fmt.Sprintf("files of type %q can not be processed", filepath.Ext(fileName)),
+		})
+	}
+
+	if err := s.checkSourceLimit(ctx, spaceId.String()); err != nil {
+		return nil, err
+	}
+
+	// The request body is gone once the handler returns, so the upload is
+	// spooled to disk before processing continues in the background.
+	tmp, err := os.CreateTemp("", "askmind-source-*"+filepath.Ext(fileName))
+	if err != nil {
+		return nil, utils.ErrInternal.Wrap(fmt.Errorf("create temp file: %w", err))
+	}
+	size, err := io.Copy(tmp, file)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, utils.ErrInternal.Wrap(fmt.Errorf("write temp file: %w", err))
+	}
+
+	source, err := s.db.CreateSource(ctx, &models.Source{
+		SpaceId:    spaceId,
+		SourceType: models.SourceTypeFile,
+		Location:   fileName,
+		Metadata: models.JSONB{
+			"file_name":    fileName,
+			"content_type": contentType,
+			"size":         size,
+			"uploaded_at":  time.Now(),
+		},
+		Status: models.SourceStatusPending,
+	})
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	go s.ingest(source, userId, func(ctx context.Context) (*processing.Document, models.JSONB, error) {
+		doc, err := processing.ProcessFile(tmp.Name(), contentType)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n := len(doc.Sections); n > 0 && doc.Sections[n-1].Page > 0 {
+			source.Metadata["page_count"] = doc.Sections[n-1].Page
+		}
+		return doc, source.Metadata, nil
+	}, func() { os.Remove(tmp.Name()) })
+
+	return source, nil
+}
+
+func (s *sourceService) GetSource(ctx context.Context, sourceId string) (*models.Source, error) {
+	return s.db.GetSource(ctx, sourceId)
+}
+
+func (s *sourceService) ListSourcesForSpace(ctx context.Context, spaceId string) ([]models.Source, error) {
+	return s.db.ListSourcesForSpace(ctx, spaceId)
+}
+
+func (s *sourceService) DeleteSource(ctx context.Context, sourceId string) error {
+	return s.db.DeleteSource(ctx, sourceId)
+}
+
+// FailInterruptedSources fails the sources left pending or processing, with
+// an error message telling the user to add them again.
+func (s *sourceService) FailInterruptedSources(ctx context.Context) error {
+	n, err := s.db.FailUnfinishedSources(ctx, "processing was interrupted by a server restart, please add the source again")
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		s.logger.Warn("Marked interrupted sources failed", zap.Int64("count", n))
+	}
+	return nil
+}
+
+// SearchSpace returns the chunks of the space's ready sources that are most
+// similar to query. Spaces without sources return nothing without calling the
+// embedding model.
+func (s *sourceService) SearchSpace(ctx context.Context, spaceId string, query string, limit int) ([]models.Chunk, error) {
+	count, err := s.db.GetSpaceSourceCount(ctx, spaceId)
+	if err != nil {
+		return nil, utils.HandlePgError(err, "SearchSpace")
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	embedder, err := s.llmFactory.CreateLLM(ctx, s.embeddingProvider, s.embeddingModel)
+	if err != nil {
+		return nil, fmt.Errorf("create embedding model: %w", err)
+	}
+
+	embedding, err := embedder.GenerateEmbeddings(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+
+	return s.db.FindSimilarChunks(ctx, embedding, limit, models.ChunkFilters{SpaceID: &spaceId})
+}
+
+func (s *sourceService) checkSourceLimit(ctx context.Context, spaceId string) error {
+	withinLimit, err := s.db.CheckSpaceSourceLimit(ctx, spaceId)
+	if err != nil {
+		return err
+	}
+	if !withinLimit {
+		return utils.ErrSourceLimitReached.Wrap(fmt.Errorf("space %s has reached its source limit", spaceId))
+	}
+	return nil
+}
+
+// ingest moves a source through processing -> ready/failed. It runs detached
+// from the request that created the source, so it uses its own context.
+func (s *sourceService) ingest(source *models.Source, userId string, extract extractFunc, cleanup func()) {
+	if cleanup != nil {
+		defer cleanup()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sourceIngestTimeout)
+	defer cancel()
+
+	sourceId := source.SourceId.String()
+	logger := s.logger.With(zap.String("source_id", sourceId), zap.String("space_id", source.SpaceId.String()))
+	start := time.Now()
+
+	fail := func(err error) {
+		logger.Error("source ingestion failed", zap.Error(err))
+		if updateErr := s.db.UpdateSourceStatus(ctx, sourceId, models.SourceStatusFailed, err.Error()); updateErr != nil {
+			logger.Error("failed to mark source as failed", zap.Error(updateErr))
+		}
+	}
+
+	if err := s.db.UpdateSourceStatus(ctx, sourceId, models.SourceStatusProcessing, ""); err != nil {
+		fail(fmt.Errorf("mark processing: %w", err))
+		return
+	}
+
+	doc, metadata, err := extract(ctx)
+	if err != nil {
+		fail(fmt.Errorf("extract text: %w", err))
+		return
+	}
+	text := doc.Text()
+	if strings.TrimSpace(text) == "" {
+		fail(fmt.Errorf("no text could be extracted from %s", source.Location))
+		return
+	}
+
+	if err := s.db.UpdateSourceContent(ctx, sourceId, text, metadata); err != nil {
+		fail(fmt.Errorf("save text: %w", err))
+		return
+	}
+
+	chunks, err := s.embedChunks(ctx, s.chunkDocument(doc))
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	if err := s.db.CreateChunks(ctx, userId, source.SpaceId.String(), sourceId, chunks); err != nil {
+		fail(fmt.Errorf("save chunks: %w", err))
+		return
+	}
+
+	if err := s.db.UpdateSourceStatus(ctx, sourceId, models.SourceStatusReady, ""); err != nil {
+		fail(fmt.Errorf("mark ready: %w", err))
+		return
+	}
+
+	logger.Info("source ingested",
+		zap.Int("chunks", len(chunks)),
+		zap.Duration("took", time.Since(start)),
+		zap.String("event", "source_ingested"),
+	)
+}
+
+// chunkDocument splits the document within its sections, so a chunk never
+// spans two pages or headings and can be cited by page number and section.
+func (s *sourceService) chunkDocument(doc *processing.Document) []models.Chunk {
+	textChunks := s.chunker.Chunk(doc)
+	chunks := make([]models.Chunk, 0, len(textChunks))
+	for i, tc := range textChunks {
+		chunk := models.Chunk{
+			Text:            tc.Text,
+			ChunkIndex:      int32(i),
+			ChunkTokenCount: int32(tc.TokenCount),
+			SectionTitle:    tc.Title,
+		}
+		if tc.Page > 0 {
+			page := int32(tc.Page)
+			chunk.PageNumber = &page
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func (s *sourceService) embedChunks(ctx context.Context, chunks []models.Chunk) ([]models.Chunk, error) {
+	embedder, err := s.llmFactory.CreateLLM(ctx, s.embeddingProvider, s.embeddingModel)
+	if err != nil {
+		return nil, fmt.Errorf("create embedding model: %w", err)
+	}
+
+	for i := range chunks {
+		// the heading path gives short chunks the context they were written in
+		input := chunks[i].Text
+		if chunks[i].SectionTitle != "" {
+			input = chunks[i].SectionTitle + "\n\n" + input
+		}
+		embedding, err := embedder.GenerateEmbeddings(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("embed chunk %d: %w", i, err)
+		}
+		chunks[i].Embedding = embedding
+	}
+	return chunks, nil
+}
+
+func (s *sourceService) extractWebPage(ctx context.Context, pageURL string) (*processing.Document, models.JSONB, error) {
+	raw, err := s.pageAnalyzer.Execute(ctx, map[string]any{
+		"url":            pageURL,
+		"extract_tables": false,
+		"extract_lists":  false,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var page tools.PageStructureResult
+	if err := json.Unmarshal([]byte(raw), &page); err != nil {
+		return nil, nil, fmt.Errorf("decode page analysis: %w", err)
+	}
+
+	websiteName := page.Metadata.OpenGraphSiteName
+	if websiteName == "" {
+		if parsed, err := url.Parse(pageURL); err == nil {
+			websiteName = parsed.Hostname()
+		}
+	}
+
+	metadata := models.JSONB{
+		"page_title":       page.Title,
+		"website_name":     websiteName,
+		"meta_description": page.Metadata.Description,
+		"scraped_at":       time.Now(),
+	}
+
+	doc := &processing.Document{Sections: []processing.Section{
+		{Text: strings.Join(page.MainContentTextBlocks, "\n\n")},
+	}}
+	return doc, metadata, nil
+}
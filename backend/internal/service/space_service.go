@@ -2,29 +2,54 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
 
+	"github.com/google/uuid"
 	"github.com/synntx/askmind/internal/db"
+	"github.com/synntx/askmind/internal/llm"
 	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/prompts"
+	"github.com/synntx/askmind/internal/utils"
 	"go.uber.org/zap"
 )
 
+// most source chunks a space can have given to the model for each completion
+const maxRetrievalTopK = 20
+
 type SpaceService interface {
 	CreateSpace(ctx context.Context, space *models.CreateSpace) error
 	GetSpace(ctx context.Context, spaceId string) (*models.Space, error)
+	// UpdateSpace validates new settings against the model catalog, the tool
+	// registry and the prompts the space can use before saving them.
 	UpdateSpace(ctx context.Context, space *models.UpdateSpace) error
 	DeleteSpace(ctx context.Context, spaceId string) error
 	ListSpacesForUser(ctx context.Context, userId string) ([]models.Space, error)
+
+	// Members; callers are expected to have authorized the space already
+	ListMembers(ctx context.Context, spaceId string) ([]models.SpaceMember, error)
+	InviteMember(ctx context.Context, spaceId, email string, role models.SpaceRole, invitedBy string) (*models.SpaceMember, error)
+	UpdateMemberRole(ctx context.Context, spaceId, userId string, role models.SpaceRole) error
+	RemoveMember(ctx context.Context, spaceId, userId string) error
+
+	// Invitations of the user themselves
+	ListInvitations(ctx context.Context, userId string) ([]models.SpaceInvitation, error)
+	AcceptInvitation(ctx context.Context, spaceId, userId string) error
+	DeclineInvitation(ctx context.Context, spaceId, userId string) error
 }
 
 type spaceService struct {
-	db     db.DB
-	logger *zap.Logger
+	db         db.DB
+	llmFactory llm.LLMFactory
+	logger     *zap.Logger
 }
 
-func NewSpaceService(db db.DB, logger *zap.Logger) *spaceService {
+func NewSpaceService(db db.DB, llmFactory llm.LLMFactory, logger *zap.Logger) *spaceService {
 	return &spaceService{
-		db:     db,
-		logger: logger,
+		db:         db,
+		llmFactory: llmFactory,
+		logger:     logger,
 	}
 }
 
@@ -37,6 +62,11 @@ func (s *spaceService) GetSpace(ctx context.Context, spaceId string) (*models.Sp
 }
 
 func (s *spaceService) UpdateSpace(ctx context.Context, space *models.UpdateSpace) error {
+	if space.Settings != nil {
+		if err := s.validateSettings(ctx, space.SpaceId, space.Settings); err != nil {
+			return err
+		}
+	}
 	return s.db.UpdateSpace(ctx, space)
 }
 
@@ -47,3 +77,152 @@ func (s *spaceService) DeleteSpace(ctx context.Context, spaceId string) error {
 func (s *spaceService) ListSpacesForUser(ctx context.Context, userId string) ([]models.Space, error) {
 	return s.db.ListSpacesForUser(ctx, userId)
 }
+
+func (s *spaceService) ListMembers(ctx context.Context, spaceId string) ([]models.SpaceMember, error) {
+	return s.db.ListSpaceMembers(ctx, spaceId)
+}
+
+func (s *spaceService) InviteMember(ctx context.Context, spaceId, email string, role models.SpaceRole, invitedBy string) (*models.SpaceMember, error) {
+	if err := validateMemberRole(role); err != nil {
+		return nil, err
+	}
+	return s.db.InviteSpaceMember(ctx, spaceId, email, role, invitedBy)
+}
+
+func (s *spaceService) UpdateMemberRole(ctx context.Context, spaceId, userId string, role models.SpaceRole) error {
+	if err := validateMemberRole(role); err != nil {
+		return err
+	}
+	return s.db.UpdateSpaceMemberRole(ctx, spaceId, userId, role)
+}
+
+func (s *spaceService) RemoveMember(ctx context.Context, spaceId, userId string) error {
+	return s.db.RemoveSpaceMember(ctx, spaceId, userId)
+}
+
+func (s *spaceService) ListInvitations(ctx context.Context, userId string) ([]models.SpaceInvitation, error) {
+	return s.db.ListSpaceInvitations(ctx, userId)
+}
+
+func (s *spaceService) AcceptInvitation(ctx context.Context, spaceId, userId string) error {
+	return s.db.AcceptSpaceInvitation(ctx, spaceId, userId)
+}
+
+// DeclineInvitation drops a pending invitation. Accepted memberships are left
+// alone; leaving a space goes through RemoveMember.
+func (s *spaceService) DeclineInvitation(ctx context.Context, spaceId, userId string) error {
+	member, err := s.db.GetSpaceMember(ctx, spaceId, userId)
+	if err != nil {
+		return err
+	}
+	if member.AcceptedAt != nil {
+		return utils.ErrNotFound.Wrap(fmt.Errorf("no pending invitation to space %s", spaceId))
+	}
+	return s.db.RemoveSpaceMember(ctx, spaceId, userId)
+}
+
+// validateSettings checks settings before they are saved, so a space's
+// completions do not all fail later on. Tools are sorted and deduplicated.
+func (s *spaceService) validateSettings(ctx context.Context, spaceId string, settings *models.SpaceSettings) error {
+	if (settings.Provider == "") != (settings.Model == "") {
+		return utils.ErrValidation.Wrap(
+			fmt.Errorf("provider and model must be set together"),
+		).WithDetails(utils.ValidationError{
+			Field:   "provider,model",
+			Message: "provider and model must be set together",
+		})
+	}
+	if settings.Provider != "" {
+		_, err := s.llmFactory.LookupModel(ctx, llm.ProviderType(settings.Provider), settings.Model)
+		switch {
+		case errors.Is(err, llm.ErrUnknownProvider):
+			return utils.ErrUnknownProvider.Wrap(err).WithDetails(utils.ValidationError{
+				Field:   "provider",
+				Message: fmt.Sprintf("provider %q is not configured", settings.Provider),
+			})
+		case errors.Is(err, llm.ErrUnknownModel):
+			return utils.ErrInvalidModel.Wrap(err).WithDetails(utils.ValidationError{
+				Field:   "model",
+				Message: fmt.Sprintf("model %q is not served by %s", settings.Model, settings.Provider),
+			})
+		case err != nil:
+			// an unreachable provider may well be back by the time it is used
+			s.logger.Warn("Could not check the space's default model", zap.Error(err),
+				zap.String("space_id", spaceId),
+				zap.String("provider", settings.Provider))
+		}
+	}
+
+	if settings.SystemPrompt != "" && !slices.Contains(prompts.List(), settings.SystemPrompt) {
+		// Personal templates are left out: the other members could not use them.
+		_, err := s.db.FindPromptTemplate(ctx, uuid.Nil.String(), spaceId, settings.SystemPrompt)
+		if errors.Is(err, utils.ErrNotFound) {
+			return utils.ErrValidation.Wrap(err).WithDetails(utils.ValidationError{
+				Field:   "system_prompt",
+				Message: fmt.Sprintf("there is no built-in prompt or space template named %q", settings.SystemPrompt),
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if settings.Tools != nil {
+		known := make(map[string]bool)
+		for _, tool := range s.llmFactory.ListTools() {
+			known[tool.Name()] = true
+		}
+		for _, name := range settings.Tools {
+			if !known[name] {
+				return utils.ErrValidation.Wrap(
+					fmt.Errorf("unknown tool %q", name),
+				).WithDetails(utils.ValidationError{
+					Field:   "tools",
+					Message: fmt.Sprintf("there is no tool named %q", name),
+				})
+			}
+		}
+		slices.Sort(settings.Tools)
+		settings.Tools = slices.Compact(settings.Tools)
+	}
+
+	if t := settings.Temperature; t != nil && (*t < 0 || *t > 2) {
+		return utils.ErrValidation.Wrap(
+			fmt.Errorf("temperature %v out of range", *t),
+		).WithDetails(utils.ValidationError{
+			Field:   "temperature",
+			Message: "temperature must be between 0 and 2",
+		})
+	}
+	if settings.MaxOutputTokens < 0 {
+		return utils.ErrValidation.Wrap(
+			fmt.Errorf("negative max_output_tokens"),
+		).WithDetails(utils.ValidationError{
+			Field:   "max_output_tokens",
+			Message: "max_output_tokens can not be negative",
+		})
+	}
+	if settings.RetrievalTopK < 0 || settings.RetrievalTopK > maxRetrievalTopK {
+		return utils.ErrValidation.Wrap(
+			fmt.Errorf("retrieval_top_k %d out of range", settings.RetrievalTopK),
+		).WithDetails(utils.ValidationError{
+			Field:   "retrieval_top_k",
+			Message: fmt.Sprintf("retrieval_top_k must be between 0 and %d", maxRetrievalTopK),
+		})
+	}
+	return nil
+}
+
+// validateMemberRole rejects roles a member can be given. There is exactly
+// one owner per space, set when the space is created.
+func validateMemberRole(role models.SpaceRole) error {
+	if role == models.SpaceRoleEditor || role == models.SpaceRoleViewer {
+		return nil
+	}
+	return utils.ErrValidation.Wrap(
+		fmt.Errorf("invalid member role %q", role),
+	).WithDetails(utils.ValidationError{
+		Field:   "role",
+		Message: `role can only be "editor" or "viewer"`,
+	})
+}
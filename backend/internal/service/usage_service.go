@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/synntx/askmind/internal/db"
+	"github.com/synntx/askmind/internal/models"
+	"github.com/synntx/askmind/internal/utils"
+	"go.uber.org/zap"
+)
+
+// longest range GetDailyUsage returns, in days
+const maxUsageDays = 366
+
+type UsageService interface {
+	GetConversationUsage(ctx context.Context, userId, convId string) (*models.TokenUsage, error)
+	GetSpaceUsage(ctx context.Context, userId, spaceId string) (*models.TokenUsage, error)
+	// GetDailyUsage returns the user's usage per day and model, from and to
+	// being inclusive UTC days.
+	GetDailyUsage(ctx context.Context, userId string, from, to time.Time) ([]models.DailyTokenUsage, error)
+	// CheckDailyQuota returns what the user has used today. The error is
+	// ErrQuotaExceeded once either daily limit is reached; a single request
+	// may still overshoot the token limit, which is only checked up front.
+	CheckDailyQuota(ctx context.Context, userId string) (*models.QuotaStatus, error)
+	// RecordUsage counts a model call that left no assistant message behind.
+	RecordUsage(ctx context.Context, record *models.UsageRecord) error
+}
+
+type usageService struct {
+	db     db.DB
+	quota  models.DailyQuota
+	logger *zap.Logger
+}
+
+func NewUsageService(db db.DB, quota models.DailyQuota, logger *zap.Logger) *usageService {
+	return &usageService{
+		db:     db,
+		quota:  quota,
+		logger: logger,
+	}
+}
+
+func (us *usageService) GetConversationUsage(ctx context.Context, userId, convId string) (*models.TokenUsage, error) {
+	return us.db.GetConversationTokenUsage(ctx, userId, convId)
+}
+
+func (us *usageService) GetSpaceUsage(ctx context.Context, userId, spaceId string) (*models.TokenUsage, error) {
+	return us.db.GetSpaceTokenUsage(ctx, userId, spaceId)
+}
+
+func (us *usageService) GetDailyUsage(ctx context.Context, userId string, from, to time.Time) ([]models.DailyTokenUsage, error) {
+	from = from.UTC().Truncate(24 * time.Hour)
+	to = to.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	if !from.Before(to) {
+		return nil, utils.ErrValidation.Wrap(
+			fmt.Errorf("from %s is after to %s", from.Format(time.DateOnly), to.Format(time.DateOnly)),
+		).WithDetails(utils.ValidationError{
+			Field:   "from",
+			Message: "'from' must not be after 'to'",
+		})
+	}
+	if to.Sub(from) > maxUsageDays*24*time.Hour {
+		return nil, utils.ErrValidation.Wrap(
+			fmt.Errorf("usage range longer than %d days", maxUsageDays),
+		).WithDetails(utils.ValidationError{
+			Field:   "from",
+			Message: fmt.Sprintf("the range can span at most %d days", maxUsageDays),
+		})
+	}
+	return us.db.GetUserDailyTokenUsage(ctx, userId, from, to)
+}
+
+func (us *usageService) CheckDailyQuota(ctx context.Context, userId string) (*models.QuotaStatus, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	status := &models.QuotaStatus{
+		RequestLimit: us.quota.Requests,
+		TokenLimit:   us.quota.Tokens,
+		ResetAt:      today.AddDate(0, 0, 1),
+	}
+	if us.quota.Requests <= 0 && us.quota.Tokens <= 0 {
+		return status, nil
+	}
+
+	requests, tokens, err := us.db.GetUserUsageSince(ctx, userId, today)
+	if err != nil {
+		return nil, err
+	}
+	status.Requests, status.Tokens = requests, tokens
+
+	if us.quota.Requests > 0 && requests >= us.quota.Requests {
+		return status, utils.ErrQuotaExceeded.Wrap(
+			fmt.Errorf("user %s made %d of %d requests today", userId, requests, us.quota.Requests),
+		)
+	}
+	if us.quota.Tokens > 0 && tokens >= us.quota.Tokens {
+		return status, utils.ErrQuotaExceeded.Wrap(
+			fmt.Errorf("user %s used %d of %d tokens today", userId, tokens, us.quota.Tokens),
+		)
+	}
+	return status, nil
+}
+
+func (us *usageService) RecordUsage(ctx context.Context, record *models.UsageRecord) error {
+	return us.db.RecordUsage(ctx, record)
+}
@@ -358,8 +358,16 @@ func (psa *WebPageStructureAnalyzerTool) extractHeadings(doc *goquery.Document)
 	return headings
 }
 
-func (psa *WebPageStructureAnalyzerTool) extractMainContentText(doc *goquery.Document) []string {
-	var textBlocks []string
+// MainContent returns a cleaned copy of the element that holds the main
+// content of doc, for HTML that was not fetched by the tool itself.
+func MainContent(doc *goquery.Document) *goquery.Selection {
+	return (&WebPageStructureAnalyzerTool{}).mainContent(doc)
+}
+
+// mainContent finds the element most likely to hold the page's main content,
+// falling back to <body>, and returns a copy stripped of navigation, ads and
+// other boilerplate.
+func (psa *WebPageStructureAnalyzerTool) mainContent(doc *goquery.Document) *goquery.Selection {
 	mainContentSelectors := []string{
 		"article", "main", "[role='main']",
 		".post-content", ".entry-content", ".td-post-content",
@@ -394,6 +402,13 @@ func (psa *WebPageStructureAnalyzerTool) extractMainContentText(doc *goquery.Doc
 
 	contentClone.Find("script, style, head, link, meta, title, noscript, iframe, frame, frameset, object, embed, param, map, area, nav, header, footer, aside, form, button, input, textarea, select, optgroup, option, label, .noprint, .sidebar, .widget, .ad, .ads, .advert, .advertisement, .banner, #comments, .comments, .comment-list, .social-share, .share-buttons, .related-posts, .post-meta, .byline, .timestamp, .cookie-banner, .popup, .modal, [role='navigation'], [role='banner'], [role='contentinfo'], [role='search'], [role='complementary'], [role='form'], [aria-hidden='true'], details > summary, figure > figcaption").Remove()
 
+	return contentClone
+}
+
+func (psa *WebPageStructureAnalyzerTool) extractMainContentText(doc *goquery.Document) []string {
+	var textBlocks []string
+	contentClone := psa.mainContent(doc)
+
 	contentClone.Find("p, div, li, pre, blockquote, section, article > div, td").Each(func(i int, s *goquery.Selection) {
 		if (s.Is("li") && s.ParentsFiltered("ul, ol").Length() > 0) || (s.Is("div") && s.ParentsFiltered("ul, ol, table").Length() > 0) {
 			return
@@ -429,7 +444,7 @@ func (psa *WebPageStructureAnalyzerTool) extractMainContentText(doc *goquery.Doc
 		}
 	})
 
-	if len(textBlocks) < 2 && (mainContentSelection != nil && mainContentSelection.Length() > 0) {
+	if len(textBlocks) < 2 && contentClone.Length() > 0 {
 		fullContentText := psa.cleanText(contentClone.Text())
 		if len(strings.Fields(fullContentText)) > 20 {
 			potentialBlocks := strings.Split(fullContentText, "\n")
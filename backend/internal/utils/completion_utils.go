@@ -5,19 +5,74 @@ import (
 	"net/http"
 
 	"github.com/google/uuid"
+	"github.com/synntx/askmind/internal/models"
 )
 
+// GenerationParams say how an answer is generated. Provider, Model and
+// SystemPrompt come from the request, the rest from the space's settings,
+// which also fill in what the request leaves out.
+type GenerationParams struct {
+	Provider        string
+	Model           string
+	SystemPrompt    string
+	Tools           []string // names of the tools the model may call; nil for all
+	Temperature     *float32 // nil for the provider's default
+	MaxOutputTokens int      // 0 for the provider's default
+	RetrievalTopK   int      // 0 for the app's default
+}
+
+// extractGenerationParams reads provider, model and system_prompt, falling
+// back to the space's settings when the request omits them. Provider and
+// model fall back together, so a request naming only one of them fails.
+func extractGenerationParams(r *http.Request, settings *models.SpaceSettings) (GenerationParams, error) {
+	params := GenerationParams{
+		Provider:        r.FormValue("provider"),
+		Model:           r.FormValue("model"),
+		SystemPrompt:    r.FormValue("system_prompt"),
+		Tools:           settings.Tools,
+		Temperature:     settings.Temperature,
+		MaxOutputTokens: settings.MaxOutputTokens,
+		RetrievalTopK:   settings.RetrievalTopK,
+	}
+	if params.Provider == "" && params.Model == "" {
+		params.Provider, params.Model = settings.Provider, settings.Model
+	}
+	if params.SystemPrompt == "" {
+		params.SystemPrompt = settings.SystemPrompt
+	}
+	if params.SystemPrompt == "" {
+		params.SystemPrompt = "general"
+	}
+
+	if params.Model == "" {
+		return GenerationParams{}, missingGenerationParam("model")
+	}
+	if params.Provider == "" {
+		return GenerationParams{}, missingGenerationParam("provider")
+	}
+	return params, nil
+}
+
+func missingGenerationParam(name string) error {
+	return ErrValidation.Wrap(
+		fmt.Errorf("missing required parameter %s", name),
+	).WithDetails(ValidationError{
+		Field:   name,
+		Message: name + " is required unless the space has a default model",
+	})
+}
+
 type CompletionRequestParams struct {
-	ConvID       uuid.UUID
-	SpaceID      uuid.UUID
-	UserMessage  string
-	Model        string
-	Provider     string
-	SystemPrompt string
-	IsNewConv    bool
+	GenerationParams
+	ConvID      uuid.UUID
+	SpaceID     uuid.UUID
+	UserMessage string
+	IsNewConv   bool
 }
 
-func ExtractCompletionRequestParams(r *http.Request) (*CompletionRequestParams, error) {
+// ExtractCompletionRequestParams reads the parameters of /c/completion.
+// spaceSettings is given the space_id of the request.
+func ExtractCompletionRequestParams(r *http.Request, spaceSettings func(spaceID uuid.UUID) (*models.SpaceSettings, error)) (*CompletionRequestParams, error) {
 	convIDStr := r.FormValue("conv_id")
 	if convIDStr == "" {
 		return nil, ErrValidation.Wrap(
@@ -48,26 +103,6 @@ func ExtractCompletionRequestParams(r *http.Request) (*CompletionRequestParams,
 		})
 	}
 
-	model := r.FormValue("model")
-	if model == "" {
-		return nil, ErrValidation.Wrap(
-			fmt.Errorf("missing required parameter model"),
-		).WithDetails(ValidationError{
-			Field:   "model",
-			Message: "model is required",
-		})
-	}
-
-	provider := r.FormValue("provider")
-	if provider == "" {
-		return nil, ErrValidation.Wrap(
-			fmt.Errorf("missing required parameter provider"),
-		).WithDetails(ValidationError{
-			Field:   "provider",
-			Message: "provider is required",
-		})
-	}
-
 	var convID uuid.UUID
 	var isNewConv bool
 
@@ -97,18 +132,74 @@ func ExtractCompletionRequestParams(r *http.Request) (*CompletionRequestParams,
 		})
 	}
 
-	systemPrompt := r.FormValue("system_prompt")
-	if systemPrompt == "" {
-		systemPrompt = "general"
+	settings, err := spaceSettings(spaceID)
+	if err != nil {
+		return nil, err
+	}
+	generation, err := extractGenerationParams(r, settings)
+	if err != nil {
+		return nil, err
 	}
 
 	return &CompletionRequestParams{
-		ConvID:       convID,
-		SpaceID:      spaceID,
-		UserMessage:  userMessage,
-		Model:        model,
-		Provider:     provider,
-		SystemPrompt: systemPrompt,
-		IsNewConv:    isNewConv,
+		GenerationParams: generation,
+		ConvID:           convID,
+		SpaceID:          spaceID,
+		UserMessage:      userMessage,
+		IsNewConv:        isNewConv,
+	}, nil
+}
+
+// BranchRequestParams are the parameters of /c/regenerate, which answers the
+// assistant message MsgID again, and /c/edit, which replaces the user message
+// MsgID with UserMessage; both add a branch to the conversation.
+type BranchRequestParams struct {
+	GenerationParams
+	MsgID       uuid.UUID
+	UserMessage string // /c/edit only
+}
+
+// ExtractBranchRequestParams reads the parameters of /c/regenerate, or of
+// /c/edit when withUserMessage is set. spaceSettings is given the msg_id of
+// the request.
+func ExtractBranchRequestParams(r *http.Request, withUserMessage bool, spaceSettings func(msgID uuid.UUID) (*models.SpaceSettings, error)) (*BranchRequestParams, error) {
+	required := []string{"msg_id"}
+	if withUserMessage {
+		required = append(required, "user_message")
+	}
+	for _, name := range required {
+		if r.FormValue(name) == "" {
+			return nil, ErrValidation.Wrap(
+				fmt.Errorf("missing required parameter %s", name),
+			).WithDetails(ValidationError{
+				Field:   name,
+				Message: name + " is required",
+			})
+		}
+	}
+
+	msgID, err := uuid.Parse(r.FormValue("msg_id"))
+	if err != nil {
+		return nil, ErrValidation.Wrap(
+			fmt.Errorf("failed to parse msg_id"),
+		).WithDetails(ValidationError{
+			Field:   "msg_id",
+			Message: "invalid msg_id",
+		})
+	}
+
+	settings, err := spaceSettings(msgID)
+	if err != nil {
+		return nil, err
+	}
+	generation, err := extractGenerationParams(r, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BranchRequestParams{
+		GenerationParams: generation,
+		MsgID:            msgID,
+		UserMessage:      r.FormValue("user_message"),
 	}, nil
 }
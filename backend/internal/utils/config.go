@@ -1,7 +1,6 @@
 package utils
 
-const (
-	SecretKey = ""
-	ClaimsKey = ""
-)
+type contextKey string
 
+// ClaimsKey is the request context key AuthMiddleware stores *Claims under.
+const ClaimsKey contextKey = "claims"
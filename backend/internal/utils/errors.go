@@ -54,11 +54,19 @@ func (e AppError) Unwrap() error {
 	return e.Cause
 }
 
+// Is matches errors by code, so errors.Is(err, ErrNotFound) holds for any
+// wrapped not-found error.
+func (e AppError) Is(target error) bool {
+	t, ok := target.(AppError)
+	return ok && t.Code == e.Code
+}
+
 var (
 	// auth
 	ErrUnauthorized       = AppError{Code: "unauthorized", Message: "Authentication required", HTTPStatus: http.StatusUnauthorized}
 	ErrEmailExists        = AppError{Code: "email_already_exists", Message: "Email Already exists", HTTPStatus: http.StatusConflict}
 	ErrInvalidCredentials = AppError{Code: "invalid_credentials", Message: "Invalid Credentials", HTTPStatus: http.StatusUnauthorized}
+	ErrForbidden          = AppError{Code: "forbidden", Message: "You do not have permission to do this", HTTPStatus: http.StatusForbidden}
 
 	// validation
 	ErrValidation = AppError{Code: "validation_failed", Message: "Invalid input", HTTPStatus: http.StatusBadRequest}
@@ -71,17 +79,25 @@ var (
 	ErrNotNullViolation    = AppError{Code: "not_null_violation", Message: "A required field is missing", HTTPStatus: http.StatusBadRequest}            // 23502
 	ErrForeignKeyViolation = AppError{Code: "foreign_key_violation", Message: "Invalid reference to another record", HTTPStatus: http.StatusBadRequest} // 23503
 
+	// sources
+	ErrSourceLimitReached  = AppError{Code: "source_limit_reached", Message: "This space has reached its source limit", HTTPStatus: http.StatusForbidden}
+	ErrUnsupportedFileType = AppError{Code: "unsupported_file_type", Message: "This file type is not supported", HTTPStatus: http.StatusUnsupportedMediaType}
+
 	// LLM Specific Errors
 	ErrPromptTooLong         = AppError{Code: "prompt_too_long", Message: "Prompt exceeds maximum length", HTTPStatus: http.StatusBadRequest}
 	ErrInvalidPrompt         = AppError{Code: "invalid_prompt", Message: "Invalid prompt format or content", HTTPStatus: http.StatusBadRequest}
 	ErrLLMServiceUnavailable = AppError{Code: "llm_service_unavailable", Message: "LLM service is currently unavailable", HTTPStatus: http.StatusServiceUnavailable}
 	ErrLLMGenerationFailed   = AppError{Code: "llm_generation_failed", Message: "Failed to generate text from LLM", HTTPStatus: http.StatusInternalServerError}
 	ErrRateLimited           = AppError{Code: "rate_limited", Message: "Too many requests, please try again later", HTTPStatus: http.StatusTooManyRequests}
+	ErrQuotaExceeded         = AppError{Code: "quota_exceeded", Message: "Daily usage quota exceeded", HTTPStatus: http.StatusTooManyRequests}
 	ErrContextWindowExceeded = AppError{Code: "context_window_exceeded", Message: "The combined prompt and response exceeds the context window", HTTPStatus: http.StatusBadRequest} // Important for conversational agents
 	ErrInvalidModel          = AppError{Code: "invalid_model", Message: "The specified LLM model is invalid or unavailable", HTTPStatus: http.StatusBadRequest}
+	ErrUnknownProvider       = AppError{Code: "unknown_provider", Message: "The specified LLM provider is not configured", HTTPStatus: http.StatusBadRequest}
+	ErrUnsupportedModel      = AppError{Code: "unsupported_model", Message: "The specified model does not support this operation", HTTPStatus: http.StatusBadRequest}
 
 	ErrSSEStreamInitFailed = AppError{Code: "sse_stream_init_failed", Message: "Failed to initialize SSE stream", HTTPStatus: http.StatusInternalServerError}
 	ErrSSEEventSendFailed  = AppError{Code: "sse_event_send_failed", Message: "Failed to send SSE event", HTTPStatus: http.StatusInternalServerError}
+	ErrGenerationRunning   = AppError{Code: "generation_in_progress", Message: "An answer is still being generated in this conversation", HTTPStatus: http.StatusConflict}
 
 	// System
 	ErrInternal = AppError{Code: "internal_error", Message: "Something went wrong", HTTPStatus: http.StatusInternalServerError}
@@ -1,20 +1,128 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// shortest HMAC secret accepted, the size of an HS256 digest
+const minSigningKeyLen = 32
+
 type Claims struct {
 	UserId string
 	jwt.RegisteredClaims
+
+	// Set when the request was authenticated with an API key rather than a
+	// session token. Never part of a JWT.
+	APIKeyId string   `json:"-"`
+	Scopes   []string `json:"-"`
+}
+
+// HasScope reports whether the request may do what scope covers. Session
+// tokens can do everything; API keys only what they were created for.
+func (c *Claims) HasScope(scope string) bool {
+	return c.APIKeyId == "" || slices.Contains(c.Scopes, scope)
+}
+
+// SigningKey is an HMAC secret identified by the kid header of the tokens
+// it signs.
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// KeySet holds the keys tokens are verified with and the one new tokens are
+// signed with. Rotating a key means adding the new one as active while the
+// old one stays in the set until the tokens it signed have expired.
+type KeySet struct {
+	active SigningKey
+	keys   map[string][]byte
+}
+
+func NewKeySet(keys []SigningKey, activeID string) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string][]byte, len(keys))}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("signing key without an id")
+		}
+		if len(key.Secret) < minSigningKeyLen {
+			return nil, fmt.Errorf("signing key %q is shorter than %d bytes", key.ID, minSigningKeyLen)
+		}
+		if _, dup := ks.keys[key.ID]; dup {
+			return nil, fmt.Errorf("duplicate signing key id %q", key.ID)
+		}
+		ks.keys[key.ID] = key.Secret
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys configured")
+	}
+	if activeID == "" {
+		activeID = keys[len(keys)-1].ID
+	}
+	secret, ok := ks.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q is not in the key set", activeID)
+	}
+	ks.active = SigningKey{ID: activeID, Secret: secret}
+	return ks, nil
+}
+
+// ParseSigningKeys parses keys written as "kid1:secret1,kid2:secret2".
+func ParseSigningKeys(s string) ([]SigningKey, error) {
+	var keys []SigningKey
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("signing key %q is not written as kid:secret", entry)
+		}
+		keys = append(keys, SigningKey{ID: strings.TrimSpace(id), Secret: []byte(strings.TrimSpace(secret))})
+	}
+	return keys, nil
+}
+
+var (
+	keySetMu sync.RWMutex
+	keySet   *KeySet
+)
+
+// SetKeySet installs the keys GenerateToken and VerifyToken use. It must be
+// called at startup; without it no token can be issued or verified.
+func SetKeySet(ks *KeySet) {
+	keySetMu.Lock()
+	keySet = ks
+	keySetMu.Unlock()
+}
+
+func currentKeySet() (*KeySet, error) {
+	keySetMu.RLock()
+	defer keySetMu.RUnlock()
+	if keySet == nil {
+		return nil, errors.New("no JWT signing keys configured")
+	}
+	return keySet, nil
 }
 
 func GenerateToken(userId string, expiresAt time.Time) (string, error) {
+	ks, err := currentKeySet()
+	if err != nil {
+		return "", err
+	}
+
 	claims := Claims{
 		UserId: userId,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			Subject:   userId,
@@ -22,14 +130,27 @@ func GenerateToken(userId string, expiresAt time.Time) (string, error) {
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(SecretKey))
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.Secret)
 }
 
 func VerifyToken(token string) (*Claims, error) {
-	tokenClaims, err := jwt.ParseWithClaims(token, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(ClaimsKey), nil
-	})
+	ks, err := currentKeySet()
+	if err != nil {
+		return nil, err
+	}
 
+	tokenClaims, err := jwt.ParseWithClaims(token, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		secret, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -38,5 +159,5 @@ func VerifyToken(token string) (*Claims, error) {
 		return claims, nil
 	}
 
-	return nil, err
+	return nil, errors.New("invalid token")
 }